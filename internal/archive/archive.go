@@ -0,0 +1,376 @@
+// Package archive expands the archives to scan each of their entries,
+// so that the infected entries can be told apart.
+//
+// The zip, tar, gzip and bzip2 formats are supported, nested or not.
+// The expansion is bounded by Limits to withstand the archive bombs.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+)
+
+var (
+	ErrLimitExceeded  = errors.New("archive limit exceeded")
+	ErrInvalidArchive = errors.New("invalid archive")
+	ErrEncrypted      = errors.New("encrypted entry")
+)
+
+// Limits bounds the expansion of an archive.
+type Limits struct {
+	// Maximum number of nested archives expanded, the outermost included
+	MaxDepth int
+
+	// Maximum number of entries, the ones of the nested archives included
+	MaxEntries int
+
+	// Maximum number of bytes expanded, the ones of the nested archives included
+	MaxSize int64
+}
+
+// Entry is the result of the scan of an entry of an archive.
+type Entry struct {
+	// Path of the entry in its archive
+	Name string
+
+	// Expanded size of the entry
+	Size int64
+
+	// Detection reported by Clamd, nil when clean
+	Result *clamd.ScanResult
+
+	// Error which prevented the entry from being scanned or expanded, if any
+	Err error
+
+	// Entries of the entry when it is an archive itself
+	Entries []*Entry
+}
+
+// Infected returns true if a virus was detected in e or in one of its entries.
+func (e *Entry) Infected() bool {
+	if e.Result != nil {
+		return true
+	}
+	for _, child := range e.Entries {
+		if child.Infected() {
+			return true
+		}
+	}
+	return false
+}
+
+// Scanner expands the archives and scans their entries with Clamd.
+type Scanner struct {
+	clamav  clamd.Clamaver
+	limits  Limits
+	tempDir string
+}
+
+// NewScanner returns a Scanner scanning the entries with clamav.
+// The nested archives are spooled to tempDir, or to the default
+// directory for temporary files when empty, to be expanded.
+func NewScanner(clamav clamd.Clamaver, limits Limits, tempDir string) *Scanner {
+	return &Scanner{clamav: clamav, limits: limits, tempDir: tempDir}
+}
+
+// Expand scans the entries of the archive of the given name and size read from ra,
+// and expands the nested archives recursively. It returns no entry if ra isn't
+// an archive of a supported format.
+//
+// The archive itself isn't scanned. It returns an error wrapping ErrLimitExceeded
+// when the limits are exceeded, or ErrInvalidArchive when ra can't be expanded.
+// The errors of the nested archives are reported by their Entry.
+func (s *Scanner) Expand(ctx context.Context, ra io.ReaderAt, size int64, name string) ([]*Entry, error) {
+	x := &expansion{s: s, ctx: ctx}
+	return x.expand(ra, size, name, 0)
+}
+
+// expansion is the state of the expansion of an archive.
+type expansion struct {
+	s   *Scanner
+	ctx context.Context
+
+	// Number of entries and bytes expanded so far
+	entries int
+	size    int64
+}
+
+// Supported formats
+type format int
+
+const (
+	formatNone format = iota
+	formatZip
+	formatTar
+	formatGzip
+	formatBzip2
+)
+
+// headerSize is the number of bytes needed to detect the format of a file.
+const headerSize = 512
+
+// detect returns the format of the file starting with header.
+func detect(header []byte) format {
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return formatZip
+	case bytes.HasPrefix(header, []byte("\x1f\x8b")):
+		return formatGzip
+	case bytes.HasPrefix(header, []byte("BZh")):
+		return formatBzip2
+	case len(header) >= 262 && bytes.HasPrefix(header[257:], []byte("ustar")):
+		return formatTar
+	}
+	return formatNone
+}
+
+// expand returns the entries of the archive read from ra,
+// nested in depth archives.
+func (x *expansion) expand(ra io.ReaderAt, size int64, name string, depth int) ([]*Entry, error) {
+	header := make([]byte, headerSize)
+	n, err := ra.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	f := detect(header[:n])
+	if f == formatNone {
+		return nil, nil
+	}
+	if depth >= x.s.limits.MaxDepth {
+		return nil, fmt.Errorf("%w: more than %d nested archives", ErrLimitExceeded, x.s.limits.MaxDepth)
+	}
+
+	r := io.NewSectionReader(ra, 0, size)
+
+	switch f {
+	case formatZip:
+		return x.expandZip(r, size, depth+1)
+	case formatTar:
+		return x.expandTar(r, depth+1)
+	case formatGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+		defer gz.Close()
+
+		entryName := gz.Name
+		if entryName == "" {
+			entryName = decompressedName(name, ".gz", ".tgz")
+		}
+		return x.expandSingle(entryName, gz, depth+1)
+	default:
+		return x.expandSingle(decompressedName(name, ".bz2", ".tbz2"), bzip2.NewReader(r), depth+1)
+	}
+}
+
+// decompressedName returns the name of the decompressed content of the
+// compressed file of the given name, without its extension ext, or with
+// the extension of a tarball instead of tarExt.
+func decompressedName(name string, ext string, tarExt string) string {
+	name = path.Base(name)
+	switch {
+	case strings.HasSuffix(name, tarExt):
+		return strings.TrimSuffix(name, tarExt) + ".tar"
+	case strings.HasSuffix(name, ext) && name != ext:
+		return strings.TrimSuffix(name, ext)
+	}
+	return "data"
+}
+
+func (x *expansion) expandZip(r *io.SectionReader, size int64, depth int) ([]*Entry, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+
+	var entries []*Entry
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+
+		// The encrypted entries can't be read
+		if zf.Flags&0x1 != 0 {
+			if err := x.count(); err != nil {
+				return entries, err
+			}
+			entries = append(entries, &Entry{Name: zf.Name, Size: int64(zf.UncompressedSize64), Err: ErrEncrypted})
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			if err := x.count(); err != nil {
+				return entries, err
+			}
+			entries = append(entries, &Entry{Name: zf.Name, Err: fmt.Errorf("%w: %w", ErrInvalidArchive, err)})
+			continue
+		}
+
+		entry, err := x.scanEntry(zf.Name, rc, depth)
+		rc.Close()
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (x *expansion) expandTar(r io.Reader, depth int) ([]*Entry, error) {
+	tr := tar.NewReader(r)
+
+	var entries []*Entry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		entry, err := x.scanEntry(hdr.Name, tr, depth)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// expandSingle returns the single entry of a compressed file.
+func (x *expansion) expandSingle(name string, r io.Reader, depth int) ([]*Entry, error) {
+	entry, err := x.scanEntry(name, r, depth)
+	if err != nil {
+		return nil, err
+	}
+	return []*Entry{entry}, nil
+}
+
+// count counts an entry and returns an error if there are too many.
+func (x *expansion) count() error {
+	x.entries++
+	if x.entries > x.s.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrLimitExceeded, x.s.limits.MaxEntries)
+	}
+	return nil
+}
+
+// scanEntry scans the entry of the given name read from r, which is in depth
+// archives. It is expanded if it is an archive itself.
+//
+// The errors specific to the entry are reported by the returned Entry.
+// The ones preventing the expansion from going on are returned.
+func (x *expansion) scanEntry(name string, r io.Reader, depth int) (*Entry, error) {
+	if err := x.count(); err != nil {
+		return nil, err
+	}
+
+	entry := &Entry{Name: name}
+
+	sr := &sizeReader{r: r, x: x}
+	br := bufio.NewReaderSize(sr, headerSize)
+
+	// The read errors are reported when scanning
+	header, _ := br.Peek(headerSize)
+
+	if detect(header) == formatNone {
+		entry.Result, entry.Err = clamd.ScanStream(x.ctx, x.s.clamav, br)
+
+		// Clamd may reply before the end of the entry,
+		// which must be read anyway to know its size
+		if entry.Err == nil || errors.Is(entry.Err, clamd.ErrScanFileSizeLimitExceeded) {
+			if _, err := io.Copy(io.Discard, br); err != nil {
+				entry.Err = err
+			}
+		}
+	} else {
+		entry.Err = x.scanArchive(entry, br, depth)
+	}
+	entry.Size = sr.n
+
+	switch {
+	case entry.Err == nil:
+	case errors.Is(entry.Err, ErrLimitExceeded):
+		return nil, entry.Err
+	case errors.Is(entry.Err, clamd.ErrScanFileSizeLimitExceeded), errors.Is(entry.Err, ErrInvalidArchive):
+	case errors.Is(entry.Err, clamd.ErrReadStream):
+		// The entry is corrupted
+		entry.Err = fmt.Errorf("%w: %w", ErrInvalidArchive, entry.Err)
+	default:
+		return nil, entry.Err
+	}
+
+	return entry, nil
+}
+
+// scanArchive spools the archive read from r to scan it as a
+// whole before expanding it into the entries of entry.
+func (x *expansion) scanArchive(entry *Entry, r io.Reader, depth int) error {
+	f, err := os.CreateTemp(x.s.tempDir, "clamav-api-archive-*")
+	if err != nil {
+		return fmt.Errorf("error while creating spool file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	size, err := io.Copy(f, r)
+	if err != nil {
+		if errors.Is(err, ErrLimitExceeded) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", clamd.ErrReadStream, err)
+	}
+
+	entry.Result, err = clamd.ScanStream(x.ctx, x.s.clamav, io.NewSectionReader(f, 0, size))
+	if err != nil && !errors.Is(err, clamd.ErrScanFileSizeLimitExceeded) {
+		return err
+	}
+
+	entries, expandErr := x.expand(f, size, entry.Name, depth)
+	entry.Entries = entries
+	if expandErr != nil {
+		return expandErr
+	}
+
+	return err
+}
+
+// sizeReader is an io.Reader counting the bytes read from r
+// against the limits of the expansion.
+type sizeReader struct {
+	r io.Reader
+	x *expansion
+	n int64
+}
+
+func (s *sizeReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.n += int64(n)
+	s.x.size += int64(n)
+
+	if s.x.size > s.x.s.limits.MaxSize {
+		return n, fmt.Errorf("%w: more than %d bytes expanded", ErrLimitExceeded, s.x.s.limits.MaxSize)
+	}
+	return n, err
+}
@@ -0,0 +1,219 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamav is a Clamaver whose InStream reports the eicar test file,
+// and fails when the stream contains "toolarge".
+type fakeClamav struct {
+	clamd.Clamaver
+
+	scans int
+}
+
+func (f *fakeClamav) InStream(ctx context.Context, r io.Reader) ([]byte, error) {
+	f.scans++
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Join(clamd.ErrReadStream, err)
+	}
+	if strings.Contains(string(b), "toolarge") {
+		return nil, clamd.ErrScanFileSizeLimitExceeded
+	}
+	if strings.Contains(string(b), "EICAR-STANDARD-ANTIVIRUS-TEST-FILE") {
+		return []byte("stream: Win.Test.EICAR_HDB-1 FOUND"), clamd.ErrVirusFound
+	}
+	return []byte("stream: OK"), nil
+}
+
+type file struct {
+	name    string
+	content string
+}
+
+func newZip(t *testing.T, files ...file) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(f.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	return buf.Bytes()
+}
+
+func newTarGz(t *testing.T, files ...file) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	for _, f := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: f.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(f.content))}))
+		_, err := tw.Write([]byte(f.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	return buf.Bytes()
+}
+
+var testLimits = Limits{MaxDepth: 3, MaxEntries: 100, MaxSize: 1024 * 1024}
+
+func expand(t *testing.T, clamav clamd.Clamaver, limits Limits, name string, b []byte) ([]*Entry, error) {
+	s := NewScanner(clamav, limits, t.TempDir())
+	return s.Expand(context.Background(), bytes.NewReader(b), int64(len(b)), name)
+}
+
+func TestScannerExpand(t *testing.T) {
+	tarGz := newTarGz(t,
+		file{name: "dir/foo.txt", content: "foo"},
+		file{name: "dir/eicar.com", content: eicar},
+	)
+	archive := newZip(t,
+		file{name: "readme.txt", content: "foobar"},
+		file{name: "docs/", content: ""},
+		file{name: "docs/large.bin", content: "toolarge"},
+		file{name: "nested.tar.gz", content: string(tarGz)},
+	)
+
+	clamav := &fakeClamav{}
+	entries, err := expand(t, clamav, testLimits, "archive.zip", archive)
+	require.NoError(t, err)
+
+	want := []*Entry{
+		{Name: "readme.txt", Size: 6},
+		{Name: "docs/large.bin", Size: 8, Err: clamd.ErrScanFileSizeLimitExceeded},
+		{
+			// Clamd would decompress it, unlike fakeClamav
+			Name: "nested.tar.gz",
+			Size: int64(len(tarGz)),
+			Entries: []*Entry{
+				{
+					Name:   "nested.tar",
+					Size:   3584,
+					Result: &clamd.ScanResult{Path: "stream", Signature: "Win.Test.EICAR_HDB-1"},
+					Entries: []*Entry{
+						{Name: "dir/foo.txt", Size: 3},
+						{Name: "dir/eicar.com", Size: int64(len(eicar)), Result: &clamd.ScanResult{Path: "stream", Signature: "Win.Test.EICAR_HDB-1"}},
+					},
+				},
+			},
+		},
+	}
+	assert.Equal(t, want, entries)
+	assert.Equal(t, 6, clamav.scans)
+
+	assert.True(t, entries[2].Infected())
+	assert.True(t, entries[2].Entries[0].Entries[1].Infected())
+	assert.False(t, entries[0].Infected())
+}
+
+func TestScannerExpandNotArchive(t *testing.T) {
+	clamav := &fakeClamav{}
+	entries, err := expand(t, clamav, testLimits, "eicar.com", []byte(eicar))
+	assert.NoError(t, err)
+	assert.Nil(t, entries)
+	assert.Zero(t, clamav.scans)
+}
+
+func TestScannerExpandLimits(t *testing.T) {
+	nested := newZip(t, file{name: "nested.zip", content: string(newZip(t, file{name: "foo.txt", content: "foo"}))})
+	many := newZip(t,
+		file{name: "foo.txt", content: "foo"},
+		file{name: "bar.txt", content: "bar"},
+		file{name: "baz.txt", content: "baz"},
+	)
+	bomb := newZip(t, file{name: "zeros", content: strings.Repeat("0", 1024*1024)})
+
+	tests := []struct {
+		name    string
+		limits  Limits
+		archive []byte
+		wantErr string
+	}{
+		{
+			name:    "depth",
+			limits:  Limits{MaxDepth: 1, MaxEntries: 100, MaxSize: 1024},
+			archive: nested,
+			wantErr: "archive limit exceeded: more than 1 nested archives",
+		},
+		{
+			name:    "entries",
+			limits:  Limits{MaxDepth: 1, MaxEntries: 2, MaxSize: 1024},
+			archive: many,
+			wantErr: "archive limit exceeded: more than 2 entries",
+		},
+		{
+			name:    "size",
+			limits:  Limits{MaxDepth: 1, MaxEntries: 100, MaxSize: 64 * 1024},
+			archive: bomb,
+			wantErr: "archive limit exceeded: more than 65536 bytes expanded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := expand(t, &fakeClamav{}, tt.limits, "archive.zip", tt.archive)
+			assert.ErrorIs(t, err, ErrLimitExceeded)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	// Within the limits
+	_, err := expand(t, &fakeClamav{}, Limits{MaxDepth: 2, MaxEntries: 2, MaxSize: 1024}, "archive.zip", nested)
+	assert.NoError(t, err)
+}
+
+func TestScannerExpandInvalid(t *testing.T) {
+	// Invalid outermost archive
+	_, err := expand(t, &fakeClamav{}, testLimits, "archive.zip", []byte("PK\x03\x04foobar"))
+	assert.ErrorIs(t, err, ErrInvalidArchive)
+
+	// Invalid nested archive
+	corrupted := newZip(t, file{name: "foo.gz", content: "\x1f\x8bfoobar"})
+	entries, err := expand(t, &fakeClamav{}, testLimits, "archive.zip", corrupted)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "foo.gz", entries[0].Name)
+	assert.ErrorIs(t, entries[0].Err, ErrInvalidArchive)
+
+	// Encrypted entry
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "secret.txt", Flags: 0x1})
+	require.NoError(t, err)
+	w.Write([]byte("foobar"))
+	require.NoError(t, zw.Close())
+
+	entries, err = expand(t, &fakeClamav{}, testLimits, "archive.zip", buf.Bytes())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.ErrorIs(t, entries[0].Err, ErrEncrypted)
+}
+
+func TestDecompressedName(t *testing.T) {
+	assert.Equal(t, "foo.txt", decompressedName("dir/foo.txt.gz", ".gz", ".tgz"))
+	assert.Equal(t, "foo.tar", decompressedName("foo.tgz", ".gz", ".tgz"))
+	assert.Equal(t, "foo.tar", decompressedName("foo.tar.bz2", ".bz2", ".tbz2"))
+	assert.Equal(t, "data", decompressedName("foo", ".gz", ".tgz"))
+	assert.Equal(t, "data", decompressedName(".gz", ".gz", ".tgz"))
+}
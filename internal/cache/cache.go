@@ -0,0 +1,135 @@
+// Package cache keeps the recent verdicts of the scans by SHA-256 of the
+// scanned content, so that the same content isn't sent to Clamd again.
+//
+// The verdicts are recorded with the version of the signature database
+// which made them and only served for this version, as they may no longer
+// hold with another database, eg. once Clamd was updated.
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/helper"
+)
+
+// Options configures a Cache.
+type Options struct {
+	// Maximum number of verdicts kept. The least recently
+	// used ones are evicted beyond
+	Size int
+
+	// Duration a verdict is kept
+	TTL time.Duration
+}
+
+// Verdict is the verdict of the scan of a content.
+type Verdict struct {
+	// Signature of the virus found, empty when clean
+	Signature string
+
+	// Version of the signature database which made the verdict, 0 if unknown
+	Database int
+}
+
+type entry struct {
+	hash      string
+	verdict   Verdict
+	expiresAt time.Time
+}
+
+// Cache is a LRU cache of the verdicts of the scans, bounded in size
+// and in time. It is safe for concurrent use.
+type Cache struct {
+	opts Options
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+
+	// Overridden in tests
+	clock helper.Clock
+}
+
+// New returns an empty Cache.
+func New(opts Options) (*Cache, error) {
+	if opts.Size < 1 {
+		return nil, fmt.Errorf("invalid cache size: %d", opts.Size)
+	}
+	if opts.TTL <= 0 {
+		return nil, errors.New("invalid cache ttl: must be positive")
+	}
+
+	return &Cache{
+		opts:    opts,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}, nil
+}
+
+// Purge drops all the verdicts, eg. to free them once the signature database changed.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// Get returns the verdict of the content of the given hex-encoded SHA-256,
+// and whether it is cached, not expired and made by the given version of
+// the signature database. The verdicts made by another version are dropped.
+func (c *Cache) Get(hash string, database int) (Verdict, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[hash]
+	if !ok {
+		return Verdict{}, false
+	}
+
+	e := elem.Value.(*entry)
+	if e.verdict.Database != database || !c.clock.Now().Before(e.expiresAt) {
+		c.lru.Remove(elem)
+		delete(c.entries, hash)
+		return Verdict{}, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return e.verdict, true
+}
+
+// Put caches the verdict of the content of the given hex-encoded SHA-256.
+func (c *Cache) Put(hash string, verdict Verdict) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.clock.Now().Add(c.opts.TTL)
+
+	if elem, ok := c.entries[hash]; ok {
+		e := elem.Value.(*entry)
+		e.verdict = verdict
+		e.expiresAt = expiresAt
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[hash] = c.lru.PushFront(&entry{hash: hash, verdict: verdict, expiresAt: expiresAt})
+
+	for c.lru.Len() > c.opts.Size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).hash)
+	}
+}
+
+// Len returns the number of verdicts cached, the expired ones included.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
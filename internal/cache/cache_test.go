@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(Options{Size: 0, TTL: time.Minute})
+	assert.ErrorContains(t, err, "invalid cache size: 0")
+
+	_, err = New(Options{Size: 1})
+	assert.ErrorContains(t, err, "invalid cache ttl")
+
+	c, err := New(Options{Size: 1, TTL: time.Minute})
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+}
+
+func TestCacheGetPut(t *testing.T) {
+	now := time.Date(2023, 7, 6, 7, 29, 38, 0, time.UTC)
+
+	c, err := New(Options{Size: 2, TTL: time.Minute})
+	require.NoError(t, err)
+	c.clock = func() time.Time { return now }
+
+	_, ok := c.Get("foo", 26961)
+	assert.False(t, ok)
+
+	c.Put("foo", Verdict{Database: 26961})
+	c.Put("bar", Verdict{Signature: "Win.Test.EICAR_HDB-1", Database: 26961})
+
+	v, ok := c.Get("foo", 26961)
+	assert.True(t, ok)
+	assert.Equal(t, Verdict{Database: 26961}, v)
+
+	// The least recently used verdict is evicted
+	c.Put("baz", Verdict{Database: 26961})
+	assert.Equal(t, 2, c.Len())
+	_, ok = c.Get("bar", 26961)
+	assert.False(t, ok)
+	_, ok = c.Get("foo", 26961)
+	assert.True(t, ok)
+
+	// Updating a verdict
+	c.Put("foo", Verdict{Signature: "Win.Test.EICAR_HDB-1", Database: 26961})
+	v, ok = c.Get("foo", 26961)
+	assert.True(t, ok)
+	assert.Equal(t, Verdict{Signature: "Win.Test.EICAR_HDB-1", Database: 26961}, v)
+	assert.Equal(t, 2, c.Len())
+
+	// Expired verdicts
+	now = now.Add(time.Minute)
+	_, ok = c.Get("foo", 26961)
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestCacheDatabase(t *testing.T) {
+	c, err := New(Options{Size: 10, TTL: time.Minute})
+	require.NoError(t, err)
+
+	// A verdict made by an outdated signature database isn't
+	// served, even when it is recorded after the update
+	c.Put("foo", Verdict{Database: 26962})
+	c.Put("bar", Verdict{Database: 26961})
+
+	_, ok := c.Get("foo", 26962)
+	assert.True(t, ok)
+	_, ok = c.Get("bar", 26962)
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.Len())
+
+	// Nor is a verdict made with an unknown database once it is known
+	c.Put("baz", Verdict{})
+	_, ok = c.Get("baz", 0)
+	assert.True(t, ok)
+	_, ok = c.Get("baz", 26962)
+	assert.False(t, ok)
+}
+
+func TestCachePurge(t *testing.T) {
+	c, err := New(Options{Size: 10, TTL: time.Minute})
+	require.NoError(t, err)
+
+	c.Put("foo", Verdict{})
+	c.Purge()
+	assert.Zero(t, c.Len())
+
+	_, ok := c.Get("foo", 0)
+	assert.False(t, ok)
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// runAdmin parses the backend flags of the subcommand name
+// and runs fn with the selected backend.
+func runAdmin(ctx context.Context, stdio *IO, name string, args []string, fn func(ctx context.Context, b backend) error) int {
+	flags := newFlagSet(name, "", stdio)
+	opts := addBackendFlags(flags)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return ExitError
+	}
+
+	b, err := opts.backend()
+	if err != nil {
+		return errorf(stdio, "%v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	if err := fn(ctx, b); err != nil {
+		return errorf(stdio, "%v", err)
+	}
+
+	return ExitOK
+}
+
+func ping(ctx context.Context, stdio *IO, args []string) int {
+	return runAdmin(ctx, stdio, "ping", args, func(ctx context.Context, b backend) error {
+		resp, err := b.ping(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(stdio.Stdout, resp)
+		return nil
+	})
+}
+
+func version(ctx context.Context, stdio *IO, args []string) int {
+	return runAdmin(ctx, stdio, "version", args, func(ctx context.Context, b backend) error {
+		resp, err := b.version(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(stdio.Stdout, resp)
+		return nil
+	})
+}
+
+// stats prints the statistics of Clamd as indented json.
+func stats(ctx context.Context, stdio *IO, args []string) int {
+	return runAdmin(ctx, stdio, "stats", args, func(ctx context.Context, b backend) error {
+		resp, err := b.stats(ctx)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(stdio.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	})
+}
+
+func reload(ctx context.Context, stdio *IO, args []string) int {
+	return runAdmin(ctx, stdio, "reload", args, func(ctx context.Context, b backend) error {
+		if err := b.reload(ctx); err != nil {
+			return err
+		}
+
+		fmt.Fprintln(stdio.Stdout, "RELOADING")
+		return nil
+	})
+}
@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/lescactus/clamav-api-go/pkg/client"
+)
+
+const defaultAPIURL = "http://127.0.0.1:8080"
+
+// backend sends the commands of the subcommands either to
+// the REST API or directly to Clamd.
+type backend interface {
+	// scan scans r and returns the matching signature,
+	// or an empty string if no virus is found
+	scan(ctx context.Context, name string, r io.Reader) (string, error)
+	ping(ctx context.Context) (string, error)
+	version(ctx context.Context) (string, error)
+	stats(ctx context.Context) (*client.StatsV2Response, error)
+	reload(ctx context.Context) error
+}
+
+// backendOptions holds the flags selecting the backend.
+type backendOptions struct {
+	apiURL       string
+	clamdAddr    string
+	clamdNetwork string
+	timeout      time.Duration
+}
+
+func addBackendFlags(fs *flag.FlagSet) *backendOptions {
+	o := &backendOptions{}
+	fs.StringVar(&o.apiURL, "api-url", defaultAPIURL, "Base url of the clamav-api-go server")
+	fs.StringVar(&o.clamdAddr, "clamd-addr", "", "Address of Clamd. When set, the commands are sent to Clamd directly instead of the server")
+	fs.StringVar(&o.clamdNetwork, "clamd-network", "tcp", "Network of Clamd: 'tcp' or 'unix'")
+	fs.DurationVar(&o.timeout, "timeout", 30*time.Second, "Timeout of each command")
+
+	return o
+}
+
+// backend returns the backend selected by the flags.
+func (o *backendOptions) backend() (backend, error) {
+	if o.clamdAddr != "" {
+		return &clamdBackend{
+			clamav: clamd.NewClamavClient(o.clamdAddr, o.clamdNetwork, o.timeout, o.timeout),
+		}, nil
+	}
+
+	c, err := client.New(o.apiURL, &http.Client{Timeout: o.timeout})
+	if err != nil {
+		return nil, fmt.Errorf("invalid -api-url: %w", err)
+	}
+
+	return &apiBackend{client: c}, nil
+}
+
+// apiBackend sends the commands to the REST API.
+type apiBackend struct {
+	client *client.Client
+}
+
+func (b *apiBackend) scan(ctx context.Context, name string, r io.Reader) (string, error) {
+	resp, err := b.client.InStreamRaw(ctx, r)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Signature, nil
+}
+
+func (b *apiBackend) ping(ctx context.Context) (string, error) {
+	resp, err := b.client.Ping(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Ping, nil
+}
+
+func (b *apiBackend) version(ctx context.Context) (string, error) {
+	resp, err := b.client.Version(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Version, nil
+}
+
+func (b *apiBackend) stats(ctx context.Context) (*client.StatsV2Response, error) {
+	return b.client.StatsV2(ctx)
+}
+
+func (b *apiBackend) reload(ctx context.Context) error {
+	_, err := b.client.Reload(ctx)
+	return err
+}
+
+// clamdBackend sends the commands directly to Clamd.
+type clamdBackend struct {
+	clamav clamd.Clamaver
+}
+
+func (b *clamdBackend) scan(ctx context.Context, name string, r io.Reader) (string, error) {
+	result, err := clamd.ScanStream(ctx, b.clamav, r)
+	if err != nil || result == nil {
+		return "", err
+	}
+
+	return result.Signature, nil
+}
+
+func (b *clamdBackend) ping(ctx context.Context) (string, error) {
+	resp, err := b.clamav.Ping(ctx)
+	return string(resp), err
+}
+
+func (b *clamdBackend) version(ctx context.Context) (string, error) {
+	resp, err := b.clamav.Version(ctx)
+	return string(resp), err
+}
+
+// stats returns the statistics of Clamd as
+// they are returned by the REST API.
+func (b *clamdBackend) stats(ctx context.Context) (*client.StatsV2Response, error) {
+	s, err := clamd.GetStats(ctx, b.clamav)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &client.StatsV2Response{
+		Pools: s.Pools,
+		State: s.State,
+		Threads: client.StatsV2Threads{
+			Live:        s.Threads.Live,
+			Idle:        s.Threads.Idle,
+			Max:         s.Threads.Max,
+			IdleTimeout: s.Threads.IdleTimeout,
+		},
+		Queue: client.StatsV2Queue{
+			Length: s.Queue.Length,
+			Items:  make([]client.StatsV2QueueItem, 0, len(s.Queue.Items)),
+		},
+		Memstats: client.StatsV2Memstats{
+			Heap:       s.Memstats.Heap,
+			Mmap:       s.Memstats.Mmap,
+			Used:       s.Memstats.Used,
+			Free:       s.Memstats.Free,
+			Releasable: s.Memstats.Releasable,
+			Pools:      s.Memstats.Pools,
+			PoolsUsed:  s.Memstats.PoolsUsed,
+			PoolsTotal: s.Memstats.PoolsTotal,
+		},
+	}
+	for _, item := range s.Queue.Items {
+		resp.Queue.Items = append(resp.Queue.Items, client.StatsV2QueueItem{
+			Command:    item.Command,
+			AgeSeconds: item.Age,
+			File:       item.File,
+		})
+	}
+
+	return resp, nil
+}
+
+func (b *clamdBackend) reload(ctx context.Context) error {
+	return b.clamav.Reload(ctx)
+}
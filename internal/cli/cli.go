@@ -0,0 +1,115 @@
+// Package cli implements the subcommands of the clamav-api-go binary.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lescactus/clamav-api-go/internal/config"
+)
+
+// Exit codes of the subcommands
+const (
+	// ExitOK is returned on success, and by the "scan" subcommand
+	// when no virus is found
+	ExitOK = 0
+
+	// ExitInfected is returned by the "scan" subcommand when a virus is found,
+	// and by the "healthcheck" subcommand when the server is unhealthy
+	ExitInfected = 1
+
+	// ExitError is returned when an error occurred
+	ExitError = 2
+)
+
+// IO holds the standard streams of a subcommand.
+type IO struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, stdio *IO, args []string) int
+}
+
+var commands = []command{
+	{"serve", "Start the http server (default)", serve},
+	{"scan", "Scan files, directories or the standard input (-)", scan},
+	{"ping", "Send the PING command to Clamd", ping},
+	{"version", "Print the version of Clamd", version},
+	{"stats", "Print the statistics of Clamd", stats},
+	{"reload", "Reload the signature database of Clamd", reload},
+	{"healthcheck", "Check whether the http server and Clamd are healthy", healthcheck},
+}
+
+// Run runs the subcommand named by args[0] with the remaining arguments
+// and returns its exit code. The server is started when args is empty.
+func Run(ctx context.Context, args []string, stdio *IO) int {
+	if len(args) == 0 {
+		return serve(ctx, stdio, args)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(ctx, stdio, args[1:])
+		}
+	}
+
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		usage(stdio.Stdout)
+		return ExitOK
+	}
+
+	fmt.Fprintf(stdio.Stderr, "unknown command %q\n\n", args[0])
+	usage(stdio.Stderr)
+	return ExitError
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags] [arguments]\n\nCommands:\n", config.AppName)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for the flags of a command.\n", config.AppName)
+}
+
+// newFlagSet returns a FlagSet for the subcommand name, printing
+// its errors and usage to stdio.Stderr.
+func newFlagSet(name string, args string, stdio *IO) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stdio.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] %s\n\nFlags:\n", config.AppName, name, args)
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// parseFlags parses args with fs and returns the exit code to return
+// if the subcommand must not be run.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK, false
+	}
+	if err != nil {
+		return ExitError, false
+	}
+
+	return ExitOK, true
+}
+
+// errorf prints an error to stdio.Stderr and returns ExitError.
+func errorf(stdio *IO, format string, a ...any) int {
+	fmt.Fprintf(stdio.Stderr, "error: "+strings.TrimSuffix(format, "\n")+"\n", a...)
+	return ExitError
+}
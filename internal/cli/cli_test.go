@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/justinas/alice"
+	"github.com/lescactus/clamav-api-go/internal/controllers"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamav is a Clamaver detecting the EICAR test file.
+type fakeClamav struct {
+	clamd.Clamaver
+}
+
+func (f *fakeClamav) Ping(ctx context.Context) ([]byte, error) {
+	return []byte("PONG"), nil
+}
+
+func (f *fakeClamav) Version(ctx context.Context) ([]byte, error) {
+	return []byte("ClamAV 1.0.1/26963/Sat Jul  8 07:27:53 2023"), nil
+}
+
+func (f *fakeClamav) Reload(ctx context.Context) error {
+	return nil
+}
+
+func (f *fakeClamav) Stats(ctx context.Context) ([]byte, error) {
+	return []byte(`POOLS: 1
+
+STATE: VALID PRIMARY
+THREADS: live 1  idle 0 max 10 idle-timeout 30
+QUEUE: 0 items
+	STATS 0.000038
+
+MEMSTATS: heap N/A mmap N/A used N/A free N/A releasable N/A pools 1 pools_used 1307.045M pools_total 1307.093M
+END`), nil
+}
+
+func (f *fakeClamav) InStream(ctx context.Context, r io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if string(b) == eicar {
+		return []byte("stream: Win.Test.EICAR_HDB-1 FOUND"), clamd.ErrVirusFound
+	}
+	return []byte("stream: OK"), nil
+}
+
+// newTestServer returns the url of a server running the handlers of the API.
+func newTestServer(t *testing.T) string {
+	logger := zerolog.New(io.Discard)
+	h := controllers.NewHandler(&logger, &fakeClamav{})
+
+	s := httptest.NewServer(controllers.NewRouter(h, alice.New()))
+	t.Cleanup(s.Close)
+
+	return s.URL
+}
+
+// newFakeClamd starts a Clamd replying to the "INSTREAM" command
+// and returns its address.
+func newFakeClamd(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				if _, err := r.ReadBytes('\000'); err != nil {
+					return
+				}
+
+				var data []byte
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					chunk := make([]byte, size)
+					if _, err := io.ReadFull(r, chunk); err != nil {
+						return
+					}
+					data = append(data, chunk...)
+				}
+
+				if string(data) == eicar {
+					conn.Write([]byte("stream: Win.Test.EICAR_HDB-1 FOUND\000"))
+				} else {
+					conn.Write([]byte("stream: OK\000"))
+				}
+			}(conn)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// run runs the cli with args and returns its exit code and outputs.
+func run(args []string, stdin string) (int, string, string) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := Run(context.Background(), args, &IO{
+		Stdin:  strings.NewReader(stdin),
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+
+	return code, stdout.String(), stderr.String()
+}
+
+// newScanDir returns a directory containing a clean file and,
+// in a sub directory, the EICAR test file.
+func newScanDir(t *testing.T) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foobar.txt"), []byte("foobar"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "eicar.txt"), []byte(eicar), 0o600))
+
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	code, stdout, _ := run([]string{"help"}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, stdout, "healthcheck")
+
+	code, _, stderr := run([]string{"foobar"}, "")
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, `unknown command "foobar"`)
+
+	code, _, _ = run([]string{"ping", "-foobar"}, "")
+	assert.Equal(t, ExitError, code)
+
+	code, _, stderr = run([]string{"scan", "-h"}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, stderr, "-clamd-addr")
+}
+
+func TestScan(t *testing.T) {
+	dir := newScanDir(t)
+	clean := filepath.Join(dir, "foobar.txt")
+	infected := filepath.Join(dir, "sub", "eicar.txt")
+
+	backends := map[string][]string{
+		"api":   {"-api-url", newTestServer(t)},
+		"clamd": {"-clamd-addr", newFakeClamd(t)},
+	}
+	for name, flags := range backends {
+		t.Run(name, func(t *testing.T) {
+			code, stdout, _ := run(append([]string{"scan"}, append(flags, clean)...), "")
+			assert.Equal(t, ExitOK, code)
+			assert.Equal(t, clean+": OK\n", stdout)
+
+			code, stdout, _ = run(append([]string{"scan"}, append(flags, dir)...), "")
+			assert.Equal(t, ExitInfected, code)
+			assert.Equal(t, clean+": OK\n"+infected+": Win.Test.EICAR_HDB-1 FOUND\n", stdout)
+
+			code, stdout, _ = run(append([]string{"scan"}, append(flags, "-")...), eicar)
+			assert.Equal(t, ExitInfected, code)
+			assert.Equal(t, "stdin: Win.Test.EICAR_HDB-1 FOUND\n", stdout)
+
+			code, stdout, _ = run(append([]string{"scan"}, append(flags, clean, filepath.Join(dir, "missing"))...), "")
+			assert.Equal(t, ExitError, code)
+			assert.Contains(t, stdout, clean+": OK\n")
+			assert.Contains(t, stdout, "missing: no such file or directory ERROR\n")
+		})
+	}
+
+	// Missing arguments
+	code, _, _ := run([]string{"scan"}, "")
+	assert.Equal(t, ExitError, code)
+
+	// Unreachable server
+	code, stdout, _ := run([]string{"scan", "-api-url", "http://127.0.0.1:1", clean}, "")
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stdout, "ERROR")
+}
+
+func TestAdmin(t *testing.T) {
+	url := newTestServer(t)
+
+	code, stdout, _ := run([]string{"ping", "-api-url", url}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "PONG\n", stdout)
+
+	code, stdout, _ = run([]string{"version", "-api-url", url}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "ClamAV 1.0.1/26963/Sat Jul  8 07:27:53 2023\n", stdout)
+
+	code, stdout, _ = run([]string{"stats", "-api-url", url}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, stdout, `"state": "VALID PRIMARY"`)
+	assert.Contains(t, stdout, `"pools_total": 1370586350`)
+
+	code, stdout, _ = run([]string{"reload", "-api-url", url}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "RELOADING\n", stdout)
+
+	code, _, stderr := run([]string{"ping", "-api-url", "127.0.0.1"}, "")
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, "invalid -api-url")
+
+	code, _, stderr = run([]string{"ping", "-api-url", "http://127.0.0.1:1"}, "")
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, "connection refused")
+}
+
+func TestHealthcheck(t *testing.T) {
+	code, stdout, _ := run([]string{"healthcheck", "-url", newTestServer(t)}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "healthy\n", stdout)
+
+	code, _, stderr := run([]string{"healthcheck", "-url", "http://127.0.0.1:1"}, "")
+	assert.Equal(t, ExitInfected, code)
+	assert.Contains(t, stderr, "unhealthy")
+}
+
+func TestLocalURL(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{":8080", "http://127.0.0.1:8080"},
+		{"0.0.0.0:8080", "http://127.0.0.1:8080"},
+		{"[::]:8080", "http://127.0.0.1:8080"},
+		{"10.0.0.1:9000", "http://10.0.0.1:9000"},
+		{"localhost:8080", "http://localhost:8080"},
+		{"[::1]:8080", "http://[::1]:8080"},
+		{"invalid", defaultAPIURL},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, localURL(tt.addr), tt.addr)
+	}
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/config"
+	"github.com/lescactus/clamav-api-go/pkg/client"
+)
+
+// healthcheck checks whether the http server is able to ping Clamd.
+// It doesn't need any external tool, so it can be used as the
+// HEALTHCHECK of a docker image built from scratch.
+//
+// It returns ExitInfected, ie. 1, when unhealthy as expected by docker.
+func healthcheck(ctx context.Context, stdio *IO, args []string) int {
+	flags := newFlagSet("healthcheck", "", stdio)
+	url := flags.String("url", "", "Base url of the server. Defaults to the local address of SERVER_ADDR")
+	timeout := flags.Duration("timeout", 5*time.Second, "Timeout of the health check")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return ExitError
+	}
+
+	if *url == "" {
+		cfg, err := config.New()
+		if err != nil {
+			return errorf(stdio, "unable to build a new app config: %v", err)
+		}
+		*url = localURL(cfg.ServerAddr)
+	}
+
+	c, err := client.New(*url, &http.Client{Timeout: *timeout})
+	if err != nil {
+		return errorf(stdio, "invalid -url: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	if _, err := c.Ping(ctx); err != nil {
+		fmt.Fprintf(stdio.Stderr, "unhealthy: %v\n", err)
+		return ExitInfected
+	}
+
+	fmt.Fprintln(stdio.Stdout, "healthy")
+	return ExitOK
+}
+
+// localURL returns the url to reach the server listening on addr from the same host.
+func localURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return defaultAPIURL
+	}
+
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	return "http://" + net.JoinHostPort(host, port)
+}
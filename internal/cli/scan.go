@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// scan scans the given files, directories (recursively) or the standard input ("-")
+// and prints one line per file:
+//
+// /data/foobar.txt: OK
+//
+// /data/eicar.txt: Win.Test.EICAR_HDB-1 FOUND
+//
+// /data/foo: open /data/foo: permission denied ERROR
+//
+// It returns ExitInfected if a virus is found, otherwise ExitError if a file
+// couldn't be scanned, or ExitOK.
+func scan(ctx context.Context, stdio *IO, args []string) int {
+	flags := newFlagSet("scan", "<file|directory|->...", stdio)
+	opts := addBackendFlags(flags)
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return ExitError
+	}
+
+	b, err := opts.backend()
+	if err != nil {
+		return errorf(stdio, "%v", err)
+	}
+
+	s := &scanner{backend: b, stdio: stdio, timeout: opts.timeout}
+	for _, path := range flags.Args() {
+		if ctx.Err() != nil {
+			break
+		}
+		s.scanPath(ctx, path)
+	}
+
+	switch {
+	case s.infected:
+		return ExitInfected
+	case s.failed || ctx.Err() != nil:
+		return ExitError
+	default:
+		return ExitOK
+	}
+}
+
+// scanner scans files with a backend and records the results.
+type scanner struct {
+	backend backend
+	stdio   *IO
+	timeout time.Duration
+
+	infected bool
+	failed   bool
+}
+
+// scanPath scans path, which is either a file,
+// a directory walked recursively or "-" for the standard input.
+func (s *scanner) scanPath(ctx context.Context, path string) {
+	if path == "-" {
+		s.scanReader(ctx, "stdin", s.stdio.Stdin)
+		return
+	}
+
+	// Symbolic links are only followed when given as argument
+	info, err := os.Stat(path)
+	if err != nil {
+		s.report(path, "", err)
+		return
+	}
+	if !info.IsDir() {
+		s.scanFile(ctx, path)
+		return
+	}
+
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			s.report(p, "", err)
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		s.scanFile(ctx, p)
+		return nil
+	})
+}
+
+func (s *scanner) scanFile(ctx context.Context, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		s.report(path, "", err)
+		return
+	}
+	defer f.Close()
+
+	s.scanReader(ctx, path, f)
+}
+
+func (s *scanner) scanReader(ctx context.Context, name string, r io.Reader) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	signature, err := s.backend.scan(ctx, filepath.Base(name), r)
+	s.report(name, signature, err)
+}
+
+// report prints the result of the scan of name.
+func (s *scanner) report(name string, signature string, err error) {
+	switch {
+	case err != nil:
+		s.failed = true
+		fmt.Fprintf(s.stdio.Stdout, "%s: %v ERROR\n", name, err)
+	case signature != "":
+		s.infected = true
+		fmt.Fprintf(s.stdio.Stdout, "%s: %s FOUND\n", name, signature)
+	default:
+		fmt.Fprintf(s.stdio.Stdout, "%s: OK\n", name)
+	}
+}
@@ -0,0 +1,373 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/handlers"
+	"github.com/lescactus/clamav-api-go/internal/archive"
+	"github.com/lescactus/clamav-api-go/internal/cache"
+	"github.com/lescactus/clamav-api-go/internal/config"
+	"github.com/lescactus/clamav-api-go/internal/controllers"
+	"github.com/lescactus/clamav-api-go/internal/fetcher"
+	"github.com/lescactus/clamav-api-go/internal/history"
+	"github.com/lescactus/clamav-api-go/internal/jobs"
+	"github.com/lescactus/clamav-api-go/internal/logger"
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+)
+
+// serve starts the http server until receiving a shutdown signal.
+// The configuration is read from files or environment variables.
+func serve(ctx context.Context, stdio *IO, args []string) int {
+	fs := newFlagSet("serve", "", stdio)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return ExitError
+	}
+
+	// Get application configuration
+	cfg, err := config.New()
+	if err != nil {
+		return errorf(stdio, "unable to build a new app config: %v", err)
+	}
+
+	logger := logger.New(
+		cfg.LoggerLogLevel,
+		cfg.LoggerDurationFieldUnit,
+		cfg.LoggerFormat,
+	)
+
+	strategy, err := clamd.ParseBalancerStrategy(cfg.ClamavBalancerStrategy)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid clamav balancer strategy")
+	}
+
+	addrs := cfg.ClamavBackends
+	if len(addrs) == 0 {
+		addrs = []string{cfg.ClamavAddr}
+	}
+
+	backends := make([]*clamd.Backend, 0, len(addrs))
+	for _, addr := range addrs {
+		clamavClient := clamd.NewClamavClient(
+			addr,
+			cfg.ClamavNetwork,
+			cfg.ClamavTimeout,
+			cfg.ClamavKeepAlive,
+		)
+		clamavClient.SetStreamChunkSize(cfg.ClamavStreamChunkSize)
+
+		var backend clamd.Clamaver = clamavClient
+
+		// Keep long lived sessions open to clamd if enabled
+		if cfg.ClamavPoolSize > 0 {
+			pool := clamd.NewClamavPoolClient(clamavClient, cfg.ClamavPoolSize, cfg.ClamavPoolIdleTimeout)
+			defer pool.Close()
+
+			backend = pool
+		}
+
+		backends = append(backends, &clamd.Backend{Name: addr, Clamav: backend})
+	}
+
+	client := backends[0].Clamav
+
+	// Spread the requests across several clamd if configured
+	if len(cfg.ClamavBackends) > 0 {
+		balancer := clamd.NewClamavBalancer(backends, strategy, cfg.ClamavHealthCheckInterval)
+		defer balancer.Close()
+
+		client = balancer
+	}
+
+	// Retry the commands failing to reach clamd and stop sending
+	// them once it failed repeatedly
+	var breaker *clamd.CircuitBreaker
+	if cfg.ClamavBreakerThreshold > 0 {
+		breaker = clamd.NewCircuitBreaker(cfg.ClamavBreakerThreshold, cfg.ClamavBreakerOpenTimeout, func(from, to clamd.BreakerState) {
+			logger.Warn().Str("from", string(from)).Str("to", string(to)).Msg("clamav circuit breaker state changed")
+		})
+	}
+	client = clamd.NewClamavResilientClient(client, clamd.RetryPolicy{
+		MaxAttempts:    cfg.ClamavRetryMaxAttempts,
+		InitialBackoff: cfg.ClamavRetryInitialBackoff,
+		MaxBackoff:     cfg.ClamavRetryMaxBackoff,
+	}, breaker)
+
+	// Fetch the commands supported by clamd to disable the
+	// features it lacks. They are refreshed after each reload
+	caps := clamd.NewCapabilities()
+	capsCtx, capsCancel := context.WithTimeout(ctx, cfg.ClamavTimeout)
+	if err := caps.Refresh(capsCtx, client); err != nil {
+		logger.Warn().Err(err).Msg("unable to fetch the commands supported by clamav, assuming all of them are")
+	}
+	capsCancel()
+
+	// Create http server and handler controller
+	h := controllers.NewHandler(logger, client)
+	h.ScanPathAllowlist = cfg.ScanPathAllowlist
+	h.SpoolDir = cfg.ScanSpoolDir
+	h.AdminToken = cfg.ServerAdminToken
+	h.Breaker = breaker
+	h.Capabilities = caps
+	h.Archives = archive.NewScanner(client, archive.Limits{
+		MaxDepth:   cfg.ScanExpandMaxDepth,
+		MaxEntries: cfg.ScanExpandMaxEntries,
+		MaxSize:    cfg.ScanExpandMaxSize,
+	}, "")
+
+	// Serve the verdicts of the contents scanned recently from a cache if enabled
+	if cfg.ScanCacheEnabled {
+		h.Cache, err = cache.New(cache.Options{
+			Size: cfg.ScanCacheSize,
+			TTL:  cfg.ScanCacheTTL,
+		})
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to create the scan cache")
+		}
+	}
+
+	// Keep track of the version of the signature database, which the verdicts
+	// are recorded with. The cached verdicts are only served for the version
+	// which made them, and dropped when it changes to free them
+	versions := clamd.NewVersionWatcher(client, cfg.ClamavVersionCheckInterval, func(from, to string) {
+		logger.Info().Str("from", from).Str("to", to).Msg("clamav version changed")
+		if h.Cache != nil {
+			h.Cache.Purge()
+		}
+	})
+	defer versions.Close()
+
+	versionCtx, versionCancel := context.WithTimeout(ctx, cfg.ClamavTimeout)
+	if err := versions.Refresh(versionCtx); err != nil {
+		logger.Warn().Err(err).Msg("unable to fetch the version of clamav")
+	}
+	versionCancel()
+	h.Versions = versions
+
+	// Record the last verdict of the scans by hash if enabled
+	if cfg.ScanHistoryEnabled {
+		if cfg.ScanHistoryStore == history.StoreFile && cfg.ScanHistoryDir == "" {
+			logger.Fatal().Msg("the directory of the history must be set to use the file history store")
+		}
+
+		h.History, err = history.OpenStore(cfg.ScanHistoryStore, cfg.ScanHistoryDir, cfg.ScanHistoryMaxRecords)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to open the history store")
+		}
+	}
+
+	// Allow or deny the uploads before they are scanned if rules are set
+	if len(cfg.ScanPolicyRules) > 0 {
+		rules := make([]policy.Rule, 0, len(cfg.ScanPolicyRules))
+		for _, r := range cfg.ScanPolicyRules {
+			rules = append(rules, policy.Rule{
+				Name:       r.Name,
+				Action:     r.Action,
+				Extensions: r.Extensions,
+				MIMETypes:  r.MIMETypes,
+				Filenames:  r.Filenames,
+				MinSize:    r.MinSize,
+				MaxSize:    r.MaxSize,
+			})
+		}
+
+		h.Policy, err = policy.New(rules)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to create the scan policy")
+		}
+	}
+
+	// Keep the infected uploads in an encrypted quarantine if enabled.
+	// Its endpoints give access to the infected files: they can't be
+	// served without authentication
+	if cfg.QuarantineEnabled {
+		if cfg.ServerAdminToken == "" {
+			logger.Fatal().Msg("the quarantine requires SERVER_ADMIN_TOKEN to be set")
+		}
+
+		key, err := quarantine.ParseKey(cfg.QuarantineKey)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to create the quarantine")
+		}
+
+		var backend quarantine.Backend
+		switch cfg.QuarantineBackend {
+		case quarantine.BackendDir:
+			backend, err = quarantine.NewDirBackend(cfg.QuarantineDir)
+		case quarantine.BackendS3:
+			backend, err = quarantine.NewS3Backend(quarantine.S3Options{
+				Endpoint:  cfg.QuarantineS3Endpoint,
+				Region:    cfg.QuarantineS3Region,
+				Bucket:    cfg.QuarantineS3Bucket,
+				Prefix:    cfg.QuarantineS3Prefix,
+				AccessKey: cfg.QuarantineS3AccessKey,
+				SecretKey: cfg.QuarantineS3SecretKey,
+				PathStyle: cfg.QuarantineS3PathStyle,
+				Timeout:   cfg.QuarantineTimeout,
+			})
+		default:
+			err = fmt.Errorf("%w: %q", quarantine.ErrUnknownBackend, cfg.QuarantineBackend)
+		}
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to create the quarantine backend")
+		}
+
+		q, err := quarantine.New(backend, quarantine.Options{
+			Key:             key,
+			ZipPassword:     cfg.QuarantineZipPassword,
+			MaxAge:          cfg.QuarantineMaxAge,
+			MaxItems:        cfg.QuarantineMaxItems,
+			CleanupInterval: cfg.QuarantineCleanupInterval,
+			Timeout:         cfg.QuarantineTimeout,
+		}, logger)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to create the quarantine")
+		}
+		q.Start()
+		defer q.Close()
+		h.Quarantine = q
+	}
+
+	// Download and scan the content of urls if enabled
+	if cfg.ScanURLEnabled {
+		h.Fetcher = fetcher.New(fetcher.Options{
+			AllowedSchemes: cfg.ScanURLAllowedSchemes,
+			AllowPrivate:   cfg.ScanURLAllowPrivate,
+			MaxSize:        cfg.ScanURLMaxSize,
+			Timeout:        cfg.ScanURLTimeout,
+			MaxRedirects:   cfg.ScanURLMaxRedirects,
+		})
+	}
+
+	// Notify the webhooks of the results of the scans if enabled.
+	// The dispatcher is closed after the job manager, which notifies it
+	if cfg.WebhookEnabled {
+		var deadLetter io.Writer
+		if cfg.WebhookDeadLetterFile != "" {
+			f, err := os.OpenFile(cfg.WebhookDeadLetterFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("unable to open the webhook dead-letter file")
+			}
+			defer f.Close()
+			deadLetter = f
+		}
+
+		dispatcher, err := webhook.New(webhook.Options{
+			URLs:   cfg.WebhookURLs,
+			Secret: cfg.WebhookSecret,
+			Retry: webhook.RetryPolicy{
+				MaxAttempts:    cfg.WebhookMaxAttempts,
+				InitialBackoff: cfg.WebhookInitialBackoff,
+				MaxBackoff:     cfg.WebhookMaxBackoff,
+			},
+			Timeout:              cfg.WebhookTimeout,
+			CallbackSchemes:      cfg.WebhookCallbackAllowedSchemes,
+			CallbackAllowPrivate: cfg.WebhookCallbackAllowPrivate,
+			DeadLetter:           deadLetter,
+		}, logger)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to create the webhook dispatcher")
+		}
+		defer dispatcher.Close()
+
+		h.Webhooks = dispatcher
+	}
+
+	// Scan the uploads asynchronously if enabled
+	if cfg.JobsEnabled {
+		dir := cfg.JobsDir
+		if dir == "" {
+			if cfg.JobsStore == jobs.StoreFile {
+				logger.Fatal().Msg("the directory of the jobs must be set to use the file job store")
+			}
+
+			dir, err = os.MkdirTemp("", config.AppName+"-jobs-")
+			if err != nil {
+				logger.Fatal().Err(err).Msg("unable to create the directory of the jobs")
+			}
+			defer os.RemoveAll(dir)
+		}
+
+		store, err := jobs.OpenStore(cfg.JobsStore, filepath.Join(dir, "jobs"))
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to open the job store")
+		}
+
+		manager, err := jobs.NewManager(store, client, jobs.Options{
+			Workers:         cfg.JobsWorkers,
+			QueueSize:       cfg.JobsQueueSize,
+			TTL:             cfg.JobsTTL,
+			CleanupInterval: cfg.JobsCleanupInterval,
+			ScanTimeout:     cfg.JobsScanTimeout,
+			UploadDir:       filepath.Join(dir, "uploads"),
+			OnFinish:        h.NotifyJob,
+			OnInfected:      h.QuarantineJob,
+		}, logger)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("unable to create the job manager")
+		}
+		if err := manager.Start(); err != nil {
+			logger.Fatal().Err(err).Msg("unable to start the job manager")
+		}
+		defer manager.Close()
+
+		h.Jobs = manager
+	}
+
+	s := &http.Server{
+		Addr:              cfg.ServerAddr,
+		ReadTimeout:       cfg.ServerReadTimeout,
+		ReadHeaderTimeout: cfg.ServerReadHeaderTimeout,
+		WriteTimeout:      cfg.ServerWriteTimeout,
+	}
+
+	// logger fields
+	*logger = logger.With().Str("svc", config.AppName).Logger()
+
+	// Register the logging, request id and request size middlewares
+	c := controllers.NewChain(*logger, cfg.ServerMaxRequestSize)
+
+	// Register the routes behind the middlewares
+	s.Handler = handlers.RecoveryHandler(handlers.PrintRecoveryStack(true))(controllers.NewRouter(h, c)) // recover from panics and print recovery stack
+
+	// Start server
+	go func() {
+		logger.Info().Msgf("Starting server %s on address %s ...", config.AppName, cfg.ServerAddr)
+		if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatal().Err(err).Msg("Startup failed")
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+
+	// Blocking until receiving a shutdown signal
+	sig := <-sigChan
+
+	logger.Info().Msgf("Server received %s signal. Shutting down...", sig)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer func() {
+		cancel()
+	}()
+
+	// Attempting to gracefully shutdown the server
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		logger.Warn().Msg("Failed to gracefully shutdown the server")
+	}
+
+	return ExitOK
+}
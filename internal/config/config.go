@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -26,6 +27,69 @@ var (
 	defaultServerReadHeaderTimeout = 10 * time.Second
 	defaultServerWriteTimeout      = 30 * time.Second
 	defaultServerMaxRequestSize    = int64(10 * 1024 * 1024) // 10MiB
+	defaultServerAdminToken        = ""
+
+	defaultScanPathAllowlist = []string{}
+	defaultScanSpoolDir      = ""
+
+	defaultScanExpandMaxDepth   = 3
+	defaultScanExpandMaxEntries = 1000
+	defaultScanExpandMaxSize    = int64(100 * 1024 * 1024) // 100MiB
+
+	defaultScanCacheEnabled = false
+	defaultScanCacheSize    = 10000
+	defaultScanCacheTTL     = 1 * time.Hour
+
+	defaultScanHistoryEnabled    = false
+	defaultScanHistoryStore      = "memory"
+	defaultScanHistoryDir        = ""
+	defaultScanHistoryMaxRecords = 100000
+
+	defaultScanPolicyRules = []ScanPolicyRule{}
+
+	defaultQuarantineEnabled         = false
+	defaultQuarantineBackend         = "dir"
+	defaultQuarantineDir             = ""
+	defaultQuarantineKey             = ""
+	defaultQuarantineZipPassword     = "infected"
+	defaultQuarantineMaxAge          = 30 * 24 * time.Hour
+	defaultQuarantineMaxItems        = 10000
+	defaultQuarantineCleanupInterval = 1 * time.Hour
+	defaultQuarantineTimeout         = 1 * time.Minute
+	defaultQuarantineS3Endpoint      = ""
+	defaultQuarantineS3Region        = "us-east-1"
+	defaultQuarantineS3Bucket        = ""
+	defaultQuarantineS3Prefix        = ""
+	defaultQuarantineS3AccessKey     = ""
+	defaultQuarantineS3SecretKey     = ""
+	defaultQuarantineS3PathStyle     = true
+
+	defaultScanURLEnabled        = false
+	defaultScanURLAllowedSchemes = []string{"http", "https"}
+	defaultScanURLAllowPrivate   = false
+	defaultScanURLMaxSize        = int64(10 * 1024 * 1024) // 10MiB
+	defaultScanURLTimeout        = 30 * time.Second
+	defaultScanURLMaxRedirects   = 5
+
+	defaultJobsEnabled         = false
+	defaultJobsStore           = "memory"
+	defaultJobsDir             = ""
+	defaultJobsWorkers         = 4
+	defaultJobsQueueSize       = 100
+	defaultJobsTTL             = 1 * time.Hour
+	defaultJobsCleanupInterval = 1 * time.Minute
+	defaultJobsScanTimeout     = 10 * time.Minute
+
+	defaultWebhookEnabled                = false
+	defaultWebhookURLs                   = []string{}
+	defaultWebhookSecret                 = ""
+	defaultWebhookMaxAttempts            = 5
+	defaultWebhookInitialBackoff         = 1 * time.Second
+	defaultWebhookMaxBackoff             = 1 * time.Minute
+	defaultWebhookTimeout                = 10 * time.Second
+	defaultWebhookCallbackAllowedSchemes = []string{"http", "https"}
+	defaultWebhookCallbackAllowPrivate   = false
+	defaultWebhookDeadLetterFile         = ""
 
 	defaultLoggerLogLevel          = "info"
 	defaultLoggerDurationFieldUnit = "ms"
@@ -35,6 +99,24 @@ var (
 	defaultClamavNetwork   = "tcp"
 	defaultClamavTimeout   = 30 * time.Second
 	defaultClamavKeepAlive = 30 * time.Second
+
+	defaultClamavStreamChunkSize = 64 * 1024 // 64KiB
+
+	defaultClamavPoolSize        = 0
+	defaultClamavPoolIdleTimeout = 20 * time.Second
+
+	defaultClamavBackends            = []string{}
+	defaultClamavBalancerStrategy    = "round-robin"
+	defaultClamavHealthCheckInterval = 10 * time.Second
+
+	defaultClamavVersionCheckInterval = 1 * time.Minute
+
+	defaultClamavRetryMaxAttempts    = 3
+	defaultClamavRetryInitialBackoff = 100 * time.Millisecond
+	defaultClamavRetryMaxBackoff     = 2 * time.Second
+
+	defaultClamavBreakerThreshold   = 5
+	defaultClamavBreakerOpenTimeout = 30 * time.Second
 )
 
 type App struct {
@@ -53,6 +135,182 @@ type App struct {
 	// Maximum size of a client request, including headers and body
 	ServerMaxRequestSize int64 `json:"server_max_request_size" yaml:"server_max_request_size" mapstructure:"SERVER_MAX_REQUEST_SIZE"`
 
+	// Bearer token required by the /admin endpoints. They aren't
+	// authenticated when empty, the quarantine requiring it
+	ServerAdminToken string `json:"server_admin_token" yaml:"server_admin_token" mapstructure:"SERVER_ADMIN_TOKEN"`
+
+	// Prefixes of the paths, on the filesystem shared with the Clamav server,
+	// allowed to be scanned. Nothing can be scanned when empty
+	ScanPathAllowlist []string `json:"scan_path_allowlist" yaml:"scan_path_allowlist" mapstructure:"SCAN_PATH_ALLOWLIST"`
+
+	// Directory, shared with the Clamav server at the same path, in which the uploads
+	// are spooled when they must be scanned from the filesystem
+	ScanSpoolDir string `json:"scan_spool_dir" yaml:"scan_spool_dir" mapstructure:"SCAN_SPOOL_DIR"`
+
+	// Enable the endpoint downloading and scanning the content of a url
+	ScanURLEnabled bool `json:"scan_url_enabled" yaml:"scan_url_enabled" mapstructure:"SCAN_URL_ENABLED"`
+
+	// Schemes of the urls allowed to be scanned
+	ScanURLAllowedSchemes []string `json:"scan_url_allowed_schemes" yaml:"scan_url_allowed_schemes" mapstructure:"SCAN_URL_ALLOWED_SCHEMES"`
+
+	// Allow the urls to scan to resolve to loopback, private,
+	// link-local and other reserved addresses
+	ScanURLAllowPrivate bool `json:"scan_url_allow_private" yaml:"scan_url_allow_private" mapstructure:"SCAN_URL_ALLOW_PRIVATE"`
+
+	// Maximum size of the content of a url to scan
+	ScanURLMaxSize int64 `json:"scan_url_max_size" yaml:"scan_url_max_size" mapstructure:"SCAN_URL_MAX_SIZE"`
+
+	// Maximum duration to download the content of a url to scan
+	ScanURLTimeout time.Duration `json:"scan_url_timeout" yaml:"scan_url_timeout" mapstructure:"SCAN_URL_TIMEOUT"`
+
+	// Maximum number of redirects followed when downloading the content of a url to scan
+	ScanURLMaxRedirects int `json:"scan_url_max_redirects" yaml:"scan_url_max_redirects" mapstructure:"SCAN_URL_MAX_REDIRECTS"`
+
+	// Maximum number of nested archives expanded with ?expand=true, the outermost included
+	ScanExpandMaxDepth int `json:"scan_expand_max_depth" yaml:"scan_expand_max_depth" mapstructure:"SCAN_EXPAND_MAX_DEPTH"`
+
+	// Maximum number of entries of an archive expanded with ?expand=true
+	ScanExpandMaxEntries int `json:"scan_expand_max_entries" yaml:"scan_expand_max_entries" mapstructure:"SCAN_EXPAND_MAX_ENTRIES"`
+
+	// Maximum number of bytes expanded from an archive with ?expand=true
+	ScanExpandMaxSize int64 `json:"scan_expand_max_size" yaml:"scan_expand_max_size" mapstructure:"SCAN_EXPAND_MAX_SIZE"`
+
+	// Enable the cache of the recent verdicts of the scans
+	ScanCacheEnabled bool `json:"scan_cache_enabled" yaml:"scan_cache_enabled" mapstructure:"SCAN_CACHE_ENABLED"`
+
+	// Maximum number of verdicts cached
+	ScanCacheSize int `json:"scan_cache_size" yaml:"scan_cache_size" mapstructure:"SCAN_CACHE_SIZE"`
+
+	// Duration a verdict is cached
+	ScanCacheTTL time.Duration `json:"scan_cache_ttl" yaml:"scan_cache_ttl" mapstructure:"SCAN_CACHE_TTL"`
+
+	// Enable the history of the last verdict of the scans by hash
+	ScanHistoryEnabled bool `json:"scan_history_enabled" yaml:"scan_history_enabled" mapstructure:"SCAN_HISTORY_ENABLED"`
+
+	// Store of the history of the verdicts
+	// Available: "memory", "file"
+	ScanHistoryStore string `json:"scan_history_store" yaml:"scan_history_store" mapstructure:"SCAN_HISTORY_STORE"`
+
+	// Directory in which the "file" store keeps the verdicts
+	ScanHistoryDir string `json:"scan_history_dir" yaml:"scan_history_dir" mapstructure:"SCAN_HISTORY_DIR"`
+
+	// Maximum number of verdicts kept by the "memory" store. The least
+	// recently recorded ones are evicted beyond. 0 means unbounded
+	ScanHistoryMaxRecords int `json:"scan_history_max_records" yaml:"scan_history_max_records" mapstructure:"SCAN_HISTORY_MAX_RECORDS"`
+
+	// Rules of the scan policy, allowing or denying the uploads before they
+	// are scanned. The first rule matching a file applies, the files matched
+	// by no rule being scanned. Given as a json array in environment variables
+	ScanPolicyRules []ScanPolicyRule `json:"scan_policy_rules" yaml:"scan_policy_rules" mapstructure:"SCAN_POLICY_RULES"`
+
+	// Enable the quarantine keeping the infected uploads, encrypted
+	QuarantineEnabled bool `json:"quarantine_enabled" yaml:"quarantine_enabled" mapstructure:"QUARANTINE_ENABLED"`
+
+	// Backend the quarantined items are kept in
+	// Available: "dir", "s3"
+	QuarantineBackend string `json:"quarantine_backend" yaml:"quarantine_backend" mapstructure:"QUARANTINE_BACKEND"`
+
+	// Directory in which the "dir" backend keeps the quarantined items
+	QuarantineDir string `json:"quarantine_dir" yaml:"quarantine_dir" mapstructure:"QUARANTINE_DIR"`
+
+	// Base64-encoded 32 bytes key with which the quarantined items
+	// are encrypted at rest. Required when enabled
+	QuarantineKey string `json:"quarantine_key" yaml:"quarantine_key" mapstructure:"QUARANTINE_KEY"`
+
+	// Password of the zip archives the quarantined items are downloaded as
+	QuarantineZipPassword string `json:"quarantine_zip_password" yaml:"quarantine_zip_password" mapstructure:"QUARANTINE_ZIP_PASSWORD"`
+
+	// Duration an item is kept in the quarantine. 0 keeps them forever
+	QuarantineMaxAge time.Duration `json:"quarantine_max_age" yaml:"quarantine_max_age" mapstructure:"QUARANTINE_MAX_AGE"`
+
+	// Maximum number of items kept in the quarantine, the oldest ones
+	// being deleted first. 0 doesn't limit it
+	QuarantineMaxItems int `json:"quarantine_max_items" yaml:"quarantine_max_items" mapstructure:"QUARANTINE_MAX_ITEMS"`
+
+	// Interval between two deletions of the expired quarantined items
+	QuarantineCleanupInterval time.Duration `json:"quarantine_cleanup_interval" yaml:"quarantine_cleanup_interval" mapstructure:"QUARANTINE_CLEANUP_INTERVAL"`
+
+	// Maximum duration to save an infected file in the quarantine, and
+	// of each request to the "s3" backend. 0 means no limit
+	QuarantineTimeout time.Duration `json:"quarantine_timeout" yaml:"quarantine_timeout" mapstructure:"QUARANTINE_TIMEOUT"`
+
+	// Url of the S3-compatible service of the "s3" backend
+	QuarantineS3Endpoint string `json:"quarantine_s3_endpoint" yaml:"quarantine_s3_endpoint" mapstructure:"QUARANTINE_S3_ENDPOINT"`
+
+	// Region of the bucket of the "s3" backend
+	QuarantineS3Region string `json:"quarantine_s3_region" yaml:"quarantine_s3_region" mapstructure:"QUARANTINE_S3_REGION"`
+
+	// Bucket in which the "s3" backend keeps the quarantined items
+	QuarantineS3Bucket string `json:"quarantine_s3_bucket" yaml:"quarantine_s3_bucket" mapstructure:"QUARANTINE_S3_BUCKET"`
+
+	// Prefix of the keys of the quarantined items in the bucket
+	QuarantineS3Prefix string `json:"quarantine_s3_prefix" yaml:"quarantine_s3_prefix" mapstructure:"QUARANTINE_S3_PREFIX"`
+
+	// Credentials of the "s3" backend
+	QuarantineS3AccessKey string `json:"quarantine_s3_access_key" yaml:"quarantine_s3_access_key" mapstructure:"QUARANTINE_S3_ACCESS_KEY"`
+	QuarantineS3SecretKey string `json:"quarantine_s3_secret_key" yaml:"quarantine_s3_secret_key" mapstructure:"QUARANTINE_S3_SECRET_KEY"`
+
+	// Address the bucket as a path of the endpoint rather than as a subdomain
+	QuarantineS3PathStyle bool `json:"quarantine_s3_path_style" yaml:"quarantine_s3_path_style" mapstructure:"QUARANTINE_S3_PATH_STYLE"`
+
+	// Enable the asynchronous scan jobs
+	JobsEnabled bool `json:"jobs_enabled" yaml:"jobs_enabled" mapstructure:"JOBS_ENABLED"`
+
+	// Store of the asynchronous scan jobs
+	// Available: "memory", "file"
+	JobsStore string `json:"jobs_store" yaml:"jobs_store" mapstructure:"JOBS_STORE"`
+
+	// Directory in which the uploads of the jobs are spooled, and the jobs
+	// are kept by the "file" store. A temporary directory is used when empty
+	JobsDir string `json:"jobs_dir" yaml:"jobs_dir" mapstructure:"JOBS_DIR"`
+
+	// Number of jobs scanned concurrently
+	JobsWorkers int `json:"jobs_workers" yaml:"jobs_workers" mapstructure:"JOBS_WORKERS"`
+
+	// Maximum number of jobs waiting to be scanned
+	JobsQueueSize int `json:"jobs_queue_size" yaml:"jobs_queue_size" mapstructure:"JOBS_QUEUE_SIZE"`
+
+	// Duration a job is kept once finished
+	JobsTTL time.Duration `json:"jobs_ttl" yaml:"jobs_ttl" mapstructure:"JOBS_TTL"`
+
+	// Interval between two deletions of the expired jobs
+	JobsCleanupInterval time.Duration `json:"jobs_cleanup_interval" yaml:"jobs_cleanup_interval" mapstructure:"JOBS_CLEANUP_INTERVAL"`
+
+	// Maximum duration of the scan of a job
+	JobsScanTimeout time.Duration `json:"jobs_scan_timeout" yaml:"jobs_scan_timeout" mapstructure:"JOBS_SCAN_TIMEOUT"`
+
+	// Enable the webhooks notifying the results of the scans
+	WebhookEnabled bool `json:"webhook_enabled" yaml:"webhook_enabled" mapstructure:"WEBHOOK_ENABLED"`
+
+	// Urls of the webhooks notified of every detection
+	WebhookURLs []string `json:"webhook_urls" yaml:"webhook_urls" mapstructure:"WEBHOOK_URLS"`
+
+	// Secret with which the webhook deliveries are signed. Required when enabled
+	WebhookSecret string `json:"webhook_secret" yaml:"webhook_secret" mapstructure:"WEBHOOK_SECRET"`
+
+	// Maximum number of attempts to deliver a webhook event
+	WebhookMaxAttempts int `json:"webhook_max_attempts" yaml:"webhook_max_attempts" mapstructure:"WEBHOOK_MAX_ATTEMPTS"`
+
+	// Duration waited before the first retry of a delivery, doubled before each subsequent one
+	WebhookInitialBackoff time.Duration `json:"webhook_initial_backoff" yaml:"webhook_initial_backoff" mapstructure:"WEBHOOK_INITIAL_BACKOFF"`
+
+	// Maximum duration waited between two attempts of a delivery
+	WebhookMaxBackoff time.Duration `json:"webhook_max_backoff" yaml:"webhook_max_backoff" mapstructure:"WEBHOOK_MAX_BACKOFF"`
+
+	// Maximum duration of an attempt to deliver a webhook event
+	WebhookTimeout time.Duration `json:"webhook_timeout" yaml:"webhook_timeout" mapstructure:"WEBHOOK_TIMEOUT"`
+
+	// Schemes allowed for the callback urls of the scan requests
+	WebhookCallbackAllowedSchemes []string `json:"webhook_callback_allowed_schemes" yaml:"webhook_callback_allowed_schemes" mapstructure:"WEBHOOK_CALLBACK_ALLOWED_SCHEMES"`
+
+	// Allow the callback urls to resolve to loopback, private,
+	// link-local and other reserved addresses
+	WebhookCallbackAllowPrivate bool `json:"webhook_callback_allow_private" yaml:"webhook_callback_allow_private" mapstructure:"WEBHOOK_CALLBACK_ALLOW_PRIVATE"`
+
+	// File to which the deliveries failing after the last attempt are appended
+	// as json lines. They are only logged when empty
+	WebhookDeadLetterFile string `json:"webhook_dead_letter_file" yaml:"webhook_dead_letter_file" mapstructure:"WEBHOOK_DEAD_LETTER_FILE"`
+
 	// Logger log level
 	// Available: "trace", "debug", "info", "warn", "error", "fatal", "panic"
 	// ref: https://pkg.go.dev/github.com/rs/zerolog@v1.26.1#pkg-variables
@@ -76,6 +334,73 @@ type App struct {
 
 	// Interval between keep-alive probes for an active connection to the Clamav server
 	ClamavKeepAlive time.Duration `json:"clamav_keepalive" yaml:"clamav_keepalive" mapstructure:"CLAMAV_KEEPALIVE"`
+
+	// Maximum size of the chunks streamed to the Clamav server when scanning
+	ClamavStreamChunkSize int `json:"clamav_stream_chunk_size" yaml:"clamav_stream_chunk_size" mapstructure:"CLAMAV_STREAM_CHUNK_SIZE"`
+
+	// Maximum number of long lived sessions kept open to the Clamav server.
+	// 0 disables the pool: a new connection is dialed for each command
+	ClamavPoolSize int `json:"clamav_pool_size" yaml:"clamav_pool_size" mapstructure:"CLAMAV_POOL_SIZE"`
+
+	// Duration after which an unused session to the Clamav server is closed
+	ClamavPoolIdleTimeout time.Duration `json:"clamav_pool_idle_timeout" yaml:"clamav_pool_idle_timeout" mapstructure:"CLAMAV_POOL_IDLE_TIMEOUT"`
+
+	// Network addresses of several Clamav servers to spread the requests across.
+	// They all use the named network of ClamavNetwork. ClamavAddr is used when empty
+	ClamavBackends []string `json:"clamav_backends" yaml:"clamav_backends" mapstructure:"CLAMAV_BACKENDS"`
+
+	// Strategy used to pick the Clamav server a request is sent to
+	// Available: "round-robin", "least-outstanding"
+	ClamavBalancerStrategy string `json:"clamav_balancer_strategy" yaml:"clamav_balancer_strategy" mapstructure:"CLAMAV_BALANCER_STRATEGY"`
+
+	// Interval between two health checks of the Clamav servers.
+	// 0 disables the health checks
+	ClamavHealthCheckInterval time.Duration `json:"clamav_health_check_interval" yaml:"clamav_health_check_interval" mapstructure:"CLAMAV_HEALTH_CHECK_INTERVAL"`
+
+	// Interval between two checks of the version of the Clamav signature database,
+	// the cached verdicts being dropped when it changes. 0 disables the checks
+	ClamavVersionCheckInterval time.Duration `json:"clamav_version_check_interval" yaml:"clamav_version_check_interval" mapstructure:"CLAMAV_VERSION_CHECK_INTERVAL"`
+
+	// Maximum number of times a command failing to reach the Clamav server is sent.
+	// 1 disables the retries
+	ClamavRetryMaxAttempts int `json:"clamav_retry_max_attempts" yaml:"clamav_retry_max_attempts" mapstructure:"CLAMAV_RETRY_MAX_ATTEMPTS"`
+
+	// Duration waited before the first retry, doubled before each subsequent one
+	ClamavRetryInitialBackoff time.Duration `json:"clamav_retry_initial_backoff" yaml:"clamav_retry_initial_backoff" mapstructure:"CLAMAV_RETRY_INITIAL_BACKOFF"`
+
+	// Maximum duration waited between two retries
+	ClamavRetryMaxBackoff time.Duration `json:"clamav_retry_max_backoff" yaml:"clamav_retry_max_backoff" mapstructure:"CLAMAV_RETRY_MAX_BACKOFF"`
+
+	// Number of consecutive failures to reach the Clamav server opening the circuit breaker.
+	// 0 disables the circuit breaker
+	ClamavBreakerThreshold int `json:"clamav_breaker_threshold" yaml:"clamav_breaker_threshold" mapstructure:"CLAMAV_BREAKER_THRESHOLD"`
+
+	// Duration the circuit breaker stays open before probing the Clamav server again
+	ClamavBreakerOpenTimeout time.Duration `json:"clamav_breaker_open_timeout" yaml:"clamav_breaker_open_timeout" mapstructure:"CLAMAV_BREAKER_OPEN_TIMEOUT"`
+}
+
+// ScanPolicyRule is a rule of the scan policy. It matches the files
+// meeting all of its conditions, a condition left empty matching every file.
+type ScanPolicyRule struct {
+	// Name of the rule, reported with the decisions it made
+	Name string `json:"name" yaml:"name" mapstructure:"name"`
+
+	// Action taken on the files matched by the rule
+	// Available: "allow", "deny", "scan"
+	Action string `json:"action" yaml:"action" mapstructure:"action"`
+
+	// Extensions of the name of the files, eg. ".exe"
+	Extensions []string `json:"extensions" yaml:"extensions" mapstructure:"extensions"`
+
+	// Patterns of the sniffed MIME types of the files, eg. "image/*"
+	MIMETypes []string `json:"mime_types" yaml:"mime_types" mapstructure:"mime_types"`
+
+	// Patterns of the name of the files, eg. "invoice*.pdf"
+	Filenames []string `json:"filenames" yaml:"filenames" mapstructure:"filenames"`
+
+	// Minimum and maximum size of the files, in bytes. 0 means no bound
+	MinSize int64 `json:"min_size" yaml:"min_size" mapstructure:"min_size"`
+	MaxSize int64 `json:"max_size" yaml:"max_size" mapstructure:"max_size"`
 }
 
 // New will retrieve the runtime configuration from either
@@ -116,6 +441,13 @@ func New() (*App, error) {
 		}
 	}
 
+	// Lists of objects can only be given as json in
+	// environment variables and dotenv files
+	err = decodeJSONSetting("SCAN_POLICY_RULES")
+	if err != nil {
+		return nil, err
+	}
+
 	err = viper.Unmarshal(&c)
 	if err != nil {
 		return nil, err
@@ -129,6 +461,25 @@ func New() (*App, error) {
 	return &c, nil
 }
 
+// decodeJSONSetting replaces the value of the setting key by the
+// json it holds, when it is a string.
+func decodeJSONSetting(key string) error {
+	s, ok := viper.Get(key).(string)
+	if !ok {
+		return nil
+	}
+
+	var v any = []any{}
+	if s != "" {
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return fmt.Errorf("error while decoding %s: %w", key, err)
+		}
+	}
+	viper.Set(key, v)
+
+	return nil
+}
+
 // validateConfig will make sure the provided configuration is valid
 // by looking if the values are present when they are expected to be present
 func validateConfig(c *App) error {
@@ -166,6 +517,69 @@ func (config *App) setDefaults() {
 	config.ServerReadHeaderTimeout = defaultServerReadHeaderTimeout
 	config.ServerWriteTimeout = defaultServerWriteTimeout
 	config.ServerMaxRequestSize = defaultServerMaxRequestSize
+	config.ServerAdminToken = defaultServerAdminToken
+
+	config.ScanPathAllowlist = defaultScanPathAllowlist
+	config.ScanSpoolDir = defaultScanSpoolDir
+
+	config.ScanExpandMaxDepth = defaultScanExpandMaxDepth
+	config.ScanExpandMaxEntries = defaultScanExpandMaxEntries
+	config.ScanExpandMaxSize = defaultScanExpandMaxSize
+
+	config.ScanCacheEnabled = defaultScanCacheEnabled
+	config.ScanCacheSize = defaultScanCacheSize
+	config.ScanCacheTTL = defaultScanCacheTTL
+
+	config.ScanHistoryEnabled = defaultScanHistoryEnabled
+	config.ScanHistoryStore = defaultScanHistoryStore
+	config.ScanHistoryDir = defaultScanHistoryDir
+	config.ScanHistoryMaxRecords = defaultScanHistoryMaxRecords
+
+	config.ScanPolicyRules = defaultScanPolicyRules
+
+	config.QuarantineEnabled = defaultQuarantineEnabled
+	config.QuarantineBackend = defaultQuarantineBackend
+	config.QuarantineDir = defaultQuarantineDir
+	config.QuarantineKey = defaultQuarantineKey
+	config.QuarantineZipPassword = defaultQuarantineZipPassword
+	config.QuarantineMaxAge = defaultQuarantineMaxAge
+	config.QuarantineMaxItems = defaultQuarantineMaxItems
+	config.QuarantineCleanupInterval = defaultQuarantineCleanupInterval
+	config.QuarantineTimeout = defaultQuarantineTimeout
+	config.QuarantineS3Endpoint = defaultQuarantineS3Endpoint
+	config.QuarantineS3Region = defaultQuarantineS3Region
+	config.QuarantineS3Bucket = defaultQuarantineS3Bucket
+	config.QuarantineS3Prefix = defaultQuarantineS3Prefix
+	config.QuarantineS3AccessKey = defaultQuarantineS3AccessKey
+	config.QuarantineS3SecretKey = defaultQuarantineS3SecretKey
+	config.QuarantineS3PathStyle = defaultQuarantineS3PathStyle
+
+	config.ScanURLEnabled = defaultScanURLEnabled
+	config.ScanURLAllowedSchemes = defaultScanURLAllowedSchemes
+	config.ScanURLAllowPrivate = defaultScanURLAllowPrivate
+	config.ScanURLMaxSize = defaultScanURLMaxSize
+	config.ScanURLTimeout = defaultScanURLTimeout
+	config.ScanURLMaxRedirects = defaultScanURLMaxRedirects
+
+	config.JobsEnabled = defaultJobsEnabled
+	config.JobsStore = defaultJobsStore
+	config.JobsDir = defaultJobsDir
+	config.JobsWorkers = defaultJobsWorkers
+	config.JobsQueueSize = defaultJobsQueueSize
+	config.JobsTTL = defaultJobsTTL
+	config.JobsCleanupInterval = defaultJobsCleanupInterval
+	config.JobsScanTimeout = defaultJobsScanTimeout
+
+	config.WebhookEnabled = defaultWebhookEnabled
+	config.WebhookURLs = defaultWebhookURLs
+	config.WebhookSecret = defaultWebhookSecret
+	config.WebhookMaxAttempts = defaultWebhookMaxAttempts
+	config.WebhookInitialBackoff = defaultWebhookInitialBackoff
+	config.WebhookMaxBackoff = defaultWebhookMaxBackoff
+	config.WebhookTimeout = defaultWebhookTimeout
+	config.WebhookCallbackAllowedSchemes = defaultWebhookCallbackAllowedSchemes
+	config.WebhookCallbackAllowPrivate = defaultWebhookCallbackAllowPrivate
+	config.WebhookDeadLetterFile = defaultWebhookDeadLetterFile
 
 	config.LoggerLogLevel = defaultLoggerLogLevel
 	config.LoggerDurationFieldUnit = defaultLoggerDurationFieldUnit
@@ -175,4 +589,22 @@ func (config *App) setDefaults() {
 	config.ClamavNetwork = defaultClamavNetwork
 	config.ClamavTimeout = defaultClamavTimeout
 	config.ClamavKeepAlive = defaultClamavKeepAlive
+
+	config.ClamavStreamChunkSize = defaultClamavStreamChunkSize
+
+	config.ClamavPoolSize = defaultClamavPoolSize
+	config.ClamavPoolIdleTimeout = defaultClamavPoolIdleTimeout
+
+	config.ClamavBackends = defaultClamavBackends
+	config.ClamavBalancerStrategy = defaultClamavBalancerStrategy
+	config.ClamavHealthCheckInterval = defaultClamavHealthCheckInterval
+
+	config.ClamavVersionCheckInterval = defaultClamavVersionCheckInterval
+
+	config.ClamavRetryMaxAttempts = defaultClamavRetryMaxAttempts
+	config.ClamavRetryInitialBackoff = defaultClamavRetryInitialBackoff
+	config.ClamavRetryMaxBackoff = defaultClamavRetryMaxBackoff
+
+	config.ClamavBreakerThreshold = defaultClamavBreakerThreshold
+	config.ClamavBreakerOpenTimeout = defaultClamavBreakerOpenTimeout
 }
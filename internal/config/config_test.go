@@ -3,7 +3,9 @@ package config
 import (
 	"testing"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAppSetDefaults(t *testing.T) {
@@ -16,6 +18,69 @@ func TestAppSetDefaults(t *testing.T) {
 	assert.Equal(t, defaultServerReadHeaderTimeout, app.ServerReadHeaderTimeout)
 	assert.Equal(t, defaultServerWriteTimeout, app.ServerWriteTimeout)
 	assert.Equal(t, defaultServerMaxRequestSize, app.ServerMaxRequestSize)
+	assert.Equal(t, defaultServerAdminToken, app.ServerAdminToken)
+
+	assert.Equal(t, defaultScanPathAllowlist, app.ScanPathAllowlist)
+	assert.Equal(t, defaultScanSpoolDir, app.ScanSpoolDir)
+
+	assert.Equal(t, defaultScanExpandMaxDepth, app.ScanExpandMaxDepth)
+	assert.Equal(t, defaultScanExpandMaxEntries, app.ScanExpandMaxEntries)
+	assert.Equal(t, defaultScanExpandMaxSize, app.ScanExpandMaxSize)
+
+	assert.Equal(t, defaultScanCacheEnabled, app.ScanCacheEnabled)
+	assert.Equal(t, defaultScanCacheSize, app.ScanCacheSize)
+	assert.Equal(t, defaultScanCacheTTL, app.ScanCacheTTL)
+
+	assert.Equal(t, defaultScanHistoryEnabled, app.ScanHistoryEnabled)
+	assert.Equal(t, defaultScanHistoryStore, app.ScanHistoryStore)
+	assert.Equal(t, defaultScanHistoryDir, app.ScanHistoryDir)
+	assert.Equal(t, defaultScanHistoryMaxRecords, app.ScanHistoryMaxRecords)
+
+	assert.Equal(t, defaultScanPolicyRules, app.ScanPolicyRules)
+
+	assert.Equal(t, defaultQuarantineEnabled, app.QuarantineEnabled)
+	assert.Equal(t, defaultQuarantineBackend, app.QuarantineBackend)
+	assert.Equal(t, defaultQuarantineDir, app.QuarantineDir)
+	assert.Equal(t, defaultQuarantineKey, app.QuarantineKey)
+	assert.Equal(t, defaultQuarantineZipPassword, app.QuarantineZipPassword)
+	assert.Equal(t, defaultQuarantineMaxAge, app.QuarantineMaxAge)
+	assert.Equal(t, defaultQuarantineMaxItems, app.QuarantineMaxItems)
+	assert.Equal(t, defaultQuarantineCleanupInterval, app.QuarantineCleanupInterval)
+	assert.Equal(t, defaultQuarantineTimeout, app.QuarantineTimeout)
+	assert.Equal(t, defaultQuarantineS3Endpoint, app.QuarantineS3Endpoint)
+	assert.Equal(t, defaultQuarantineS3Region, app.QuarantineS3Region)
+	assert.Equal(t, defaultQuarantineS3Bucket, app.QuarantineS3Bucket)
+	assert.Equal(t, defaultQuarantineS3Prefix, app.QuarantineS3Prefix)
+	assert.Equal(t, defaultQuarantineS3AccessKey, app.QuarantineS3AccessKey)
+	assert.Equal(t, defaultQuarantineS3SecretKey, app.QuarantineS3SecretKey)
+	assert.Equal(t, defaultQuarantineS3PathStyle, app.QuarantineS3PathStyle)
+
+	assert.Equal(t, defaultScanURLEnabled, app.ScanURLEnabled)
+	assert.Equal(t, defaultScanURLAllowedSchemes, app.ScanURLAllowedSchemes)
+	assert.Equal(t, defaultScanURLAllowPrivate, app.ScanURLAllowPrivate)
+	assert.Equal(t, defaultScanURLMaxSize, app.ScanURLMaxSize)
+	assert.Equal(t, defaultScanURLTimeout, app.ScanURLTimeout)
+	assert.Equal(t, defaultScanURLMaxRedirects, app.ScanURLMaxRedirects)
+
+	assert.Equal(t, defaultJobsEnabled, app.JobsEnabled)
+	assert.Equal(t, defaultJobsStore, app.JobsStore)
+	assert.Equal(t, defaultJobsDir, app.JobsDir)
+	assert.Equal(t, defaultJobsWorkers, app.JobsWorkers)
+	assert.Equal(t, defaultJobsQueueSize, app.JobsQueueSize)
+	assert.Equal(t, defaultJobsTTL, app.JobsTTL)
+	assert.Equal(t, defaultJobsCleanupInterval, app.JobsCleanupInterval)
+	assert.Equal(t, defaultJobsScanTimeout, app.JobsScanTimeout)
+
+	assert.Equal(t, defaultWebhookEnabled, app.WebhookEnabled)
+	assert.Equal(t, defaultWebhookURLs, app.WebhookURLs)
+	assert.Equal(t, defaultWebhookSecret, app.WebhookSecret)
+	assert.Equal(t, defaultWebhookMaxAttempts, app.WebhookMaxAttempts)
+	assert.Equal(t, defaultWebhookInitialBackoff, app.WebhookInitialBackoff)
+	assert.Equal(t, defaultWebhookMaxBackoff, app.WebhookMaxBackoff)
+	assert.Equal(t, defaultWebhookTimeout, app.WebhookTimeout)
+	assert.Equal(t, defaultWebhookCallbackAllowedSchemes, app.WebhookCallbackAllowedSchemes)
+	assert.Equal(t, defaultWebhookCallbackAllowPrivate, app.WebhookCallbackAllowPrivate)
+	assert.Equal(t, defaultWebhookDeadLetterFile, app.WebhookDeadLetterFile)
 
 	assert.Equal(t, defaultLoggerLogLevel, app.LoggerLogLevel)
 	assert.Equal(t, defaultLoggerDurationFieldUnit, app.LoggerDurationFieldUnit)
@@ -25,4 +90,42 @@ func TestAppSetDefaults(t *testing.T) {
 	assert.Equal(t, defaultClamavNetwork, app.ClamavNetwork)
 	assert.Equal(t, defaultClamavTimeout, app.ClamavTimeout)
 	assert.Equal(t, defaultClamavKeepAlive, app.ClamavKeepAlive)
+
+	assert.Equal(t, defaultClamavStreamChunkSize, app.ClamavStreamChunkSize)
+
+	assert.Equal(t, defaultClamavPoolSize, app.ClamavPoolSize)
+	assert.Equal(t, defaultClamavPoolIdleTimeout, app.ClamavPoolIdleTimeout)
+
+	assert.Equal(t, defaultClamavBackends, app.ClamavBackends)
+	assert.Equal(t, defaultClamavBalancerStrategy, app.ClamavBalancerStrategy)
+	assert.Equal(t, defaultClamavHealthCheckInterval, app.ClamavHealthCheckInterval)
+
+	assert.Equal(t, defaultClamavVersionCheckInterval, app.ClamavVersionCheckInterval)
+
+	assert.Equal(t, defaultClamavRetryMaxAttempts, app.ClamavRetryMaxAttempts)
+	assert.Equal(t, defaultClamavRetryInitialBackoff, app.ClamavRetryInitialBackoff)
+	assert.Equal(t, defaultClamavRetryMaxBackoff, app.ClamavRetryMaxBackoff)
+
+	assert.Equal(t, defaultClamavBreakerThreshold, app.ClamavBreakerThreshold)
+	assert.Equal(t, defaultClamavBreakerOpenTimeout, app.ClamavBreakerOpenTimeout)
+}
+
+func TestNewScanPolicyRulesFromEnv(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	t.Setenv("SCAN_POLICY_RULES", `[{"name":"executables","action":"deny","extensions":[".exe"]},{"name":"images","action":"allow","mime_types":["image/*"],"max_size":1024}]`)
+
+	app, err := New()
+	require.NoError(t, err)
+	assert.Equal(t, []ScanPolicyRule{
+		{Name: "executables", Action: "deny", Extensions: []string{".exe"}},
+		{Name: "images", Action: "allow", MIMETypes: []string{"image/*"}, MaxSize: 1024},
+	}, app.ScanPolicyRules)
+
+	t.Setenv("SCAN_POLICY_RULES", "[")
+	viper.Reset()
+
+	_, err = New()
+	assert.ErrorContains(t, err, "error while decoding SCAN_POLICY_RULES")
 }
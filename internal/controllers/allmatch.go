@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog/hlog"
+)
+
+var ErrSpoolDirNotConfigured = errors.New("scanning all matches requires a spool directory shared with clamav")
+
+// inStreamAllMatch will scan the uploaded file f with the "ALLMATCHSCAN" command,
+// so that every signature matching the file is reported.
+//
+// Clamd can't report all the matches of a stream, hence the file is spooled to the
+// spool directory, which must be shared with Clamd at the same path, and
+// scanned from there.
+//
+// The webhooks are notified of the result of the scan of file.
+func (h *Handler) inStreamAllMatch(w http.ResponseWriter, r *http.Request, f io.Reader, callbackURL string, file webhook.File, details ScanDetails) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	if h.SpoolDir == "" {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msg(ErrSpoolDirNotConfigured.Error())
+
+		SetErrorResponse(w, ErrSpoolDirNotConfigured)
+		return
+	}
+
+	// The file is hashed while being spooled
+	body := newDigestReader(f)
+	path, err := h.spool(body)
+	if err != nil {
+		h.Logger.Error().Str("req_id", req_id.String()).Err(err).Msg("error while spooling file")
+
+		SetErrorResponse(w, err)
+		return
+	}
+	defer os.Remove(path)
+	body.fill(&details)
+
+	h.Logger.Debug().Str("req_id", req_id.String()).Str("path", path).Msg("file spooled successfully")
+
+	ctx := details.scanContext(r.Context())
+
+	results, err := h.Clamav.ScanPath(ctx, path, clamd.ScanModeAllMatch)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Err(err).Msg("error while scanning file")
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	inStreamResp := InStreamResponse{
+		Status:     "noerror",
+		Msg:        string(clamd.RespScan),
+		Signature:  "",
+		Signatures: make([]string, 0, len(results)),
+		VirusFound: false,
+	}
+	for _, res := range results {
+		if res.Error != "" {
+			continue
+		}
+		inStreamResp.Signatures = append(inStreamResp.Signatures, res.Signature)
+	}
+	if len(inStreamResp.Signatures) > 0 {
+		inStreamResp.Status = "error"
+		inStreamResp.Msg = clamd.ErrVirusFound.Error()
+		inStreamResp.Signature = inStreamResp.Signatures[0]
+		inStreamResp.VirusFound = true
+	}
+
+	h.Logger.Debug().Str("req_id", req_id.String()).Int("matches", len(inStreamResp.Signatures)).Msg("file scanned successfully")
+
+	inStreamResp.ScanDetails = details
+	h.writeVerdict(w, req_id.String(), callbackURL, file, inStreamResp)
+}
+
+// spool will copy r into a new file of the spool directory
+// and return its path.
+//
+// The file is made world readable for Clamd, which usually runs
+// as a different user, to be able to read it.
+func (h *Handler) spool(r io.Reader) (string, error) {
+	f, err := os.CreateTemp(h.SpoolDir, "clamav-api-*")
+	if err != nil {
+		return "", fmt.Errorf("error while creating spool file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("error while writing spool file: %w", err)
+	}
+
+	if err := f.Chmod(0o644); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("error while writing spool file: %w", err)
+	}
+
+	return f.Name(), nil
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerInStreamAllMatch(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	type args struct {
+		scenario MockScenario
+		spoolDir string
+		query    string
+	}
+	type want struct {
+		status int
+		body   []byte
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "no error",
+			args: args{
+				scenario: ScenarioNoError,
+				spoolDir: t.TempDir(),
+				query:    "allmatch=true",
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"filename":"eicar.txt","size":6,` + foobarDetails + `}`),
+			},
+		},
+		{
+			name: "virus found",
+			args: args{
+				scenario: ScenarioErrVirusFound,
+				spoolDir: t.TempDir(),
+				query:    "allmatch=1",
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","signatures":["Win.Test.EICAR_HDB-1","Eicar-Signature"],"virus_found":true,"filename":"eicar.txt","size":6,` + foobarDetails + `}`),
+			},
+		},
+		{
+			name: "allmatch disabled",
+			args: args{
+				scenario: ScenarioErrVirusFound,
+				query:    "allmatch=false",
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"filename":"eicar.txt","size":6,` + foobarDetails + `}`),
+			},
+		},
+		{
+			name: "spool directory not configured",
+			args: args{
+				scenario: ScenarioNoError,
+				query:    "allmatch=true",
+			},
+			want: want{
+				status: http.StatusNotImplemented,
+				body:   []byte(`{"status":"error","msg":"not implemented: scanning all matches requires a spool directory shared with clamav"}`),
+			},
+		},
+		{
+			name: "invalid query parameter",
+			args: args{
+				scenario: ScenarioNoError,
+				query:    "allmatch=foo",
+			},
+			want: want{
+				status: http.StatusBadRequest,
+				body:   []byte(`{"status":"error","msg":"bad request: invalid query parameter: allmatch: \"foo\""}`),
+			},
+		},
+		{
+			name: "error is net error",
+			args: args{
+				scenario: ScenarioNetError,
+				spoolDir: t.TempDir(),
+				query:    "allmatch=true",
+			},
+			want: want{
+				status: http.StatusBadGateway,
+				body:   []byte(`{"status":"error","msg":"something wrong happened while communicating with clamav"}`),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, mockClamav)
+			h.SpoolDir = tt.args.spoolDir
+			h.clock = testClock
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(h.InStream)
+
+			b := &bytes.Buffer{}
+			writer := multipart.NewWriter(b)
+			part, _ := writer.CreateFormFile("file", "eicar.txt")
+			io.Copy(part, strings.NewReader("foobar"))
+			writer.Close()
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.args.scenario)
+			req, err := http.NewRequestWithContext(ctx, "POST", "/rest/v1/scan?"+tt.args.query, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			handler.ServeHTTP(rr, req)
+
+			resp := rr.Result()
+			body, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.want.status, resp.StatusCode)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want.body, body)
+
+			// The spooled file is removed once scanned
+			if tt.args.spoolDir != "" {
+				entries, err := os.ReadDir(tt.args.spoolDir)
+				assert.NoError(t, err)
+				assert.Empty(t, entries)
+			}
+		})
+	}
+}
+
+func TestHandlerSpool(t *testing.T) {
+	h := &Handler{SpoolDir: t.TempDir()}
+
+	path, err := h.spool(strings.NewReader("foobar"))
+	assert.NoError(t, err)
+
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("foobar"), b)
+
+	fi, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+
+	h = &Handler{SpoolDir: "/non/existing/directory"}
+	_, err = h.spool(strings.NewReader("foobar"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// BreakerResponse represents the json response of a /admin/breaker endpoint.
+// It represents the state of the circuit breaker guarding the calls to Clamd.
+type BreakerResponse struct {
+	State             string     `json:"state"`
+	Failures          int        `json:"failures"`
+	OpenedAt          *time.Time `json:"opened_at"`
+	RetryAfterSeconds int        `json:"retry_after_seconds"`
+}
+
+var ErrBreakerNotConfigured = errors.New("circuit breaker disabled")
+
+func (h *Handler) BreakerStatus(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	if h.Breaker == nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", ErrBreakerNotConfigured)
+
+		SetErrorResponse(w, ErrBreakerNotConfigured)
+		return
+	}
+
+	status := h.Breaker.Status()
+
+	breaker := BreakerResponse{
+		State:    string(status.State),
+		Failures: status.Failures,
+	}
+	if !status.OpenedAt.IsZero() {
+		breaker.OpenedAt = &status.OpenedAt
+	}
+	if status.RetryAfter > 0 {
+		breaker.RetryAfterSeconds = retryAfterSeconds(status.RetryAfter)
+	}
+
+	resp, err := json.Marshal(&breaker)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
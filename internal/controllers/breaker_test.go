@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerBreaker(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	closed := clamd.NewCircuitBreaker(1, time.Minute, nil)
+
+	open := clamd.NewCircuitBreaker(1, time.Minute, nil)
+	open.Allow()
+	open.Record(&net.OpError{Err: errors.New("network error")})
+
+	type want struct {
+		status int
+		body   string
+	}
+	tests := []struct {
+		name    string
+		breaker *clamd.CircuitBreaker
+		want    want
+	}{
+		{
+			name:    "breaker disabled",
+			breaker: nil,
+			want: want{
+				status: http.StatusNotImplemented,
+				body:   `{"status":"error","msg":"not implemented: circuit breaker disabled"}`,
+			},
+		},
+		{
+			name:    "breaker closed",
+			breaker: closed,
+			want: want{
+				status: http.StatusOK,
+				body:   `{"state":"closed","failures":0,"opened_at":null,"retry_after_seconds":0}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, mockClamav)
+			h.Breaker = tt.breaker
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(h.BreakerStatus)
+
+			req, err := http.NewRequest("GET", "/rest/v1/admin/breaker", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handler.ServeHTTP(rr, req)
+
+			resp := rr.Result()
+			body, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.want.status, resp.StatusCode)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want.body, string(body))
+		})
+	}
+
+	t.Run("breaker open", func(t *testing.T) {
+		h := NewHandler(&logger, mockClamav)
+		h.Breaker = open
+		rr := httptest.NewRecorder()
+
+		req, err := http.NewRequest("GET", "/rest/v1/admin/breaker", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		http.HandlerFunc(h.BreakerStatus).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"state":"open","failures":1,"opened_at":"`)
+		assert.Contains(t, rr.Body.String(), `"retry_after_seconds":60`)
+	})
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/lescactus/clamav-api-go/internal/cache"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+)
+
+// recordVerdict caches and records in the history the verdict of the content
+// of details, from the response of Clamd and the error returned while scanning
+// it. Only the clean and infected verdicts of the hashed contents are recorded,
+// along with the version of Clamd which made them.
+func (h *Handler) recordVerdict(reqID string, details *ScanDetails, inStream []byte, err error) {
+	sum := details.SHA256
+	if sum == "" {
+		return
+	}
+
+	var signature string
+	switch {
+	case err == nil:
+	case errors.Is(err, clamd.ErrVirusFound):
+		signature = h.parseSignature(string(inStream))
+	default:
+		return
+	}
+
+	version := details.scanVersion()
+	if h.Cache != nil {
+		h.Cache.Put(sum, cache.Verdict{Signature: signature, Database: databaseVersion(version)})
+	}
+	h.recordHistory(reqID, sum, signature, version)
+}
+
+// cachedVerdict returns the cached verdict of the content of details, if any.
+// Only the verdicts made by the signature database Clamd was known to run when
+// the scan started are served: with several Clamd, the most recent one.
+func (h *Handler) cachedVerdict(details *ScanDetails) (cache.Verdict, bool) {
+	if h.Cache == nil {
+		return cache.Verdict{}, false
+	}
+	return h.Cache.Get(details.SHA256, databaseVersion(details.version))
+}
+
+// databaseVersion returns the version of the signature database of v, 0 if unknown.
+func databaseVersion(v *clamd.Version) int {
+	if v == nil {
+		return 0
+	}
+	return v.Database
+}
+
+// cachedResponse returns the response to the scan of a content from its cached verdict.
+func cachedResponse(v cache.Verdict) InStreamResponse {
+	if v.Signature != "" {
+		return InStreamResponse{
+			Status:     "error",
+			Msg:        clamd.ErrVirusFound.Error(),
+			Signature:  v.Signature,
+			VirusFound: true,
+			Cached:     true,
+		}
+	}
+
+	return InStreamResponse{
+		Status:     "noerror",
+		Msg:        string(clamd.RespScan),
+		Signature:  "",
+		VirusFound: false,
+		Cached:     true,
+	}
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/cache"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingClamav is a Clamaver counting the calls to InStream.
+type countingClamav struct {
+	clamd.Clamaver
+
+	inStreamCalls atomic.Int32
+}
+
+func (c *countingClamav) InStream(ctx context.Context, r io.Reader) ([]byte, error) {
+	c.inStreamCalls.Add(1)
+	return c.Clamaver.InStream(ctx, r)
+}
+
+func TestHandlerCache(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	clamav := &countingClamav{Clamaver: &MockClamav{}}
+
+	h := NewHandler(&logger, clamav)
+	h.clock = testClock
+
+	var err error
+	h.Cache, err = cache.New(cache.Options{Size: 10, TTL: time.Hour})
+	require.NoError(t, err)
+
+	do := func(scenario MockScenario, method string, path string, contentType string, body io.Reader, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		ctx := context.WithValue(context.Background(), MockScenario(""), scenario)
+		req, err := http.NewRequestWithContext(ctx, method, path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		handler(rr, req)
+		return rr
+	}
+	upload := func(scenario MockScenario, content string) *httptest.ResponseRecorder {
+		b := &bytes.Buffer{}
+		writer := multipart.NewWriter(b)
+		part, _ := writer.CreateFormFile("file", "file.txt")
+		io.WriteString(part, content)
+		writer.Close()
+
+		return do(scenario, http.MethodPost, "/rest/v1/scan", writer.FormDataContentType(), b, h.InStream)
+	}
+
+	const (
+		infected       = `{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"filename":"file.txt","size":68,` + eicarDetails + `}`
+		cachedInfected = `{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"cached":true,"filename":"file.txt","size":68,` + eicarDetails + `}`
+	)
+
+	// Cache miss, then hit
+	rr := upload(ScenarioReadStream, eicar)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, infected, rr.Body.String())
+	assert.EqualValues(t, 1, clamav.inStreamCalls.Load())
+
+	rr = upload(ScenarioReadStream, eicar)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, cachedInfected, rr.Body.String())
+	assert.EqualValues(t, 1, clamav.inStreamCalls.Load())
+
+	// The verdicts of the streamed contents are cached
+	rr = do(ScenarioReadStream, http.MethodPost, "/rest/v1/scan/stream", "text/plain", strings.NewReader("foobar"), h.InStreamRaw)
+	assert.Equal(t, `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"size":6,`+foobarDetails+`}`, rr.Body.String())
+
+	b := &bytes.Buffer{}
+	writer := multipart.NewWriter(b)
+	part, _ := writer.CreateFormFile("file", "foo.txt")
+	io.WriteString(part, "foo")
+	writer.Close()
+	rr = do(ScenarioReadStream, http.MethodPost, "/rest/v1/scan/files", writer.FormDataContentType(), b, h.ScanFiles)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.EqualValues(t, 3, clamav.inStreamCalls.Load())
+
+	rr = upload(ScenarioReadStream, "foobar")
+	assert.Equal(t, `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"cached":true,"filename":"file.txt","size":6,`+foobarDetails+`}`, rr.Body.String())
+	rr = upload(ScenarioReadStream, "foo")
+	assert.Contains(t, rr.Body.String(), `"cached":true`)
+	assert.EqualValues(t, 3, clamav.inStreamCalls.Load())
+
+	// The errors aren't cached
+	rr = upload(ScenarioNetError, "bar")
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	rr = upload(ScenarioReadStream, "bar")
+	assert.NotContains(t, rr.Body.String(), `"cached":true`)
+	assert.EqualValues(t, 5, clamav.inStreamCalls.Load())
+
+	// The verdicts are only served for the signature database which made them
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)
+	h.Versions = clamd.NewVersionWatcher(&outdatedClamav{}, 0, nil)
+	defer h.Versions.Close()
+	require.NoError(t, h.Versions.Refresh(ctx))
+
+	const infected26960 = `{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"filename":"file.txt","size":68,` + eicarDetails + `,"engine_version":"1.0.1","database_version":26960}`
+	rr = upload(ScenarioReadStream, eicar)
+	assert.Equal(t, infected26960, rr.Body.String())
+	assert.EqualValues(t, 6, clamav.inStreamCalls.Load())
+
+	rr = upload(ScenarioReadStream, eicar)
+	assert.Contains(t, rr.Body.String(), `"cached":true`)
+	assert.EqualValues(t, 6, clamav.inStreamCalls.Load())
+
+	// The reload itself doesn't drop the verdicts, as Clamd
+	// may still run the previous database meanwhile
+	rr = do(ScenarioNoError, http.MethodPost, "/rest/v1/reload", "", nil, h.Reload)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = upload(ScenarioReadStream, eicar)
+	assert.Contains(t, rr.Body.String(), `"cached":true`)
+	assert.EqualValues(t, 6, clamav.inStreamCalls.Load())
+
+	// Until the new database is reported
+	h.Versions = clamd.NewVersionWatcher(clamav, 0, nil)
+	defer h.Versions.Close()
+	require.NoError(t, h.Versions.Refresh(ctx))
+
+	rr = upload(ScenarioReadStream, eicar)
+	assert.Equal(t, `{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"filename":"file.txt","size":68,`+eicarDetails+`,"engine_version":"1.0.1","database_version":26961}`, rr.Body.String())
+	assert.EqualValues(t, 7, clamav.inStreamCalls.Load())
+}
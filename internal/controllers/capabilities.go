@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// CapabilitiesResponse represents the json response of a /admin/capabilities endpoint.
+// It represents the commands supported by Clamd, as negotiated with "VERSIONCOMMANDS".
+type CapabilitiesResponse struct {
+	Known       bool       `json:"known"`
+	Version     string     `json:"clamav_version"`
+	Commands    []string   `json:"commands"`
+	RefreshedAt *time.Time `json:"refreshed_at"`
+	Error       string     `json:"error,omitempty"`
+}
+
+var ErrCapabilitiesNotConfigured = errors.New("capabilities negotiation disabled")
+
+func (h *Handler) CapabilitiesStatus(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	if h.Capabilities == nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", ErrCapabilitiesNotConfigured)
+
+		SetErrorResponse(w, ErrCapabilitiesNotConfigured)
+		return
+	}
+
+	status := h.Capabilities.Status()
+
+	capabilities := CapabilitiesResponse{
+		Known:    status.Known,
+		Version:  status.Version,
+		Commands: status.Commands,
+	}
+	if !status.RefreshedAt.IsZero() {
+		capabilities.RefreshedAt = &status.RefreshedAt
+	}
+	if status.Err != nil {
+		capabilities.Error = status.Err.Error()
+	}
+
+	resp, err := json.Marshal(&capabilities)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
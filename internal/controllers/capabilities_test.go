@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// newLimitedCapabilities returns capabilities negotiated with
+// a Clamd supporting neither DETSTATS, MULTISCAN nor ALLMATCHSCAN.
+func newLimitedCapabilities(t *testing.T) *clamd.Capabilities {
+	cp := clamd.NewCapabilities()
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioLimitedCommands)
+	if err := cp.Refresh(ctx, &MockClamav{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return cp
+}
+
+func TestHandlerCapabilitiesStatus(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	h := NewHandler(&logger, &MockClamav{})
+
+	req, err := http.NewRequest("GET", "/rest/v1/admin/capabilities", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Capabilities disabled
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.CapabilitiesStatus).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"not implemented: capabilities negotiation disabled"}`, rr.Body.String())
+
+	// Capabilities not known yet
+	h.Capabilities = clamd.NewCapabilities()
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(h.CapabilitiesStatus).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `{"known":false,"clamav_version":"","commands":[],"refreshed_at":null}`, rr.Body.String())
+
+	// Capabilities negotiated
+	h.Capabilities = newLimitedCapabilities(t)
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(h.CapabilitiesStatus).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `{"known":true,"clamav_version":"ClamAV 0.103.8/26963/Sat Jul  8 07:27:53 2023","commands":["CONTSCAN","END","INSTREAM","PING","QUIT","RELOAD","SCAN","SHUTDOWN","VERSION","VERSIONCOMMANDS"],"refreshed_at":"`)
+}
+
+func TestHandlerRequireCommand(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	h := NewHandler(&logger, &MockClamav{})
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)
+	req, err := http.NewRequestWithContext(ctx, "GET", "/rest/v1/detstats", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Everything is allowed without capabilities
+	rr := httptest.NewRecorder()
+	h.RequireCommand("DETSTATS")(http.HandlerFunc(h.DetStats)).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	h.Capabilities = newLimitedCapabilities(t)
+
+	rr = httptest.NewRecorder()
+	h.RequireCommand("DETSTATS")(http.HandlerFunc(h.DetStats)).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"not implemented: command not supported by clamav: DETSTATS"}`, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	h.RequireCommand("PING")(http.HandlerFunc(h.Ping)).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestHandlerUnsupportedScanModes(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	h := NewHandler(&logger, &MockClamav{})
+	h.ScanPathAllowlist = []string{"/data"}
+	h.SpoolDir = t.TempDir()
+	h.Capabilities = newLimitedCapabilities(t)
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)
+
+	// Scanning a path with a supported mode
+	req, err := http.NewRequestWithContext(ctx, "POST", "/rest/v1/scan/path", strings.NewReader(`{"path":"/data","mode":"contscan"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.ScanPath).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Scanning a path with an unsupported mode
+	req, err = http.NewRequestWithContext(ctx, "POST", "/rest/v1/scan/path", strings.NewReader(`{"path":"/data","mode":"multiscan"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(h.ScanPath).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"not implemented: command not supported by clamav: MULTISCAN"}`, rr.Body.String())
+
+	// Scanning all the matches of an upload
+	b := &bytes.Buffer{}
+	writer := multipart.NewWriter(b)
+	part, _ := writer.CreateFormFile("file", "file.txt")
+	io.Copy(part, strings.NewReader("foobar"))
+	writer.Close()
+
+	req, err = http.NewRequestWithContext(ctx, "POST", "/rest/v1/scan?allmatch=true", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(h.InStream).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"not implemented: command not supported by clamav: ALLMATCHSCAN"}`, rr.Body.String())
+}
+
+func TestHandlerReloadRefreshesCapabilities(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	h := NewHandler(&logger, &MockClamav{})
+	h.Capabilities = newLimitedCapabilities(t)
+	assert.False(t, h.Capabilities.Supports("DETSTATS"))
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)
+	req, err := http.NewRequestWithContext(ctx, "POST", "/rest/v1/reload", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.Reload).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, h.Capabilities.Supports("DETSTATS"))
+}
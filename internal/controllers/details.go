@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+)
+
+// ScanDetails represents the details of the scan of a file
+// reported along with its verdict, eg. for audit purposes.
+type ScanDetails struct {
+	// MIME type sniffed from the first bytes of the file
+	MIMEType string `json:"mime_type,omitempty"`
+
+	// Hex-encoded hashes of the file, empty if it wasn't read until the end
+	MD5    string `json:"md5,omitempty"`
+	SHA1   string `json:"sha1,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Duration of the scan, in milliseconds
+	ScanDuration float64 `json:"scan_duration_ms"`
+
+	// Versions of the Clamav engine and signature database which made the verdict, if known
+	Engine   string `json:"engine_version,omitempty"`
+	Database int    `json:"database_version,omitempty"`
+
+	// Rule of the scan policy which matched the file, if any
+	Policy *PolicyMatch `json:"policy,omitempty"`
+
+	// Id of the item of the quarantine the infected file was saved as, if any
+	QuarantineID string `json:"quarantine_id,omitempty"`
+
+	// Time the scan started at
+	start time.Time
+
+	// Version of Clamd when the scan started, if known, and Clamd
+	// backend the content was sent to when balanced across several
+	version *clamd.Version
+	trace   *clamd.BackendTrace
+
+	// Content of the file, if it must be quarantined when infected
+	source *quarantineSource
+}
+
+// newScanDetails returns the details of a scan starting now.
+func (h *Handler) newScanDetails() ScanDetails {
+	details := ScanDetails{start: h.clock.Now(), trace: &clamd.BackendTrace{}}
+	if h.Versions != nil {
+		details.version = h.Versions.Version()
+	}
+
+	return details
+}
+
+// scanContext returns a copy of ctx with which the content must be
+// sent to Clamd, to record the backend which made the verdict.
+func (d *ScanDetails) scanContext(ctx context.Context) context.Context {
+	if d.trace == nil {
+		return ctx
+	}
+	return clamd.WithBackendTrace(ctx, d.trace)
+}
+
+// scanVersion returns the version of Clamd which made the verdict, if known:
+// the version of the backend the content was sent to when balanced across
+// several Clamd, which may lag behind the others, and the version of Clamd
+// when the scan started otherwise.
+func (d *ScanDetails) scanVersion() *clamd.Version {
+	if d.trace != nil {
+		if name, v := d.trace.Backend(); name != "" {
+			return v
+		}
+	}
+	return d.version
+}
+
+// finishScanDetails records in details the duration of the
+// scan and the version of Clamd which made the verdict.
+func (h *Handler) finishScanDetails(details *ScanDetails) {
+	details.ScanDuration = float64(h.clock.Now().Sub(details.start)) / float64(time.Millisecond)
+
+	if v := details.scanVersion(); v != nil {
+		details.Engine = v.Engine
+		details.Database = v.Database
+	}
+}
+
+// sniffLen is the number of bytes needed to sniff a MIME type.
+const sniffLen = 512
+
+// digester is an io.Writer computing the hashes of the content written
+// to it, and sniffing its MIME type, in a single pass.
+type digester struct {
+	md5    hash.Hash
+	sha1   hash.Hash
+	sha256 hash.Hash
+
+	// First bytes of the content
+	head []byte
+}
+
+func newDigester() *digester {
+	return &digester{md5: md5.New(), sha1: sha1.New(), sha256: sha256.New()}
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	d.md5.Write(p)
+	d.sha1.Write(p)
+	d.sha256.Write(p)
+
+	if n := min(sniffLen-len(d.head), len(p)); n > 0 {
+		d.head = append(d.head, p[:n]...)
+	}
+	return len(p), nil
+}
+
+// fill records in details the hashes and the MIME type of the content written.
+func (d *digester) fill(details *ScanDetails) {
+	details.MIMEType = policy.DetectContentType(d.head)
+	details.MD5 = hex.EncodeToString(d.md5.Sum(nil))
+	details.SHA1 = hex.EncodeToString(d.sha1.Sum(nil))
+	details.SHA256 = hex.EncodeToString(d.sha256.Sum(nil))
+}
+
+// digestFile digests the content of f and rewinds it to be read again.
+func digestFile(f io.ReadSeeker) (*digester, error) {
+	d := newDigester()
+	if _, err := io.Copy(d, f); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// sniffFile returns the MIME type sniffed from the first
+// bytes of f, and rewinds it to be read again.
+func sniffFile(f io.ReadSeeker) (string, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return policy.DetectContentType(head[:n]), nil
+}
+
+// digestReader is an io.Reader digesting and counting the bytes read from r.
+type digestReader struct {
+	r   io.Reader
+	d   *digester
+	n   int64
+	eof bool
+}
+
+func newDigestReader(r io.Reader) *digestReader {
+	return &digestReader{r: r, d: newDigester()}
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.d.Write(p[:n])
+	d.n += int64(n)
+	if err == io.EOF {
+		d.eof = true
+	}
+	return n, err
+}
+
+// Seek only reports the current offset and rewinds to the offset r was at
+// when wrapped, the digest being then started over, so that the content can
+// be sent to Clamd again when a scan is retried. r must be an io.Seeker.
+func (d *digestReader) Seek(offset int64, whence int) (int64, error) {
+	s, ok := d.r.(io.Seeker)
+	if !ok {
+		return 0, errors.New("digest reader: the content can't be rewound")
+	}
+
+	switch {
+	case offset == 0 && whence == io.SeekCurrent:
+		return d.n, nil
+	case offset == 0 && whence == io.SeekStart:
+		if _, err := s.Seek(-d.n, io.SeekCurrent); err != nil {
+			return 0, err
+		}
+		d.d, d.n, d.eof = newDigester(), 0, false
+		return 0, nil
+	default:
+		return 0, errors.New("digest reader: only rewinding is supported")
+	}
+}
+
+// fill records in details the MIME type of the content read, if
+// any, and its hashes if it was read until the end.
+func (d *digestReader) fill(details *ScanDetails) {
+	if !d.eof {
+		if len(d.d.head) > 0 {
+			details.MIMEType = policy.DetectContentType(d.d.head)
+		}
+		return
+	}
+	d.d.fill(details)
+}
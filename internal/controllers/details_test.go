@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/cache"
+	"github.com/lescactus/clamav-api-go/internal/history"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Details of the scan of an empty file, of "foo", of "foobar" and of the
+// EICAR test file, as reported by a handler whose clock is testClock.
+const (
+	fooDetails    = `"mime_type":"text/plain; charset=utf-8","md5":"acbd18db4cc2f85cedef654fccc4a4d8","sha1":"0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33","sha256":"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae","scan_duration_ms":0`
+	emptyDetails  = `"mime_type":"text/plain; charset=utf-8","md5":"d41d8cd98f00b204e9800998ecf8427e","sha1":"da39a3ee5e6b4b0d3255bfef95601890afd80709","sha256":"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855","scan_duration_ms":0`
+	foobarDetails = `"mime_type":"text/plain; charset=utf-8","md5":"3858f62230ac3c915f300c664312c63f","sha1":"8843d7f92416211de9ebb963ff4ce28125932878","sha256":"c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2","scan_duration_ms":0`
+	eicarDetails  = `"mime_type":"text/plain; charset=utf-8","md5":"44d88612fea8a8f36de82e1278abb02f","sha1":"3395856ce81f2b7382dee72602f798b642f14140","sha256":"` + eicarSHA256 + `","scan_duration_ms":0`
+)
+
+func TestDigestFile(t *testing.T) {
+	f := strings.NewReader("\x89PNG\r\n\x1a\nfoobar")
+
+	d, err := digestFile(f)
+	require.NoError(t, err)
+
+	var details ScanDetails
+	d.fill(&details)
+	assert.Equal(t, "image/png", details.MIMEType)
+	assert.Equal(t, "91848ec17e918fcf1bb1e2127dac2cb4", details.MD5)
+	assert.Len(t, details.SHA1, 40)
+	assert.Len(t, details.SHA256, 64)
+
+	// The file is rewound
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "\x89PNG\r\n\x1a\nfoobar", string(b))
+}
+
+func TestDigestReader(t *testing.T) {
+	content := strings.Repeat("a", 2*sniffLen)
+
+	// Read until the end
+	r := newDigestReader(strings.NewReader(content))
+	_, err := io.Copy(io.Discard, r)
+	require.NoError(t, err)
+
+	var details ScanDetails
+	r.fill(&details)
+	assert.EqualValues(t, 2*sniffLen, r.n)
+	assert.Equal(t, "text/plain; charset=utf-8", details.MIMEType)
+	assert.NotEmpty(t, details.MD5)
+	assert.NotEmpty(t, details.SHA1)
+	assert.NotEmpty(t, details.SHA256)
+
+	// Read partially: the hashes would be the ones of a part of the content
+	r = newDigestReader(strings.NewReader(content))
+	_, err = io.CopyN(io.Discard, r, sniffLen+1)
+	require.NoError(t, err)
+
+	details = ScanDetails{}
+	r.fill(&details)
+	assert.EqualValues(t, sniffLen+1, r.n)
+	assert.Equal(t, "text/plain; charset=utf-8", details.MIMEType)
+	assert.Empty(t, details.MD5)
+	assert.Empty(t, details.SHA1)
+	assert.Empty(t, details.SHA256)
+
+	// Rewound to its offset when wrapped and read again
+	sr := strings.NewReader("foo" + content)
+	sr.Seek(3, io.SeekStart)
+	r = newDigestReader(sr)
+	_, err = io.CopyN(io.Discard, r, sniffLen+1)
+	require.NoError(t, err)
+
+	offset, err := r.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.EqualValues(t, sniffLen+1, offset)
+	offset, err = r.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, offset)
+
+	_, err = io.Copy(io.Discard, r)
+	require.NoError(t, err)
+
+	rewound := ScanDetails{}
+	r.fill(&rewound)
+	assert.EqualValues(t, 2*sniffLen, r.n)
+	assert.Equal(t, details.MIMEType, rewound.MIMEType)
+	d, err := digestFile(strings.NewReader(content))
+	require.NoError(t, err)
+	d.fill(&details)
+	assert.Equal(t, details.SHA256, rewound.SHA256)
+
+	_, err = r.Seek(1, io.SeekStart)
+	assert.Error(t, err)
+
+	// Not rewound when the content can't be
+	_, err = newDigestReader(io.MultiReader(strings.NewReader(content))).Seek(0, io.SeekCurrent)
+	assert.Error(t, err)
+}
+
+func TestSniffFile(t *testing.T) {
+	f := strings.NewReader("%PDF-1.7")
+	mimeType, err := sniffFile(f)
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", mimeType)
+
+	// Rewound
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF-1.7", string(b))
+}
+
+func TestHandlerFinishScanDetails(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	now := testClock()
+	h := NewHandler(&logger, mockClamav)
+	h.clock = func() time.Time { return now }
+
+	details := h.newScanDetails()
+	now = now.Add(1500 * time.Microsecond)
+
+	// The version of Clamd isn't known
+	h.finishScanDetails(&details)
+	assert.Equal(t, 1.5, details.ScanDuration)
+	assert.Empty(t, details.Engine)
+	assert.Zero(t, details.Database)
+
+	h.Versions = clamd.NewVersionWatcher(mockClamav, 0, nil)
+	defer h.Versions.Close()
+	require.NoError(t, h.Versions.Refresh(context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)))
+
+	// The version is the one of Clamd when the scan started
+	h.finishScanDetails(&details)
+	assert.Empty(t, details.Engine)
+	assert.Zero(t, details.Database)
+
+	details = h.newScanDetails()
+	h.finishScanDetails(&details)
+	assert.Equal(t, "1.0.1", details.Engine)
+	assert.Equal(t, 26961, details.Database)
+}
+
+// outdatedClamav is a Clamaver whose signature database
+// lags behind the one of MockClamav.
+type outdatedClamav struct {
+	clamd.Clamaver
+}
+
+func (c *outdatedClamav) Version(ctx context.Context) ([]byte, error) {
+	return []byte("ClamAV 1.0.1/26960/Wed Jul  5 07:29:38 2023"), nil
+}
+
+func TestHandlerScanVersionBalanced(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	balancer := clamd.NewClamavBalancer([]*clamd.Backend{
+		{Name: "outdated", Clamav: &outdatedClamav{Clamaver: mockClamav}},
+		{Name: "updated", Clamav: mockClamav},
+	}, clamd.BalancerRoundRobin, 0)
+	defer balancer.Close()
+
+	h := NewHandler(&logger, balancer)
+	h.clock = testClock
+	h.History = history.NewMemoryStore(0)
+	var err error
+	h.Cache, err = cache.New(cache.Options{Size: 10, TTL: time.Hour})
+	require.NoError(t, err)
+	h.Versions = clamd.NewVersionWatcher(balancer, 0, nil)
+	defer h.Versions.Close()
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)
+	require.NoError(t, h.Versions.Refresh(ctx))
+	assert.Equal(t, 26961, h.Versions.Version().Database)
+
+	// The verdicts are reported and recorded with the version
+	// of the backend which made them, not the most recent one
+	for _, database := range []int{26960, 26961} {
+		details := h.newScanDetails()
+		details.SHA256 = eicarSHA256
+		inStream, err := balancer.InStream(details.scanContext(ctx), strings.NewReader("foobar"))
+		require.NoError(t, err)
+
+		h.recordVerdict("cimuf5d3d0kc73ahh5h0", &details, inStream, err)
+		h.finishScanDetails(&details)
+		assert.Equal(t, "1.0.1", details.Engine)
+		assert.Equal(t, database, details.Database)
+
+		record, err := h.History.Get(eicarSHA256)
+		require.NoError(t, err)
+		assert.Equal(t, database, record.Database)
+
+		// The verdicts of the outdated backend aren't served from the cache
+		lookup := h.newScanDetails()
+		lookup.SHA256 = eicarSHA256
+		_, ok := h.cachedVerdict(&lookup)
+		assert.Equal(t, database == 26961, ok)
+	}
+}
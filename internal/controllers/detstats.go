@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// DetStatsResponse represents the json response of a /detstats endpoint.
+// It represents the statistics about the latest detections made by Clamd.
+type DetStatsResponse struct {
+	Detections []DetStatsDetection `json:"detections"`
+}
+
+// DetStatsDetection represents a single detection
+// reported by Clamd.
+type DetStatsDetection struct {
+	Time      time.Time `json:"time"`
+	MD5       string    `json:"md5"`
+	Size      int64     `json:"size"`
+	Signature string    `json:"signature"`
+	FileName  string    `json:"filename"`
+	Backend   string    `json:"backend,omitempty"`
+}
+
+// DetStatsClearResponse represents the json response of a /detstats/clear endpoint.
+type DetStatsClearResponse struct {
+	Status string `json:"status"`
+}
+
+func (h *Handler) DetStats(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	ctx := r.Context()
+
+	stats, err := h.Clamav.DetStats(ctx)
+	if err != nil {
+		h.Logger.Error().Str("req_id", req_id.String()).Msgf("error while sending detstats command: %v", err)
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	h.Logger.Debug().Str("req_id", req_id.String()).Msg("detstats command sent successfully")
+
+	detStats := DetStatsResponse{
+		Detections: make([]DetStatsDetection, 0, len(stats)),
+	}
+	for _, s := range stats {
+		detStats.Detections = append(detStats.Detections, DetStatsDetection{
+			Time:      s.Time,
+			MD5:       s.MD5,
+			Size:      s.Size,
+			Signature: s.Signature,
+			FileName:  s.FileName,
+			Backend:   s.Backend,
+		})
+	}
+
+	resp, err := json.Marshal(&detStats)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+func (h *Handler) DetStatsClear(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	ctx := r.Context()
+
+	err := h.Clamav.DetStatsClear(ctx)
+	if err != nil {
+		h.Logger.Error().Str("req_id", req_id.String()).Msgf("error while sending detstatsclear command: %v", err)
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	h.Logger.Debug().Str("req_id", req_id.String()).Msg("detstatsclear command sent successfully")
+
+	clear := DetStatsClearResponse{
+		Status: "CLEARED",
+	}
+
+	resp, err := json.Marshal(&clear)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerDetStats(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	type args struct {
+		scenario MockScenario
+	}
+	type want struct {
+		status int
+		body   []byte
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "no error",
+			args: args{
+				scenario: ScenarioNoError,
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"detections":[{"time":"2023-07-06T07:29:38Z","md5":"44d88612fea8a8f36de82e1278abb02f","size":68,"signature":"Win.Test.EICAR_HDB-1","filename":"eicar.txt"}]}`),
+			},
+		},
+		{
+			name: "no detection",
+			args: args{
+				scenario: ScenarioDetStatsEmpty,
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"detections":[]}`),
+			},
+		},
+		{
+			name: "detection of a backend",
+			args: args{
+				scenario: ScenarioDetStatsBackends,
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"detections":[{"time":"2023-07-06T07:29:38Z","md5":"44d88612fea8a8f36de82e1278abb02f","size":68,"signature":"Win.Test.EICAR_HDB-1","filename":"eicar.txt","backend":"10.0.0.1:3310"}]}`),
+			},
+		},
+		{
+			name: "error is net error",
+			args: args{
+				scenario: ScenarioNetError,
+			},
+			want: want{
+				status: http.StatusBadGateway,
+				body:   []byte(`{"status":"error","msg":"something wrong happened while communicating with clamav"}`),
+			},
+		},
+		{
+			name: "error is ErrUnknownCommand",
+			args: args{
+				scenario: ScenarioErrUnknownCommand,
+			},
+			want: want{
+				status: http.StatusInternalServerError,
+				body:   []byte(`{"status":"error","msg":"unknown command sent to clamav"}`),
+			},
+		},
+		{
+			name: "error is ErrUnknownResponse",
+			args: args{
+				scenario: ScenarioErrUnknownResponse,
+			},
+			want: want{
+				status: http.StatusInternalServerError,
+				body:   []byte(`{"status":"error","msg":"unknown response from clamav"}`),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, mockClamav)
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(h.DetStats)
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.args.scenario)
+			req, err := http.NewRequestWithContext(ctx, "GET", "/rest/v1/detstats", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handler.ServeHTTP(rr, req)
+
+			resp := rr.Result()
+			body, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.want.status, resp.StatusCode)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want.body, body)
+		})
+	}
+}
+
+func TestHandlerDetStatsClear(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	type args struct {
+		scenario MockScenario
+	}
+	type want struct {
+		status int
+		body   []byte
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "no error",
+			args: args{
+				scenario: ScenarioNoError,
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"status":"CLEARED"}`),
+			},
+		},
+		{
+			name: "error is net error",
+			args: args{
+				scenario: ScenarioNetError,
+			},
+			want: want{
+				status: http.StatusBadGateway,
+				body:   []byte(`{"status":"error","msg":"something wrong happened while communicating with clamav"}`),
+			},
+		},
+		{
+			name: "error is ErrUnknownCommand",
+			args: args{
+				scenario: ScenarioErrUnknownCommand,
+			},
+			want: want{
+				status: http.StatusInternalServerError,
+				body:   []byte(`{"status":"error","msg":"unknown command sent to clamav"}`),
+			},
+		},
+		{
+			name: "error is ErrUnexpectedResponse",
+			args: args{
+				scenario: ScenarioErrUnexpectedResponse,
+			},
+			want: want{
+				status: http.StatusInternalServerError,
+				body:   []byte(`{"status":"error","msg":"unexpected response from clamav"}`),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, mockClamav)
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(h.DetStatsClear)
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.args.scenario)
+			req, err := http.NewRequestWithContext(ctx, "POST", "/rest/v1/detstats/clear", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handler.ServeHTTP(rr, req)
+
+			resp := rr.Result()
+			body, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.want.status, resp.StatusCode)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want.body, body)
+		})
+	}
+}
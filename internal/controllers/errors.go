@@ -3,10 +3,18 @@ package controllers
 import (
 	"encoding/json"
 	"errors"
+	"math"
 	"net"
 	"net/http"
+	"strconv"
+	"time"
 
-	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/archive"
+	"github.com/lescactus/clamav-api-go/internal/fetcher"
+	"github.com/lescactus/clamav-api-go/internal/history"
+	"github.com/lescactus/clamav-api-go/internal/jobs"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
 )
 
 // ErrorResponse represents the json response
@@ -35,24 +43,61 @@ func SetErrorResponse(w http.ResponseWriter, err error) {
 
 	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
 
-	if isNetError(err) {
+	var maxBytesErr *http.MaxBytesError
+
+	if errors.As(err, &maxBytesErr) {
+		errResp = NewErrorResponse("request entity too large: " + maxBytesErr.Error())
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	} else if errors.Is(err, ErrFetchURL) {
+		setFetchErrorResponse(w, err)
+		return
+	} else if isNetError(err) {
 		errResp = NewErrorResponse("something wrong happened while communicating with clamav")
 		w.WriteHeader(http.StatusBadGateway)
-	} else if errors.Is(err, ErrFormFile) || errors.Is(err, ErrOpenFileHeaders) {
+	} else if errors.Is(err, ErrFormFile) || errors.Is(err, ErrOpenFileHeaders) || errors.Is(err, ErrScanPathRequest) || errors.Is(err, clamd.ErrInvalidPath) ||
+		errors.Is(err, ErrQueryParam) || errors.Is(err, ErrScanURLRequest) || errors.Is(err, ErrInvalidHash) {
 		errResp = NewErrorResponse("bad request: " + err.Error())
 		w.WriteHeader((http.StatusBadRequest))
+	} else if errors.Is(err, ErrAdminUnauthorized) {
+		errResp = NewErrorResponse("unauthorized: " + err.Error())
+		w.WriteHeader((http.StatusUnauthorized))
+	} else if errors.Is(err, ErrScanPathNotAllowed) || errors.Is(err, ErrPolicyDenied) {
+		errResp = NewErrorResponse("forbidden: " + err.Error())
+		w.WriteHeader((http.StatusForbidden))
+	} else if errors.Is(err, clamd.ErrCircuitOpen) {
+		var openErr *clamd.CircuitOpenError
+		if errors.As(err, &openErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(openErr.RetryAfter)))
+		}
+		errResp = NewErrorResponse("service unavailable: " + err.Error())
+		w.WriteHeader((http.StatusServiceUnavailable))
+	} else if errors.Is(err, archive.ErrLimitExceeded) || errors.Is(err, archive.ErrInvalidArchive) || errors.Is(err, clamd.ErrScanPath) {
+		errResp = NewErrorResponse("unprocessable entity: " + err.Error())
+		w.WriteHeader((http.StatusUnprocessableEntity))
+	} else if errors.Is(err, jobs.ErrJobNotFound) || errors.Is(err, history.ErrNotFound) || errors.Is(err, quarantine.ErrNotFound) {
+		errResp = NewErrorResponse("not found: " + err.Error())
+		w.WriteHeader((http.StatusNotFound))
+	} else if errors.Is(err, clamd.ErrNoBackendAvailable) || errors.Is(err, jobs.ErrQueueFull) || errors.Is(err, jobs.ErrClosed) {
+		errResp = NewErrorResponse("service unavailable: " + err.Error())
+		w.WriteHeader((http.StatusServiceUnavailable))
+	} else if errors.Is(err, ErrSpoolDirNotConfigured) || errors.Is(err, ErrBreakerNotConfigured) || errors.Is(err, clamd.ErrUnsupportedCommand) ||
+		errors.Is(err, ErrCapabilitiesNotConfigured) || errors.Is(err, ErrFetcherNotConfigured) ||
+		errors.Is(err, ErrJobsNotConfigured) || errors.Is(err, ErrWebhooksNotConfigured) || errors.Is(err, ErrArchivesNotConfigured) ||
+		errors.Is(err, ErrHistoryNotConfigured) || errors.Is(err, ErrQuarantineNotConfigured) {
+		errResp = NewErrorResponse("not implemented: " + err.Error())
+		w.WriteHeader((http.StatusNotImplemented))
 	} else {
 		switch err {
-		case clamav.ErrUnknownCommand:
+		case clamd.ErrUnknownCommand:
 			errResp = NewErrorResponse("unknown command sent to clamav")
 			w.WriteHeader((http.StatusInternalServerError))
-		case clamav.ErrUnknownResponse:
+		case clamd.ErrUnknownResponse:
 			errResp = NewErrorResponse(err.Error())
 			w.WriteHeader((http.StatusInternalServerError))
-		case clamav.ErrUnexpectedResponse:
+		case clamd.ErrUnexpectedResponse:
 			errResp = NewErrorResponse(err.Error())
 			w.WriteHeader((http.StatusInternalServerError))
-		case clamav.ErrScanFileSizeLimitExceeded:
+		case clamd.ErrScanFileSizeLimitExceeded:
 			errResp = NewErrorResponse("clamav: " + err.Error())
 			w.WriteHeader((http.StatusInternalServerError))
 		default:
@@ -65,9 +110,52 @@ func SetErrorResponse(w http.ResponseWriter, err error) {
 	w.Write(resp)
 }
 
+// setFetchErrorResponse sets the response of an error which
+// occurred while fetching the content of a url to scan.
+//
+// Unlike the other errors, a network error means that the remote
+// server couldn't be reached rather than Clamd.
+func setFetchErrorResponse(w http.ResponseWriter, err error) {
+	var errResp *ErrorResponse
+
+	switch {
+	case errors.Is(err, fetcher.ErrInvalidURL):
+		errResp = NewErrorResponse("bad request: " + err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, fetcher.ErrURLNotAllowed):
+		errResp = NewErrorResponse("forbidden: " + err.Error())
+		w.WriteHeader(http.StatusForbidden)
+	case errors.Is(err, fetcher.ErrContentTooLarge):
+		errResp = NewErrorResponse("request entity too large: " + err.Error())
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	case isTimeout(err):
+		errResp = NewErrorResponse("gateway timeout: " + err.Error())
+		w.WriteHeader(http.StatusGatewayTimeout)
+	default:
+		errResp = NewErrorResponse("bad gateway: " + err.Error())
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	resp, _ := json.Marshal(errResp)
+	w.Write(resp)
+}
+
+// retryAfterSeconds returns d as a number of seconds
+// suitable for the Retry-After header, rounded up.
+func retryAfterSeconds(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
+
 // isNetError returns true if the error
 // is a net.Error
 func isNetError(err error) bool {
 	var e net.Error
 	return errors.As(err, &e)
 }
+
+// isTimeout returns true if the error
+// is a net.Error caused by a timeout
+func isTimeout(err error) bool {
+	var e net.Error
+	return errors.As(err, &e) && e.Timeout()
+}
@@ -2,13 +2,19 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/lescactus/clamav-api-go/internal/archive"
+	"github.com/lescactus/clamav-api-go/internal/history"
+	"github.com/lescactus/clamav-api-go/internal/jobs"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -110,6 +116,41 @@ func TestSetErrorResponse(t *testing.T) {
 			args: args{&net.OpError{}},
 			want: want{http.StatusBadGateway, "application/json", []byte(`{"status":"error","msg":"something wrong happened while communicating with clamav"}`)},
 		},
+		{
+			name: "error is ErrCircuitOpen",
+			args: args{fmt.Errorf("error from clamav: %w", &clamd.CircuitOpenError{RetryAfter: 1500 * time.Millisecond})},
+			want: want{http.StatusServiceUnavailable, "application/json", []byte(`{"status":"error","msg":"service unavailable: error from clamav: circuit breaker open: retry after 1.5s"}`)},
+		},
+		{
+			name: "error is ErrNoBackendAvailable",
+			args: args{clamd.ErrNoBackendAvailable},
+			want: want{http.StatusServiceUnavailable, "application/json", []byte(`{"status":"error","msg":"service unavailable: no clamd backend available"}`)},
+		},
+		{
+			name: "error is ErrJobNotFound",
+			args: args{fmt.Errorf("%w: %q", jobs.ErrJobNotFound, "foobar")},
+			want: want{http.StatusNotFound, "application/json", []byte(`{"status":"error","msg":"not found: job not found: \"foobar\""}`)},
+		},
+		{
+			name: "error is history.ErrNotFound",
+			args: args{fmt.Errorf("%w: %q", history.ErrNotFound, "foobar")},
+			want: want{http.StatusNotFound, "application/json", []byte(`{"status":"error","msg":"not found: hash not found: \"foobar\""}`)},
+		},
+		{
+			name: "error is ErrQueueFull",
+			args: args{jobs.ErrQueueFull},
+			want: want{http.StatusServiceUnavailable, "application/json", []byte(`{"status":"error","msg":"service unavailable: job queue is full"}`)},
+		},
+		{
+			name: "error is ErrLimitExceeded",
+			args: args{fmt.Errorf("%w: more than 3 nested archives", archive.ErrLimitExceeded)},
+			want: want{http.StatusUnprocessableEntity, "application/json", []byte(`{"status":"error","msg":"unprocessable entity: archive limit exceeded: more than 3 nested archives"}`)},
+		},
+		{
+			name: "error is ErrScanPath",
+			args: args{fmt.Errorf("%w: /foo: lstat() failed: No such file or directory.", clamd.ErrScanPath)},
+			want: want{http.StatusUnprocessableEntity, "application/json", []byte(`{"status":"error","msg":"unprocessable entity: error while scanning path: /foo: lstat() failed: No such file or directory."}`)},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -124,3 +165,17 @@ func TestSetErrorResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestSetErrorResponseRetryAfter(t *testing.T) {
+	rr := httptest.NewRecorder()
+	SetErrorResponse(rr, &clamd.CircuitOpenError{RetryAfter: 1500 * time.Millisecond})
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+
+	rr = httptest.NewRecorder()
+	SetErrorResponse(rr, &clamd.CircuitOpenError{RetryAfter: time.Millisecond})
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+	rr = httptest.NewRecorder()
+	SetErrorResponse(rr, clamd.ErrNoBackendAvailable)
+	assert.Empty(t, rr.Header().Get("Retry-After"))
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/lescactus/clamav-api-go/internal/archive"
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog/hlog"
+)
+
+// ArchiveEntry represents the result of the scan of an entry
+// of an archive, and of its own entries if it is an archive too.
+type ArchiveEntry struct {
+	Name      string         `json:"name"`
+	Size      int64          `json:"size"`
+	Verdict   string         `json:"verdict"`
+	Signature string         `json:"signature"`
+	Error     string         `json:"error,omitempty"`
+	Entries   []ArchiveEntry `json:"entries,omitempty"`
+}
+
+var ErrArchivesNotConfigured = errors.New("archive expansion is not enabled")
+
+// inStreamExpand will scan the uploaded file f with the "INSTREAM" command and,
+// if it is an archive, expand it to scan each of its entries the same way.
+//
+// The response contains the tree of the verdicts of the entries, so that the
+// infected ones can be told apart. The webhooks are notified of the result of
+// the scan of file as a whole.
+func (h *Handler) inStreamExpand(w http.ResponseWriter, r *http.Request, f io.ReaderAt, size int64, callbackURL string, file webhook.File, details ScanDetails) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	if h.Archives == nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msg(ErrArchivesNotConfigured.Error())
+
+		SetErrorResponse(w, ErrArchivesNotConfigured)
+		return
+	}
+
+	ctx := details.scanContext(r.Context())
+
+	result, err := clamd.ScanStream(ctx, h.Clamav, io.NewSectionReader(f, 0, size))
+	if err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Err(err).Msg("error while scanning file")
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	entries, err := h.Archives.Expand(ctx, f, size, file.Name)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Err(err).Msg("error while expanding archive")
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	inStreamResp := InStreamResponse{
+		Status:      "noerror",
+		Msg:         string(clamd.RespScan),
+		Signature:   "",
+		VirusFound:  false,
+		Entries:     archiveEntries(entries),
+		ScanDetails: details,
+	}
+	if signature := firstSignature(result, entries); signature != "" {
+		inStreamResp.Status = "error"
+		inStreamResp.Msg = clamd.ErrVirusFound.Error()
+		inStreamResp.Signature = signature
+		inStreamResp.VirusFound = true
+	}
+
+	h.Logger.Debug().Str("req_id", req_id.String()).Int("entries", len(entries)).Msg("file scanned successfully")
+
+	h.writeVerdict(w, req_id.String(), callbackURL, file, inStreamResp)
+}
+
+// archiveEntries returns the json representation of entries.
+func archiveEntries(entries []*archive.Entry) []ArchiveEntry {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	res := make([]ArchiveEntry, 0, len(entries))
+	for _, e := range entries {
+		entry := ArchiveEntry{
+			Name:    e.Name,
+			Size:    e.Size,
+			Verdict: VerdictClean,
+			Entries: archiveEntries(e.Entries),
+		}
+		if e.Err != nil {
+			entry.Verdict = VerdictError
+			entry.Error = e.Err.Error()
+		}
+		if e.Result != nil {
+			entry.Verdict = VerdictInfected
+			entry.Signature = e.Result.Signature
+		}
+		res = append(res, entry)
+	}
+
+	return res
+}
+
+// firstSignature returns the signature of result, if any,
+// or else the one of the first infected entry.
+func firstSignature(result *clamd.ScanResult, entries []*archive.Entry) string {
+	if result != nil {
+		return result.Signature
+	}
+	for _, e := range entries {
+		if s := firstSignature(e.Result, e.Entries); s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lescactus/clamav-api-go/internal/archive"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestZip(t *testing.T, files map[string]string, names ...string) string {
+	b := &bytes.Buffer{}
+	zw := zip.NewWriter(b)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		io.WriteString(w, files[name])
+	}
+	require.NoError(t, zw.Close())
+
+	return b.String()
+}
+
+func TestHandlerInStreamExpand(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	limits := archive.Limits{MaxDepth: 2, MaxEntries: 10, MaxSize: 1024 * 1024}
+
+	infected := newTestZip(t, map[string]string{
+		"readme.txt":  "foobar",
+		"nested.zip":  newTestZip(t, map[string]string{"eicar.com": eicar}, "eicar.com"),
+		"license.txt": "foo",
+	}, "readme.txt", "nested.zip", "license.txt")
+
+	type args struct {
+		scenario MockScenario
+		limits   *archive.Limits
+		query    string
+		content  string
+	}
+	type want struct {
+		status int
+		body   string
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "infected entry",
+			args: args{
+				scenario: ScenarioReadStream,
+				limits:   &limits,
+				query:    "expand=true",
+				content:  infected,
+			},
+			want: want{
+				status: http.StatusOK,
+				body: `{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"filename":"archive.zip","size":539,` +
+					`"mime_type":"application/zip","md5":"886fd2fb6d4b50a9574fc07cb8daed69","sha1":"6162f170e9bfdf6243c4ce432249428420c3d81e","sha256":"f3bc43dccedb33da9c60220680d53c02681067ad9c1853a150eee17a9071e113","scan_duration_ms":0,"entries":[` +
+					`{"name":"readme.txt","size":6,"verdict":"clean","signature":""},` +
+					`{"name":"nested.zip","size":207,"verdict":"infected","signature":"Win.Test.EICAR_HDB-1","entries":[{"name":"eicar.com","size":68,"verdict":"infected","signature":"Win.Test.EICAR_HDB-1"}]},` +
+					`{"name":"license.txt","size":3,"verdict":"clean","signature":""}]}`,
+			},
+		},
+		{
+			name: "not an archive",
+			args: args{
+				scenario: ScenarioReadStream,
+				limits:   &limits,
+				query:    "expand=true",
+				content:  "foobar",
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"filename":"archive.zip","size":6,` + foobarDetails + `}`,
+			},
+		},
+		{
+			name: "limit exceeded",
+			args: args{
+				scenario: ScenarioReadStream,
+				limits:   &archive.Limits{MaxDepth: 1, MaxEntries: 10, MaxSize: 1024},
+				query:    "expand=true",
+				content:  infected,
+			},
+			want: want{
+				status: http.StatusUnprocessableEntity,
+				body:   `{"status":"error","msg":"unprocessable entity: archive limit exceeded: more than 1 nested archives"}`,
+			},
+		},
+		{
+			name: "expansion not configured",
+			args: args{
+				scenario: ScenarioReadStream,
+				query:    "expand=true",
+				content:  infected,
+			},
+			want: want{
+				status: http.StatusNotImplemented,
+				body:   `{"status":"error","msg":"not implemented: archive expansion is not enabled"}`,
+			},
+		},
+		{
+			name: "combined with allmatch",
+			args: args{
+				scenario: ScenarioReadStream,
+				limits:   &limits,
+				query:    "expand=true&allmatch=true",
+				content:  infected,
+			},
+			want: want{
+				status: http.StatusBadRequest,
+				body:   `{"status":"error","msg":"bad request: invalid query parameter: allmatch and expand can't be combined"}`,
+			},
+		},
+		{
+			name: "error is net error",
+			args: args{
+				scenario: ScenarioNetError,
+				limits:   &limits,
+				query:    "expand=true",
+				content:  infected,
+			},
+			want: want{
+				status: http.StatusBadGateway,
+				body:   `{"status":"error","msg":"something wrong happened while communicating with clamav"}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, mockClamav)
+			h.clock = testClock
+			if tt.args.limits != nil {
+				h.Archives = archive.NewScanner(&scenarioClamav{MockClamav: mockClamav, scenario: tt.args.scenario}, *tt.args.limits, t.TempDir())
+			}
+
+			rr := httptest.NewRecorder()
+
+			b := &bytes.Buffer{}
+			writer := multipart.NewWriter(b)
+			part, _ := writer.CreateFormFile("file", "archive.zip")
+			io.Copy(part, strings.NewReader(tt.args.content))
+			writer.Close()
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.args.scenario)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan?"+tt.args.query, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			h.InStream(rr, req)
+
+			assert.Equal(t, tt.want.status, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want.body, rr.Body.String())
+		})
+	}
+}
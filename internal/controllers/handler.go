@@ -1,10 +1,28 @@
 package controllers
 
 import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/justinas/alice"
+	"github.com/lescactus/clamav-api-go/internal/archive"
+	"github.com/lescactus/clamav-api-go/internal/cache"
+	"github.com/lescactus/clamav-api-go/internal/fetcher"
+	"github.com/lescactus/clamav-api-go/internal/helper"
+	"github.com/lescactus/clamav-api-go/internal/history"
+	"github.com/lescactus/clamav-api-go/internal/jobs"
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/xid"
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
 )
 
 const (
@@ -13,11 +31,59 @@ const (
 )
 
 type Handler struct {
-	Clamav clamav.Clamaver
+	Clamav clamd.Clamaver
 	Logger *zerolog.Logger
+
+	// Prefixes of the paths allowed to be scanned with the /scan/path endpoint
+	ScanPathAllowlist []string
+
+	// Directory shared with Clamd in which the uploads are spooled
+	// when they must be scanned from the filesystem
+	SpoolDir string
+
+	// Circuit breaker guarding the calls to Clamd, if enabled
+	Breaker *clamd.CircuitBreaker
+
+	// Commands supported by Clamd, if negotiated
+	Capabilities *clamd.Capabilities
+
+	// Fetcher downloading the content scanned with the /scan/url endpoint, if enabled
+	Fetcher *fetcher.Fetcher
+
+	// Manager of the asynchronous scan jobs, if enabled
+	Jobs *jobs.Manager
+
+	// Dispatcher notifying the webhooks of the scan results, if enabled
+	Webhooks *webhook.Dispatcher
+
+	// Scanner expanding the archives to scan their entries, if enabled
+	Archives *archive.Scanner
+
+	// Cache of the recent verdicts of the scans, if enabled. The verdicts
+	// of all the uploads are cached, but only InStream serves them
+	Cache *cache.Cache
+
+	// Store recording the last verdict of the scans by hash, if enabled
+	History history.Store
+
+	// Watcher of the version of Clamd and of its signature database, if enabled
+	Versions *clamd.VersionWatcher
+
+	// Policy allowing or denying the uploads before they are scanned, if any
+	Policy *policy.Policy
+
+	// Quarantine keeping the infected uploads, if enabled
+	Quarantine *quarantine.Quarantine
+
+	// Bearer token required by the admin endpoints, which
+	// aren't authenticated when empty
+	AdminToken string
+
+	// Overridden in tests
+	clock helper.Clock
 }
 
-func NewHandler(logger *zerolog.Logger, clamav clamav.Clamaver) *Handler {
+func NewHandler(logger *zerolog.Logger, clamav clamd.Clamaver) *Handler {
 	return &Handler{Logger: logger, Clamav: clamav}
 }
 
@@ -31,3 +97,115 @@ func MaxReqSize(maxReqSize int64) func(next http.Handler) http.Handler {
 		})
 	}
 }
+
+// RequestIDHeader is the header carrying the id of a request.
+const RequestIDHeader = "X-Request-ID"
+
+// NewChain returns the middlewares the endpoints are served behind:
+// logging of the requests with logger, request ids and the maxReqSize
+// limit on the size of the requests.
+func NewChain(logger zerolog.Logger, maxReqSize int64) alice.Chain {
+	c := alice.New()
+
+	// Register logging middleware
+	c = c.Append(hlog.NewHandler(logger))
+	c = c.Append(hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
+		hlog.FromRequest(r).Info().
+			Str("method", r.Method).
+			Stringer("url", r.URL).
+			Int("status", status).
+			Int("size", size).
+			Dur("duration", duration).
+			Msg("")
+	}))
+	c = c.Append(hlog.RefererHandler("referer"))
+	c = c.Append(hlog.RemoteAddrHandler("remote_client"))
+	c = c.Append(hlog.UserAgentHandler("user_agent"))
+	c = c.Append(RequestIDHandler("req_id", RequestIDHeader))
+	c = c.Append(MaxReqSize(maxReqSize))
+
+	return c
+}
+
+// RequestIDHandler is a HTTP middleware setting the id of the request, as
+// hlog.RequestIDHandler does, but reusing the id given in the headerName
+// header of the request if it is a valid one, so that the request can be
+// traced across services.
+func RequestIDHandler(fieldKey, headerName string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		next = hlog.RequestIDHandler(fieldKey, headerName)(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if id, err := xid.FromString(r.Header.Get(headerName)); err == nil {
+				r = r.WithContext(hlog.CtxWithID(r.Context(), id))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireCommand returns an error wrapping clamd.ErrUnsupportedCommand
+// when Clamd is known not to support cmd.
+func (h *Handler) requireCommand(cmd string) error {
+	if h.Capabilities == nil {
+		return nil
+	}
+	return h.Capabilities.Require(cmd)
+}
+
+// RequireCommand is a HTTP middleware responding with a 501 status
+// code when Clamd is known not to support the command cmd.
+func (h *Handler) RequireCommand(cmd string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := h.requireCommand(cmd); err != nil {
+				req_id, _ := hlog.IDFromCtx(r.Context())
+				h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", err)
+
+				SetErrorResponse(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+var ErrAdminUnauthorized = errors.New("missing or invalid admin token")
+
+// RequireAdmin is a HTTP middleware responding with a 401 status code when
+// the request doesn't carry the admin token in its Authorization header.
+// The requests go through when there is no admin token.
+func (h *Handler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.AdminToken != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminToken)) != 1 {
+				req_id, _ := hlog.IDFromCtx(r.Context())
+				h.Logger.Warn().Str("req_id", req_id.String()).Str("path", r.URL.Path).Msgf("%v", ErrAdminUnauthorized)
+
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				SetErrorResponse(w, ErrAdminUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+var ErrQueryParam = errors.New("invalid query parameter")
+
+// queryBool returns the value of the boolean query parameter key.
+// It returns false when the parameter is absent.
+func queryBool(r *http.Request, key string) (bool, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%w: %s: %q", ErrQueryParam, key, v)
+	}
+
+	return b, nil
+}
@@ -3,21 +3,29 @@ package controllers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
-	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
 	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestNewHandler(t *testing.T) {
 	logger := zerolog.Logger{}
-	c := clamav.ClamavClient{}
+	c := clamd.ClamavClient{}
 	type args struct {
 		logger *zerolog.Logger
-		clamav clamav.Clamaver
+		clamav clamd.Clamaver
 	}
 	tests := []struct {
 		name string
@@ -27,12 +35,12 @@ func TestNewHandler(t *testing.T) {
 		{
 			name: "nil args",
 			args: args{nil, nil},
-			want: &Handler{nil, nil},
+			want: &Handler{},
 		},
 		{
 			name: "non nil args",
 			args: args{&logger, &c},
-			want: &Handler{&c, &logger},
+			want: &Handler{Clamav: &c, Logger: &logger},
 		},
 	}
 	for _, tt := range tests {
@@ -44,9 +52,46 @@ func TestNewHandler(t *testing.T) {
 	}
 }
 
-type MockClamav struct{}
+func TestQueryBool(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    bool
+		wantErr bool
+	}{
+		{name: "absent", url: "/", want: false},
+		{name: "true", url: "/?foo=true", want: true},
+		{name: "1", url: "/?foo=1", want: true},
+		{name: "false", url: "/?foo=false", want: false},
+		{name: "invalid", url: "/?foo=bar", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
 
-var _ clamav.Clamaver = (*MockClamav)(nil)
+			got, err := queryBool(r, "foo")
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrQueryParam)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// testClock returns a fixed time, so that the durations
+// computed by the handlers are predictable.
+func testClock() time.Time {
+	return time.Date(2023, time.July, 8, 8, 0, 0, 0, time.UTC)
+}
+
+type MockClamav struct {
+	// number of calls to ScanFile
+	scanFileCalls atomic.Int32
+}
+
+var _ clamd.Clamaver = (*MockClamav)(nil)
 
 func (m *MockClamav) Ping(ctx context.Context) ([]byte, error) {
 	scenario := ctx.Value(MockScenario(""))
@@ -105,6 +150,8 @@ func (m *MockClamav) VersionCommands(ctx context.Context) ([]byte, error) {
 
 	if scenario == ScenarioNoError {
 		return []byte("ClamAV 1.0.1/26963/Sat Jul  8 07:27:53 2023| COMMANDS: SCAN QUIT RELOAD PING CONTSCAN VERSIONCOMMANDS VERSION END SHUTDOWN MULTISCAN FILDES STATS IDSESSION INSTREAM DETSTATSCLEAR DETSTATS ALLMATCHSCAN"), nil
+	} else if scenario == ScenarioLimitedCommands {
+		return []byte("ClamAV 0.103.8/26963/Sat Jul  8 07:27:53 2023| COMMANDS: SCAN QUIT RELOAD PING CONTSCAN VERSIONCOMMANDS VERSION END SHUTDOWN INSTREAM"), nil
 	} else if scenario == ScenarioVersionCommandsErrMarshall {
 		return []byte("Some unparsable VERSIONCOMMANS output"), nil
 	} else {
@@ -122,32 +169,117 @@ func (m *MockClamav) Shutdown(ctx context.Context) error {
 	}
 }
 
-func (m *MockClamav) InStream(ctx context.Context, r io.Reader, size int64) ([]byte, error) {
+func (m *MockClamav) InStream(ctx context.Context, r io.Reader) ([]byte, error) {
 	scenario := ctx.Value(MockScenario(""))
 
 	if scenario == ScenarioNoError {
 		return []byte("stream: OK"), nil
 	} else if scenario == ScenarioErrVirusFound {
-		return []byte("stream: Win.Test.EICAR_HDB-1 FOUND"), clamav.ErrVirusFound
+		return []byte("stream: Win.Test.EICAR_HDB-1 FOUND"), clamd.ErrVirusFound
+	} else if scenario == ScenarioReadStream {
+		// Reading the whole stream like Clamd
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", clamd.ErrReadStream, err)
+		}
+		if strings.Contains(string(b), "EICAR-STANDARD-ANTIVIRUS-TEST-FILE") {
+			return []byte("stream: Win.Test.EICAR_HDB-1 FOUND"), clamd.ErrVirusFound
+		}
+		return []byte("stream: OK"), nil
+	} else {
+		return nil, dispatchErrFromScenario(scenario.(MockScenario))
+	}
+}
+
+func (m *MockClamav) ScanPath(ctx context.Context, path string, mode clamd.ScanMode) ([]clamd.ScanResult, error) {
+	scenario := ctx.Value(MockScenario(""))
+	if scenario == ScenarioNoError {
+		return []clamd.ScanResult{}, nil
+	} else if scenario == ScenarioErrVirusFound {
+		return []clamd.ScanResult{
+			{Path: path + "/eicar.txt", Signature: "Win.Test.EICAR_HDB-1"},
+			{Path: path + "/eicar.com", Signature: "Eicar-Signature"},
+		}, nil
+	} else if scenario == ScenarioScanPathErrors {
+		return []clamd.ScanResult{
+			{Path: path + "/eicar.txt", Signature: "Win.Test.EICAR_HDB-1"},
+			{Path: path + "/secret", Error: "Can't open file or directory"},
+		}, nil
+	} else if scenario == ScenarioErrScanPath {
+		return nil, fmt.Errorf("%w: %s: lstat() failed: No such file or directory.", clamd.ErrScanPath, path)
 	} else {
 		return nil, dispatchErrFromScenario(scenario.(MockScenario))
 	}
 }
 
+func (m *MockClamav) ScanFile(ctx context.Context, f *os.File) ([]byte, error) {
+	m.scanFileCalls.Add(1)
+
+	scenario := ctx.Value(MockScenario(""))
+	if scenario == ScenarioNoError {
+		return []byte("fd[10]: OK"), nil
+	} else if scenario == ScenarioErrVirusFound {
+		return []byte("fd[10]: Win.Test.EICAR_HDB-1 FOUND"), clamd.ErrVirusFound
+	} else {
+		return nil, dispatchErrFromScenario(scenario.(MockScenario))
+	}
+}
+
+func (m *MockClamav) DetStats(ctx context.Context) ([]clamd.DetStat, error) {
+	scenario := ctx.Value(MockScenario(""))
+
+	if scenario == ScenarioNoError {
+		return []clamd.DetStat{
+			{
+				Time:      time.Unix(1688628578, 0).UTC(),
+				MD5:       "44d88612fea8a8f36de82e1278abb02f",
+				Size:      68,
+				Signature: "Win.Test.EICAR_HDB-1",
+				FileName:  "eicar.txt",
+			},
+		}, nil
+	} else if scenario == ScenarioDetStatsEmpty {
+		return []clamd.DetStat{}, nil
+	} else if scenario == ScenarioDetStatsBackends {
+		return []clamd.DetStat{
+			{
+				Time:      time.Unix(1688628578, 0).UTC(),
+				MD5:       "44d88612fea8a8f36de82e1278abb02f",
+				Size:      68,
+				Signature: "Win.Test.EICAR_HDB-1",
+				FileName:  "eicar.txt",
+				Backend:   "10.0.0.1:3310",
+			},
+		}, nil
+	} else {
+		return nil, dispatchErrFromScenario(scenario.(MockScenario))
+	}
+}
+
+func (m *MockClamav) DetStatsClear(ctx context.Context) error {
+	scenario := ctx.Value(MockScenario(""))
+
+	if scenario == ScenarioNoError {
+		return nil
+	} else {
+		return dispatchErrFromScenario(scenario.(MockScenario))
+	}
+}
+
 func dispatchErrFromScenario(scenario MockScenario) error {
 	switch scenario {
 	case ScenarioNetError:
 		return &net.OpError{Err: errors.New("network error")}
 	case ScenarioErrUnknownCommand:
-		return clamav.ErrUnknownCommand
+		return clamd.ErrUnknownCommand
 	case ScenarioErrUnknownResponse:
-		return clamav.ErrUnknownResponse
+		return clamd.ErrUnknownResponse
 	case ScenarioErrUnexpectedResponse:
-		return clamav.ErrUnexpectedResponse
+		return clamd.ErrUnexpectedResponse
 	case ScenarioErrScanFileSizeLimitExceeded:
-		return clamav.ErrScanFileSizeLimitExceeded
+		return clamd.ErrScanFileSizeLimitExceeded
 	case ScenarioErrVirusFound:
-		return clamav.ErrVirusFound
+		return clamd.ErrVirusFound
 	default:
 		return nil
 	}
@@ -165,6 +297,12 @@ var (
 
 	ScenarioStatsErrMarshall           MockScenario = "statserrmarshall"
 	ScenarioVersionCommandsErrMarshall MockScenario = "versioncommandserrmarshall"
+	ScenarioDetStatsEmpty              MockScenario = "detstatsempty"
+	ScenarioDetStatsBackends           MockScenario = "detstatsbackends"
+	ScenarioLimitedCommands            MockScenario = "limitedcommands"
+	ScenarioReadStream                 MockScenario = "readstream"
+	ScenarioScanPathErrors             MockScenario = "scanpatherrors"
+	ScenarioErrScanPath                MockScenario = "scanpath"
 
 	ScenarioErrVirusFound MockScenario = "virusfound"
 )
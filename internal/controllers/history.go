@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/history"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog/hlog"
+)
+
+// HashLookupResponse represents the json response of a /scan/{sha256} endpoint.
+type HashLookupResponse struct {
+	SHA256     string    `json:"sha256"`
+	Verdict    string    `json:"verdict"`
+	Signature  string    `json:"signature"`
+	VirusFound bool      `json:"virus_found"`
+	Engine     string    `json:"engine_version,omitempty"`
+	Database   int       `json:"database_version,omitempty"`
+	ScannedAt  time.Time `json:"scanned_at"`
+}
+
+var (
+	ErrHistoryNotConfigured = errors.New("scan history is not enabled")
+	ErrInvalidHash          = errors.New("invalid sha256")
+)
+
+// LookupHash will return the last verdict of the scan of the content
+// whose SHA-256 is given in the path, without the content being uploaded.
+func (h *Handler) LookupHash(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	if h.History == nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", ErrHistoryNotConfigured)
+		SetErrorResponse(w, ErrHistoryNotConfigured)
+		return
+	}
+
+	sum := strings.ToLower(httprouter.ParamsFromContext(r.Context()).ByName("sha256"))
+	if !history.ValidHash(sum) {
+		e := fmt.Errorf("%w: %q", ErrInvalidHash, sum)
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", e)
+
+		SetErrorResponse(w, e)
+		return
+	}
+
+	record, err := h.History.Get(sum)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Str("sha256", sum).Msgf("%v", err)
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	lookupResp := HashLookupResponse{
+		SHA256:    record.SHA256,
+		Verdict:   VerdictClean,
+		Signature: record.Signature,
+		Engine:    record.Engine,
+		Database:  record.Database,
+		ScannedAt: record.ScannedAt,
+	}
+	if record.Signature != "" {
+		lookupResp.Verdict = VerdictInfected
+		lookupResp.VirusFound = true
+	}
+
+	resp, err := json.Marshal(&lookupResp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// recordHistory records in the history the verdict of the content of the
+// given SHA-256, along with the version of Clamd which made it, if known.
+// Failures are logged only, as the content was scanned anyway.
+func (h *Handler) recordHistory(reqID string, sum string, signature string, version *clamd.Version) {
+	if h.History == nil {
+		return
+	}
+
+	record := &history.Record{
+		SHA256:    sum,
+		Signature: signature,
+		ScannedAt: h.clock.Now().UTC(),
+	}
+	if version != nil {
+		record.Engine = version.Engine
+		record.Database = version.Database
+	}
+
+	if err := h.History.Put(record); err != nil {
+		h.Logger.Error().Str("req_id", reqID).Str("sha256", sum).Err(err).Msg("error while recording the verdict in the history")
+	}
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/history"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicarSHA256 = "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"
+
+func TestHandlerLookupHash(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	h := NewHandler(&logger, mockClamav)
+	h.clock = func() time.Time { return time.Date(2023, time.July, 8, 8, 0, 0, 0, time.UTC) }
+
+	lookup := func(sum string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		ctx := context.WithValue(context.Background(), httprouter.ParamsKey, httprouter.Params{{Key: "sha256", Value: sum}})
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/rest/v1/scan/"+sum, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h.LookupHash(rr, req)
+		return rr
+	}
+	scan := func(content string) {
+		b := &bytes.Buffer{}
+		writer := multipart.NewWriter(b)
+		part, _ := writer.CreateFormFile("file", "file.txt")
+		io.WriteString(part, content)
+		writer.Close()
+
+		ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioReadStream)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan", b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		rr := httptest.NewRecorder()
+		h.InStream(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	// The history isn't enabled
+	rr := lookup(eicarSHA256)
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"not implemented: scan history is not enabled"}`, rr.Body.String())
+
+	h.History = history.NewMemoryStore(0)
+	h.Versions = clamd.NewVersionWatcher(mockClamav, 0, nil)
+	defer h.Versions.Close()
+
+	// Invalid hash
+	rr = lookup("foobar")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"bad request: invalid sha256: \"foobar\""}`, rr.Body.String())
+
+	// Unknown hash
+	rr = lookup(eicarSHA256)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"not found: hash not found: \"`+eicarSHA256+`\""}`, rr.Body.String())
+
+	// Scanned before the version of Clamd is known
+	scan(eicar)
+
+	rr = lookup(strings.ToUpper(eicarSHA256))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `{"sha256":"`+eicarSHA256+`","verdict":"infected","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"scanned_at":"2023-07-08T08:00:00Z"}`, rr.Body.String())
+
+	// Scanned with a known version of Clamd
+	require.NoError(t, h.Versions.Refresh(context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)))
+	scan("foobar")
+
+	const foobarSHA256 = "c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2"
+	rr = lookup(foobarSHA256)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"sha256":"`+foobarSHA256+`","verdict":"clean","signature":"","virus_found":false,"engine_version":"1.0.1","database_version":26961,"scanned_at":"2023-07-08T08:00:00Z"}`, rr.Body.String())
+}
@@ -4,30 +4,65 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"strings"
 
-	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
 	"github.com/rs/zerolog/hlog"
 )
 
 // InStreamResponse represents the json response of a /scan endpoint.
 type InStreamResponse struct {
-	Status     string `json:"status"`
-	Msg        string `json:"msg"`
-	Signature  string `json:"signature"`
-	VirusFound bool   `json:"virus_found"`
+	Status     string   `json:"status"`
+	Msg        string   `json:"msg"`
+	Signature  string   `json:"signature"`
+	Signatures []string `json:"signatures,omitempty"`
+	VirusFound bool     `json:"virus_found"`
+	Cached     bool     `json:"cached,omitempty"`
+	FileName   string   `json:"filename,omitempty"`
+	Size       int64    `json:"size"`
+	ScanDetails
+	Entries []ArchiveEntry `json:"entries,omitempty"`
 }
 
 var (
 	ErrFormFile        = errors.New("failed to parse file")
 	ErrOpenFileHeaders = errors.New("failed to open multipart file headers")
+
+	// ErrSeveralFiles is returned when the form sent to /scan holds
+	// other files than the one to scan, which would be left unscanned.
+	ErrSeveralFiles = errors.New("several files in multipart form, use /rest/v1/scan/files to scan them")
 )
 
 func (h *Handler) InStream(w http.ResponseWriter, r *http.Request) {
 	// Get request id for logging purposes
 	req_id, _ := hlog.IDFromCtx(r.Context())
 
+	allMatch, err := queryBool(r, "allmatch")
+	if err == nil && allMatch {
+		err = h.requireCommand(string(clamd.ScanModeAllMatch))
+	}
+	var expand bool
+	if err == nil {
+		expand, err = queryBool(r, "expand")
+	}
+	if err == nil && expand && allMatch {
+		err = fmt.Errorf("%w: allmatch and expand can't be combined", ErrQueryParam)
+	}
+	var callbackURL string
+	if err == nil {
+		callbackURL, err = h.callbackURL(r)
+	}
+	if err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", err)
+
+		SetErrorResponse(w, err)
+		return
+	}
+
 	// Parsing the Multipart file
 	_, hd, err := r.FormFile("file")
 	if err != nil {
@@ -38,6 +73,18 @@ func (h *Handler) InStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	files := 0
+	for _, fhs := range r.MultipartForm.File {
+		files += len(fhs)
+	}
+	if files > 1 {
+		e := fmt.Errorf("%w: %w", ErrFormFile, ErrSeveralFiles)
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", e)
+
+		SetErrorResponse(w, e)
+		return
+	}
+
 	f, err := hd.Open()
 	if err != nil {
 		e := fmt.Errorf("%w: %v", ErrOpenFileHeaders, err)
@@ -49,30 +96,119 @@ func (h *Handler) InStream(w http.ResponseWriter, r *http.Request) {
 
 	defer f.Close()
 
-	size := hd.Size
-
 	h.Logger.Debug().
 		Str("req_id", req_id.String()).
 		Str("file_name", hd.Filename).
 		Int64("file_size", hd.Size).
 		Msg("multipart file read successfully")
 
+	file := webhook.File{Name: hd.Filename, Size: hd.Size, Field: "file"}
+
+	// The hashes of the file are computed while it is sent to Clamd, in a
+	// single pass, and only its MIME type is sniffed beforehand for the scan
+	// policy. The file is hashed in a pass of its own before being scanned
+	// only when the hashes are needed first or Clamd doesn't read it from
+	// this process: to look its verdict up in the cache, when it was spooled
+	// to a temporary file which Clamd reads itself (FILDES), and with
+	// ?expand=true whose archive entries are read apart. With ?allmatch=true,
+	// it is hashed while being spooled.
+	details := h.newScanDetails()
+	spooled, isSpooled := f.(*os.File)
+	if h.Cache != nil || isSpooled || expand {
+		var d *digester
+		if d, err = digestFile(f); err == nil {
+			d.fill(&details)
+		}
+	} else {
+		details.MIMEType, err = sniffFile(f)
+	}
+	if err != nil {
+		e := fmt.Errorf("%w: %v", ErrOpenFileHeaders, err)
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", e)
+
+		SetErrorResponse(w, e)
+		return
+	}
+	details.source = h.quarantineContent(r, f)
+
+	// The scan policy is applied before anything is sent to Clamd
+	details.Policy, _ = h.matchPolicy(hd.Filename, details.MIMEType, hd.Size)
+	if v := details.Policy.verdict(); v != "" {
+		// Not sent to Clamd, the file is only read to be hashed
+		if details.SHA256 == "" {
+			if d, err := digestFile(f); err == nil {
+				d.fill(&details)
+			}
+		}
+
+		h.Logger.Debug().Str("req_id", req_id.String()).Str("rule", details.Policy.Rule).Msgf("file %s by policy", v)
+
+		h.writeVerdict(w, req_id.String(), callbackURL, file, policyResponse(details))
+		return
+	}
+
+	if allMatch {
+		h.inStreamAllMatch(w, r, f, callbackURL, file, details)
+		return
+	}
+	if expand {
+		h.inStreamExpand(w, r, f, hd.Size, callbackURL, file, details)
+		return
+	}
+
+	// The verdict of a content scanned recently is served from the cache
+	if v, ok := h.cachedVerdict(&details); ok {
+		h.Logger.Debug().Str("req_id", req_id.String()).Str("sha256", details.SHA256).Msg("verdict served from cache")
+
+		inStreamResp := cachedResponse(v)
+		inStreamResp.ScanDetails = details
+		h.writeVerdict(w, req_id.String(), callbackURL, file, inStreamResp)
+		return
+	}
+
+	ctx := details.scanContext(r.Context())
+
+	var inStream []byte
+
+	// Uploads too large to be kept in memory are spooled to temporary files
+	// by the multipart parser. They can be scanned without being streamed
+	// to Clamd once again.
+	if isSpooled {
+		inStream, err = h.Clamav.ScanFile(ctx, spooled)
+	} else if details.SHA256 != "" {
+		inStream, err = h.Clamav.InStream(ctx, f)
+	} else {
+		body := newDigestReader(f)
+		inStream, err = h.Clamav.InStream(ctx, body)
+
+		// Clamd may reply before the file was read entirely. The rest
+		// is read to complete the hashes, the file being local
+		io.Copy(io.Discard, body)
+		body.fill(&details)
+	}
+
+	h.recordVerdict(req_id.String(), &details, inStream, err)
+	h.writeInStreamResponse(w, req_id.String(), callbackURL, file, details, inStream, err)
+}
+
+// writeInStreamResponse writes the response to the scan of a stream
+// from the response of Clamd and the error returned while scanning.
+// The webhooks are notified of the result of the scan of file.
+func (h *Handler) writeInStreamResponse(w http.ResponseWriter, reqID string, callbackURL string, file webhook.File, details ScanDetails, inStream []byte, err error) {
 	var inStreamResp InStreamResponse
-	var ctx = r.Context()
 
-	inStream, err := h.Clamav.InStream(ctx, f, size)
 	if err != nil {
-		if errors.Is(err, clamav.ErrVirusFound) {
-			h.Logger.Debug().Str("req_id", req_id.String()).Msg(err.Error())
+		if errors.Is(err, clamd.ErrVirusFound) {
+			h.Logger.Debug().Str("req_id", reqID).Msg(err.Error())
 
 			inStreamResp = InStreamResponse{
 				Status:     "error",
-				Msg:        clamav.ErrVirusFound.Error(),
+				Msg:        clamd.ErrVirusFound.Error(),
 				Signature:  h.parseSignature(string(inStream)),
 				VirusFound: true,
 			}
 		} else {
-			h.Logger.Debug().Str("req_id", req_id.String()).Err(err).Msg("error while scanning file")
+			h.Logger.Debug().Str("req_id", reqID).Err(err).Msg("error while scanning file")
 
 			SetErrorResponse(w, err)
 			return
@@ -80,13 +216,39 @@ func (h *Handler) InStream(w http.ResponseWriter, r *http.Request) {
 	} else {
 		inStreamResp = InStreamResponse{
 			Status:     "noerror",
-			Msg:        string(clamav.RespScan),
+			Msg:        string(clamd.RespScan),
 			Signature:  "",
 			VirusFound: false,
 		}
 	}
 
-	h.Logger.Debug().Str("req_id", req_id.String()).Msg("file scanned successfully")
+	h.Logger.Debug().Str("req_id", reqID).Msg("file scanned successfully")
+
+	inStreamResp.ScanDetails = details
+	h.writeVerdict(w, reqID, callbackURL, file, inStreamResp)
+}
+
+// writeVerdict writes inStreamResp as the response to the
+// scan of file, after notifying the webhooks of it.
+// The name and the size of file, and the duration of the
+// scan, are added to the response. An infected file is
+// quarantined beforehand, if enabled.
+func (h *Handler) writeVerdict(w http.ResponseWriter, reqID string, callbackURL string, file webhook.File, inStreamResp InStreamResponse) {
+	inStreamResp.FileName = file.Name
+	inStreamResp.Size = file.Size
+	h.finishScanDetails(&inStreamResp.ScanDetails)
+
+	if inStreamResp.VirusFound {
+		h.quarantine(reqID, file, inStreamResp.Signature, &inStreamResp.ScanDetails)
+	}
+
+	ev := scanEvent(inStreamResp.Signature, file)
+	ev.QuarantineID = inStreamResp.QuarantineID
+	if v := inStreamResp.Policy.verdict(); v != "" && !inStreamResp.VirusFound {
+		ev.Verdict = v
+		ev.Rule = inStreamResp.Policy.Rule
+	}
+	h.notify(reqID, callbackURL, ev)
 
 	resp, err := json.Marshal(inStreamResp)
 	if err != nil {
@@ -102,8 +264,13 @@ func (h *Handler) InStream(w http.ResponseWriter, r *http.Request) {
 // parseSignature will extract the name of the virus signature
 // from Clamd response when a potential virus is found.
 //
-// An example of such response from the Clamd daemon is:
-// "stream: Eicar-Signature FOUND"
+// Examples of such responses from the Clamd daemon are:
+// "stream: Eicar-Signature FOUND" or "fd[10]: Eicar-Signature FOUND"
 func (h *Handler) parseSignature(msg string) string {
-	return strings.TrimLeft(strings.TrimRight(msg, " FOUND"), "stream: ")
+	// The signature can't contain ": "
+	if i := strings.LastIndex(msg, ": "); i >= 0 {
+		msg = msg[i+2:]
+	}
+
+	return strings.TrimSuffix(msg, " FOUND")
 }
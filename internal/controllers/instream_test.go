@@ -10,7 +10,7 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 )
@@ -43,7 +43,7 @@ func TestHandlerInStream(t *testing.T) {
 			},
 			want: want{
 				status: http.StatusOK,
-				body:   []byte(`{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false}`),
+				body:   []byte(`{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"filename":"test.txt","size":0,` + emptyDetails + `}`),
 			},
 		},
 		{
@@ -55,7 +55,7 @@ func TestHandlerInStream(t *testing.T) {
 			},
 			want: want{
 				status: http.StatusOK,
-				body:   []byte(`{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false}`),
+				body:   []byte(`{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"filename":"test.txt","size":6,` + foobarDetails + `}`),
 			},
 		},
 		{
@@ -139,7 +139,7 @@ func TestHandlerInStream(t *testing.T) {
 			},
 			want: want{
 				status: http.StatusOK,
-				body:   []byte(`{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true}`),
+				body:   []byte(`{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"filename":"eicar.txt","size":0,` + emptyDetails + `}`),
 			},
 		},
 		{
@@ -159,6 +159,7 @@ func TestHandlerInStream(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			h := NewHandler(&logger, mockClamav)
+			h.clock = testClock
 			rr := httptest.NewRecorder()
 			handler := http.HandlerFunc(h.InStream)
 
@@ -192,9 +193,114 @@ func TestHandlerInStream(t *testing.T) {
 	}
 }
 
+func TestHandlerInStreamSpooledFile(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	h := NewHandler(&logger, mockClamav)
+	h.clock = testClock
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.InStream)
+
+	b := &bytes.Buffer{}
+	writer := multipart.NewWriter(b)
+	part, _ := writer.CreateFormFile("file", "eicar.txt")
+	io.Copy(part, strings.NewReader("foobar"))
+	writer.Close()
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioErrVirusFound)
+	req, err := http.NewRequestWithContext(ctx, "POST", "/rest/v1/scan", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	// Force the multipart parser to spool the file to disk
+	assert.NoError(t, req.ParseMultipartForm(1))
+	defer req.MultipartForm.RemoveAll()
+
+	handler.ServeHTTP(rr, req)
+
+	resp := rr.Result()
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []byte(`{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"filename":"eicar.txt","size":6,`+foobarDetails+`}`), body)
+	assert.EqualValues(t, 1, mockClamav.scanFileCalls.Load())
+}
+
+func TestHandlerInStreamSeveralFiles(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	tests := []struct {
+		name  string
+		parts []formPart
+	}{
+		{
+			name: "files of other fields",
+			parts: []formPart{
+				{field: "file", filename: "foo.txt", content: "foo"},
+				{field: "attachment", filename: "eicar.txt", content: "foobar"},
+			},
+		},
+		{
+			name: "several files in the file field",
+			parts: []formPart{
+				{field: "file", filename: "foo.txt", content: "foo"},
+				{field: "file", filename: "eicar.txt", content: "foobar"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, mockClamav)
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(h.InStream)
+
+			b, contentType := newMultipartBody(t, tt.parts)
+			ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioErrVirusFound)
+			req, err := http.NewRequestWithContext(ctx, "POST", "/rest/v1/scan", b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", contentType)
+
+			handler.ServeHTTP(rr, req)
+
+			resp := rr.Result()
+			body, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			assert.Equal(t, `{"status":"error","msg":"bad request: failed to parse file: several files in multipart form, use /rest/v1/scan/files to scan them"}`, string(body))
+		})
+	}
+
+	// The fields which aren't files are ignored
+	h := NewHandler(&logger, mockClamav)
+	h.clock = testClock
+	rr := httptest.NewRecorder()
+
+	b, contentType := newMultipartBody(t, []formPart{
+		{field: "comment", content: "foo"},
+		{field: "file", filename: "test.txt", content: "foobar"},
+	})
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioNoError)
+	req, err := http.NewRequestWithContext(ctx, "POST", "/rest/v1/scan", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	http.HandlerFunc(h.InStream).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"filename":"test.txt","size":6,`+foobarDetails+`}`, rr.Body.String())
+}
+
 func TestHandlerParseSignature(t *testing.T) {
 	type fields struct {
-		Clamav clamav.Clamaver
+		Clamav clamd.Clamaver
 		Logger *zerolog.Logger
 	}
 	type args struct {
@@ -230,6 +336,18 @@ func TestHandlerParseSignature(t *testing.T) {
 			args:   args{msg: "stream: Eicar-Signature FOUND"},
 			want:   "Eicar-Signature",
 		},
+		{
+			name:   "fd[10]: Eicar-Signature FOUND",
+			fields: fields{},
+			args:   args{msg: "fd[10]: Eicar-Signature FOUND"},
+			want:   "Eicar-Signature",
+		},
+		{
+			name:   "stream: Win.Test.EICAR_HDB-1 FOUND",
+			fields: fields{},
+			args:   args{msg: "stream: Win.Test.EICAR_HDB-1 FOUND"},
+			want:   "Win.Test.EICAR_HDB-1",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
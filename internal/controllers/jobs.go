@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/jobs"
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog/hlog"
+)
+
+// JobResponse represents the json response of the /jobs endpoints.
+type JobResponse struct {
+	ID        string     `json:"id"`
+	Status    string     `json:"status"`
+	FileName  string     `json:"filename"`
+	Size      int64      `json:"size"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Result    *JobResult `json:"result"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// JobResult represents the result of the scan of a job, once done.
+type JobResult struct {
+	Signature  string `json:"signature"`
+	VirusFound bool   `json:"virus_found"`
+
+	// Rule of the scan policy which allowed the file without scanning it
+	Policy *PolicyMatch `json:"policy,omitempty"`
+
+	// Id of the quarantined file, if infected
+	QuarantineID string `json:"quarantine_id,omitempty"`
+}
+
+var ErrJobsNotConfigured = errors.New("asynchronous scan jobs are not enabled")
+
+// SubmitJob will spool the file of the multipart form of the request to disk
+// and queue a job scanning it with the "INSTREAM" command.
+//
+// The scan policy is applied beforehand: a file allowed by it is recorded
+// as a job already done, while a denied one is refused with a 403 status code.
+//
+// It responds with a 202 status code as soon as the job is queued, without
+// waiting for the scan. The job can be polled with the url of the Location header,
+// or its result sent to the url of the "callback_url" query parameter.
+func (h *Handler) SubmitJob(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	if h.Jobs == nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", ErrJobsNotConfigured)
+		SetErrorResponse(w, ErrJobsNotConfigured)
+		return
+	}
+
+	callbackURL, err := h.callbackURL(r)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", err)
+		SetErrorResponse(w, err)
+		return
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		e := fmt.Errorf("%w: %w", ErrFormFile, err)
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", e)
+
+		SetErrorResponse(w, e)
+		return
+	}
+
+	// Looking for the "file" field, the other ones are ignored
+	var job *jobs.Job
+	for job == nil {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			err = http.ErrMissingFile
+		}
+		if err != nil {
+			e := fmt.Errorf("%w: %w", ErrFormFile, err)
+			h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", e)
+
+			SetErrorResponse(w, e)
+			return
+		}
+
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		job, err = h.submitJob(part, jobs.SubmitOptions{
+			RequestID:   req_id.String(),
+			CallbackURL: callbackURL,
+			ClientIP:    clientIP(r),
+		})
+		if errors.Is(err, jobs.ErrReadUpload) || errors.Is(err, clamd.ErrReadStream) {
+			err = fmt.Errorf("%w: %w", ErrFormFile, err)
+		}
+		if errors.Is(err, ErrPolicyDenied) {
+			h.Logger.Debug().Str("req_id", req_id.String()).Str("file_name", part.FileName()).Msgf("%v", err)
+
+			SetErrorResponse(w, err)
+			return
+		}
+		if err != nil {
+			h.Logger.Error().Str("req_id", req_id.String()).Msgf("error while submitting job: %v", err)
+
+			SetErrorResponse(w, err)
+			return
+		}
+	}
+
+	h.Logger.Debug().
+		Str("req_id", req_id.String()).
+		Str("job_id", job.ID).
+		Str("file_name", job.FileName).
+		Int64("file_size", job.Size).
+		Msg("job submitted")
+
+	w.Header().Set("Location", "/rest/v1/jobs/"+job.ID)
+	h.writeJobResponse(w, http.StatusAccepted, job)
+}
+
+// Job will respond with the status of the job whose id is in the path
+// and, once done, with the result of its scan.
+func (h *Handler) Job(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	if h.Jobs == nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", ErrJobsNotConfigured)
+		SetErrorResponse(w, ErrJobsNotConfigured)
+		return
+	}
+
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+	job, err := h.Jobs.Get(id)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Str("job_id", id).Msgf("%v", err)
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	h.writeJobResponse(w, http.StatusOK, job)
+}
+
+// submitJob matches the file of part with the scan policy before queuing
+// a job scanning it. A file allowed by the policy is recorded as a job done
+// without being scanned, while a denied one is refused with ErrPolicyDenied,
+// the callback url of opts being notified of either decision.
+func (h *Handler) submitJob(part *multipart.Part, opts jobs.SubmitOptions) (*jobs.Job, error) {
+	match, content, err := h.matchPolicyStream(part.FileName(), part, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	switch match.verdict() {
+	case VerdictDenied:
+		// Read entirely for its size to be notified
+		size, err := io.Copy(io.Discard, &streamReader{r: content})
+		if err != nil {
+			return nil, err
+		}
+
+		ev := scanEvent("", webhook.File{Name: part.FileName(), Size: size})
+		ev.Verdict = VerdictDenied
+		ev.Rule = match.Rule
+		h.notify(opts.RequestID, opts.CallbackURL, ev)
+
+		return nil, fmt.Errorf("%w: rule %q", ErrPolicyDenied, match.Rule)
+	case VerdictAllowed:
+		size, err := io.Copy(io.Discard, &streamReader{r: content})
+		if err != nil {
+			return nil, err
+		}
+		return h.Jobs.Allow(part.FileName(), size, match.Rule, opts)
+	default:
+		return h.Jobs.Submit(part.FileName(), content, opts)
+	}
+}
+
+func (h *Handler) writeJobResponse(w http.ResponseWriter, status int, job *jobs.Job) {
+	jobResp := JobResponse{
+		ID:        job.ID,
+		Status:    string(job.Status),
+		FileName:  job.FileName,
+		Size:      job.Size,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+		Error:     job.Error,
+	}
+	if !job.ExpiresAt.IsZero() {
+		jobResp.ExpiresAt = &job.ExpiresAt
+	}
+	if job.Status == jobs.StatusDone {
+		jobResp.Result = &JobResult{
+			Signature:    job.Signature,
+			VirusFound:   job.VirusFound,
+			QuarantineID: job.QuarantineID,
+		}
+		if job.Rule != "" {
+			jobResp.Result.Policy = &PolicyMatch{Rule: job.Rule, Action: policy.ActionAllow}
+		}
+	}
+
+	resp, err := json.Marshal(&jobResp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(status)
+	w.Write(resp)
+}
@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/jobs"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scenarioClamav runs the commands of MockClamav with scenario,
+// for the callers which don't have the context of the request.
+type scenarioClamav struct {
+	*MockClamav
+	scenario MockScenario
+}
+
+func (s *scenarioClamav) InStream(ctx context.Context, r io.Reader) ([]byte, error) {
+	return s.MockClamav.InStream(context.WithValue(ctx, MockScenario(""), s.scenario), r)
+}
+
+func newTestJobs(t *testing.T, clamav clamd.Clamaver, queueSize int) *jobs.Manager {
+	m, err := jobs.NewManager(jobs.NewMemoryStore(), clamav, jobs.Options{
+		Workers:   1,
+		QueueSize: queueSize,
+		TTL:       time.Hour,
+		UploadDir: filepath.Join(t.TempDir(), "uploads"),
+	}, nil)
+	require.NoError(t, err)
+
+	return m
+}
+
+func TestHandlerSubmitJob(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	type args struct {
+		scenario MockScenario
+		parts    []formPart
+		disabled bool
+	}
+	type want struct {
+		status int
+		body   string
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "no error",
+			args: args{
+				scenario: ScenarioNoError,
+				parts: []formPart{
+					{field: "description", content: "attachments"},
+					{field: "attachment", filename: "foo.txt", content: "foo"},
+					{field: "file", filename: "eicar.txt", content: eicar},
+				},
+			},
+			want: want{status: http.StatusAccepted},
+		},
+		{
+			name: "no file",
+			args: args{
+				scenario: ScenarioNoError,
+				parts:    []formPart{{field: "attachment", filename: "foo.txt", content: "foo"}},
+			},
+			want: want{
+				status: http.StatusBadRequest,
+				body:   `{"status":"error","msg":"bad request: failed to parse file: http: no such file"}`,
+			},
+		},
+		{
+			name: "jobs not configured",
+			args: args{
+				scenario: ScenarioNoError,
+				parts:    []formPart{{field: "file", filename: "eicar.txt", content: eicar}},
+				disabled: true,
+			},
+			want: want{
+				status: http.StatusNotImplemented,
+				body:   `{"status":"error","msg":"not implemented: asynchronous scan jobs are not enabled"}`,
+			},
+		},
+		{
+			name: "request too large",
+			args: args{
+				scenario: ScenarioNoError,
+				parts:    []formPart{{field: "file", filename: "large.txt", content: strings.Repeat("a", 1025)}},
+			},
+			want: want{
+				status: http.StatusRequestEntityTooLarge,
+				body:   `{"status":"error","msg":"request entity too large: http: request body too large"}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, mockClamav)
+			if !tt.args.disabled {
+				// The workers aren't started: the job stays queued
+				h.Jobs = newTestJobs(t, mockClamav, 10)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := MaxReqSize(1024)(http.HandlerFunc(h.SubmitJob))
+
+			body, contentType := newMultipartBody(t, tt.args.parts)
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.args.scenario)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/jobs", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", contentType)
+
+			handler.ServeHTTP(rr, req)
+
+			resp := rr.Result()
+			b, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.want.status, resp.StatusCode)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			if tt.want.body != "" {
+				assert.Equal(t, tt.want.body, string(b))
+				return
+			}
+
+			var job JobResponse
+			require.NoError(t, json.Unmarshal(b, &job))
+			assert.Equal(t, "/rest/v1/jobs/"+job.ID, resp.Header.Get("Location"))
+			assert.Equal(t, "queued", job.Status)
+			assert.Equal(t, "eicar.txt", job.FileName)
+			assert.Equal(t, int64(len(eicar)), job.Size)
+			assert.Nil(t, job.ExpiresAt)
+			assert.Nil(t, job.Result)
+		})
+	}
+}
+
+func TestHandlerSubmitJobQueueFull(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	h := NewHandler(&logger, &MockClamav{})
+	h.Jobs = newTestJobs(t, h.Clamav, 0)
+
+	rr := httptest.NewRecorder()
+
+	body, contentType := newMultipartBody(t, []formPart{{field: "file", filename: "foo.txt", content: "foo"}})
+	req := httptest.NewRequest(http.MethodPost, "/rest/v1/jobs", body)
+	req.Header.Set("Content-Type", contentType)
+
+	h.SubmitJob(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"service unavailable: job queue is full"}`, rr.Body.String())
+}
+
+func TestHandlerJob(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	h := NewHandler(&logger, &MockClamav{})
+
+	get := func(id string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		ctx := context.WithValue(context.Background(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: id}})
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/rest/v1/jobs/"+id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h.Job(rr, req)
+		return rr
+	}
+
+	rr := get("cimuf5d3d0kc73ahh5h0")
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"not implemented: asynchronous scan jobs are not enabled"}`, rr.Body.String())
+
+	h.Jobs = newTestJobs(t, &scenarioClamav{MockClamav: &MockClamav{}, scenario: ScenarioReadStream}, 10)
+	require.NoError(t, h.Jobs.Start())
+	defer h.Jobs.Close()
+
+	rr = get("cimuf5d3d0kc73ahh5h0")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"not found: job not found: \"cimuf5d3d0kc73ahh5h0\""}`, rr.Body.String())
+
+	job, err := h.Jobs.Submit("eicar.txt", strings.NewReader(eicar), jobs.SubmitOptions{})
+	require.NoError(t, err)
+
+	var jobResp JobResponse
+	require.Eventually(t, func() bool {
+		rr = get(job.ID)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &jobResp))
+		return jobResp.Status == "done"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, job.ID, jobResp.ID)
+	assert.Equal(t, &JobResult{Signature: "Win.Test.EICAR_HDB-1", VirusFound: true}, jobResp.Result)
+	assert.NotNil(t, jobResp.ExpiresAt)
+	assert.Empty(t, jobResp.Error)
+}
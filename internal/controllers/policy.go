@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+)
+
+// PolicyMatch represents the rule of the scan policy which matched a file.
+type PolicyMatch struct {
+	Rule string `json:"rule"`
+
+	// Action taken on the file
+	Action string `json:"action"`
+}
+
+var ErrPolicyDenied = errors.New("file denied by policy")
+
+// msgPolicyAllowed is the message of the response to the upload
+// of a file allowed by the scan policy without being scanned.
+const msgPolicyAllowed = "file allowed by policy"
+
+// matchPolicy returns the match of the rule of the scan policy matching the
+// file of the given name, sniffed MIME type and size, negative when unknown.
+// It returns nil when no rule matches or when there is no policy.
+//
+// When the size is unknown, ok is false if it is needed to tell: the file
+// must be matched with matchPolicyStream instead.
+func (h *Handler) matchPolicy(name string, mimeType string, size int64) (match *PolicyMatch, ok bool) {
+	if h.Policy == nil {
+		return nil, true
+	}
+
+	rule, ok := h.Policy.Match(policy.File{Name: name, MIMEType: mimeType, Size: size})
+	if rule == nil {
+		return nil, ok
+	}
+	return &PolicyMatch{Rule: rule.Name, Action: rule.Action}, true
+}
+
+// policyContent is the content of a file streamed to be scanned, whose
+// beginning was read to match the scan policy. It reads the content from
+// its beginning.
+type policyContent struct {
+	io.Reader
+
+	// MIME type sniffed from the first bytes of the content
+	mimeType string
+
+	// Size of the content when sized is true, else the number
+	// of bytes read to match the policy
+	size  int64
+	sized bool
+
+	// Temporary file keeping the bytes read, if any
+	spool *os.File
+}
+
+// matchPolicyStream returns the match of the rule of the scan policy
+// matching the file of the given name streamed from r, whose size is
+// negative when unknown, along with the content to scan.
+//
+// The first bytes of r are sniffed. When the size is unknown and needed to
+// tell, r is read up to the size limit of the policy into a temporary file,
+// so that the rule is known before anything is sent to Clamd. The errors
+// returned while reading r wrap clamd.ErrReadStream, except the ones of the
+// sniffing which are returned again when reading the content. The content
+// must be closed once read.
+func (h *Handler) matchPolicyStream(name string, r io.Reader, size int64) (*PolicyMatch, *policyContent, error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+	head, err := br.Peek(sniffLen)
+	c := &policyContent{
+		Reader:   br,
+		mimeType: policy.DetectContentType(head),
+		size:     size,
+		sized:    size >= 0,
+	}
+	if !c.sized {
+		c.size = int64(len(head))
+		c.sized = err == io.EOF
+	}
+
+	matchSize := int64(-1)
+	if c.sized {
+		matchSize = c.size
+	}
+	match, ok := h.matchPolicy(name, c.mimeType, matchSize)
+	if ok {
+		return match, c, nil
+	}
+
+	limit := h.Policy.SizeLimit(policy.File{Name: name, MIMEType: c.mimeType})
+
+	c.spool, err = os.CreateTemp("", "clamav-api-policy-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while spooling the file: %w", err)
+	}
+
+	n, err := io.Copy(c.spool, &streamReader{r: io.LimitReader(br, limit+1)})
+	if err == nil {
+		_, err = c.spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		c.Close()
+		if errors.Is(err, clamd.ErrReadStream) {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("error while spooling the file: %w", err)
+	}
+	c.size = max(c.size, n)
+	c.sized = n <= limit
+	c.Reader = io.MultiReader(c.spool, br)
+
+	// Beyond the limit, the file matches as if it was one byte larger
+	match, _ = h.matchPolicy(name, c.mimeType, n)
+	return match, c, nil
+}
+
+// Close removes the temporary file of c, if any.
+func (c *policyContent) Close() {
+	if c.spool != nil {
+		c.spool.Close()
+		os.Remove(c.spool.Name())
+		c.spool = nil
+	}
+}
+
+// streamReader wraps the errors returned by r in clamd.ErrReadStream.
+type streamReader struct {
+	r io.Reader
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %w", clamd.ErrReadStream, err)
+	}
+	return n, err
+}
+
+// verdict returns the verdict of the file matched by m, either VerdictAllowed
+// or VerdictDenied, or an empty string when the file is scanned.
+func (m *PolicyMatch) verdict() string {
+	if m == nil {
+		return ""
+	}
+
+	switch m.Action {
+	case policy.ActionAllow:
+		return VerdictAllowed
+	case policy.ActionDeny:
+		return VerdictDenied
+	default:
+		return ""
+	}
+}
+
+// policyResponse returns the response to the upload of a file
+// allowed or denied by the rule of the scan policy of details.
+func policyResponse(details ScanDetails) InStreamResponse {
+	if details.Policy.verdict() == VerdictDenied {
+		return InStreamResponse{Status: "error", Msg: ErrPolicyDenied.Error(), ScanDetails: details}
+	}
+	return InStreamResponse{Status: "noerror", Msg: msgPolicyAllowed, ScanDetails: details}
+}
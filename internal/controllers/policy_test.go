@@ -0,0 +1,486 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/fetcher"
+	"github.com/lescactus/clamav-api-go/internal/policy"
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Details of the scan of "MZfoobar", sniffed as a windows executable,
+// and of "foobar" repeated 20 times, as reported by a handler whose clock is testClock.
+const (
+	mzDetails        = `"mime_type":"application/vnd.microsoft.portable-executable","md5":"6d6b9b955abe00ae042be6c0090e3c47","sha1":"9cc75cdbefa6d4490db401c9b0dc6398c7fb2a39","sha256":"31b7bcfda3653f68213fd59b33fdcda5bf9513c31f0adde1c75beaaa31e0f44b","scan_duration_ms":0`
+	largeTextDetails = `"mime_type":"text/plain; charset=utf-8","md5":"f5e10320532914e3769e5c842bc3b64e","sha1":"71ec8e5faab2174decaa794162e032fefeb6f932","sha256":"f00ce683e450e391aa1e2d8c586572c3ed668960f4500947c1a8c9531eb17756","scan_duration_ms":0`
+)
+
+var largeText = strings.Repeat("foobar", 20)
+
+func newTestPolicy(t *testing.T) *policy.Policy {
+	p, err := policy.New([]policy.Rule{
+		{Name: "executables", Action: policy.ActionDeny, Extensions: []string{".exe"}},
+		{Name: "binaries", Action: policy.ActionDeny, MIMETypes: []string{"application/vnd.microsoft.portable-executable"}},
+		{Name: "trusted", Action: policy.ActionAllow, Filenames: []string{"trusted-*"}},
+		{Name: "reports", Action: policy.ActionScan, Filenames: []string{"report-*"}},
+		{Name: "large text", Action: policy.ActionDeny, MIMETypes: []string{"text/plain"}, MinSize: 100},
+	})
+	require.NoError(t, err)
+
+	return p
+}
+
+func TestHandlerMatchPolicyStream(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	h := NewHandler(&logger, &MockClamav{})
+	p, err := policy.New([]policy.Rule{
+		{Name: "small text", Action: policy.ActionAllow, MIMETypes: []string{"text/plain"}, MaxSize: 1000},
+	})
+	require.NoError(t, err)
+	h.Policy = p
+
+	tests := []struct {
+		name    string
+		content string
+		rule    string
+		size    int64
+		sized   bool
+	}{
+		{
+			name:    "sniffed entirely",
+			content: "foobar",
+			rule:    "small text",
+			size:    6,
+			sized:   true,
+		},
+		{
+			name:    "size not needed",
+			content: "%PDF-1.7" + strings.Repeat("a", 2000),
+			size:    512,
+		},
+		{
+			name:    "below the limit",
+			content: strings.Repeat("a", 600),
+			rule:    "small text",
+			size:    600,
+			sized:   true,
+		},
+		{
+			name:    "beyond the limit",
+			content: strings.Repeat("a", 2000),
+			size:    1001,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, content, err := h.matchPolicyStream("foo", strings.NewReader(tt.content), -1)
+			require.NoError(t, err)
+			defer content.Close()
+
+			if tt.rule == "" {
+				assert.Nil(t, match)
+			} else if assert.NotNil(t, match) {
+				assert.Equal(t, tt.rule, match.Rule)
+			}
+			assert.Equal(t, tt.size, content.size)
+			assert.Equal(t, tt.sized, content.sized)
+
+			// The content is read from its beginning
+			b, err := io.ReadAll(content)
+			require.NoError(t, err)
+			assert.Equal(t, tt.content, string(b))
+
+			if content.spool != nil {
+				name := content.spool.Name()
+				content.Close()
+				assert.NoFileExists(t, name)
+			}
+		})
+	}
+
+	// With a known size, nothing is read beyond the sniffed bytes
+	match, content, err := h.matchPolicyStream("foo", strings.NewReader(strings.Repeat("a", 2000)), 2000)
+	require.NoError(t, err)
+	assert.Nil(t, match)
+	assert.Nil(t, content.spool)
+	assert.EqualValues(t, 2000, content.size)
+
+	// The read errors are told apart
+	_, _, err = h.matchPolicyStream("foo", iotest.ErrReader(io.ErrUnexpectedEOF), -1)
+	assert.ErrorIs(t, err, clamd.ErrReadStream)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestHandlerInStreamPolicy(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	callbackURL, events := newWebhookReceiver(t)
+
+	h := NewHandler(&logger, &MockClamav{})
+	h.clock = testClock
+	h.Policy = newTestPolicy(t)
+	h.Webhooks = newTestWebhooks(t)
+
+	tests := []struct {
+		name        string
+		filename    string
+		filecontent string
+		body        string
+		verdict     string
+		rule        string
+	}{
+		{
+			name:        "denied by extension",
+			filename:    "setup.exe",
+			filecontent: eicar,
+			body:        `{"status":"error","msg":"file denied by policy","signature":"","virus_found":false,"filename":"setup.exe","size":68,` + eicarDetails + `,"policy":{"rule":"executables","action":"deny"}}`,
+			verdict:     VerdictDenied,
+			rule:        "executables",
+		},
+		{
+			name:        "denied by MIME type",
+			filename:    "notes.txt",
+			filecontent: "MZfoobar",
+			body:        `{"status":"error","msg":"file denied by policy","signature":"","virus_found":false,"filename":"notes.txt","size":8,` + mzDetails + `,"policy":{"rule":"binaries","action":"deny"}}`,
+			verdict:     VerdictDenied,
+			rule:        "binaries",
+		},
+		{
+			name:        "allowed without being scanned",
+			filename:    "trusted-eicar.txt",
+			filecontent: eicar,
+			body:        `{"status":"noerror","msg":"file allowed by policy","signature":"","virus_found":false,"filename":"trusted-eicar.txt","size":68,` + eicarDetails + `,"policy":{"rule":"trusted","action":"allow"}}`,
+			verdict:     VerdictAllowed,
+			rule:        "trusted",
+		},
+		{
+			name:        "scanned by rule",
+			filename:    "report-eicar.txt",
+			filecontent: eicar,
+			body:        `{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"filename":"report-eicar.txt","size":68,` + eicarDetails + `,"policy":{"rule":"reports","action":"scan"}}`,
+			verdict:     VerdictInfected,
+		},
+		{
+			name:        "denied by size",
+			filename:    "large.txt",
+			filecontent: largeText,
+			body:        `{"status":"error","msg":"file denied by policy","signature":"","virus_found":false,"filename":"large.txt","size":120,` + largeTextDetails + `,"policy":{"rule":"large text","action":"deny"}}`,
+			verdict:     VerdictDenied,
+			rule:        "large text",
+		},
+		{
+			name:        "no matching rule",
+			filename:    "foobar.txt",
+			filecontent: "foobar",
+			body:        `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"filename":"foobar.txt","size":6,` + foobarDetails + `}`,
+			verdict:     VerdictClean,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			writer := multipart.NewWriter(b)
+			part, _ := writer.CreateFormFile("file", tt.filename)
+			io.WriteString(part, tt.filecontent)
+			writer.Close()
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioReadStream)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan?callback_url="+callbackURL, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+
+			rr := httptest.NewRecorder()
+			h.InStream(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.body, rr.Body.String())
+
+			ev := receiveEvent(t, events)
+			assert.Equal(t, tt.verdict, ev.Verdict)
+			assert.Equal(t, tt.rule, ev.Rule)
+		})
+	}
+}
+
+func TestHandlerInStreamRawPolicy(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	h := NewHandler(&logger, &MockClamav{})
+	h.clock = testClock
+	h.Policy = newTestPolicy(t)
+
+	tests := []struct {
+		name               string
+		content            string
+		contentLength      bool
+		query              string
+		contentDisposition string
+		body               string
+	}{
+		{
+			name:          "denied by MIME type",
+			content:       "MZfoobar",
+			contentLength: true,
+			body:          `{"status":"error","msg":"file denied by policy","signature":"","virus_found":false,"size":8,"mime_type":"application/vnd.microsoft.portable-executable","scan_duration_ms":0,"policy":{"rule":"binaries","action":"deny"}}`,
+		},
+		{
+			name:          "denied by size",
+			content:       largeText,
+			contentLength: true,
+			body:          `{"status":"error","msg":"file denied by policy","signature":"","virus_found":false,"size":120,"mime_type":"text/plain; charset=utf-8","scan_duration_ms":0,"policy":{"rule":"large text","action":"deny"}}`,
+		},
+		{
+			name:          "denied by the name of the query",
+			content:       "foobar",
+			contentLength: true,
+			query:         "?filename=setup.exe",
+			body:          `{"status":"error","msg":"file denied by policy","signature":"","virus_found":false,"filename":"setup.exe","size":6,"mime_type":"text/plain; charset=utf-8","scan_duration_ms":0,"policy":{"rule":"executables","action":"deny"}}`,
+		},
+		{
+			name:               "allowed by the name of the Content-Disposition",
+			content:            eicar,
+			contentLength:      true,
+			query:              "?filename=setup.exe",
+			contentDisposition: `attachment; filename="C:\\Users\\foo\\trusted-eicar.txt"`,
+			body:               `{"status":"noerror","msg":"file allowed by policy","signature":"","virus_found":false,"filename":"trusted-eicar.txt","size":68,"mime_type":"text/plain; charset=utf-8","scan_duration_ms":0,"policy":{"rule":"trusted","action":"allow"}}`,
+		},
+		{
+			name:    "denied by size, read entirely when sniffed",
+			content: largeText,
+			body:    `{"status":"error","msg":"file denied by policy","signature":"","virus_found":false,"size":120,"mime_type":"text/plain; charset=utf-8","scan_duration_ms":0,"policy":{"rule":"large text","action":"deny"}}`,
+		},
+		{
+			// Only the bytes read are known
+			name:    "denied by size before being scanned",
+			content: strings.Repeat(largeText, 10),
+			body:    `{"status":"error","msg":"file denied by policy","signature":"","virus_found":false,"size":512,"mime_type":"text/plain; charset=utf-8","scan_duration_ms":0,"policy":{"rule":"large text","action":"deny"}}`,
+		},
+		{
+			name:    "not denied by size",
+			content: "foobar",
+			body:    `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"size":6,` + foobarDetails + `}`,
+		},
+		{
+			name:    "infected, below the size limit",
+			content: eicar,
+			body:    `{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"size":68,` + eicarDetails + `}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioReadStream)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/stream"+tt.query, strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.contentLength {
+				// As for a chunked body
+				req.ContentLength = -1
+			}
+			if tt.contentDisposition != "" {
+				req.Header.Set("Content-Disposition", tt.contentDisposition)
+			}
+
+			rr := httptest.NewRecorder()
+			h.InStreamRaw(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.body, rr.Body.String())
+		})
+	}
+}
+
+func TestHandlerScanURLPolicy(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "foobar")
+	})
+	mux.HandleFunc("/trusted-eicar.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, eicar)
+	})
+	mux.HandleFunc("/large.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		// Flushed to be sent without a Content-Length
+		io.WriteString(w, largeText)
+		w.(http.Flusher).Flush()
+		io.WriteString(w, strings.Repeat(largeText, 9))
+	})
+	upstream := httptest.NewServer(mux)
+	defer upstream.Close()
+
+	h := NewHandler(&logger, &MockClamav{})
+	h.clock = testClock
+	h.Policy = newTestPolicy(t)
+	h.Fetcher = fetcher.New(fetcher.Options{
+		AllowedSchemes: []string{"http"},
+		AllowPrivate:   true,
+		MaxSize:        2048,
+		Timeout:        5 * time.Second,
+	})
+
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{
+			name: "denied by the name of the path",
+			path: "/download/setup.exe?version=1",
+			body: `{"status":"error","msg":"file denied by policy","signature":"","virus_found":false,"url":"{{upstream}}/download/setup.exe?version=1","content_type":"text/plain","filename":"setup.exe","size":6,"mime_type":"text/plain; charset=utf-8","scan_duration_ms":0,"policy":{"rule":"executables","action":"deny"}}`,
+		},
+		{
+			name: "allowed by the name of the path",
+			path: "/trusted-eicar.txt",
+			body: `{"status":"noerror","msg":"file allowed by policy","signature":"","virus_found":false,"url":"{{upstream}}/trusted-eicar.txt","content_type":"text/plain","filename":"trusted-eicar.txt","size":68,"mime_type":"text/plain; charset=utf-8","scan_duration_ms":0,"policy":{"rule":"trusted","action":"allow"}}`,
+		},
+		{
+			// Only the bytes read are known
+			name: "denied by size without a Content-Length",
+			path: "/large.txt",
+			body: `{"status":"error","msg":"file denied by policy","signature":"","virus_found":false,"url":"{{upstream}}/large.txt","content_type":"text/plain","filename":"large.txt","size":512,"mime_type":"text/plain; charset=utf-8","scan_duration_ms":0,"policy":{"rule":"large text","action":"deny"}}`,
+		},
+		{
+			name: "scanned",
+			path: "/file.txt",
+			body: `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"url":"{{upstream}}/file.txt","content_type":"text/plain","filename":"file.txt","size":6,` + foobarDetails + `}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioReadStream)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/url", strings.NewReader(`{"url":"`+upstream.URL+tt.path+`"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			h.ScanURL(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, strings.ReplaceAll(tt.body, "{{upstream}}", upstream.URL), rr.Body.String())
+		})
+	}
+}
+
+func TestHandlerSubmitJobPolicy(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	callbackURL, events := newWebhookReceiver(t)
+
+	h := NewHandler(&logger, &MockClamav{})
+	h.Policy = newTestPolicy(t)
+	h.Webhooks = newTestWebhooks(t)
+	// The workers aren't started: the scanned jobs stay queued
+	h.Jobs = newTestJobs(t, h.Clamav, 10)
+
+	submit := func(filename string, content string) *httptest.ResponseRecorder {
+		body, contentType := newMultipartBody(t, []formPart{{field: "file", filename: filename, content: content}})
+		req, err := http.NewRequest(http.MethodPost, "/rest/v1/jobs?callback_url="+callbackURL, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+
+		rr := httptest.NewRecorder()
+		h.SubmitJob(rr, req)
+		return rr
+	}
+
+	// Denied, without being queued
+	rr := submit("setup.exe", eicar)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"forbidden: file denied by policy: rule \"executables\""}`, rr.Body.String())
+
+	ev := receiveEvent(t, events)
+	assert.Equal(t, VerdictDenied, ev.Verdict)
+	assert.Equal(t, "executables", ev.Rule)
+	assert.Equal(t, webhook.File{Name: "setup.exe", Size: int64(len(eicar))}, ev.File)
+
+	// Allowed, done without being scanned
+	rr = submit("trusted-eicar.txt", eicar)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	var job JobResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &job))
+	assert.Equal(t, "done", job.Status)
+	assert.Equal(t, int64(len(eicar)), job.Size)
+	assert.Equal(t, &JobResult{Policy: &PolicyMatch{Rule: "trusted", Action: policy.ActionAllow}}, job.Result)
+
+	// Scanned
+	rr = submit("foobar.txt", "foobar")
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &job))
+	assert.Equal(t, "queued", job.Status)
+	assert.Equal(t, int64(6), job.Size)
+}
+
+func TestHandlerScanFilesPolicy(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	callbackURL, events := newWebhookReceiver(t)
+
+	h := NewHandler(&logger, &MockClamav{})
+	h.clock = testClock
+	h.Policy = newTestPolicy(t)
+	h.Webhooks = newTestWebhooks(t)
+
+	body, contentType := newMultipartBody(t, []formPart{
+		{field: "file", filename: "setup.exe", content: eicar},
+		{field: "file", filename: "trusted-eicar.txt", content: eicar},
+		{field: "file", filename: "large.txt", content: largeText},
+		{field: "file", filename: "foobar.txt", content: "foobar"},
+	})
+
+	ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioReadStream)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/files?callback_url="+callbackURL, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	rr := httptest.NewRecorder()
+	h.ScanFiles(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"file denied by policy","files":[`+
+		`{"field":"file","filename":"setup.exe","size":68,"verdict":"denied","signature":"",`+eicarDetails+`,"policy":{"rule":"executables","action":"deny"}},`+
+		`{"field":"file","filename":"trusted-eicar.txt","size":68,"verdict":"allowed","signature":"",`+eicarDetails+`,"policy":{"rule":"trusted","action":"allow"}},`+
+		`{"field":"file","filename":"large.txt","size":120,"verdict":"denied","signature":"",`+largeTextDetails+`,"policy":{"rule":"large text","action":"deny"}},`+
+		`{"field":"file","filename":"foobar.txt","size":6,"verdict":"clean","signature":"",`+foobarDetails+`}`+
+		`],"virus_found":false,"denied":true}`, rr.Body.String())
+
+	// The events may be delivered in any order
+	type decision struct{ verdict, rule string }
+	var decisions []decision
+	for range 4 {
+		ev := receiveEvent(t, events)
+		decisions = append(decisions, decision{ev.Verdict, ev.Rule})
+	}
+	assert.ElementsMatch(t, []decision{
+		{VerdictDenied, "executables"},
+		{VerdictAllowed, "trusted"},
+		{VerdictDenied, "large text"},
+		{VerdictClean, ""},
+	}, decisions)
+}
@@ -0,0 +1,311 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/jobs"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/rs/zerolog/hlog"
+)
+
+// QuarantineListResponse represents the json response of a /admin/quarantine endpoint.
+type QuarantineListResponse struct {
+	Items []QuarantinedItem `json:"items"`
+}
+
+// QuarantinedItem represents an infected file kept in the quarantine.
+type QuarantinedItem struct {
+	quarantine.Item
+
+	// Time the item is deleted at, unless there is no maximum age
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type QuarantineDeleteResponse struct {
+	Status string `json:"status"`
+}
+
+var ErrQuarantineNotConfigured = errors.New("quarantine is not enabled")
+
+// quarantineSource is the content of a file being scanned,
+// kept to be quarantined if the file is infected.
+type quarantineSource struct {
+	// Address of the client which uploaded the file
+	clientIP string
+
+	// Either the content of the file, read again when quarantined,
+	// or the spool the content is copied to while it is streamed
+	content io.ReadSeeker
+	spool   *quarantine.Spool
+}
+
+// quarantineContent returns the source of the file f of the request r,
+// or nil when the quarantine is disabled.
+func (h *Handler) quarantineContent(r *http.Request, f io.ReadSeeker) *quarantineSource {
+	if h.Quarantine == nil {
+		return nil
+	}
+	return &quarantineSource{clientIP: clientIP(r), content: f}
+}
+
+// quarantineSpool returns the source of a file of the request r which is
+// streamed, or nil when the quarantine is disabled. The content must be
+// written to its spool, which must be discarded once the scan is over.
+func (h *Handler) quarantineSpool(r *http.Request) *quarantineSource {
+	if h.Quarantine == nil {
+		return nil
+	}
+
+	spool, err := h.Quarantine.NewSpool()
+	if err != nil {
+		req_id, _ := hlog.IDFromCtx(r.Context())
+		h.Logger.Error().Str("req_id", req_id.String()).Err(err).Msg("unable to quarantine the streamed content")
+		return nil
+	}
+	return &quarantineSource{clientIP: clientIP(r), spool: spool}
+}
+
+// tee returns a reader writing what it reads from r to the spool of s, if any.
+func (s *quarantineSource) tee(r io.Reader) io.Reader {
+	if s == nil || s.spool == nil {
+		return r
+	}
+	return io.TeeReader(r, s.spool)
+}
+
+// discard discards the spool of s, if any.
+func (s *quarantineSource) discard() {
+	if s != nil && s.spool != nil {
+		s.spool.Discard()
+	}
+}
+
+// quarantine saves the content of the infected file in the quarantine,
+// along with its details, and records the id of the item in details.
+// The scan isn't failed when the file can't be quarantined.
+func (h *Handler) quarantine(reqID string, file webhook.File, signature string, details *ScanDetails) {
+	s := details.source
+	if s == nil {
+		return
+	}
+
+	item := &quarantine.Item{
+		FileName:  file.Name,
+		MIMEType:  details.MIMEType,
+		MD5:       details.MD5,
+		SHA1:      details.SHA1,
+		SHA256:    details.SHA256,
+		Signature: signature,
+		RequestID: reqID,
+		ClientIP:  s.clientIP,
+	}
+
+	// The item is saved even if the client went away meanwhile
+	ctx := context.Background()
+
+	var err error
+	if s.spool != nil {
+		err = s.spool.Commit(ctx, item)
+	} else if _, err = s.content.Seek(0, io.SeekStart); err == nil {
+		err = h.Quarantine.Put(ctx, item, s.content)
+	}
+	if err != nil {
+		h.Logger.Error().Str("req_id", reqID).Err(err).Msg("unable to quarantine the infected file")
+		return
+	}
+
+	h.Logger.Info().Str("req_id", reqID).Str("quarantine_id", item.ID).Str("signature", signature).Msg("infected file quarantined")
+	details.QuarantineID = item.ID
+}
+
+// QuarantineJob saves the upload of job, found infected, in the quarantine
+// and records the id of the item in job. The job isn't failed when the upload
+// can't be quarantined.
+//
+// It is meant to be called by the job manager before the upload is removed.
+func (h *Handler) QuarantineJob(job *jobs.Job, upload io.ReadSeeker) {
+	if h.Quarantine == nil {
+		return
+	}
+
+	d, err := digestFile(upload)
+	if err != nil {
+		h.Logger.Error().Str("req_id", job.RequestID).Str("job_id", job.ID).Err(err).Msg("unable to quarantine the infected file")
+		return
+	}
+
+	details := ScanDetails{source: &quarantineSource{clientIP: job.ClientIP, content: upload}}
+	d.fill(&details)
+	h.quarantine(job.RequestID, webhook.File{Name: job.FileName}, job.Signature, &details)
+	job.QuarantineID = details.QuarantineID
+}
+
+// clientIP returns the address of the client which sent r, without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ListQuarantine will return the items of the quarantine, most recent first.
+func (h *Handler) ListQuarantine(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	if h.Quarantine == nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", ErrQuarantineNotConfigured)
+		SetErrorResponse(w, ErrQuarantineNotConfigured)
+		return
+	}
+
+	items, err := h.Quarantine.List(r.Context())
+	if err != nil {
+		h.Logger.Error().Str("req_id", req_id.String()).Err(err).Msg("error while listing the quarantine")
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	listResp := QuarantineListResponse{Items: make([]QuarantinedItem, 0, len(items))}
+	for _, item := range items {
+		i := QuarantinedItem{Item: *item}
+		if expiresAt := h.Quarantine.ExpiresAt(item); !expiresAt.IsZero() {
+			i.ExpiresAt = &expiresAt
+		}
+		listResp.Items = append(listResp.Items, i)
+	}
+
+	resp, err := json.Marshal(&listResp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// DownloadQuarantine will return the quarantined item whose id is given
+// in the path as a zip archive protected by the password of the quarantine.
+func (h *Handler) DownloadQuarantine(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	if h.Quarantine == nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", ErrQuarantineNotConfigured)
+		SetErrorResponse(w, ErrQuarantineNotConfigured)
+		return
+	}
+
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+	// Checking that the item exists before anything is written
+	if _, err := h.Quarantine.Get(r.Context(), id); err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Str("quarantine_id", id).Msgf("%v", err)
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": id + ".zip"}))
+	w.WriteHeader(http.StatusOK)
+
+	if err := h.Quarantine.Export(r.Context(), w, id); err != nil {
+		h.Logger.Error().Str("req_id", req_id.String()).Str("quarantine_id", id).Err(err).Msg("error while downloading the quarantined item")
+	}
+}
+
+// ReleaseQuarantine will return the original content of the quarantined
+// item whose id is given in the path, and delete it from the quarantine
+// once it is entirely sent.
+func (h *Handler) ReleaseQuarantine(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	if h.Quarantine == nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", ErrQuarantineNotConfigured)
+		SetErrorResponse(w, ErrQuarantineNotConfigured)
+		return
+	}
+
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+	item, err := h.Quarantine.Get(r.Context(), id)
+	var content io.ReadCloser
+	if err == nil {
+		content, err = h.Quarantine.Open(r.Context(), id)
+	}
+	if err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Str("quarantine_id", id).Msgf("%v", err)
+
+		SetErrorResponse(w, err)
+		return
+	}
+	defer content.Close()
+
+	name := item.FileName
+	if name == "" {
+		name = item.ID
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.WriteHeader(http.StatusOK)
+
+	// The item is only deleted once released entirely
+	if _, err := io.Copy(w, content); err != nil {
+		h.Logger.Error().Str("req_id", req_id.String()).Str("quarantine_id", id).Err(err).Msg("error while releasing the quarantined item")
+		return
+	}
+	if err := h.Quarantine.Delete(r.Context(), id); err != nil {
+		h.Logger.Error().Str("req_id", req_id.String()).Str("quarantine_id", id).Err(err).Msg("error while deleting the released item")
+		return
+	}
+
+	h.Logger.Info().Str("req_id", req_id.String()).Str("quarantine_id", id).Str("signature", item.Signature).Msg("quarantined item released")
+}
+
+// DeleteQuarantine will delete the quarantined item whose id is given in the path.
+func (h *Handler) DeleteQuarantine(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	if h.Quarantine == nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", ErrQuarantineNotConfigured)
+		SetErrorResponse(w, ErrQuarantineNotConfigured)
+		return
+	}
+
+	id := httprouter.ParamsFromContext(r.Context()).ByName("id")
+
+	if err := h.Quarantine.Delete(r.Context(), id); err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Str("quarantine_id", id).Msgf("%v", err)
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	h.Logger.Info().Str("req_id", req_id.String()).Str("quarantine_id", id).Msg("quarantined item deleted")
+
+	resp, err := json.Marshal(&QuarantineDeleteResponse{Status: "DELETED"})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lescactus/clamav-api-go/internal/fetcher"
+	"github.com/lescactus/clamav-api-go/internal/helper"
+	"github.com/lescactus/clamav-api-go/internal/jobs"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestQuarantine(t *testing.T) *quarantine.Quarantine {
+	backend, err := quarantine.NewDirBackend(t.TempDir())
+	require.NoError(t, err)
+
+	q, err := quarantine.New(backend, quarantine.Options{
+		Key:         bytes.Repeat([]byte{0x42}, 32),
+		ZipPassword: "infected",
+		MaxAge:      24 * time.Hour,
+		SpoolDir:    t.TempDir(),
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(q.Close)
+
+	return q
+}
+
+// quarantinedContent returns the original content of the quarantined item id.
+func quarantinedContent(t *testing.T, q *quarantine.Quarantine, id string) string {
+	rc, err := q.Open(context.Background(), id)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestHandlerQuarantineScan(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	url, events := newWebhookReceiver(t)
+
+	h := NewHandler(&logger, mockClamav)
+	h.clock = func() time.Time { return time.Date(2023, time.July, 8, 8, 0, 0, 0, time.UTC) }
+	h.Webhooks = newTestWebhooks(t, url)
+	h.Quarantine = newTestQuarantine(t)
+
+	serve := func(handler http.HandlerFunc, scenario MockScenario, method string, path string, body io.Reader, contentType string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		ctx := context.WithValue(context.Background(), MockScenario(""), scenario)
+		req, err := http.NewRequestWithContext(ctx, method, path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.RemoteAddr = "192.0.2.1:54321"
+
+		hlog.RequestIDHandler("req_id", "X-Request-ID")(handler).ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		return rr
+	}
+
+	// Clean upload: nothing is quarantined
+	body, contentType := newMultipartBody(t, []formPart{{"file", "foo.txt", "foo"}})
+	rr := serve(h.InStream, ScenarioReadStream, http.MethodPost, "/rest/v1/scan", body, contentType)
+	assert.NotContains(t, rr.Body.String(), "quarantine_id")
+
+	// Infected upload
+	body, contentType = newMultipartBody(t, []formPart{{"file", "eicar.txt", eicar}})
+	rr = serve(h.InStream, ScenarioReadStream, http.MethodPost, "/rest/v1/scan", body, contentType)
+
+	var inStreamResp InStreamResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &inStreamResp))
+	require.NotEmpty(t, inStreamResp.QuarantineID)
+
+	ev := receiveEvent(t, events)
+	assert.Equal(t, inStreamResp.QuarantineID, ev.QuarantineID)
+
+	item, err := h.Quarantine.Get(context.Background(), inStreamResp.QuarantineID)
+	require.NoError(t, err)
+	assert.Equal(t, &quarantine.Item{
+		ID:            inStreamResp.QuarantineID,
+		FileName:      "eicar.txt",
+		Size:          int64(len(eicar)),
+		MIMEType:      "text/plain; charset=utf-8",
+		MD5:           "44d88612fea8a8f36de82e1278abb02f",
+		SHA1:          "3395856ce81f2b7382dee72602f798b642f14140",
+		SHA256:        eicarSHA256,
+		Signature:     "Win.Test.EICAR_HDB-1",
+		RequestID:     rr.Header().Get("X-Request-ID"),
+		ClientIP:      "192.0.2.1",
+		QuarantinedAt: item.QuarantinedAt,
+	}, item)
+	assert.Equal(t, eicar, quarantinedContent(t, h.Quarantine, item.ID))
+
+	// Streamed body, Clamd replying before reading it entirely
+	rr = serve(h.InStreamRaw, ScenarioErrVirusFound, http.MethodPut, "/rest/v1/scan/stream", strings.NewReader("foobar"), "text/plain")
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &inStreamResp))
+	require.NotEmpty(t, inStreamResp.QuarantineID)
+	assert.Equal(t, int64(6), inStreamResp.Size)
+	assert.Equal(t, "c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2", inStreamResp.SHA256)
+	assert.Equal(t, "foobar", quarantinedContent(t, h.Quarantine, inStreamResp.QuarantineID))
+	assert.Equal(t, inStreamResp.QuarantineID, receiveEvent(t, events).QuarantineID)
+
+	// Multipart form: only the infected files are quarantined
+	body, contentType = newMultipartBody(t, []formPart{
+		{"foo", "foo.txt", "foo"},
+		{"eicar", "eicar.com", eicar},
+	})
+	rr = serve(h.ScanFiles, ScenarioReadStream, http.MethodPost, "/rest/v1/scan/files", body, contentType)
+
+	var scanFilesResp ScanFilesResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &scanFilesResp))
+	require.Len(t, scanFilesResp.Files, 2)
+	assert.Empty(t, scanFilesResp.Files[0].QuarantineID)
+	require.NotEmpty(t, scanFilesResp.Files[1].QuarantineID)
+	assert.Equal(t, eicar, quarantinedContent(t, h.Quarantine, scanFilesResp.Files[1].QuarantineID))
+
+	item, err = h.Quarantine.Get(context.Background(), scanFilesResp.Files[1].QuarantineID)
+	require.NoError(t, err)
+	assert.Equal(t, "eicar.com", item.FileName)
+	assert.Equal(t, eicarSHA256, item.SHA256)
+
+	// Only the detections are notified to the global webhooks
+	ev = receiveEvent(t, events)
+	assert.Equal(t, webhook.EventVirusDetected, ev.Type)
+	assert.Equal(t, scanFilesResp.Files[1].QuarantineID, ev.QuarantineID)
+
+	// Downloaded content, Clamd replying before reading it entirely
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "foobar")
+	}))
+	defer upstream.Close()
+	h.Fetcher = fetcher.New(fetcher.Options{AllowedSchemes: []string{"http"}, AllowPrivate: true})
+
+	rr = serve(h.ScanURL, ScenarioErrVirusFound, http.MethodPost, "/rest/v1/scan/url", strings.NewReader(`{"url":"`+upstream.URL+`/foobar.txt"}`), "application/json")
+
+	var scanURLResp ScanURLResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &scanURLResp))
+	require.NotEmpty(t, scanURLResp.QuarantineID)
+	assert.Equal(t, "foobar", quarantinedContent(t, h.Quarantine, scanURLResp.QuarantineID))
+	assert.Equal(t, scanURLResp.QuarantineID, receiveEvent(t, events).QuarantineID)
+
+	item, err = h.Quarantine.Get(context.Background(), scanURLResp.QuarantineID)
+	require.NoError(t, err)
+	assert.Equal(t, "foobar.txt", item.FileName)
+	assert.Equal(t, "192.0.2.1", item.ClientIP)
+
+	// Upload of a job
+	job := &jobs.Job{
+		ID:        helper.NewID(),
+		FileName:  "eicar.txt",
+		RequestID: "cimuf5d3d0kc73ahh5h0",
+		ClientIP:  "192.0.2.2",
+		Signature: "Win.Test.EICAR_HDB-1",
+	}
+	h.QuarantineJob(job, strings.NewReader(eicar))
+	require.NotEmpty(t, job.QuarantineID)
+	assert.Equal(t, eicar, quarantinedContent(t, h.Quarantine, job.QuarantineID))
+
+	item, err = h.Quarantine.Get(context.Background(), job.QuarantineID)
+	require.NoError(t, err)
+	assert.Equal(t, &quarantine.Item{
+		ID:            job.QuarantineID,
+		FileName:      "eicar.txt",
+		Size:          int64(len(eicar)),
+		MIMEType:      "text/plain; charset=utf-8",
+		MD5:           "44d88612fea8a8f36de82e1278abb02f",
+		SHA1:          "3395856ce81f2b7382dee72602f798b642f14140",
+		SHA256:        eicarSHA256,
+		Signature:     "Win.Test.EICAR_HDB-1",
+		RequestID:     "cimuf5d3d0kc73ahh5h0",
+		ClientIP:      "192.0.2.2",
+		QuarantinedAt: item.QuarantinedAt,
+	}, item)
+
+	items, err := h.Quarantine.List(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, items, 5)
+}
+
+func TestHandlerQuarantineAdmin(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	h := NewHandler(&logger, &MockClamav{})
+
+	serve := func(handler http.HandlerFunc, method string, id string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		ctx := context.WithValue(context.Background(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: id}})
+		req, err := http.NewRequestWithContext(ctx, method, "/rest/v1/admin/quarantine/"+id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler(rr, req)
+		return rr
+	}
+
+	// The quarantine isn't enabled
+	for _, handler := range []http.HandlerFunc{h.ListQuarantine, h.DownloadQuarantine, h.ReleaseQuarantine, h.DeleteQuarantine} {
+		rr := serve(handler, http.MethodGet, "")
+		assert.Equal(t, http.StatusNotImplemented, rr.Code)
+		assert.Equal(t, `{"status":"error","msg":"not implemented: quarantine is not enabled"}`, rr.Body.String())
+	}
+
+	h.Quarantine = newTestQuarantine(t)
+
+	// Empty quarantine
+	rr := serve(h.ListQuarantine, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `{"items":[]}`, rr.Body.String())
+
+	item := &quarantine.Item{FileName: "eicar.txt", SHA256: eicarSHA256, Signature: "Win.Test.EICAR_HDB-1", ClientIP: "192.0.2.1"}
+	require.NoError(t, h.Quarantine.Put(context.Background(), item, strings.NewReader(eicar)))
+
+	rr = serve(h.ListQuarantine, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var listResp QuarantineListResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listResp))
+	require.Len(t, listResp.Items, 1)
+	assert.Equal(t, item.ID, listResp.Items[0].ID)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", listResp.Items[0].Signature)
+	assert.Equal(t, "192.0.2.1", listResp.Items[0].ClientIP)
+	require.NotNil(t, listResp.Items[0].ExpiresAt)
+	assert.True(t, item.QuarantinedAt.Add(24*time.Hour).Equal(*listResp.Items[0].ExpiresAt))
+
+	// Unknown item
+	for _, handler := range []http.HandlerFunc{h.DownloadQuarantine, h.ReleaseQuarantine, h.DeleteQuarantine} {
+		rr = serve(handler, http.MethodGet, "0123456789abcdef0123456789abcdef")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, `{"status":"error","msg":"not found: quarantined item not found: \"0123456789abcdef0123456789abcdef\""}`, rr.Body.String())
+	}
+
+	// Downloaded as an encrypted zip archive
+	rr = serve(h.DownloadQuarantine, http.MethodGet, item.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=`+item.ID+`.zip`, rr.Header().Get("Content-Disposition"))
+	assert.NotContains(t, rr.Body.String(), "EICAR")
+
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+	assert.Equal(t, eicarSHA256, zr.File[0].Name)
+	assert.Equal(t, "metadata.json", zr.File[1].Name)
+
+	// Released
+	rr = serve(h.ReleaseQuarantine, http.MethodPost, item.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/octet-stream", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=eicar.txt`, rr.Header().Get("Content-Disposition"))
+	assert.Equal(t, eicar, rr.Body.String())
+
+	_, err = h.Quarantine.Get(context.Background(), item.ID)
+	assert.ErrorIs(t, err, quarantine.ErrNotFound)
+
+	// Deleted
+	item = &quarantine.Item{Signature: "Win.Test.EICAR_HDB-1"}
+	require.NoError(t, h.Quarantine.Put(context.Background(), item, strings.NewReader(eicar)))
+
+	rr = serve(h.DeleteQuarantine, http.MethodDelete, item.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"status":"DELETED"}`, rr.Body.String())
+
+	rr = serve(h.DeleteQuarantine, http.MethodDelete, item.ID)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
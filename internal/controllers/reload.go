@@ -4,7 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
-	"github.com/lescactus/clamav-api-go/internal/clamav"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
 	"github.com/rs/zerolog/hlog"
 )
 
@@ -29,8 +29,24 @@ func (h *Handler) Reload(w http.ResponseWriter, r *http.Request) {
 
 	h.Logger.Debug().Str("req_id", req_id.String()).Msg("version command sent successfully")
 
+	// Clamd reloads in the background: the cached verdicts are no longer
+	// served once it reports the new signature database, which is checked
+	// right away and then periodically
+	if h.Versions != nil {
+		if err := h.Versions.Refresh(ctx); err != nil {
+			h.Logger.Warn().Str("req_id", req_id.String()).Msgf("error while refreshing clamav version: %v", err)
+		}
+	}
+
+	// The commands supported by Clamd may have changed with its configuration
+	if h.Capabilities != nil {
+		if err := h.Capabilities.Refresh(ctx, h.Clamav); err != nil {
+			h.Logger.Warn().Str("req_id", req_id.String()).Msgf("error while refreshing clamav capabilities: %v", err)
+		}
+	}
+
 	reload := ReloadResponse{
-		Status: string(clamav.RespReload),
+		Status: string(clamd.RespReload),
 	}
 
 	resp, err := json.Marshal(&reload)
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/justinas/alice"
+)
+
+// NewRouter returns a router serving all the endpoints of h,
+// each one wrapped by the middlewares of c.
+func NewRouter(h *Handler, c alice.Chain) *httprouter.Router {
+	r := httprouter.New()
+
+	r.Handler(http.MethodGet, "/rest/v1/ping", c.Append(h.RequireCommand("PING")).ThenFunc(h.Ping))
+	r.Handler(http.MethodGet, "/rest/v1/version", c.Append(h.RequireCommand("VERSION")).ThenFunc(h.Version))
+	r.Handler(http.MethodGet, "/rest/v1/stats", c.Append(h.RequireCommand("STATS")).ThenFunc(h.Stats))
+	r.Handler(http.MethodGet, "/rest/v2/stats", c.Append(h.RequireCommand("STATS")).ThenFunc(h.StatsV2))
+	r.Handler(http.MethodGet, "/rest/v1/versioncommands", c.ThenFunc(h.VersionCommands))
+	r.Handler(http.MethodGet, "/rest/v1/detstats", c.Append(h.RequireCommand("DETSTATS")).ThenFunc(h.DetStats))
+	r.Handler(http.MethodPost, "/rest/v1/detstats/clear", c.Append(h.RequireCommand("DETSTATSCLEAR")).ThenFunc(h.DetStatsClear))
+	r.Handler(http.MethodPost, "/rest/v1/reload", c.Append(h.RequireCommand("RELOAD")).ThenFunc(h.Reload))
+	r.Handler(http.MethodPost, "/rest/v1/shutdown", c.Append(h.RequireCommand("SHUTDOWN")).ThenFunc(h.Shutdown))
+	r.Handler(http.MethodPost, "/rest/v1/scan", c.Append(h.RequireCommand("INSTREAM")).ThenFunc(h.InStream))
+	r.Handler(http.MethodPut, "/rest/v1/scan/stream", c.Append(h.RequireCommand("INSTREAM")).ThenFunc(h.InStreamRaw))
+	r.Handler(http.MethodPost, "/rest/v1/scan/stream", c.Append(h.RequireCommand("INSTREAM")).ThenFunc(h.InStreamRaw))
+	r.Handler(http.MethodPost, "/rest/v1/scan/files", c.Append(h.RequireCommand("INSTREAM")).ThenFunc(h.ScanFiles))
+	r.Handler(http.MethodPost, "/rest/v1/scan/url", c.Append(h.RequireCommand("INSTREAM")).ThenFunc(h.ScanURL))
+	r.Handler(http.MethodPost, "/rest/v1/scan/path", c.ThenFunc(h.ScanPath))
+	r.Handler(http.MethodGet, "/rest/v1/scan/:sha256", c.ThenFunc(h.LookupHash))
+	r.Handler(http.MethodPost, "/rest/v1/jobs", c.Append(h.RequireCommand("INSTREAM")).ThenFunc(h.SubmitJob))
+	r.Handler(http.MethodGet, "/rest/v1/jobs/:id", c.ThenFunc(h.Job))
+	// The admin endpoints are authenticated with the admin token
+	admin := c.Append(h.RequireAdmin)
+	r.Handler(http.MethodGet, "/rest/v1/admin/breaker", admin.ThenFunc(h.BreakerStatus))
+	r.Handler(http.MethodGet, "/rest/v1/admin/capabilities", admin.ThenFunc(h.CapabilitiesStatus))
+	r.Handler(http.MethodGet, "/rest/v1/admin/quarantine", admin.ThenFunc(h.ListQuarantine))
+	r.Handler(http.MethodGet, "/rest/v1/admin/quarantine/:id/download", admin.ThenFunc(h.DownloadQuarantine))
+	r.Handler(http.MethodPost, "/rest/v1/admin/quarantine/:id/release", admin.ThenFunc(h.ReleaseQuarantine))
+	r.Handler(http.MethodDelete, "/rest/v1/admin/quarantine/:id", admin.ThenFunc(h.DeleteQuarantine))
+
+	return r
+}
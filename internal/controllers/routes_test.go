@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/justinas/alice"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRouter(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	r := NewRouter(NewHandler(&logger, &MockClamav{}), alice.New())
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/rest/v1/ping"},
+		{http.MethodGet, "/rest/v1/version"},
+		{http.MethodGet, "/rest/v1/stats"},
+		{http.MethodGet, "/rest/v2/stats"},
+		{http.MethodGet, "/rest/v1/versioncommands"},
+		{http.MethodGet, "/rest/v1/detstats"},
+		{http.MethodPost, "/rest/v1/detstats/clear"},
+		{http.MethodPost, "/rest/v1/reload"},
+		{http.MethodPost, "/rest/v1/shutdown"},
+		{http.MethodPost, "/rest/v1/scan"},
+		{http.MethodPut, "/rest/v1/scan/stream"},
+		{http.MethodPost, "/rest/v1/scan/stream"},
+		{http.MethodPost, "/rest/v1/scan/files"},
+		{http.MethodPost, "/rest/v1/scan/url"},
+		{http.MethodPost, "/rest/v1/scan/path"},
+		{http.MethodGet, "/rest/v1/scan/275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"},
+		{http.MethodPost, "/rest/v1/jobs"},
+		{http.MethodGet, "/rest/v1/jobs/cimuf5d3d0kc73ahh5h0"},
+		{http.MethodGet, "/rest/v1/admin/breaker"},
+		{http.MethodGet, "/rest/v1/admin/capabilities"},
+		{http.MethodGet, "/rest/v1/admin/quarantine"},
+		{http.MethodGet, "/rest/v1/admin/quarantine/0123456789abcdef0123456789abcdef/download"},
+		{http.MethodPost, "/rest/v1/admin/quarantine/0123456789abcdef0123456789abcdef/release"},
+		{http.MethodDelete, "/rest/v1/admin/quarantine/0123456789abcdef0123456789abcdef"},
+	}
+	for _, route := range routes {
+		h, _, _ := r.Lookup(route.method, route.path)
+		assert.NotNil(t, h, "%s %s", route.method, route.path)
+	}
+
+	h, _, _ := r.Lookup(http.MethodGet, "/rest/v1/scan")
+	assert.Nil(t, h)
+}
+
+func TestNewRouterAdmin(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	h := NewHandler(&logger, &MockClamav{})
+	h.Quarantine = newTestQuarantine(t)
+	h.AdminToken = "foobar"
+	r := NewRouter(h, alice.New())
+
+	serve := func(method string, path string, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Unauthenticated
+	for _, authorization := range []string{"", "Bearer foo", "Basic Zm9vYmFy", "foobar"} {
+		rr := serve(http.MethodGet, "/rest/v1/admin/quarantine", authorization)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, authorization)
+		assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+		assert.Equal(t, `{"status":"error","msg":"unauthorized: missing or invalid admin token"}`, rr.Body.String())
+	}
+	rr := serve(http.MethodDelete, "/rest/v1/admin/quarantine/0123456789abcdef0123456789abcdef", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Authenticated
+	rr = serve(http.MethodGet, "/rest/v1/admin/quarantine", "Bearer foobar")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"items":[]}`, rr.Body.String())
+
+	// The other endpoints aren't authenticated
+	rr = serve(http.MethodGet, "/rest/v1/jobs/0123456789abcdef0123456789abcdef", "")
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+
+	// Without admin token
+	h.AdminToken = ""
+	rr = serve(http.MethodGet, "/rest/v1/admin/quarantine", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog/hlog"
+)
+
+// Verdicts of the scan of a file
+const (
+	VerdictClean    = "clean"
+	VerdictInfected = "infected"
+	VerdictError    = "error"
+
+	// The file was allowed or denied by the scan policy without being scanned
+	VerdictAllowed = "allowed"
+	VerdictDenied  = "denied"
+)
+
+// ScanFilesResponse represents the json response of a /scan/files endpoint.
+// It contains one result per file of the multipart form.
+type ScanFilesResponse struct {
+	Status     string           `json:"status"`
+	Msg        string           `json:"msg"`
+	Files      []ScanFileResult `json:"files"`
+	VirusFound bool             `json:"virus_found"`
+
+	// Whether a file was denied by the scan policy
+	Denied bool `json:"denied,omitempty"`
+}
+
+// ScanFileResult represents the result of the scan
+// of a single file of a multipart form.
+type ScanFileResult struct {
+	Field     string `json:"field"`
+	FileName  string `json:"filename"`
+	Size      int64  `json:"size"`
+	Verdict   string `json:"verdict"`
+	Signature string `json:"signature"`
+	Error     string `json:"error,omitempty"`
+	ScanDetails
+}
+
+var ErrNoFile = errors.New("no file in multipart form")
+
+// ScanFiles will scan every file of the multipart form of the request
+// with the "INSTREAM" command.
+//
+// The form is read part by part: each file is streamed to Clamd while
+// it is being received, without being buffered in memory nor on disk.
+// The form fields which aren't files are ignored, and the files
+// allowed or denied by the scan policy aren't sent to Clamd.
+//
+// A file Clamd fails to scan is reported with the "error" verdict, the
+// request only failing when the form itself can't be read.
+func (h *Handler) ScanFiles(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	callbackURL, err := h.callbackURL(r)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", err)
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		e := fmt.Errorf("%w: %w", ErrFormFile, err)
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", e)
+
+		SetErrorResponse(w, e)
+		return
+	}
+
+	scanFilesResp := ScanFilesResponse{
+		Status: "noerror",
+		Msg:    "OK",
+		Files:  make([]ScanFileResult, 0),
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			e := fmt.Errorf("%w: %w", ErrFormFile, err)
+			h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", e)
+
+			SetErrorResponse(w, e)
+			return
+		}
+
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		result, err := h.scanPart(r, req_id.String(), part)
+		if err != nil {
+			h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", err)
+
+			SetErrorResponse(w, err)
+			return
+		}
+
+		switch result.Verdict {
+		case VerdictInfected:
+			scanFilesResp.VirusFound = true
+		case VerdictDenied:
+			scanFilesResp.Denied = true
+		}
+
+		scanFilesResp.Files = append(scanFilesResp.Files, result)
+	}
+
+	// Notifying once the whole form is read, as the request may still fail
+	for _, result := range scanFilesResp.Files {
+		ev := scanEvent(result.Signature, webhook.File{Name: result.FileName, Size: result.Size, Field: result.Field})
+		ev.QuarantineID = result.QuarantineID
+		switch result.Verdict {
+		case VerdictError:
+			ev.Verdict = VerdictError
+			ev.Error = result.Error
+		case VerdictAllowed, VerdictDenied:
+			ev.Verdict = result.Verdict
+			ev.Rule = result.Policy.Rule
+		}
+		h.notify(req_id.String(), callbackURL, ev)
+	}
+
+	if len(scanFilesResp.Files) == 0 {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", ErrNoFile)
+
+		SetErrorResponse(w, fmt.Errorf("%w: %w", ErrFormFile, ErrNoFile))
+		return
+	}
+
+	switch {
+	case scanFilesResp.VirusFound:
+		scanFilesResp.Status = "error"
+		scanFilesResp.Msg = clamd.ErrVirusFound.Error()
+	case scanFilesResp.Denied:
+		scanFilesResp.Status = "error"
+		scanFilesResp.Msg = ErrPolicyDenied.Error()
+	}
+
+	resp, err := json.Marshal(&scanFilesResp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// scanPart scans part, a file of the multipart form of a ScanFiles request,
+// and returns its result. The part is read until its end, and its content
+// and spool are released once it is scanned.
+//
+// A file Clamd fails to scan gets the "error" verdict: an error is only
+// returned when the form can't be read.
+func (h *Handler) scanPart(r *http.Request, reqID string, part *multipart.Part) (ScanFileResult, error) {
+	details := h.newScanDetails()
+
+	result := ScanFileResult{
+		Field:    part.FormName(),
+		FileName: part.FileName(),
+		Verdict:  VerdictClean,
+	}
+
+	// The size of the parts is never known before they are read: their
+	// beginning is read beforehand when it is needed by the policy
+	var content *policyContent
+	var err error
+	details.Policy, content, err = h.matchPolicyStream(part.FileName(), part, -1)
+	if err != nil {
+		if errors.Is(err, clamd.ErrReadStream) {
+			err = fmt.Errorf("%w: %w", ErrFormFile, err)
+		}
+		return result, err
+	}
+	defer content.Close()
+	scanned := details.Policy.verdict() == ""
+
+	// The file is hashed while being streamed, to be reported and to
+	// record its verdict, and spooled to be quarantined if infected
+	if scanned {
+		details.source = h.quarantineSpool(r)
+		defer details.source.discard()
+	}
+	f := newDigestReader(details.source.tee(content))
+
+	var inStream []byte
+	if scanned {
+		inStream, err = h.Clamav.InStream(details.scanContext(r.Context()), f)
+	} else {
+		result.Verdict = details.Policy.verdict()
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, clamd.ErrVirusFound):
+		result.Verdict = VerdictInfected
+		result.Signature = h.parseSignature(string(inStream))
+	case errors.Is(err, clamd.ErrReadStream):
+		return result, fmt.Errorf("%w: %w", ErrFormFile, err)
+	default:
+		// The other files can still be scanned as long as
+		// the form can be read, Clamd may be back meanwhile
+		h.Logger.Error().Str("req_id", reqID).Str("file_name", result.FileName).Err(err).Msg("error while scanning file")
+
+		result.Verdict = VerdictError
+		result.Error = scanErrorMessage(err)
+	}
+
+	// Clamd may reply before the end of the file, which must
+	// be read anyway to know its size and reach the next part
+	if _, err := io.Copy(io.Discard, f); err != nil {
+		return result, fmt.Errorf("%w: %w", ErrFormFile, err)
+	}
+	result.Size = f.n
+
+	f.fill(&details)
+	h.finishScanDetails(&details)
+	if result.Verdict == VerdictInfected {
+		h.quarantine(reqID, webhook.File{Name: result.FileName}, result.Signature, &details)
+	}
+	result.ScanDetails = details
+	if scanned {
+		h.recordVerdict(reqID, &details, inStream, err)
+	}
+
+	h.Logger.Debug().
+		Str("req_id", reqID).
+		Str("file_name", result.FileName).
+		Int64("file_size", result.Size).
+		Str("verdict", result.Verdict).
+		Msg("multipart file scanned")
+
+	return result, nil
+}
+
+// scanErrorMessage returns the message reporting err, the error
+// returned by Clamd while scanning a file, as SetErrorResponse does.
+func scanErrorMessage(err error) string {
+	switch {
+	case isNetError(err):
+		return "something wrong happened while communicating with clamav"
+	case errors.Is(err, clamd.ErrUnknownCommand):
+		return "unknown command sent to clamav"
+	default:
+		return "clamav: " + err.Error()
+	}
+}
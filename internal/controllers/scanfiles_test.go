@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// formPart is a part of a multipart form. It is a file if filename isn't empty.
+type formPart struct {
+	field    string
+	filename string
+	content  string
+}
+
+// newMultipartBody returns a multipart form made of parts and its content type.
+func newMultipartBody(t *testing.T, parts []formPart) (io.Reader, string) {
+	b := &bytes.Buffer{}
+	writer := multipart.NewWriter(b)
+
+	for _, p := range parts {
+		var w io.Writer
+		var err error
+		if p.filename != "" {
+			w, err = writer.CreateFormFile(p.field, p.filename)
+		} else {
+			w, err = writer.CreateFormField(p.field)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, p.content)
+	}
+	writer.Close()
+
+	return b, writer.FormDataContentType()
+}
+
+func TestHandlerScanFiles(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	type args struct {
+		scenario MockScenario
+		parts    []formPart
+	}
+	type want struct {
+		status int
+		body   string
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "no error",
+			args: args{
+				scenario: ScenarioReadStream,
+				parts: []formPart{
+					{field: "description", content: "attachments"},
+					{field: "file", filename: "foo.txt", content: "foo"},
+					{field: "attachment", filename: "foobar.txt", content: "foobar"},
+				},
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   `{"status":"noerror","msg":"OK","files":[{"field":"file","filename":"foo.txt","size":3,"verdict":"clean","signature":"",` + fooDetails + `},{"field":"attachment","filename":"foobar.txt","size":6,"verdict":"clean","signature":"",` + foobarDetails + `}],"virus_found":false}`,
+			},
+		},
+		{
+			name: "virus found",
+			args: args{
+				scenario: ScenarioReadStream,
+				parts: []formPart{
+					{field: "file", filename: "foo.txt", content: "foo"},
+					{field: "file", filename: "eicar.txt", content: eicar},
+				},
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   `{"status":"error","msg":"file contains potential virus","files":[{"field":"file","filename":"foo.txt","size":3,"verdict":"clean","signature":"",` + fooDetails + `},{"field":"file","filename":"eicar.txt","size":68,"verdict":"infected","signature":"Win.Test.EICAR_HDB-1",` + eicarDetails + `}],"virus_found":true}`,
+			},
+		},
+		{
+			name: "size limit exceeded",
+			args: args{
+				scenario: ScenarioErrScanFileSizeLimitExceeded,
+				parts: []formPart{
+					{field: "file", filename: "foobar.txt", content: "foobar"},
+				},
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   `{"status":"noerror","msg":"OK","files":[{"field":"file","filename":"foobar.txt","size":6,"verdict":"error","signature":"","error":"clamav: size limit exceeded",` + foobarDetails + `}],"virus_found":false}`,
+			},
+		},
+		{
+			name: "no file",
+			args: args{
+				scenario: ScenarioReadStream,
+				parts: []formPart{
+					{field: "description", content: "attachments"},
+				},
+			},
+			want: want{
+				status: http.StatusBadRequest,
+				body:   `{"status":"error","msg":"bad request: failed to parse file: no file in multipart form"}`,
+			},
+		},
+		{
+			name: "request too large",
+			args: args{
+				scenario: ScenarioReadStream,
+				parts: []formPart{
+					{field: "file", filename: "foobar.txt", content: strings.Repeat("a", 2048)},
+				},
+			},
+			want: want{
+				status: http.StatusRequestEntityTooLarge,
+				body:   `{"status":"error","msg":"request entity too large: http: request body too large"}`,
+			},
+		},
+		{
+			name: "error is net error",
+			args: args{
+				scenario: ScenarioNetError,
+				parts: []formPart{
+					{field: "file", filename: "foobar.txt", content: "foobar"},
+					{field: "file", filename: "foo.txt", content: "foo"},
+				},
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   `{"status":"noerror","msg":"OK","files":[{"field":"file","filename":"foobar.txt","size":6,"verdict":"error","signature":"","error":"something wrong happened while communicating with clamav",` + foobarDetails + `},{"field":"file","filename":"foo.txt","size":3,"verdict":"error","signature":"","error":"something wrong happened while communicating with clamav",` + fooDetails + `}],"virus_found":false}`,
+			},
+		},
+		{
+			name: "error is ErrUnknownResponse",
+			args: args{
+				scenario: ScenarioErrUnknownResponse,
+				parts: []formPart{
+					{field: "file", filename: "foobar.txt", content: "foobar"},
+				},
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   `{"status":"noerror","msg":"OK","files":[{"field":"file","filename":"foobar.txt","size":6,"verdict":"error","signature":"","error":"clamav: unknown response from clamav",` + foobarDetails + `}],"virus_found":false}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, mockClamav)
+			h.clock = testClock
+			rr := httptest.NewRecorder()
+			handler := MaxReqSize(1024)(http.HandlerFunc(h.ScanFiles))
+
+			body, contentType := newMultipartBody(t, tt.args.parts)
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.args.scenario)
+			req, err := http.NewRequestWithContext(ctx, "POST", "/rest/v1/scan/files", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", contentType)
+
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.want.status, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want.body, rr.Body.String())
+		})
+	}
+
+	// Not a multipart form
+	h := NewHandler(&logger, mockClamav)
+	rr := httptest.NewRecorder()
+
+	req, err := http.NewRequest("POST", "/rest/v1/scan/files", strings.NewReader("foobar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	http.HandlerFunc(h.ScanFiles).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, `{"status":"error","msg":"bad request: failed to parse file: request Content-Type isn't multipart/form-data"}`, rr.Body.String())
+}
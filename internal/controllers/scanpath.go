@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog/hlog"
+)
+
+// ScanPathRequest represents the json request of a /scan/path endpoint.
+type ScanPathRequest struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+}
+
+// ScanPathResponse represents the json response of a /scan/path endpoint.
+type ScanPathResponse struct {
+	Status     string           `json:"status"`
+	Msg        string           `json:"msg"`
+	Path       string           `json:"path"`
+	Mode       string           `json:"mode"`
+	Results    []ScanPathResult `json:"results"`
+	Errors     []ScanPathError  `json:"errors,omitempty"`
+	VirusFound bool             `json:"virus_found"`
+}
+
+// ScanPathResult represents an infected file
+// found while scanning a path.
+type ScanPathResult struct {
+	Path      string `json:"path"`
+	Signature string `json:"signature"`
+}
+
+// ScanPathError represents a file which couldn't
+// be scanned while scanning a path.
+type ScanPathError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+var (
+	ErrScanPathRequest    = errors.New("failed to parse scan path request")
+	ErrScanPathNotAllowed = errors.New("path not allowed")
+)
+
+// defaultScanMode is the scan mode used when
+// none is given in the request.
+const defaultScanMode = clamd.ScanModeContScan
+
+func (h *Handler) ScanPath(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	callbackURL, err := h.callbackURL(r)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", err)
+		SetErrorResponse(w, err)
+		return
+	}
+
+	var req ScanPathRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		e := fmt.Errorf("%w: %v", ErrScanPathRequest, err)
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", e)
+		SetErrorResponse(w, e)
+		return
+	}
+
+	mode := defaultScanMode
+	if req.Mode != "" {
+		m, err := clamd.ParseScanMode(req.Mode)
+		if err != nil {
+			e := fmt.Errorf("%w: %v", ErrScanPathRequest, err)
+			h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", e)
+			SetErrorResponse(w, e)
+			return
+		}
+		mode = m
+	}
+
+	if err := h.requireCommand(string(mode)); err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", err)
+		SetErrorResponse(w, err)
+		return
+	}
+
+	path, err := h.allowedScanPath(req.Path)
+	if err != nil {
+		h.Logger.Warn().Str("req_id", req_id.String()).Str("path", req.Path).Msgf("%v", err)
+		SetErrorResponse(w, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	results, err := h.Clamav.ScanPath(ctx, path, mode)
+	if err != nil {
+		h.Logger.Error().Str("req_id", req_id.String()).Msgf("error while scanning path: %v", err)
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	h.Logger.Debug().Str("req_id", req_id.String()).Str("path", path).Msg("path scanned successfully")
+
+	scanPathResp := ScanPathResponse{
+		Status:  "noerror",
+		Msg:     "OK",
+		Path:    path,
+		Mode:    strings.ToLower(string(mode)),
+		Results: make([]ScanPathResult, 0, len(results)),
+	}
+	for _, res := range results {
+		if res.Error != "" {
+			scanPathResp.Errors = append(scanPathResp.Errors, ScanPathError{
+				Path:  res.Path,
+				Error: res.Error,
+			})
+			continue
+		}
+		scanPathResp.Results = append(scanPathResp.Results, ScanPathResult{
+			Path:      res.Path,
+			Signature: res.Signature,
+		})
+	}
+	if len(scanPathResp.Errors) > 0 {
+		h.Logger.Warn().Str("req_id", req_id.String()).Str("path", path).Int("errors", len(scanPathResp.Errors)).Msg("some files couldn't be scanned")
+
+		scanPathResp.Status = "error"
+		scanPathResp.Msg = clamd.ErrScanPath.Error()
+	}
+	if len(scanPathResp.Results) > 0 {
+		scanPathResp.Status = "error"
+		scanPathResp.Msg = clamd.ErrVirusFound.Error()
+		scanPathResp.VirusFound = true
+	}
+
+	// One event per infected file, or a single one when the path is clean
+	for _, res := range scanPathResp.Results {
+		h.notify(req_id.String(), callbackURL, scanEvent(res.Signature, webhook.File{Path: res.Path}))
+	}
+	if len(results) == 0 {
+		h.notify(req_id.String(), callbackURL, scanEvent("", webhook.File{Path: path}))
+	}
+
+	resp, err := json.Marshal(&scanPathResp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// allowedScanPath will clean the given path and ensure it is located
+// under one of the prefixes of the scan path allowlist.
+//
+// Symbolic links are resolved when the path exists locally, so that
+// they can't be used to escape the allowlist.
+//
+// It returns the cleaned path or ErrScanPathNotAllowed.
+func (h *Handler) allowedScanPath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("%w: %q is not absolute", ErrScanPathNotAllowed, path)
+	}
+
+	path = filepath.Clean(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	for _, prefix := range h.ScanPathAllowlist {
+		if prefix == "" {
+			continue
+		}
+
+		prefix = filepath.Clean(prefix)
+		if resolved, err := filepath.EvalSymlinks(prefix); err == nil {
+			prefix = resolved
+		}
+
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, string(filepath.Separator))+string(filepath.Separator)) {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrScanPathNotAllowed, path)
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerScanPath(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	type args struct {
+		scenario MockScenario
+		body     string
+	}
+	type want struct {
+		status int
+		body   []byte
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "no error",
+			args: args{
+				scenario: ScenarioNoError,
+				body:     `{"path":"/data/uploads","mode":"scan"}`,
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"status":"noerror","msg":"OK","path":"/data/uploads","mode":"scan","results":[],"virus_found":false}`),
+			},
+		},
+		{
+			name: "no error - default mode",
+			args: args{
+				scenario: ScenarioNoError,
+				body:     `{"path":"/data/uploads"}`,
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"status":"noerror","msg":"OK","path":"/data/uploads","mode":"contscan","results":[],"virus_found":false}`),
+			},
+		},
+		{
+			name: "virus found",
+			args: args{
+				scenario: ScenarioErrVirusFound,
+				body:     `{"path":"/data/uploads","mode":"MULTISCAN"}`,
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"status":"error","msg":"file contains potential virus","path":"/data/uploads","mode":"multiscan","results":[{"path":"/data/uploads/eicar.txt","signature":"Win.Test.EICAR_HDB-1"},{"path":"/data/uploads/eicar.com","signature":"Eicar-Signature"}],"virus_found":true}`),
+			},
+		},
+		{
+			name: "unreadable files",
+			args: args{
+				scenario: ScenarioScanPathErrors,
+				body:     `{"path":"/data/uploads"}`,
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"status":"error","msg":"file contains potential virus","path":"/data/uploads","mode":"contscan","results":[{"path":"/data/uploads/eicar.txt","signature":"Win.Test.EICAR_HDB-1"}],"errors":[{"path":"/data/uploads/secret","error":"Can't open file or directory"}],"virus_found":true}`),
+			},
+		},
+		{
+			name: "unreadable path",
+			args: args{
+				scenario: ScenarioErrScanPath,
+				body:     `{"path":"/data/uploads/foo"}`,
+			},
+			want: want{
+				status: http.StatusUnprocessableEntity,
+				body:   []byte(`{"status":"error","msg":"unprocessable entity: error while scanning path: /data/uploads/foo: lstat() failed: No such file or directory."}`),
+			},
+		},
+		{
+			name: "invalid json",
+			args: args{
+				scenario: ScenarioNoError,
+				body:     `{"path":`,
+			},
+			want: want{
+				status: http.StatusBadRequest,
+				body:   []byte(`{"status":"error","msg":"bad request: failed to parse scan path request: unexpected EOF"}`),
+			},
+		},
+		{
+			name: "invalid mode",
+			args: args{
+				scenario: ScenarioNoError,
+				body:     `{"path":"/data/uploads","mode":"instream"}`,
+			},
+			want: want{
+				status: http.StatusBadRequest,
+				body:   []byte(`{"status":"error","msg":"bad request: failed to parse scan path request: invalid scan mode: \"instream\""}`),
+			},
+		},
+		{
+			name: "path not allowed",
+			args: args{
+				scenario: ScenarioNoError,
+				body:     `{"path":"/etc"}`,
+			},
+			want: want{
+				status: http.StatusForbidden,
+				body:   []byte(`{"status":"error","msg":"forbidden: path not allowed: \"/etc\""}`),
+			},
+		},
+		{
+			name: "path escaping the allowlist",
+			args: args{
+				scenario: ScenarioNoError,
+				body:     `{"path":"/data/uploads/../../etc"}`,
+			},
+			want: want{
+				status: http.StatusForbidden,
+				body:   []byte(`{"status":"error","msg":"forbidden: path not allowed: \"/etc\""}`),
+			},
+		},
+		{
+			name: "error is net error",
+			args: args{
+				scenario: ScenarioNetError,
+				body:     `{"path":"/data/uploads"}`,
+			},
+			want: want{
+				status: http.StatusBadGateway,
+				body:   []byte(`{"status":"error","msg":"something wrong happened while communicating with clamav"}`),
+			},
+		},
+		{
+			name: "error is ErrUnknownCommand",
+			args: args{
+				scenario: ScenarioErrUnknownCommand,
+				body:     `{"path":"/data/uploads"}`,
+			},
+			want: want{
+				status: http.StatusInternalServerError,
+				body:   []byte(`{"status":"error","msg":"unknown command sent to clamav"}`),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, mockClamav)
+			h.ScanPathAllowlist = []string{"/data/uploads", "/data/shared/"}
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(h.ScanPath)
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.args.scenario)
+			req, err := http.NewRequestWithContext(ctx, "POST", "/rest/v1/scan/path", strings.NewReader(tt.args.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handler.ServeHTTP(rr, req)
+
+			resp := rr.Result()
+			body, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.want.status, resp.StatusCode)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want.body, body)
+		})
+	}
+}
+
+func TestHandlerAllowedScanPath(t *testing.T) {
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "allowed")
+	forbidden := filepath.Join(dir, "forbidden")
+	assert.NoError(t, os.Mkdir(allowed, 0o755))
+	assert.NoError(t, os.Mkdir(forbidden, 0o755))
+
+	// Symbolic link escaping the allowlist
+	assert.NoError(t, os.Symlink(forbidden, filepath.Join(allowed, "link")))
+
+	h := &Handler{ScanPathAllowlist: []string{allowed}}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "allowed prefix", path: allowed},
+		{name: "under allowed prefix", path: filepath.Join(allowed, "foo")},
+		{name: "relative path", path: "allowed/foo", wantErr: true},
+		{name: "sibling with same prefix", path: allowed + "-foo", wantErr: true},
+		{name: "parent directory", path: filepath.Join(allowed, ".."), wantErr: true},
+		{name: "symbolic link", path: filepath.Join(allowed, "link"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.allowedScanPath(tt.path)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrScanPathNotAllowed)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	// Nothing is allowed with an empty allowlist
+	h = &Handler{}
+	_, err := h.allowedScanPath(allowed)
+	assert.ErrorIs(t, err, ErrScanPathNotAllowed)
+}
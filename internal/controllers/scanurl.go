@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog/hlog"
+)
+
+// ScanURLRequest represents the json request of a /scan/url endpoint.
+type ScanURLRequest struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+// ScanURLResponse represents the json response of a /scan/url endpoint.
+type ScanURLResponse struct {
+	Status      string `json:"status"`
+	Msg         string `json:"msg"`
+	Signature   string `json:"signature"`
+	VirusFound  bool   `json:"virus_found"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	FileName    string `json:"filename,omitempty"`
+	Size        int64  `json:"size"`
+	ScanDetails
+}
+
+var (
+	ErrScanURLRequest       = errors.New("failed to parse scan url request")
+	ErrFetchURL             = errors.New("failed to fetch url")
+	ErrFetcherNotConfigured = errors.New("scanning urls is not enabled")
+)
+
+// ScanURL will download the content of the url of the request
+// and stream it to Clamd with the "INSTREAM" command.
+//
+// The content is neither buffered in memory nor spooled to disk, unless
+// the scan policy needs its size while it has no Content-Length.
+// The response contains the url the content was fetched from,
+// once the redirects followed, and its content type. The name
+// of the content, matched by the scan policy, is the last
+// segment of the path of this url.
+func (h *Handler) ScanURL(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	if h.Fetcher == nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", ErrFetcherNotConfigured)
+		SetErrorResponse(w, ErrFetcherNotConfigured)
+		return
+	}
+
+	callbackURL, err := h.callbackURL(r)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", err)
+		SetErrorResponse(w, err)
+		return
+	}
+
+	var req ScanURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		e := fmt.Errorf("%w: %v", ErrScanURLRequest, err)
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", e)
+		SetErrorResponse(w, e)
+		return
+	}
+	if req.URL == "" {
+		e := fmt.Errorf("%w: missing url", ErrScanURLRequest)
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", e)
+		SetErrorResponse(w, e)
+		return
+	}
+
+	header := make(http.Header, len(req.Headers))
+	for k, v := range req.Headers {
+		header.Set(k, v)
+	}
+
+	ctx := r.Context()
+
+	fetched, err := h.Fetcher.Fetch(ctx, req.URL, header)
+	if err != nil {
+		e := fmt.Errorf("%w: %w", ErrFetchURL, err)
+		h.Logger.Warn().Str("req_id", req_id.String()).Str("url", req.URL).Msgf("%v", e)
+		SetErrorResponse(w, e)
+		return
+	}
+	defer fetched.Body.Close()
+
+	h.Logger.Debug().
+		Str("req_id", req_id.String()).
+		Str("url", fetched.URL).
+		Str("content_type", fetched.ContentType).
+		Msg("streaming remote content to clamav")
+
+	name := urlFileName(fetched.URL)
+	details := h.newScanDetails()
+
+	// The scan policy is applied before anything is sent to Clamd.
+	// Without a Content-Length, the beginning of the content is
+	// read beforehand when its size is needed
+	var content *policyContent
+	details.Policy, content, err = h.matchPolicyStream(name, fetched.Body, fetched.ContentLength)
+	if err != nil {
+		if errors.Is(err, clamd.ErrReadStream) {
+			err = fmt.Errorf("%w: %w", ErrFetchURL, err)
+		}
+		h.Logger.Warn().Str("req_id", req_id.String()).Str("url", fetched.URL).Msgf("%v", err)
+		SetErrorResponse(w, err)
+		return
+	}
+	defer content.Close()
+
+	if v := details.Policy.verdict(); v != "" {
+		h.Logger.Debug().Str("req_id", req_id.String()).Str("url", fetched.URL).Str("rule", details.Policy.Rule).Msgf("content %s by policy", v)
+
+		// Without a Content-Length, only the bytes read may be known
+		details.MIMEType = content.mimeType
+		h.finishScanDetails(&details)
+
+		policyResp := policyResponse(details)
+		h.writeScanURLResponse(w, req_id.String(), callbackURL, ScanURLResponse{
+			Status:      policyResp.Status,
+			Msg:         policyResp.Msg,
+			URL:         fetched.URL,
+			ContentType: fetched.ContentType,
+			FileName:    name,
+			Size:        content.size,
+			ScanDetails: details,
+		})
+		return
+	}
+
+	// The content is hashed while being streamed, to be
+	// reported, and spooled to be quarantined if infected
+	details.source = h.quarantineSpool(r)
+	defer details.source.discard()
+
+	body := newDigestReader(details.source.tee(content))
+	inStream, err := h.Clamav.InStream(details.scanContext(ctx), body)
+
+	// Clamd may reply before the end of the content, which
+	// must be read anyway for the spool to be complete
+	if errors.Is(err, clamd.ErrVirusFound) && details.source != nil && !body.eof {
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			h.Logger.Error().Str("req_id", req_id.String()).Err(err).Msg("unable to quarantine the downloaded content")
+
+			details.source.discard()
+			details.source = nil
+		}
+	}
+
+	body.fill(&details)
+	h.finishScanDetails(&details)
+
+	scanURLResp := ScanURLResponse{
+		Status:      "noerror",
+		Msg:         string(clamd.RespScan),
+		URL:         fetched.URL,
+		ContentType: fetched.ContentType,
+		FileName:    name,
+		Size:        body.n,
+		ScanDetails: details,
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, clamd.ErrVirusFound):
+		h.Logger.Debug().Str("req_id", req_id.String()).Msg(err.Error())
+
+		scanURLResp.Status = "error"
+		scanURLResp.Msg = clamd.ErrVirusFound.Error()
+		scanURLResp.Signature = h.parseSignature(string(inStream))
+		scanURLResp.VirusFound = true
+	case errors.Is(err, clamd.ErrReadStream):
+		e := fmt.Errorf("%w: %w", ErrFetchURL, err)
+		h.Logger.Warn().Str("req_id", req_id.String()).Str("url", fetched.URL).Msgf("%v", e)
+		SetErrorResponse(w, e)
+		return
+	default:
+		h.Logger.Debug().Str("req_id", req_id.String()).Err(err).Msg("error while scanning url")
+		SetErrorResponse(w, err)
+		return
+	}
+
+	h.Logger.Debug().Str("req_id", req_id.String()).Str("url", fetched.URL).Int64("size", body.n).Msg("url scanned successfully")
+
+	h.writeScanURLResponse(w, req_id.String(), callbackURL, scanURLResp)
+}
+
+// writeScanURLResponse writes scanURLResp as the response to
+// the scan of a url, after notifying the webhooks of it.
+// An infected content is quarantined beforehand, if enabled.
+func (h *Handler) writeScanURLResponse(w http.ResponseWriter, reqID string, callbackURL string, scanURLResp ScanURLResponse) {
+	file := webhook.File{
+		Name:        scanURLResp.FileName,
+		Size:        scanURLResp.Size,
+		URL:         scanURLResp.URL,
+		ContentType: scanURLResp.ContentType,
+	}
+	if scanURLResp.VirusFound {
+		h.quarantine(reqID, file, scanURLResp.Signature, &scanURLResp.ScanDetails)
+	}
+
+	ev := scanEvent(scanURLResp.Signature, file)
+	ev.QuarantineID = scanURLResp.QuarantineID
+	if v := scanURLResp.Policy.verdict(); v != "" && !scanURLResp.VirusFound {
+		ev.Verdict = v
+		ev.Rule = scanURLResp.Policy.Rule
+	}
+	h.notify(reqID, callbackURL, ev)
+
+	resp, err := json.Marshal(&scanURLResp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// urlFileName returns the last segment of the path of rawURL,
+// empty when there is none.
+func urlFileName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/fetcher"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerScanURL(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "foobar")
+	})
+	mux.HandleFunc("/eicar.txt", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer foo" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, eicar)
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/file.txt", http.StatusFound)
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("a", 1025))
+	})
+	upstream := httptest.NewServer(mux)
+	defer upstream.Close()
+
+	opts := fetcher.Options{
+		AllowedSchemes: []string{"http", "https"},
+		AllowPrivate:   true,
+		MaxSize:        1024,
+		Timeout:        5 * time.Second,
+		MaxRedirects:   1,
+	}
+
+	type args struct {
+		scenario MockScenario
+		fetcher  *fetcher.Fetcher
+		body     string
+	}
+	type want struct {
+		status int
+		body   string
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "no error",
+			args: args{
+				scenario: ScenarioReadStream,
+				fetcher:  fetcher.New(opts),
+				body:     `{"url":"{{upstream}}/file.txt"}`,
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"url":"{{upstream}}/file.txt","content_type":"text/plain","filename":"file.txt","size":6,` + foobarDetails + `}`,
+			},
+		},
+		{
+			name: "virus found with headers",
+			args: args{
+				scenario: ScenarioReadStream,
+				fetcher:  fetcher.New(opts),
+				body:     `{"url":"{{upstream}}/eicar.txt","headers":{"Authorization":"Bearer foo"}}`,
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   `{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"url":"{{upstream}}/eicar.txt","content_type":"text/plain","filename":"eicar.txt","size":68,` + eicarDetails + `}`,
+			},
+		},
+		{
+			name: "redirect",
+			args: args{
+				scenario: ScenarioReadStream,
+				fetcher:  fetcher.New(opts),
+				body:     `{"url":"{{upstream}}/download"}`,
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   `{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"url":"{{upstream}}/file.txt","content_type":"text/plain","filename":"file.txt","size":6,` + foobarDetails + `}`,
+			},
+		},
+		{
+			name: "fetcher not configured",
+			args: args{
+				scenario: ScenarioReadStream,
+				body:     `{"url":"{{upstream}}/file.txt"}`,
+			},
+			want: want{
+				status: http.StatusNotImplemented,
+				body:   `{"status":"error","msg":"not implemented: scanning urls is not enabled"}`,
+			},
+		},
+		{
+			name: "invalid json",
+			args: args{
+				scenario: ScenarioReadStream,
+				fetcher:  fetcher.New(opts),
+				body:     `{"url":`,
+			},
+			want: want{
+				status: http.StatusBadRequest,
+				body:   `{"status":"error","msg":"bad request: failed to parse scan url request: unexpected EOF"}`,
+			},
+		},
+		{
+			name: "missing url",
+			args: args{
+				scenario: ScenarioReadStream,
+				fetcher:  fetcher.New(opts),
+				body:     `{}`,
+			},
+			want: want{
+				status: http.StatusBadRequest,
+				body:   `{"status":"error","msg":"bad request: failed to parse scan url request: missing url"}`,
+			},
+		},
+		{
+			name: "relative url",
+			args: args{
+				scenario: ScenarioReadStream,
+				fetcher:  fetcher.New(opts),
+				body:     `{"url":"/file.txt"}`,
+			},
+			want: want{
+				status: http.StatusBadRequest,
+				body:   `{"status":"error","msg":"bad request: failed to fetch url: invalid url: \"/file.txt\" is not absolute"}`,
+			},
+		},
+		{
+			name: "scheme not allowed",
+			args: args{
+				scenario: ScenarioReadStream,
+				fetcher:  fetcher.New(opts),
+				body:     `{"url":"file:///etc/passwd"}`,
+			},
+			want: want{
+				status: http.StatusForbidden,
+				body:   `{"status":"error","msg":"forbidden: failed to fetch url: url not allowed: scheme \"file\""}`,
+			},
+		},
+		{
+			name: "private address",
+			args: args{
+				scenario: ScenarioReadStream,
+				fetcher:  fetcher.New(fetcher.Options{AllowedSchemes: []string{"http"}}),
+				body:     `{"url":"{{upstream}}/file.txt"}`,
+			},
+			want: want{
+				status: http.StatusForbidden,
+			},
+		},
+		{
+			name: "remote error",
+			args: args{
+				scenario: ScenarioReadStream,
+				fetcher:  fetcher.New(opts),
+				body:     `{"url":"{{upstream}}/eicar.txt"}`,
+			},
+			want: want{
+				status: http.StatusBadGateway,
+				body:   `{"status":"error","msg":"bad gateway: failed to fetch url: unexpected status code: 401 Unauthorized"}`,
+			},
+		},
+		{
+			name: "content too large",
+			args: args{
+				scenario: ScenarioReadStream,
+				fetcher:  fetcher.New(opts),
+				body:     `{"url":"{{upstream}}/large"}`,
+			},
+			want: want{
+				status: http.StatusRequestEntityTooLarge,
+				body:   `{"status":"error","msg":"request entity too large: failed to fetch url: remote content too large: 1025 bytes, more than 1024"}`,
+			},
+		},
+		{
+			name: "error is net error",
+			args: args{
+				scenario: ScenarioNetError,
+				fetcher:  fetcher.New(opts),
+				body:     `{"url":"{{upstream}}/file.txt"}`,
+			},
+			want: want{
+				status: http.StatusBadGateway,
+				body:   `{"status":"error","msg":"something wrong happened while communicating with clamav"}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, mockClamav)
+			h.clock = testClock
+			h.Fetcher = tt.args.fetcher
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(h.ScanURL)
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.args.scenario)
+			body := strings.ReplaceAll(tt.args.body, "{{upstream}}", upstream.URL)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/url", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handler.ServeHTTP(rr, req)
+
+			resp := rr.Result()
+			b, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.want.status, resp.StatusCode)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			if tt.want.body != "" {
+				assert.Equal(t, strings.ReplaceAll(tt.want.body, "{{upstream}}", upstream.URL), string(b))
+			}
+		})
+	}
+}
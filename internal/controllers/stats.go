@@ -1,15 +1,13 @@
 package controllers
 
 import (
-	"bufio"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
-	"regexp"
 	"strconv"
 	"strings"
 
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
 	"github.com/rs/zerolog/hlog"
 )
 
@@ -24,8 +22,6 @@ type StatsResponse struct {
 	Memstats string `json:"memstats"`
 }
 
-var ErrParsingStats = errors.New("error while parsing 'stats'")
-
 func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
 	// Get request id for logging purposes
 	req_id, _ := hlog.IDFromCtx(r.Context())
@@ -42,17 +38,17 @@ func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
 
 	h.Logger.Debug().Str("req_id", req_id.String()).Msg("stats command sent successfully")
 
-	s, err := statsMarshall(string(stats))
+	s, err := clamd.ParseStats(stats)
 	if err != nil {
-		h.Logger.Error().Str("req_id", req_id.String()).Msgf("error while marshalling stats: %v", err)
+		h.Logger.Error().Str("req_id", req_id.String()).Msgf("error while parsing stats: %v", err)
 
 		SetErrorResponse(w, err)
 		return
 	}
 
-	h.Logger.Debug().Str("req_id", req_id.String()).Msg("stats marshalled successfully")
+	h.Logger.Debug().Str("req_id", req_id.String()).Msg("stats parsed successfully")
 
-	resp, err := json.Marshal(&s)
+	resp, err := json.Marshal(newStatsResponse(s))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -63,93 +59,45 @@ func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
 	w.Write(resp)
 }
 
-// statsMarshall will marshall the string s
-// into a *StatsResponse.
-//
-// Example of output for a 'STATS' command:
-//
-// POOLS: 1
+// newStatsResponse formats the statistics s the way Clamd
+// reports them, as expected from the /rest/v1/stats endpoint.
 //
-// STATE: VALID PRIMARY
-// THREADS: live 1  idle 0 max 10 idle-timeout 30
-// QUEUE: 0 items
+// Example of response:
 //
-//	STATS 0.000111
-//
-// MEMSTATS: heap N/A mmap N/A used N/A free N/A releasable N/A pools 1 pools_used 713.137M pools_total 713.226M
-// END
-//
-// It returns any error encountered.
-func statsMarshall(s string) (*StatsResponse, error) {
-	if len(s) == 0 {
-		return nil, fmt.Errorf("error: empty string")
-	}
-
-	scanner := bufio.NewScanner(strings.NewReader(s))
-	scanner.Split(bufio.ScanLines)
-
-	var pools int
-	var state string
-	var threads string
-	var queue string
-	var memstats string
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		if strings.HasPrefix(line, "POOLS: ") {
-			var err error
-			s := strings.SplitAfter(line, ": ")
-			if len(s) != 2 {
-				return nil, ErrParsingStats
-			}
-			pools, err = strconv.Atoi(s[1])
-			if err != nil {
-				return nil, ErrParsingStats
-			}
-		}
-
-		if strings.HasPrefix(line, "STATE: ") {
-			s := strings.SplitAfter(line, ": ")
-			if len(s) != 2 {
-				return nil, ErrParsingStats
-			}
-			state = s[1]
-		}
-
-		if strings.HasPrefix(line, "THREADS: ") {
-			s := strings.SplitAfter(line, ": ")
-			if len(s) != 2 {
-				return nil, ErrParsingStats
-			}
-			threads = s[1]
-		}
-
-		// "QUEUE" is a multi-line string until the "MEMSTATS" section
-		if strings.HasPrefix(line, "QUEUE: ") {
-			re := regexp.MustCompile(`(?ms)QUEUE: (.*?)\sMEMSTATS`)
-			matches := re.FindStringSubmatch(s)
-
-			if len(matches) != 2 {
-				return nil, ErrParsingStats
-			}
-			queue = strings.TrimSuffix(matches[1], "\n")
-		}
-
-		if strings.HasPrefix(line, "MEMSTATS: ") {
-			s := strings.SplitAfter(line, ": ")
-			if len(s) != 2 {
-				return nil, ErrParsingStats
-			}
-			memstats = s[1]
+//	{"pools":1,"state":"VALID PRIMARY","threads":"live 1  idle 0 max 10 idle-timeout 30",
+//	"queue":"0 items\n\tSTATS 0.000111","memstats":"heap N/A mmap N/A used N/A free N/A releasable N/A pools 1 pools_used 713.137M pools_total 713.226M"}
+func newStatsResponse(s *clamd.Stats) *StatsResponse {
+	t := s.Threads
+	threads := fmt.Sprintf("live %d  idle %d max %d idle-timeout %d", t.Live, t.Idle, t.Max, t.IdleTimeout)
+
+	var queue strings.Builder
+	fmt.Fprintf(&queue, "%d items", s.Queue.Length)
+	for _, item := range s.Queue.Items {
+		fmt.Fprintf(&queue, "\n\t%s %f", item.Command, item.Age)
+		if item.File != "" {
+			fmt.Fprintf(&queue, " %s", item.File)
 		}
 	}
 
+	m := s.Memstats
+	memstats := fmt.Sprintf("heap %s mmap %s used %s free %s releasable %s pools %d pools_used %s pools_total %s",
+		megabytes(m.Heap), megabytes(m.Mmap), megabytes(m.Used), megabytes(m.Free), megabytes(m.Releasable),
+		m.Pools, megabytes(m.PoolsUsed), megabytes(m.PoolsTotal))
+
 	return &StatsResponse{
-		Pools:    pools,
-		State:    state,
+		Pools:    s.Pools,
+		State:    s.State,
 		Threads:  threads,
-		Queue:    queue,
+		Queue:    queue.String(),
 		Memstats: memstats,
-	}, nil
+	}
+}
+
+// megabytes formats the size b in megabytes as Clamd does,
+// eg. "565.577M", or "N/A" when b is nil.
+func megabytes(b *int64) string {
+	if b == nil {
+		return "N/A"
+	}
+	return strconv.FormatFloat(float64(*b)/1024/1024, 'f', 3, 64) + "M"
 }
@@ -2,13 +2,12 @@ package controllers
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
-	"reflect"
 	"testing"
 
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 )
@@ -36,7 +35,7 @@ func TestHandlerStats(t *testing.T) {
 			},
 			want: want{
 				status: http.StatusOK,
-				body:   []byte(`{"pools":1,"state":"VALID PRIMARY","threads":"live 1  idle 0 max 10 idle-timeout 30","queue":"0 items\n\tSTATS 0.000086 ","memstats":"heap N/A mmap N/A used N/A free N/A releasable N/A pools 1 pools_used 1306.837M pools_total 1306.882M"}`),
+				body:   []byte(`{"pools":1,"state":"VALID PRIMARY","threads":"live 1  idle 0 max 10 idle-timeout 30","queue":"0 items\n\tSTATS 0.000086","memstats":"heap N/A mmap N/A used N/A free N/A releasable N/A pools 1 pools_used 1306.837M pools_total 1306.882M"}`),
 			},
 		},
 		{
@@ -96,7 +95,7 @@ func TestHandlerStats(t *testing.T) {
 			},
 			want: want{
 				status: http.StatusInternalServerError,
-				body:   []byte(fmt.Sprintf(`{"status":"error","msg":"%s"}`, ErrParsingStats)),
+				body:   []byte(`{"status":"error","msg":"error while parsing 'stats': \"POOLS: POOLS: POOLS: some invalid stats\": strconv.Atoi: parsing \"POOLS: POOLS: some invalid stats\": invalid syntax"}`),
 			},
 		},
 	}
@@ -124,24 +123,17 @@ func TestHandlerStats(t *testing.T) {
 	}
 }
 
-func TestStatsMarshall(t *testing.T) {
+func TestNewStatsResponse(t *testing.T) {
 	type args struct {
 		s string
 	}
 	tests := []struct {
-		name    string
-		args    args
-		want    *StatsResponse
-		wantErr bool
+		name string
+		args args
+		want *StatsResponse
 	}{
 		{
-			name:    "empty input",
-			args:    args{""},
-			want:    nil,
-			wantErr: true,
-		},
-		{
-			name: "valid input",
+			name: "memstats not available",
 			args: args{
 				s: `POOLS: 1
 
@@ -161,79 +153,40 @@ END
 				Queue:    "0 items\n\tSTATS 0.000042",
 				Memstats: "heap N/A mmap N/A used N/A free N/A releasable N/A pools 1 pools_used 713.137M pools_total 713.226M",
 			},
-			wantErr: false,
-		},
-		{
-			name: "invalid input - 01",
-			args: args{
-				s: `POOLS: : 1
-END
-				`,
-			},
-			want:    nil,
-			wantErr: true,
 		},
 		{
-			name: "invalid input - 02",
+			name: "scans in progress",
 			args: args{
-				s: `STATE: : 1
-END
-				`,
-			},
-			want:    nil,
-			wantErr: true,
-		},
-		{
-			name: "invalid input - 03",
-			args: args{
-				s: `THREADS: : 1
-END
-				`,
-			},
-			want:    nil,
-			wantErr: true,
-		},
-		{
-			name: "invalid input - 04",
-			args: args{
-				s: `MEMSTATS: : 1
-END
-				`,
-			},
-			want:    nil,
-			wantErr: true,
-		},
-		{
-			name: "invalid input - 05",
-			args: args{
-				s: `QUEUE: : 1
+				s: `POOLS: 1
+
+STATE: VALID PRIMARY
+THREADS: live 3  idle 0 max 10 idle-timeout 30
+QUEUE: 1 items
+	STATS 0.000042
+	SCAN 1.250000 /data/eicar.txt
+	INSTREAM 0.500000
+
+MEMSTATS: heap 3.656M mmap 0.129M used 3.012M free 0.644M releasable 0.127M pools 1 pools_used 565.577M pools_total 565.616M
 END
 				`,
 			},
-			want:    nil,
-			wantErr: true,
-		},
-		{
-			name: "invalid input - 06",
-			args: args{
-				s: `POOLS: str
-END
-				`,
+			want: &StatsResponse{
+				Pools:    1,
+				State:    "VALID PRIMARY",
+				Threads:  "live 3  idle 0 max 10 idle-timeout 30",
+				Queue:    "1 items\n\tSTATS 0.000042\n\tSCAN 1.250000 /data/eicar.txt\n\tINSTREAM 0.500000",
+				Memstats: "heap 3.656M mmap 0.129M used 3.012M free 0.644M releasable 0.127M pools 1 pools_used 565.577M pools_total 565.616M",
 			},
-			want:    nil,
-			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := statsMarshall(tt.args.s)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("statsMarshall() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("statsMarshall() = %v, want %v", got, tt.want)
+			stats, err := clamd.ParseStats([]byte(tt.args.s))
+			if err != nil {
+				t.Fatal(err)
 			}
+
+			assert.Equal(t, tt.want, newStatsResponse(stats))
 		})
 	}
 }
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog/hlog"
+)
+
+// StatsV2Response represents the json response of a /v2/stats endpoint.
+// It represents the statistics about the scan queue,
+// contents of scan queue, and memory usage.
+type StatsV2Response struct {
+	Pools    int             `json:"pools"`
+	State    string          `json:"state"`
+	Threads  StatsV2Threads  `json:"threads"`
+	Queue    StatsV2Queue    `json:"queue"`
+	Memstats StatsV2Memstats `json:"memstats"`
+}
+
+// StatsV2Threads represents the threads of Clamd.
+type StatsV2Threads struct {
+	Live        int `json:"live"`
+	Idle        int `json:"idle"`
+	Max         int `json:"max"`
+	IdleTimeout int `json:"idle_timeout"`
+}
+
+// StatsV2Queue represents the scan queue of Clamd.
+type StatsV2Queue struct {
+	Length int                `json:"length"`
+	Items  []StatsV2QueueItem `json:"items"`
+}
+
+// StatsV2QueueItem represents a job queued or being processed by Clamd.
+type StatsV2QueueItem struct {
+	Command    string  `json:"command"`
+	AgeSeconds float64 `json:"age_seconds"`
+	File       string  `json:"file,omitempty"`
+}
+
+// StatsV2Memstats represents the memory usage of Clamd, in bytes.
+// The sizes not available are null.
+type StatsV2Memstats struct {
+	Heap       *int64 `json:"heap"`
+	Mmap       *int64 `json:"mmap"`
+	Used       *int64 `json:"used"`
+	Free       *int64 `json:"free"`
+	Releasable *int64 `json:"releasable"`
+	Pools      int    `json:"pools"`
+	PoolsUsed  *int64 `json:"pools_used"`
+	PoolsTotal *int64 `json:"pools_total"`
+}
+
+func (h *Handler) StatsV2(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	ctx := r.Context()
+
+	stats, err := h.Clamav.Stats(ctx)
+	if err != nil {
+		h.Logger.Error().Str("req_id", req_id.String()).Msgf("error while sending stats command: %v", err)
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	h.Logger.Debug().Str("req_id", req_id.String()).Msg("stats command sent successfully")
+
+	s, err := clamd.ParseStats(stats)
+	if err != nil {
+		h.Logger.Error().Str("req_id", req_id.String()).Msgf("error while parsing stats: %v", err)
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	h.Logger.Debug().Str("req_id", req_id.String()).Msg("stats parsed successfully")
+
+	statsResp := StatsV2Response{
+		Pools: s.Pools,
+		State: s.State,
+		Threads: StatsV2Threads{
+			Live:        s.Threads.Live,
+			Idle:        s.Threads.Idle,
+			Max:         s.Threads.Max,
+			IdleTimeout: s.Threads.IdleTimeout,
+		},
+		Queue: StatsV2Queue{
+			Length: s.Queue.Length,
+			Items:  make([]StatsV2QueueItem, 0, len(s.Queue.Items)),
+		},
+		Memstats: StatsV2Memstats{
+			Heap:       s.Memstats.Heap,
+			Mmap:       s.Memstats.Mmap,
+			Used:       s.Memstats.Used,
+			Free:       s.Memstats.Free,
+			Releasable: s.Memstats.Releasable,
+			Pools:      s.Memstats.Pools,
+			PoolsUsed:  s.Memstats.PoolsUsed,
+			PoolsTotal: s.Memstats.PoolsTotal,
+		},
+	}
+	for _, item := range s.Queue.Items {
+		statsResp.Queue.Items = append(statsResp.Queue.Items, StatsV2QueueItem{
+			Command:    item.Command,
+			AgeSeconds: item.Age,
+			File:       item.File,
+		})
+	}
+
+	resp, err := json.Marshal(&statsResp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
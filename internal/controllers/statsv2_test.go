@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerStatsV2(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	type args struct {
+		scenario MockScenario
+	}
+	type want struct {
+		status int
+		body   []byte
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "no error",
+			args: args{
+				scenario: ScenarioNoError,
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"pools":1,"state":"VALID PRIMARY","threads":{"live":1,"idle":0,"max":10,"idle_timeout":30},"queue":{"length":0,"items":[{"command":"STATS","age_seconds":0.000086}]},"memstats":{"heap":null,"mmap":null,"used":null,"free":null,"releasable":null,"pools":1,"pools_used":1370317914,"pools_total":1370365100}}`),
+			},
+		},
+		{
+			name: "error is net error",
+			args: args{
+				scenario: ScenarioNetError,
+			},
+			want: want{
+				status: http.StatusBadGateway,
+				body:   []byte(`{"status":"error","msg":"something wrong happened while communicating with clamav"}`),
+			},
+		},
+		{
+			name: "error is ErrUnknownCommand",
+			args: args{
+				scenario: ScenarioErrUnknownCommand,
+			},
+			want: want{
+				status: http.StatusInternalServerError,
+				body:   []byte(`{"status":"error","msg":"unknown command sent to clamav"}`),
+			},
+		},
+		{
+			name: "error is ErrParsingStats",
+			args: args{
+				scenario: ScenarioStatsErrMarshall,
+			},
+			want: want{
+				status: http.StatusInternalServerError,
+				body:   []byte(`{"status":"error","msg":"error while parsing 'stats': \"POOLS: POOLS: POOLS: some invalid stats\": strconv.Atoi: parsing \"POOLS: POOLS: some invalid stats\": invalid syntax"}`),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, mockClamav)
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(h.StatsV2)
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.args.scenario)
+			req, err := http.NewRequestWithContext(ctx, "GET", "/rest/v2/stats", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handler.ServeHTTP(rr, req)
+
+			resp := rr.Result()
+			body, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.want.status, resp.StatusCode)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.Equal(t, string(tt.want.body), string(body))
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog/hlog"
+)
+
+// InStreamRaw will stream the request body to Clamd with the "INSTREAM" command
+// while it is still being received.
+//
+// Unlike InStream, the body isn't a multipart form: it is the raw content to scan,
+// which is neither buffered in memory nor spooled to disk, unless the scan policy
+// needs its size while it has no Content-Length. Its name may be given
+// by the filename of the Content-Disposition header or the "filename" query
+// parameter. The response is the same as the one of InStream.
+func (h *Handler) InStreamRaw(w http.ResponseWriter, r *http.Request) {
+	// Get request id for logging purposes
+	req_id, _ := hlog.IDFromCtx(r.Context())
+
+	callbackURL, err := h.callbackURL(r)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Msgf("%v", err)
+
+		SetErrorResponse(w, err)
+		return
+	}
+
+	name := streamFileName(r)
+
+	h.Logger.Debug().
+		Str("req_id", req_id.String()).
+		Str("file_name", name).
+		Int64("content_length", r.ContentLength).
+		Msg("streaming request body to clamav")
+
+	details := h.newScanDetails()
+
+	// The scan policy is applied before anything is sent to Clamd.
+	// Without a Content-Length, the beginning of the body is read
+	// beforehand when its size is needed
+	var content *policyContent
+	details.Policy, content, err = h.matchPolicyStream(name, r.Body, r.ContentLength)
+	if err != nil {
+		h.Logger.Debug().Str("req_id", req_id.String()).Err(err).Msg("error while reading the body")
+
+		SetErrorResponse(w, err)
+		return
+	}
+	defer content.Close()
+
+	if v := details.Policy.verdict(); v != "" {
+		h.Logger.Debug().Str("req_id", req_id.String()).Str("rule", details.Policy.Rule).Msgf("body %s by policy", v)
+
+		// Without a Content-Length, only the bytes read may be known
+		details.MIMEType = content.mimeType
+		file := webhook.File{Name: name, Size: content.size, ContentType: r.Header.Get("Content-Type")}
+		h.writeVerdict(w, req_id.String(), callbackURL, file, policyResponse(details))
+		return
+	}
+
+	// The body is hashed while being streamed, to be reported and to
+	// record its verdict, and spooled to be quarantined if infected
+	details.source = h.quarantineSpool(r)
+	defer details.source.discard()
+
+	body := newDigestReader(details.source.tee(content))
+	inStream, err := h.Clamav.InStream(details.scanContext(r.Context()), body)
+
+	// Clamd may reply before the end of the body, which
+	// must be read anyway for the spool to be complete
+	if errors.Is(err, clamd.ErrVirusFound) && details.source != nil && !body.eof {
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			h.Logger.Error().Str("req_id", req_id.String()).Err(err).Msg("unable to quarantine the streamed content")
+
+			details.source.discard()
+			details.source = nil
+		}
+	}
+
+	body.fill(&details)
+	h.recordVerdict(req_id.String(), &details, inStream, err)
+
+	file := webhook.File{Name: name, Size: body.n, ContentType: r.Header.Get("Content-Type")}
+	h.writeInStreamResponse(w, req_id.String(), callbackURL, file, details, inStream, err)
+}
+
+// streamFileName returns the name of the file streamed in the body of r,
+// from the filename parameter of its Content-Disposition header or else
+// from its "filename" query parameter. It is empty when unknown.
+func streamFileName(r *http.Request) string {
+	name := r.URL.Query().Get("filename")
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = params["filename"]
+	}
+	if name == "" {
+		return ""
+	}
+
+	// As for the multipart forms, the directories are dropped
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerInStreamRaw(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	mockClamav := &MockClamav{}
+
+	type args struct {
+		scenario    MockScenario
+		method      string
+		filecontent string
+	}
+	type want struct {
+		status int
+		body   []byte
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "no error - put",
+			args: args{
+				scenario:    ScenarioReadStream,
+				method:      http.MethodPut,
+				filecontent: "foobar",
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"size":6,` + foobarDetails + `}`),
+			},
+		},
+		{
+			name: "no error - post",
+			args: args{
+				scenario:    ScenarioReadStream,
+				method:      http.MethodPost,
+				filecontent: "foobar",
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"status":"noerror","msg":"stream: OK","signature":"","virus_found":false,"size":6,` + foobarDetails + `}`),
+			},
+		},
+		{
+			name: "virus found",
+			args: args{
+				scenario:    ScenarioErrVirusFound,
+				method:      http.MethodPut,
+				filecontent: "foobar",
+			},
+			want: want{
+				status: http.StatusOK,
+				body:   []byte(`{"status":"error","msg":"file contains potential virus","signature":"Win.Test.EICAR_HDB-1","virus_found":true,"size":0,"scan_duration_ms":0}`),
+			},
+		},
+		{
+			name: "request too large",
+			args: args{
+				scenario:    ScenarioReadStream,
+				method:      http.MethodPut,
+				filecontent: strings.Repeat("a", 1025),
+			},
+			want: want{
+				status: http.StatusRequestEntityTooLarge,
+				body:   []byte(`{"status":"error","msg":"request entity too large: http: request body too large"}`),
+			},
+		},
+		{
+			name: "error is net error",
+			args: args{
+				scenario:    ScenarioNetError,
+				method:      http.MethodPut,
+				filecontent: "foobar",
+			},
+			want: want{
+				status: http.StatusBadGateway,
+				body:   []byte(`{"status":"error","msg":"something wrong happened while communicating with clamav"}`),
+			},
+		},
+		{
+			name: "error is ErrScanFileSizeLimitExceeded",
+			args: args{
+				scenario:    ScenarioErrScanFileSizeLimitExceeded,
+				method:      http.MethodPut,
+				filecontent: "foobar",
+			},
+			want: want{
+				status: http.StatusInternalServerError,
+				body:   []byte(`{"status":"error","msg":"clamav: size limit exceeded"}`),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, mockClamav)
+			h.clock = testClock
+			rr := httptest.NewRecorder()
+			handler := MaxReqSize(1024)(http.HandlerFunc(h.InStreamRaw))
+
+			ctx := context.WithValue(context.Background(), MockScenario(""), tt.args.scenario)
+			req, err := http.NewRequestWithContext(ctx, tt.args.method, "/rest/v1/scan/stream", strings.NewReader(tt.args.filecontent))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/octet-stream")
+
+			handler.ServeHTTP(rr, req)
+
+			resp := rr.Result()
+			body, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, tt.want.status, resp.StatusCode)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want.body, body)
+		})
+	}
+}
@@ -3,13 +3,25 @@ package controllers
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
 	"github.com/rs/zerolog/hlog"
 )
 
 // VersionResponse represents the json response of a /version endpoint.
 type VersionResponse struct {
 	Version string `json:"clamav_version"`
+	VersionInfo
+}
+
+// VersionInfo represents the fields parsed from the Clamav version.
+// They are omitted when the version can't be parsed.
+type VersionInfo struct {
+	Engine             string     `json:"engine_version,omitempty"`
+	Database           int        `json:"database_version,omitempty"`
+	DatabaseDate       *time.Time `json:"database_date,omitempty"`
+	DatabaseAgeSeconds *int64     `json:"database_age_seconds,omitempty"`
 }
 
 func (h *Handler) Version(w http.ResponseWriter, r *http.Request) {
@@ -29,7 +41,8 @@ func (h *Handler) Version(w http.ResponseWriter, r *http.Request) {
 	h.Logger.Debug().Str("req_id", req_id.String()).Msg("version command sent successfully")
 
 	v := VersionResponse{
-		Version: string(version),
+		Version:     string(version),
+		VersionInfo: h.versionInfo(req_id.String(), version),
 	}
 
 	resp, err := json.Marshal(&v)
@@ -42,3 +55,27 @@ func (h *Handler) Version(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(resp)
 }
+
+// versionInfo parses the given Clamav version and computes the
+// age of the signature database.
+//
+// Parsing errors are logged only, so that the raw version is still returned.
+func (h *Handler) versionInfo(reqID string, version []byte) VersionInfo {
+	v, err := clamd.ParseVersion(version)
+	if err != nil {
+		h.Logger.Warn().Str("req_id", reqID).Msgf("%v", err)
+		return VersionInfo{}
+	}
+
+	info := VersionInfo{
+		Engine:   v.Engine,
+		Database: v.Database,
+	}
+	if !v.DatabaseTime.IsZero() {
+		age := int64(v.DatabaseAge(h.clock.Now()).Seconds())
+		info.DatabaseDate = &v.DatabaseTime
+		info.DatabaseAgeSeconds = &age
+	}
+
+	return info
+}
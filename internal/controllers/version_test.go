@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
@@ -34,7 +35,7 @@ func TestHandlerVersion(t *testing.T) {
 			},
 			want: want{
 				status: http.StatusOK,
-				body:   []byte(`{"clamav_version":"ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023"}`),
+				body:   []byte(`{"clamav_version":"ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023","engine_version":"1.0.1","database_version":26961,"database_date":"2023-07-06T07:29:38Z","database_age_seconds":174622}`),
 			},
 		},
 		{
@@ -91,6 +92,7 @@ func TestHandlerVersion(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			h := NewHandler(&logger, mockClamav)
+			h.clock = testClock
 			rr := httptest.NewRecorder()
 			handler := http.HandlerFunc(h.Version)
 
@@ -111,3 +113,23 @@ func TestHandlerVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestHandlerVersionInfo(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	h := NewHandler(&logger, &MockClamav{})
+	h.clock = testClock
+
+	info := h.versionInfo("", []byte("ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023"))
+	assert.Equal(t, "1.0.1", info.Engine)
+	assert.Equal(t, 26961, info.Database)
+	assert.Equal(t, time.Date(2023, time.July, 6, 7, 29, 38, 0, time.UTC), *info.DatabaseDate)
+	assert.Equal(t, int64(174622), *info.DatabaseAgeSeconds)
+
+	// Without database
+	info = h.versionInfo("", []byte("ClamAV 1.0.1"))
+	assert.Equal(t, VersionInfo{Engine: "1.0.1"}, info)
+
+	// The version can't be parsed
+	info = h.versionInfo("", []byte("foobar"))
+	assert.Equal(t, VersionInfo{}, info)
+}
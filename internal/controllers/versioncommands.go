@@ -2,10 +2,9 @@ package controllers
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
-	"strings"
 
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
 	"github.com/rs/zerolog/hlog"
 )
 
@@ -13,7 +12,8 @@ import (
 // It represents the version of Clamav, followed by "| COMMANDS:" and a
 // space-delimited list of supported commands.
 type VersionCommandsResponse struct {
-	Version  string   `json:"clamav_version"`
+	Version string `json:"clamav_version"`
+	VersionInfo
 	Commands []string `json:"commands"`
 }
 
@@ -43,6 +43,8 @@ func (h *Handler) VersionCommands(w http.ResponseWriter, r *http.Request) {
 
 	h.Logger.Debug().Str("req_id", req_id.String()).Msg("versioncommands marshalled successfully")
 
+	v.VersionInfo = h.versionInfo(req_id.String(), []byte(v.Version))
+
 	resp, err := json.Marshal(&v)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -57,24 +59,19 @@ func (h *Handler) VersionCommands(w http.ResponseWriter, r *http.Request) {
 // versionCommandsMarshall will marshall the string v
 // into a *VersionCommandsResponse.
 // It returns an error if not possible.
+//
+// The Clamav "VERSIONCOMMANDS" command return the version of Clamav,
+// followed by "| COMMANDS:" and a space-delimited list of supported commands.
+//
+// ex: "ClamAV 1.0.0/26804/Mon Feb  6 08:47:07 2023| COMMANDS: SCAN QUIT RELOAD PING CONTSCAN VERSIONCOMMANDS VERSION END SHUTDOWN MULTISCAN FILDES STATS IDSESSION INSTREAM DETSTATSCLEAR DETSTATS ALLMATCHSCAN"
 func versionCommandsMarshall(v string) (*VersionCommandsResponse, error) {
-	// The Clamav "VERSIONCOMMANDS" command
-	// return the version of Clamav, followed by "| COMMANDS:" and a
-	// space-delimited list of supported commands.
-	//
-	// ex: "ClamAV 1.0.0/26804/Mon Feb  6 08:47:07 2023| COMMANDS: SCAN QUIT RELOAD PING CONTSCAN VERSIONCOMMANDS VERSION END SHUTDOWN MULTISCAN FILDES STATS IDSESSION INSTREAM DETSTATSCLEAR DETSTATS ALLMATCHSCAN"
-	//
-	// Note: it is terminated by '\n'
-	s := strings.Split(v, "| COMMANDS: ")
-
-	if len(s) != 2 {
-		return nil, fmt.Errorf("error while parsing 'versioncommands'")
+	version, cmds, err := clamd.ParseVersionCommands([]byte(v))
+	if err != nil {
+		return nil, err
 	}
 
-	cmds := strings.Split(strings.TrimSuffix(s[1], "\n"), " ")
-
 	return &VersionCommandsResponse{
-		Version:  s[0],
+		Version:  version,
 		Commands: cmds,
 	}, nil
 }
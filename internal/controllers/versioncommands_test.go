@@ -35,7 +35,7 @@ func TestHandlerVersionCommands(t *testing.T) {
 			},
 			want: want{
 				status: http.StatusOK,
-				body:   []byte(`{"clamav_version":"ClamAV 1.0.1/26963/Sat Jul  8 07:27:53 2023","commands":["SCAN","QUIT","RELOAD","PING","CONTSCAN","VERSIONCOMMANDS","VERSION","END","SHUTDOWN","MULTISCAN","FILDES","STATS","IDSESSION","INSTREAM","DETSTATSCLEAR","DETSTATS","ALLMATCHSCAN"]}`),
+				body:   []byte(`{"clamav_version":"ClamAV 1.0.1/26963/Sat Jul  8 07:27:53 2023","engine_version":"1.0.1","database_version":26963,"database_date":"2023-07-08T07:27:53Z","database_age_seconds":1927,"commands":["SCAN","QUIT","RELOAD","PING","CONTSCAN","VERSIONCOMMANDS","VERSION","END","SHUTDOWN","MULTISCAN","FILDES","STATS","IDSESSION","INSTREAM","DETSTATSCLEAR","DETSTATS","ALLMATCHSCAN"]}`),
 			},
 		},
 		{
@@ -102,6 +102,7 @@ func TestHandlerVersionCommands(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			h := NewHandler(&logger, mockClamav)
+			h.clock = testClock
 			rr := httptest.NewRecorder()
 			handler := http.HandlerFunc(h.VersionCommands)
 
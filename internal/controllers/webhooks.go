@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lescactus/clamav-api-go/internal/jobs"
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+)
+
+var ErrWebhooksNotConfigured = errors.New("webhooks are not enabled")
+
+// callbackURL returns the url given with the "callback_url" query parameter
+// of the request, to be notified once the scan is completed.
+// It returns an empty string when the parameter is absent.
+func (h *Handler) callbackURL(r *http.Request) (string, error) {
+	u := r.URL.Query().Get("callback_url")
+	if u == "" {
+		return "", nil
+	}
+
+	if h.Webhooks == nil {
+		return "", ErrWebhooksNotConfigured
+	}
+
+	// The url errors aren't wrapped: they would be mistaken for network errors
+	if err := h.Webhooks.CheckCallback(u); err != nil {
+		return "", fmt.Errorf("%w: callback_url: %v", ErrQueryParam, err)
+	}
+
+	return u, nil
+}
+
+// notify sends ev to the callback url of the request with the given id, if any,
+// and to the global webhooks if a virus was detected.
+// It does nothing when the webhooks aren't enabled.
+func (h *Handler) notify(reqID string, callbackURL string, ev webhook.Event) {
+	if h.Webhooks == nil {
+		return
+	}
+
+	ev.RequestID = reqID
+	h.Webhooks.Notify(callbackURL, ev)
+}
+
+// scanEvent returns the event of a completed scan of file,
+// which is infected when signature isn't empty.
+func scanEvent(signature string, file webhook.File) webhook.Event {
+	ev := webhook.Event{Verdict: VerdictClean, Signature: signature, File: file}
+	if signature != "" {
+		ev.Verdict = VerdictInfected
+		ev.VirusFound = true
+	}
+	return ev
+}
+
+// NotifyJob sends the result of job to the callback url it was submitted
+// with, if any, and to the global webhooks if a virus was detected.
+//
+// It is meant to be called by the job manager once the job is finished.
+func (h *Handler) NotifyJob(job *jobs.Job) {
+	ev := webhook.Event{
+		JobID:   job.ID,
+		Verdict: VerdictClean,
+		File:    webhook.File{Name: job.FileName, Size: job.Size},
+	}
+
+	switch {
+	case job.Status == jobs.StatusFailed:
+		ev.Verdict = VerdictError
+		ev.Error = job.Error
+	case job.VirusFound:
+		ev.Verdict = VerdictInfected
+		ev.VirusFound = true
+		ev.Signature = job.Signature
+		ev.QuarantineID = job.QuarantineID
+	case job.Rule != "":
+		ev.Verdict = VerdictAllowed
+		ev.Rule = job.Rule
+	}
+
+	h.notify(job.RequestID, job.CallbackURL, ev)
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/jobs"
+	"github.com/lescactus/clamav-api-go/internal/webhook"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newWebhookReceiver returns the url of a webhook endpoint
+// and the channel to which the events it receives are sent.
+func newWebhookReceiver(t *testing.T) (string, chan webhook.Event) {
+	events := make(chan webhook.Event, 10)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev webhook.Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events <- ev
+	}))
+	t.Cleanup(s.Close)
+
+	return s.URL, events
+}
+
+func newTestWebhooks(t *testing.T, urls ...string) *webhook.Dispatcher {
+	d, err := webhook.New(webhook.Options{
+		URLs:                 urls,
+		Secret:               "s3cr3t",
+		Timeout:              5 * time.Second,
+		CallbackSchemes:      []string{"http", "https"},
+		CallbackAllowPrivate: true,
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	return d
+}
+
+func receiveEvent(t *testing.T, events chan webhook.Event) webhook.Event {
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook event received")
+		return webhook.Event{}
+	}
+}
+
+func TestHandlerCallbackURL(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	tests := []struct {
+		name     string
+		query    string
+		webhooks bool
+		status   int
+		body     string
+	}{
+		{
+			name:   "webhooks not configured",
+			query:  "?callback_url=https://example.com/callback",
+			status: http.StatusNotImplemented,
+			body:   `{"status":"error","msg":"not implemented: webhooks are not enabled"}`,
+		},
+		{
+			name:     "scheme not allowed",
+			query:    "?callback_url=ftp://example.com/callback",
+			webhooks: true,
+			status:   http.StatusBadRequest,
+			body:     `{"status":"error","msg":"bad request: invalid query parameter: callback_url: url not allowed: scheme \"ftp\""}`,
+		},
+		{
+			name:     "invalid url",
+			query:    "?callback_url=%2Fcallback",
+			webhooks: true,
+			status:   http.StatusBadRequest,
+			body:     `{"status":"error","msg":"bad request: invalid query parameter: callback_url: invalid url: \"/callback\" is not absolute"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&logger, &MockClamav{})
+			if tt.webhooks {
+				h.Webhooks = newTestWebhooks(t)
+			}
+
+			rr := httptest.NewRecorder()
+			ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioReadStream)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/stream"+tt.query, strings.NewReader("foobar"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h.InStreamRaw(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Equal(t, tt.body, rr.Body.String())
+		})
+	}
+}
+
+func TestHandlerWebhooks(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	callbackURL, callbackEvents := newWebhookReceiver(t)
+	globalURL, globalEvents := newWebhookReceiver(t)
+
+	h := NewHandler(&logger, &MockClamav{})
+	h.Webhooks = newTestWebhooks(t, globalURL)
+
+	handler := hlog.RequestIDHandler("req_id", "X-Request-ID")(http.HandlerFunc(h.InStreamRaw))
+
+	scan := func(query string, content string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		ctx := context.WithValue(context.Background(), MockScenario(""), ScenarioReadStream)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/rest/v1/scan/stream"+query, strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "text/plain")
+
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		return rr
+	}
+
+	// Clean file: only the callback is notified
+	rr := scan("?callback_url="+callbackURL, "foobar")
+
+	ev := receiveEvent(t, callbackEvents)
+	assert.Equal(t, webhook.EventScanCompleted, ev.Type)
+	assert.Equal(t, rr.Header().Get("X-Request-ID"), ev.RequestID)
+	assert.Equal(t, VerdictClean, ev.Verdict)
+	assert.False(t, ev.VirusFound)
+	assert.Equal(t, webhook.File{Size: 6, ContentType: "text/plain"}, ev.File)
+
+	// Infected file without callback: only the global webhooks are notified
+	rr = scan("", eicar)
+
+	ev = receiveEvent(t, globalEvents)
+	assert.Equal(t, webhook.EventVirusDetected, ev.Type)
+	assert.Equal(t, rr.Header().Get("X-Request-ID"), ev.RequestID)
+	assert.Equal(t, VerdictInfected, ev.Verdict)
+	assert.True(t, ev.VirusFound)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", ev.Signature)
+	assert.Equal(t, int64(len(eicar)), ev.File.Size)
+
+	h.Webhooks.Close()
+	assert.Empty(t, callbackEvents)
+	assert.Empty(t, globalEvents)
+}
+
+func TestHandlerNotifyJob(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	callbackURL, callbackEvents := newWebhookReceiver(t)
+
+	h := NewHandler(&logger, &MockClamav{})
+
+	// Webhooks not configured
+	h.NotifyJob(&jobs.Job{ID: "foobar", Status: jobs.StatusDone, CallbackURL: callbackURL})
+
+	h.Webhooks = newTestWebhooks(t)
+	h.NotifyJob(&jobs.Job{
+		ID:          "foobar",
+		Status:      jobs.StatusFailed,
+		FileName:    "foobar.txt",
+		Size:        6,
+		RequestID:   "cimuf5d3d0kc73ahh5h0",
+		CallbackURL: callbackURL,
+		Error:       "size limit exceeded",
+	})
+
+	ev := receiveEvent(t, callbackEvents)
+	assert.Equal(t, webhook.EventScanCompleted, ev.Type)
+	assert.Equal(t, "cimuf5d3d0kc73ahh5h0", ev.RequestID)
+	assert.Equal(t, "foobar", ev.JobID)
+	assert.Equal(t, VerdictError, ev.Verdict)
+	assert.Equal(t, "size limit exceeded", ev.Error)
+	assert.Equal(t, webhook.File{Name: "foobar.txt", Size: 6}, ev.File)
+
+	// Infected and quarantined
+	h.NotifyJob(&jobs.Job{
+		ID:           "foobar",
+		Status:       jobs.StatusDone,
+		CallbackURL:  callbackURL,
+		VirusFound:   true,
+		Signature:    "Win.Test.EICAR_HDB-1",
+		QuarantineID: "0123456789abcdef0123456789abcdef",
+	})
+
+	ev = receiveEvent(t, callbackEvents)
+	assert.Equal(t, VerdictInfected, ev.Verdict)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", ev.QuarantineID)
+
+	// Allowed by the scan policy
+	h.NotifyJob(&jobs.Job{ID: "foobar", Status: jobs.StatusDone, Rule: "trusted", CallbackURL: callbackURL})
+
+	ev = receiveEvent(t, callbackEvents)
+	assert.Equal(t, VerdictAllowed, ev.Verdict)
+	assert.Equal(t, "trusted", ev.Rule)
+
+	h.Webhooks.Close()
+	assert.Empty(t, callbackEvents)
+}
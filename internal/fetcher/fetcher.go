@@ -0,0 +1,260 @@
+// Package fetcher downloads remote content to be scanned.
+//
+// It guards against server side request forgery: only the allowed schemes
+// can be fetched, the number of redirects is limited and, unless allowed,
+// the connections to loopback, private, link-local and other reserved
+// addresses are refused. The addresses are checked once resolved, right
+// before connecting, so that DNS can't be used to bypass the check.
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInvalidURL        = errors.New("invalid url")
+	ErrURLNotAllowed     = errors.New("url not allowed")
+	ErrTooManyRedirects  = errors.New("too many redirects")
+	ErrContentTooLarge   = errors.New("remote content too large")
+	ErrUnexpectedStatus  = errors.New("unexpected status code")
+	ErrAddressNotAllowed = fmt.Errorf("%w: address not allowed", ErrURLNotAllowed)
+)
+
+// Options configures a Fetcher.
+type Options struct {
+	// Schemes of the urls allowed to be fetched, eg. "https"
+	AllowedSchemes []string
+
+	// Allow the connections to loopback, private, link-local
+	// and other reserved addresses
+	AllowPrivate bool
+
+	// Maximum size of the fetched content. 0 means no limit
+	MaxSize int64
+
+	// Maximum duration of a fetch, including reading the content.
+	// 0 means no timeout
+	Timeout time.Duration
+
+	// Maximum number of redirects followed. 0 disables the redirects
+	MaxRedirects int
+}
+
+// Fetcher downloads remote content over http.
+type Fetcher struct {
+	opts   Options
+	client *http.Client
+}
+
+// Response is the content fetched from a url.
+type Response struct {
+	// Content of the response. It must be closed by the caller.
+	// Reading more than Options.MaxSize bytes from it fails with ErrContentTooLarge
+	Body io.ReadCloser
+
+	// Url the content was fetched from, once the redirects followed
+	URL string
+
+	// Content-Type header of the response
+	ContentType string
+
+	// Length of the content announced by the response, -1 when unknown
+	ContentLength int64
+}
+
+func New(opts Options) *Fetcher {
+	return &Fetcher{opts: opts, client: NewClient(opts)}
+}
+
+// NewClient returns a http client enforcing opts.AllowedSchemes on the
+// redirects, opts.MaxRedirects and, unless opts.AllowPrivate is set,
+// refusing to connect to reserved addresses. opts.MaxSize is ignored.
+//
+// The urls of the requests must be checked with CheckURL before being sent.
+func NewClient(opts Options) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if opts.AllowPrivate {
+				return nil
+			}
+			return checkAddress(address)
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed instead of the requested host,
+	// bypassing the check of its address
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > opts.MaxRedirects {
+				return fmt.Errorf("%w: more than %d", ErrTooManyRedirects, opts.MaxRedirects)
+			}
+			return checkScheme(req.URL, opts.AllowedSchemes)
+		},
+		Timeout: opts.Timeout,
+	}
+}
+
+// CheckURL parses rawURL and ensures it is an absolute url
+// with a host and one of the allowed schemes.
+func CheckURL(rawURL string, allowedSchemes []string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+	if !u.IsAbs() {
+		return nil, fmt.Errorf("%w: %q is not absolute", ErrInvalidURL, rawURL)
+	}
+	if err := checkScheme(u, allowedSchemes); err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%w: %q has no host", ErrInvalidURL, rawURL)
+	}
+
+	return u, nil
+}
+
+// Fetch sends a GET request to rawURL with the given headers
+// and returns the response once its headers are received.
+//
+// The request fails with ErrUnexpectedStatus when the response status code isn't 2xx.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string, header http.Header) (*Response, error) {
+	u, err := CheckURL(rawURL, f.opts.AllowedSchemes)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+	for k, v := range header {
+		req.Header[http.CanonicalHeaderKey(k)] = slices.Clone(v)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+
+	body := resp.Body
+	if f.opts.MaxSize > 0 {
+		if resp.ContentLength > f.opts.MaxSize {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%w: %d bytes, more than %d", ErrContentTooLarge, resp.ContentLength, f.opts.MaxSize)
+		}
+		body = &limitedBody{ReadCloser: resp.Body, max: f.opts.MaxSize, remaining: f.opts.MaxSize}
+	}
+
+	return &Response{
+		Body:          body,
+		URL:           resp.Request.URL.String(),
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+	}, nil
+}
+
+// checkScheme returns an error wrapping ErrURLNotAllowed
+// when the scheme of u isn't one of allowedSchemes.
+func checkScheme(u *url.URL, allowedSchemes []string) error {
+	for _, scheme := range allowedSchemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: scheme %q", ErrURLNotAllowed, u.Scheme)
+}
+
+// checkAddress is called once the address to connect to is resolved,
+// before connecting to it. It returns an error wrapping ErrAddressNotAllowed
+// when it is reserved.
+func checkAddress(address string) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrAddressNotAllowed, err)
+	}
+	if IsReservedAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrAddressNotAllowed, addrPort.Addr())
+	}
+
+	return nil
+}
+
+// reservedPrefixes are the ranges of addresses not reachable on the
+// internet which aren't covered by the methods of netip.Addr.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, may translate to a private IPv4
+}
+
+// IsReservedAddr returns true if addr is a loopback, private, link-local,
+// multicast or other reserved address.
+func IsReservedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return true
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// limitedBody is a response body failing with ErrContentTooLarge
+// once more than max bytes are read from it.
+type limitedBody struct {
+	io.ReadCloser
+	max       int64
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	// Reading one more byte than allowed tells whether the limit is exceeded
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.ReadCloser.Read(p)
+	if int64(n) > l.remaining {
+		n = int(l.remaining)
+		l.remaining = 0
+		return n, fmt.Errorf("%w: more than %d bytes", ErrContentTooLarge, l.max)
+	}
+	l.remaining -= int64(n)
+
+	return n, err
+}
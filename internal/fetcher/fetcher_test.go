@@ -0,0 +1,243 @@
+package fetcher
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "foobar")
+	})
+	mux.HandleFunc("/headers", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("Authorization"))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1025")
+		io.WriteString(w, strings.Repeat("a", 1025))
+	})
+	mux.HandleFunc("/chunked", func(w http.ResponseWriter, r *http.Request) {
+		// Flushing before writing everything sends the response without Content-Length
+		io.WriteString(w, strings.Repeat("a", 512))
+		w.(http.Flusher).Flush()
+		io.WriteString(w, strings.Repeat("a", 513))
+	})
+	mux.HandleFunc("/notfound", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/file", http.StatusFound)
+	})
+	mux.HandleFunc("/redirect/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/redirect/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/redirect/ftp", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "ftp://example.com/file", http.StatusFound)
+	})
+
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestFetcherFetch(t *testing.T) {
+	s := newTestServer(t)
+
+	opts := Options{
+		AllowedSchemes: []string{"http", "https"},
+		AllowPrivate:   true,
+		MaxSize:        1024,
+		Timeout:        5 * time.Second,
+		MaxRedirects:   2,
+	}
+
+	type want struct {
+		body        string
+		url         string
+		contentType string
+		err         error
+		readErr     error
+	}
+	tests := []struct {
+		name   string
+		opts   Options
+		url    string
+		header http.Header
+		want   want
+	}{
+		{
+			name: "no error",
+			opts: opts,
+			url:  s.URL + "/file",
+			want: want{body: "foobar", url: s.URL + "/file", contentType: "text/plain"},
+		},
+		{
+			name:   "headers",
+			opts:   opts,
+			url:    s.URL + "/headers",
+			header: http.Header{"authorization": {"Bearer foo"}},
+			want:   want{body: "Bearer foo", url: s.URL + "/headers", contentType: "text/plain; charset=utf-8"},
+		},
+		{
+			name: "redirect",
+			opts: opts,
+			url:  s.URL + "/redirect",
+			want: want{body: "foobar", url: s.URL + "/file", contentType: "text/plain"},
+		},
+		{
+			name: "too many redirects",
+			opts: opts,
+			url:  s.URL + "/redirect/loop",
+			want: want{err: ErrTooManyRedirects},
+		},
+		{
+			name: "redirects disabled",
+			opts: Options{AllowedSchemes: []string{"http"}, AllowPrivate: true},
+			url:  s.URL + "/redirect",
+			want: want{err: ErrTooManyRedirects},
+		},
+		{
+			name: "redirect to scheme not allowed",
+			opts: opts,
+			url:  s.URL + "/redirect/ftp",
+			want: want{err: ErrURLNotAllowed},
+		},
+		{
+			name: "scheme not allowed",
+			opts: Options{AllowedSchemes: []string{"https"}, AllowPrivate: true},
+			url:  s.URL + "/file",
+			want: want{err: ErrURLNotAllowed},
+		},
+		{
+			name: "private address",
+			opts: Options{AllowedSchemes: []string{"http"}},
+			url:  s.URL + "/file",
+			want: want{err: ErrAddressNotAllowed},
+		},
+		{
+			name: "relative url",
+			opts: opts,
+			url:  "/file",
+			want: want{err: ErrInvalidURL},
+		},
+		{
+			name: "invalid url",
+			opts: opts,
+			url:  "http://[::1",
+			want: want{err: ErrInvalidURL},
+		},
+		{
+			name: "unexpected status",
+			opts: opts,
+			url:  s.URL + "/notfound",
+			want: want{err: ErrUnexpectedStatus},
+		},
+		{
+			name: "content length too large",
+			opts: opts,
+			url:  s.URL + "/large",
+			want: want{err: ErrContentTooLarge},
+		},
+		{
+			name: "content too large",
+			opts: opts,
+			url:  s.URL + "/chunked",
+			want: want{url: s.URL + "/chunked", contentType: "text/plain; charset=utf-8", readErr: ErrContentTooLarge},
+		},
+		{
+			name: "no size limit",
+			opts: Options{AllowedSchemes: []string{"http"}, AllowPrivate: true},
+			url:  s.URL + "/chunked",
+			want: want{body: strings.Repeat("a", 1025), url: s.URL + "/chunked", contentType: "text/plain; charset=utf-8"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := New(tt.opts)
+
+			resp, err := f.Fetch(context.Background(), tt.url, tt.header)
+			if tt.want.err != nil {
+				assert.ErrorIs(t, err, tt.want.err)
+				assert.Nil(t, resp)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.want.url, resp.URL)
+			assert.Equal(t, tt.want.contentType, resp.ContentType)
+
+			b, err := io.ReadAll(resp.Body)
+			if tt.want.readErr != nil {
+				assert.ErrorIs(t, err, tt.want.readErr)
+				assert.Len(t, b, int(tt.opts.MaxSize))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want.body, string(b))
+		})
+	}
+}
+
+func TestFetcherFetchTimeout(t *testing.T) {
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer s.Close()
+	defer close(done)
+
+	f := New(Options{AllowedSchemes: []string{"http"}, AllowPrivate: true, Timeout: 50 * time.Millisecond})
+
+	_, err := f.Fetch(context.Background(), s.URL, nil)
+	assert.Error(t, err)
+}
+
+func TestIsReservedAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"127.0.0.1", true},
+		{"10.0.0.1", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"198.18.0.1", true},
+		{"224.0.0.1", true},
+		{"255.255.255.255", true},
+		{"::", true},
+		{"::1", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"ff02::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"64:ff9b::a00:1", true},
+		{"1.1.1.1", false},
+		{"93.184.216.34", false},
+		{"2606:4700:4700::1111", false},
+		{"::ffff:1.1.1.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsReservedAddr(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
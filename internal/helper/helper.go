@@ -0,0 +1,65 @@
+// Package helper provides the helpers shared by the packages of the server:
+// random ids, atomic file writes and a clock which can be overridden in tests.
+package helper
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// NewID returns a random id of 32 hexadecimal characters.
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidID returns true if id has the format of the ids returned by NewID.
+// It prevents ids coming from requests from being used to build paths.
+func ValidID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// WriteFile writes the content of r to a temporary file of the directory
+// of path, prefixed with a dot, renamed to path once complete so that the
+// file is never read partially written. It returns the number of bytes written.
+func WriteFile(path string, r io.Reader) (int64, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return n, err
+	}
+	if err := f.Close(); err != nil {
+		return n, err
+	}
+
+	return n, os.Rename(f.Name(), path)
+}
+
+// Clock returns the current time. The zero Clock uses time.Now,
+// another one being set in tests.
+type Clock func() time.Time
+
+// Now returns the current time according to c.
+func (c Clock) Now() time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c()
+}
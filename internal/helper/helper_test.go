@@ -0,0 +1,61 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestID(t *testing.T) {
+	id := NewID()
+	assert.Len(t, id, 32)
+	assert.True(t, ValidID(id))
+	assert.NotEqual(t, id, NewID())
+
+	assert.False(t, ValidID(""))
+	assert.False(t, ValidID("../"+id[3:]))
+	assert.False(t, ValidID(id+"0"))
+	assert.False(t, ValidID("zz"+id[2:]))
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "foo.json")
+
+	n, err := WriteFile(path, strings.NewReader("foobar"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, n)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "foobar", string(b))
+
+	// Replaced, without temporary file left behind
+	_, err = WriteFile(path, strings.NewReader("bar"))
+	require.NoError(t, err)
+
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(b))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	_, err = WriteFile(filepath.Join(dir, "missing", "foo.json"), strings.NewReader("foobar"))
+	assert.Error(t, err)
+}
+
+func TestClock(t *testing.T) {
+	var c Clock
+	assert.WithinDuration(t, time.Now(), c.Now(), time.Second)
+
+	now := time.Date(2023, time.July, 8, 8, 0, 0, 0, time.UTC)
+	c = func() time.Time { return now }
+	assert.Equal(t, now, c.Now())
+}
@@ -0,0 +1,72 @@
+// Package history records the last verdict of the scans by SHA-256 of the
+// scanned content, so that it can be looked up without the content.
+package history
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotFound     = errors.New("hash not found")
+	ErrUnknownStore = errors.New("unknown history store")
+)
+
+// Record is the last verdict of the scan of a content.
+type Record struct {
+	// Hex-encoded SHA-256 of the content
+	SHA256 string `json:"sha256"`
+
+	// Signature of the virus found, empty when clean
+	Signature string `json:"signature"`
+
+	// Version of the Clamav engine and of the signature
+	// database which made the verdict, if known
+	Engine   string `json:"engine,omitempty"`
+	Database int    `json:"database,omitempty"`
+
+	ScannedAt time.Time `json:"scanned_at"`
+}
+
+// Store records the verdicts by hash.
+type Store interface {
+	// Put records the verdict, replacing the previous one of the same hash
+	Put(record *Record) error
+
+	// Get returns the verdict of the given hash, or an error wrapping ErrNotFound
+	Get(sha256 string) (*Record, error)
+}
+
+// Available history stores
+const (
+	StoreMemory = "memory"
+	StoreFile   = "file"
+)
+
+// OpenStore returns the history store of the given kind, either
+// StoreMemory or StoreFile. The file store keeps the verdicts in dir,
+// the memory store keeps at most maxRecords of them.
+func OpenStore(kind string, dir string, maxRecords int) (Store, error) {
+	switch kind {
+	case StoreMemory:
+		return NewMemoryStore(maxRecords), nil
+	case StoreFile:
+		return NewFileStore(dir)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStore, kind)
+	}
+}
+
+// ValidHash returns true if s is a lowercase hex-encoded SHA-256.
+func ValidHash(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
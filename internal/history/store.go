@@ -0,0 +1,136 @@
+package history
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lescactus/clamav-api-go/internal/helper"
+)
+
+// MemoryStore is a Store keeping the verdicts in memory, bounded in number:
+// the least recently recorded ones are evicted beyond. They are lost on restart.
+type MemoryStore struct {
+	maxRecords int
+
+	mu      sync.RWMutex
+	records map[string]*list.Element
+	order   *list.List
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns a MemoryStore keeping at most maxRecords
+// verdicts, or an unbounded number of them when maxRecords is 0 or less.
+func NewMemoryStore(maxRecords int) *MemoryStore {
+	return &MemoryStore{
+		maxRecords: maxRecords,
+		records:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (s *MemoryStore) Put(record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.records[record.SHA256]; ok {
+		e.Value = *record
+		s.order.MoveToFront(e)
+		return nil
+	}
+
+	s.records[record.SHA256] = s.order.PushFront(*record)
+	if s.maxRecords > 0 && s.order.Len() > s.maxRecords {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.records, oldest.Value.(Record).SHA256)
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Get(sha256 string) (*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.records[sha256]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, sha256)
+	}
+	record := e.Value.(Record)
+	return &record, nil
+}
+
+// FileStore is a Store keeping each verdict in a json file of a directory,
+// so that they survive restarts. The files are spread across subdirectories
+// named after the first two characters of the hash.
+type FileStore struct {
+	dir string
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore returns a FileStore keeping the verdicts in dir,
+// which is created if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, errors.New("history store directory not configured")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error while creating the history store directory: %w", err)
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(sha256 string) string {
+	return filepath.Join(s.dir, sha256[:2], sha256+".json")
+}
+
+// Put writes the verdict to a temporary file renamed once complete,
+// so that a verdict is never read partially written.
+func (s *FileStore) Put(record *Record) error {
+	if !ValidHash(record.SHA256) {
+		return fmt.Errorf("invalid hash %q", record.SHA256)
+	}
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	path := s.path(record.SHA256)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	_, err = helper.WriteFile(path, bytes.NewReader(b))
+	return err
+}
+
+func (s *FileStore) Get(sha256 string) (*Record, error) {
+	if !ValidHash(sha256) {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, sha256)
+	}
+
+	b, err := os.ReadFile(s.path(sha256))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, sha256)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record Record
+	if err := json.Unmarshal(b, &record); err != nil {
+		return nil, fmt.Errorf("error while decoding the verdict of %q: %w", sha256, err)
+	}
+	return &record, nil
+}
@@ -0,0 +1,130 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicarSHA256 = "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"
+
+func TestStores(t *testing.T) {
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "history"))
+	require.NoError(t, err)
+
+	stores := map[string]Store{
+		StoreMemory: NewMemoryStore(0),
+		StoreFile:   fileStore,
+	}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2023, time.July, 8, 8, 0, 0, 0, time.UTC)
+			record := &Record{
+				SHA256:    eicarSHA256,
+				Signature: "Win.Test.EICAR_HDB-1",
+				Engine:    "1.0.1",
+				Database:  26961,
+				ScannedAt: now,
+			}
+
+			_, err := s.Get(record.SHA256)
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			assert.NoError(t, s.Put(record))
+
+			got, err := s.Get(record.SHA256)
+			assert.NoError(t, err)
+			assert.Equal(t, record, got)
+
+			// The last verdict replaces the previous one
+			record.Signature = ""
+			record.ScannedAt = now.Add(time.Hour)
+			assert.NoError(t, s.Put(record))
+
+			got, err = s.Get(record.SHA256)
+			assert.NoError(t, err)
+			assert.Equal(t, record, got)
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore(2)
+
+	hashes := []string{
+		strings.Repeat("a", 64),
+		strings.Repeat("b", 64),
+		strings.Repeat("c", 64),
+	}
+	require.NoError(t, s.Put(&Record{SHA256: hashes[0]}))
+	require.NoError(t, s.Put(&Record{SHA256: hashes[1]}))
+
+	// Recorded again, the first verdict is now the most recent
+	require.NoError(t, s.Put(&Record{SHA256: hashes[0], Signature: "Win.Test.EICAR_HDB-1"}))
+
+	// The least recently recorded verdict is evicted beyond the maximum
+	require.NoError(t, s.Put(&Record{SHA256: hashes[2]}))
+
+	_, err := s.Get(hashes[1])
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	got, err := s.Get(hashes[0])
+	require.NoError(t, err)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", got.Signature)
+	_, err = s.Get(hashes[2])
+	assert.NoError(t, err)
+}
+
+func TestFileStore(t *testing.T) {
+	_, err := NewFileStore("")
+	assert.Error(t, err)
+
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Put(&Record{SHA256: eicarSHA256}))
+	assert.FileExists(t, filepath.Join(dir, "27", eicarSHA256+".json"))
+
+	// Survives a restart
+	s, err = NewFileStore(dir)
+	require.NoError(t, err)
+	_, err = s.Get(eicarSHA256)
+	assert.NoError(t, err)
+
+	// Invalid hashes, which could escape the directory
+	assert.Error(t, s.Put(&Record{SHA256: "../foobar"}))
+	_, err = s.Get("../../" + eicarSHA256[6:])
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Corrupted record
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "27", eicarSHA256+".json"), []byte("foobar"), 0o600))
+	_, err = s.Get(eicarSHA256)
+	assert.ErrorContains(t, err, "error while decoding the verdict")
+}
+
+func TestOpenStore(t *testing.T) {
+	s, err := OpenStore(StoreMemory, "", 10)
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, s)
+
+	s, err = OpenStore(StoreFile, t.TempDir(), 0)
+	assert.NoError(t, err)
+	assert.IsType(t, &FileStore{}, s)
+
+	_, err = OpenStore("foobar", "", 0)
+	assert.ErrorIs(t, err, ErrUnknownStore)
+}
+
+func TestValidHash(t *testing.T) {
+	assert.True(t, ValidHash(eicarSHA256))
+	assert.False(t, ValidHash(strings.ToUpper(eicarSHA256)))
+	assert.False(t, ValidHash(eicarSHA256[1:]))
+	assert.False(t, ValidHash("z"+eicarSHA256[1:]))
+	assert.False(t, ValidHash(""))
+}
@@ -0,0 +1,109 @@
+// Package jobs runs scans asynchronously.
+//
+// An upload is spooled to disk and recorded as a queued Job in a Store.
+// A bounded pool of workers scans the queued jobs and records their results,
+// which expire after a while. With a persistent Store, the jobs survive
+// restarts: the ones which were queued or running are scanned again.
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Status is the state of a job.
+type Status string
+
+const (
+	StatusQueued  Status = "queued"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+)
+
+var (
+	ErrJobNotFound  = errors.New("job not found")
+	ErrQueueFull    = errors.New("job queue is full")
+	ErrClosed       = errors.New("job manager is closed")
+	ErrReadUpload   = errors.New("error while reading the upload")
+	ErrUnknownStore = errors.New("unknown job store")
+	ErrScanTimeout  = errors.New("scan timed out")
+)
+
+// Job is a scan run asynchronously.
+type Job struct {
+	ID       string `json:"id"`
+	Status   Status `json:"status"`
+	FileName string `json:"filename"`
+	Size     int64  `json:"size"`
+
+	// Id of the request which submitted the job
+	RequestID string `json:"request_id,omitempty"`
+
+	// Url notified once the job is finished, if any
+	CallbackURL string `json:"callback_url,omitempty"`
+
+	// Address of the client which submitted the job
+	ClientIP string `json:"client_ip,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Time after which the job is deleted, zero until it is done or failed
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Result of the scan, once done
+	VirusFound bool   `json:"virus_found"`
+	Signature  string `json:"signature"`
+
+	// Rule of the scan policy which allowed the file
+	// without it being scanned, if any
+	Rule string `json:"rule,omitempty"`
+
+	// Id of the quarantined upload, once found infected
+	QuarantineID string `json:"quarantine_id,omitempty"`
+
+	// Reason of the failure, once failed
+	Error string `json:"error,omitempty"`
+}
+
+// Finished returns true if the job is done or failed.
+func (j *Job) Finished() bool {
+	return j.Status == StatusDone || j.Status == StatusFailed
+}
+
+// Store records the jobs.
+// Its methods must be safe for concurrent use.
+type Store interface {
+	// Put creates or replaces the job with the same id
+	Put(job *Job) error
+
+	// Get returns the job with the given id, or ErrJobNotFound
+	Get(id string) (*Job, error)
+
+	// Delete removes the job with the given id, if any
+	Delete(id string) error
+
+	// List returns all the jobs, in no particular order
+	List() ([]*Job, error)
+}
+
+// Available job stores
+const (
+	StoreMemory = "memory"
+	StoreFile   = "file"
+)
+
+// OpenStore returns the job store of the given kind, either
+// StoreMemory or StoreFile. The file store keeps the jobs in dir.
+func OpenStore(kind string, dir string) (Store, error) {
+	switch kind {
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case StoreFile:
+		return NewFileStore(dir)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStore, kind)
+	}
+}
@@ -0,0 +1,426 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/helper"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog"
+)
+
+// Options configures a Manager.
+type Options struct {
+	// Number of jobs scanned concurrently
+	Workers int
+
+	// Maximum number of jobs waiting for a worker.
+	// Submitting a job fails with ErrQueueFull beyond
+	QueueSize int
+
+	// Duration a job is kept once done or failed
+	TTL time.Duration
+
+	// Interval between two deletions of the expired jobs
+	CleanupInterval time.Duration
+
+	// Maximum duration of the scan of a job, which fails beyond
+	// so that its worker is freed. 0 means no limit
+	ScanTimeout time.Duration
+
+	// Directory in which the uploads are spooled until they are scanned
+	UploadDir string
+
+	// Called by the workers once a job is done or failed, if not nil
+	OnFinish func(job *Job)
+
+	// Called by the workers with the upload of a job found infected,
+	// before it is removed and OnFinish is called, if not nil. It may
+	// set the QuarantineID of the job
+	OnInfected func(job *Job, upload io.ReadSeeker)
+}
+
+// SubmitOptions are the optional attributes of a submitted job.
+type SubmitOptions struct {
+	// Id of the request submitting the job
+	RequestID string
+
+	// Url notified once the job is finished
+	CallbackURL string
+
+	// Address of the client which uploaded the file
+	ClientIP string
+}
+
+// Manager scans the submitted uploads with a bounded pool of workers.
+type Manager struct {
+	store  Store
+	clamav clamd.Clamaver
+	opts   Options
+	logger *zerolog.Logger
+
+	queue chan string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	clock helper.Clock
+}
+
+// NewManager returns a Manager recording the jobs in store
+// and scanning them with clamav. Start must be called for the
+// jobs to be scanned.
+func NewManager(store Store, clamav clamd.Clamaver, opts Options, logger *zerolog.Logger) (*Manager, error) {
+	if opts.Workers < 1 {
+		return nil, fmt.Errorf("invalid number of workers: %d", opts.Workers)
+	}
+	if opts.UploadDir == "" {
+		return nil, errors.New("upload directory not configured")
+	}
+	if err := os.MkdirAll(opts.UploadDir, 0o700); err != nil {
+		return nil, fmt.Errorf("error while creating the upload directory: %w", err)
+	}
+	if logger == nil {
+		nop := zerolog.Nop()
+		logger = &nop
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Manager{
+		store:  store,
+		clamav: clamav,
+		opts:   opts,
+		logger: logger,
+		queue:  make(chan string, max(opts.QueueSize, 0)),
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+func (m *Manager) uploadPath(id string) string {
+	return filepath.Join(m.opts.UploadDir, id)
+}
+
+// Start starts the workers and the cleanup of the expired jobs.
+//
+// The jobs of the store which were queued or running, eg. before a restart,
+// are queued again. The ones whose upload is missing are failed.
+func (m *Manager) Start() error {
+	jobs, err := m.store.List()
+	if err != nil {
+		return fmt.Errorf("error while listing the jobs: %w", err)
+	}
+
+	var pending []string
+	for _, job := range jobs {
+		if job.Finished() {
+			continue
+		}
+
+		if _, err := os.Stat(m.uploadPath(job.ID)); err != nil {
+			m.finish(job, nil, fmt.Errorf("upload lost: %w", err))
+			continue
+		}
+
+		job.Status = StatusQueued
+		job.UpdatedAt = m.clock.Now()
+		if err := m.store.Put(job); err != nil {
+			return fmt.Errorf("error while queuing job %q again: %w", job.ID, err)
+		}
+		pending = append(pending, job.ID)
+	}
+
+	for i := 0; i < m.opts.Workers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+
+	// The pending jobs may not fit in the queue
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for _, id := range pending {
+			select {
+			case m.queue <- id:
+			case <-m.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if m.opts.CleanupInterval > 0 {
+		m.wg.Add(1)
+		go m.cleanup()
+	}
+
+	return nil
+}
+
+// Close stops the workers and waits for them to return.
+// The jobs being scanned are queued again, to be scanned
+// on the next start with a persistent store.
+func (m *Manager) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Submit spools the content of r to disk and queues a job scanning it.
+//
+// Errors returned while reading r are wrapped in ErrReadUpload.
+func (m *Manager) Submit(fileName string, r io.Reader, opts SubmitOptions) (*Job, error) {
+	if m.ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+
+	id := helper.NewID()
+	path := m.uploadPath(id)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error while spooling the upload: %w", err)
+	}
+
+	size, err := io.Copy(f, &uploadReader{r: r})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		if errors.Is(err, ErrReadUpload) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error while spooling the upload: %w", err)
+	}
+
+	now := m.clock.Now()
+	job := &Job{
+		ID:          id,
+		Status:      StatusQueued,
+		FileName:    fileName,
+		Size:        size,
+		RequestID:   opts.RequestID,
+		CallbackURL: opts.CallbackURL,
+		ClientIP:    opts.ClientIP,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := m.store.Put(job); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	select {
+	case m.queue <- id:
+	default:
+		m.store.Delete(id)
+		os.Remove(path)
+		return nil, ErrQueueFull
+	}
+
+	return job, nil
+}
+
+// Allow records a job which is done without being scanned, the upload
+// of the given name and size being allowed by the rule of a scan policy.
+func (m *Manager) Allow(fileName string, size int64, rule string, opts SubmitOptions) (*Job, error) {
+	if m.ctx.Err() != nil {
+		return nil, ErrClosed
+	}
+
+	now := m.clock.Now()
+	job := &Job{
+		ID:          helper.NewID(),
+		FileName:    fileName,
+		Size:        size,
+		Rule:        rule,
+		RequestID:   opts.RequestID,
+		CallbackURL: opts.CallbackURL,
+		ClientIP:    opts.ClientIP,
+		CreatedAt:   now,
+	}
+	m.finish(job, nil, nil)
+
+	return job, nil
+}
+
+// Get returns the job with the given id, or ErrJobNotFound.
+func (m *Manager) Get(id string) (*Job, error) {
+	if !helper.ValidID(id) {
+		return nil, fmt.Errorf("%w: %q", ErrJobNotFound, id)
+	}
+	return m.store.Get(id)
+}
+
+func (m *Manager) work() {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case id := <-m.queue:
+			m.run(id)
+		}
+	}
+}
+
+// run scans the upload of the job with the given id.
+func (m *Manager) run(id string) {
+	job, err := m.store.Get(id)
+	if err != nil {
+		m.logger.Error().Err(err).Str("job_id", id).Msg("unable to get job to scan")
+		return
+	}
+
+	job.Status = StatusRunning
+	job.UpdatedAt = m.clock.Now()
+	if err := m.store.Put(job); err != nil {
+		m.logger.Error().Err(err).Str("job_id", id).Msg("unable to update job")
+		return
+	}
+
+	f, err := os.Open(m.uploadPath(id))
+	if err != nil {
+		m.finish(job, nil, fmt.Errorf("upload lost: %w", err))
+		return
+	}
+	defer f.Close()
+
+	ctx, cancel := m.ctx, context.CancelFunc(func() {})
+	if m.opts.ScanTimeout > 0 {
+		ctx, cancel = context.WithTimeout(m.ctx, m.opts.ScanTimeout)
+	}
+	defer cancel()
+
+	result, err := clamd.ScanStream(ctx, m.clamav, f)
+
+	if m.ctx.Err() != nil {
+		// Closing: scanned again on the next start
+		job.Status = StatusQueued
+		job.UpdatedAt = m.clock.Now()
+		if err := m.store.Put(job); err != nil {
+			m.logger.Error().Err(err).Str("job_id", id).Msg("unable to update job")
+		}
+		return
+	}
+
+	// The scan may fail with a network error once its connection
+	// is unblocked by the deadline
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w after %s", ErrScanTimeout, m.opts.ScanTimeout)
+	}
+
+	if err == nil && result != nil && m.opts.OnInfected != nil {
+		job.Signature = result.Signature
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			m.logger.Error().Err(err).Str("job_id", id).Msg("unable to read the infected upload")
+		} else {
+			m.opts.OnInfected(job, f)
+		}
+	}
+
+	m.finish(job, result, err)
+}
+
+// finish records the result of the scan of job, or
+// its failure if err isn't nil, and removes its upload.
+func (m *Manager) finish(job *Job, result *clamd.ScanResult, err error) {
+	now := m.clock.Now()
+	job.UpdatedAt = now
+	job.ExpiresAt = now.Add(m.opts.TTL)
+
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = StatusDone
+		if result != nil {
+			job.VirusFound = true
+			job.Signature = result.Signature
+		}
+	}
+
+	if err := m.store.Put(job); err != nil {
+		m.logger.Error().Err(err).Str("job_id", job.ID).Msg("unable to update job")
+	}
+
+	if err := os.Remove(m.uploadPath(job.ID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		m.logger.Warn().Err(err).Str("job_id", job.ID).Msg("unable to remove upload")
+	}
+
+	m.logger.Debug().
+		Str("job_id", job.ID).
+		Str("status", string(job.Status)).
+		Bool("virus_found", job.VirusFound).
+		Msg("job finished")
+
+	if m.opts.OnFinish != nil {
+		m.opts.OnFinish(job)
+	}
+}
+
+func (m *Manager) cleanup() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.opts.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := m.DeleteExpired(); err != nil {
+				m.logger.Error().Err(err).Msg("unable to delete expired jobs")
+			} else if n > 0 {
+				m.logger.Debug().Int("count", n).Msg("expired jobs deleted")
+			}
+		}
+	}
+}
+
+// DeleteExpired deletes the finished jobs which expired
+// and returns how many were deleted.
+func (m *Manager) DeleteExpired() (int, error) {
+	jobs, err := m.store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	now := m.clock.Now()
+	n := 0
+	for _, job := range jobs {
+		if !job.Finished() || job.ExpiresAt.After(now) {
+			continue
+		}
+		if err := m.store.Delete(job.ID); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// uploadReader wraps the errors returned by r in ErrReadUpload, to tell
+// them apart from the ones returned while writing the upload to disk.
+type uploadReader struct {
+	r io.Reader
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %w", ErrReadUpload, err)
+	}
+	return n, err
+}
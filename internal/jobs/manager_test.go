@@ -0,0 +1,337 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/helper"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamav is a Clamaver whose InStream reports the eicar test file.
+// When block isn't nil, InStream waits for it to be closed or for its
+// context to be done.
+type fakeClamav struct {
+	clamd.Clamaver
+
+	block chan struct{}
+	err   error
+}
+
+func (f *fakeClamav) InStream(ctx context.Context, r io.Reader) ([]byte, error) {
+	if f.block != nil {
+		select {
+		case <-f.block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(string(b), "EICAR-STANDARD-ANTIVIRUS-TEST-FILE") {
+		return []byte("stream: Win.Test.EICAR_HDB-1 FOUND"), clamd.ErrVirusFound
+	}
+	return []byte("stream: OK"), nil
+}
+
+func newTestManager(t *testing.T, store Store, clamav clamd.Clamaver, opts Options) *Manager {
+	if opts.Workers == 0 {
+		opts.Workers = 2
+	}
+	if opts.UploadDir == "" {
+		opts.UploadDir = filepath.Join(t.TempDir(), "uploads")
+	}
+
+	m, err := NewManager(store, clamav, opts, nil)
+	require.NoError(t, err)
+
+	return m
+}
+
+// waitFinished polls the job with the given id until it is finished.
+func waitFinished(t *testing.T, m *Manager, id string) *Job {
+	var job *Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = m.Get(id)
+		require.NoError(t, err)
+		return job.Finished()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return job
+}
+
+func TestManagerSubmit(t *testing.T) {
+	finished := make(chan *Job, 2)
+	m := newTestManager(t, NewMemoryStore(), &fakeClamav{}, Options{
+		QueueSize: 10,
+		TTL:       time.Hour,
+		OnFinish:  func(job *Job) { finished <- job },
+		OnInfected: func(job *Job, upload io.ReadSeeker) {
+			b, err := io.ReadAll(upload)
+			assert.NoError(t, err)
+			assert.Equal(t, eicar, string(b))
+			assert.Equal(t, "Win.Test.EICAR_HDB-1", job.Signature)
+			job.QuarantineID = "foobar"
+		},
+	})
+	require.NoError(t, m.Start())
+	defer m.Close()
+
+	clean, err := m.Submit("foobar.txt", strings.NewReader("foobar"), SubmitOptions{
+		RequestID:   "cimuf5d3d0kc73ahh5h0",
+		CallbackURL: "https://example.com/callback",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, StatusQueued, clean.Status)
+	assert.Equal(t, "foobar.txt", clean.FileName)
+	assert.Equal(t, int64(6), clean.Size)
+	assert.Equal(t, "cimuf5d3d0kc73ahh5h0", clean.RequestID)
+	assert.Equal(t, "https://example.com/callback", clean.CallbackURL)
+
+	infected, err := m.Submit("eicar.txt", strings.NewReader(eicar), SubmitOptions{ClientIP: "192.0.2.1"})
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", infected.ClientIP)
+
+	job := waitFinished(t, m, clean.ID)
+	assert.Equal(t, StatusDone, job.Status)
+	assert.False(t, job.VirusFound)
+	assert.WithinDuration(t, job.UpdatedAt.Add(time.Hour), job.ExpiresAt, 0)
+
+	job = waitFinished(t, m, infected.ID)
+	assert.Equal(t, StatusDone, job.Status)
+	assert.True(t, job.VirusFound)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", job.Signature)
+	assert.Equal(t, "foobar", job.QuarantineID)
+
+	// Both jobs are notified once finished
+	var notified []string
+	for range 2 {
+		select {
+		case job := <-finished:
+			assert.True(t, job.Finished())
+			notified = append(notified, job.ID)
+		case <-time.After(5 * time.Second):
+			t.Fatal("job not notified")
+		}
+	}
+	assert.ElementsMatch(t, []string{clean.ID, infected.ID}, notified)
+
+	// The uploads are removed once scanned
+	entries, err := os.ReadDir(m.opts.UploadDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = m.Get(helper.NewID())
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	_, err = m.Get("../foobar")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestManagerSubmitErrors(t *testing.T) {
+	// Scan failure
+	m := newTestManager(t, NewMemoryStore(), &fakeClamav{err: clamd.ErrScanFileSizeLimitExceeded}, Options{QueueSize: 10})
+	require.NoError(t, m.Start())
+
+	job, err := m.Submit("foobar.txt", strings.NewReader("foobar"), SubmitOptions{})
+	require.NoError(t, err)
+
+	job = waitFinished(t, m, job.ID)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Equal(t, "size limit exceeded", job.Error)
+	m.Close()
+
+	// Upload failure
+	_, err = m.Submit("foobar.txt", strings.NewReader("foobar"), SubmitOptions{})
+	assert.ErrorIs(t, err, ErrClosed)
+
+	m = newTestManager(t, NewMemoryStore(), &fakeClamav{}, Options{QueueSize: 10})
+	_, err = m.Submit("foobar.txt", io.MultiReader(strings.NewReader("foo"), errReader{}), SubmitOptions{})
+	assert.ErrorIs(t, err, ErrReadUpload)
+
+	entries, err := os.ReadDir(m.opts.UploadDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Queue full: the workers aren't started
+	m = newTestManager(t, NewMemoryStore(), &fakeClamav{}, Options{QueueSize: 1})
+	_, err = m.Submit("foobar.txt", strings.NewReader("foobar"), SubmitOptions{})
+	assert.NoError(t, err)
+	_, err = m.Submit("foobar.txt", strings.NewReader("foobar"), SubmitOptions{})
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	jobs, err := m.store.List()
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+}
+
+func TestManagerScanTimeout(t *testing.T) {
+	clamav := &fakeClamav{block: make(chan struct{})}
+	defer close(clamav.block)
+
+	m := newTestManager(t, NewMemoryStore(), clamav, Options{
+		Workers:     1,
+		QueueSize:   10,
+		ScanTimeout: 50 * time.Millisecond,
+	})
+	require.NoError(t, m.Start())
+	defer m.Close()
+
+	// The worker is freed to scan the next jobs
+	for range 2 {
+		job, err := m.Submit("foobar.txt", strings.NewReader("foobar"), SubmitOptions{})
+		require.NoError(t, err)
+
+		job = waitFinished(t, m, job.ID)
+		assert.Equal(t, StatusFailed, job.Status)
+		assert.Equal(t, "scan timed out after 50ms", job.Error)
+	}
+}
+
+func TestManagerAllow(t *testing.T) {
+	finished := make(chan *Job, 1)
+	m := newTestManager(t, NewMemoryStore(), &fakeClamav{}, Options{
+		TTL:      time.Hour,
+		OnFinish: func(job *Job) { finished <- job },
+	})
+
+	// Done at once, without the workers
+	job, err := m.Allow("trusted.txt", 6, "trusted", SubmitOptions{RequestID: "cimuf5d3d0kc73ahh5h0"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusDone, job.Status)
+	assert.Equal(t, "trusted", job.Rule)
+	assert.Equal(t, int64(6), job.Size)
+	assert.False(t, job.VirusFound)
+	assert.WithinDuration(t, job.UpdatedAt.Add(time.Hour), job.ExpiresAt, 0)
+	assert.Equal(t, job, <-finished)
+
+	got, err := m.Get(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, job, got)
+
+	m.Close()
+	_, err = m.Allow("trusted.txt", 6, "trusted", SubmitOptions{})
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestManagerRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(filepath.Join(dir, "jobs"))
+	require.NoError(t, err)
+
+	clamav := &fakeClamav{block: make(chan struct{})}
+	opts := Options{Workers: 1, QueueSize: 10, UploadDir: filepath.Join(dir, "uploads")}
+
+	m := newTestManager(t, store, clamav, opts)
+	require.NoError(t, m.Start())
+
+	running, err := m.Submit("eicar.txt", strings.NewReader(eicar), SubmitOptions{})
+	require.NoError(t, err)
+	queued, err := m.Submit("foobar.txt", strings.NewReader("foobar"), SubmitOptions{})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		job, err := m.Get(running.ID)
+		return err == nil && job.Status == StatusRunning
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Stopping while a job is running
+	m.Close()
+
+	job, err := store.Get(running.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusQueued, job.Status)
+
+	// A job whose upload is lost
+	lost := &Job{ID: helper.NewID(), Status: StatusRunning}
+	require.NoError(t, store.Put(lost))
+
+	close(clamav.block)
+	m = newTestManager(t, store, clamav, opts)
+	require.NoError(t, m.Start())
+	defer m.Close()
+
+	job = waitFinished(t, m, running.ID)
+	assert.Equal(t, StatusDone, job.Status)
+	assert.True(t, job.VirusFound)
+
+	job = waitFinished(t, m, queued.ID)
+	assert.Equal(t, StatusDone, job.Status)
+	assert.False(t, job.VirusFound)
+
+	job = waitFinished(t, m, lost.ID)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Contains(t, job.Error, "upload lost")
+}
+
+func TestManagerDeleteExpired(t *testing.T) {
+	now := time.Date(2023, time.July, 8, 8, 0, 0, 0, time.UTC)
+
+	m := newTestManager(t, NewMemoryStore(), &fakeClamav{}, Options{})
+	m.clock = func() time.Time { return now }
+
+	jobs := []*Job{
+		{ID: helper.NewID(), Status: StatusDone, ExpiresAt: now.Add(-time.Second)},
+		{ID: helper.NewID(), Status: StatusFailed, ExpiresAt: now},
+		{ID: helper.NewID(), Status: StatusDone, ExpiresAt: now.Add(time.Second)},
+		{ID: helper.NewID(), Status: StatusQueued},
+		{ID: helper.NewID(), Status: StatusRunning},
+	}
+	for _, job := range jobs {
+		require.NoError(t, m.store.Put(job))
+	}
+
+	n, err := m.DeleteExpired()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	left, err := m.store.List()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, jobs[2:], left)
+}
+
+func TestManagerCleanup(t *testing.T) {
+	m := newTestManager(t, NewMemoryStore(), &fakeClamav{}, Options{QueueSize: 10, CleanupInterval: 10 * time.Millisecond})
+	require.NoError(t, m.Start())
+	defer m.Close()
+
+	job, err := m.Submit("foobar.txt", strings.NewReader("foobar"), SubmitOptions{})
+	require.NoError(t, err)
+
+	// Expiring as soon as finished
+	assert.Eventually(t, func() bool {
+		_, err := m.Get(job.ID)
+		return errors.Is(err, ErrJobNotFound)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNewManager(t *testing.T) {
+	_, err := NewManager(NewMemoryStore(), &fakeClamav{}, Options{UploadDir: t.TempDir()}, nil)
+	assert.Error(t, err)
+
+	_, err = NewManager(NewMemoryStore(), &fakeClamav{}, Options{Workers: 1}, nil)
+	assert.Error(t, err)
+}
+
+// errReader is an io.Reader always failing.
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read error")
+}
@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/lescactus/clamav-api-go/internal/helper"
+)
+
+// MemoryStore is a Store keeping the jobs in memory.
+// They are lost on restart.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	jobs map[string]Job
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]Job)}
+}
+
+func (s *MemoryStore) Put(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = *job
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrJobNotFound, id)
+	}
+	return &job, nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.jobs, id)
+	return nil
+}
+
+func (s *MemoryStore) List() ([]*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// FileStore is a Store keeping each job in a json file of a directory,
+// so that they survive restarts.
+type FileStore struct {
+	dir string
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore returns a FileStore keeping the jobs in dir,
+// which is created if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, errors.New("job store directory not configured")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error while creating the job store directory: %w", err)
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Put writes the job to a temporary file renamed once complete,
+// so that a job is never read partially written.
+func (s *FileStore) Put(job *Job) error {
+	if !helper.ValidID(job.ID) {
+		return fmt.Errorf("invalid job id %q", job.ID)
+	}
+
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = helper.WriteFile(s.path(job.ID), bytes.NewReader(b))
+	return err
+}
+
+func (s *FileStore) Get(id string) (*Job, error) {
+	if !helper.ValidID(id) {
+		return nil, fmt.Errorf("%w: %q", ErrJobNotFound, id)
+	}
+
+	b, err := os.ReadFile(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %q", ErrJobNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(b, &job); err != nil {
+		return nil, fmt.Errorf("error while decoding job %q: %w", id, err)
+	}
+	return &job, nil
+}
+
+func (s *FileStore) Delete(id string) error {
+	if !helper.ValidID(id) {
+		return nil
+	}
+
+	err := os.Remove(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *FileStore) List() ([]*Job, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(entries))
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !helper.ValidID(id) {
+			continue
+		}
+
+		job, err := s.Get(id)
+		if errors.Is(err, ErrJobNotFound) {
+			// Deleted meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
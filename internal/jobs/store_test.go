@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/helper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStores(t *testing.T) {
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "jobs"))
+	require.NoError(t, err)
+
+	stores := map[string]Store{
+		StoreMemory: NewMemoryStore(),
+		StoreFile:   fileStore,
+	}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2023, time.July, 8, 8, 0, 0, 0, time.UTC)
+			job := &Job{
+				ID:        helper.NewID(),
+				Status:    StatusQueued,
+				FileName:  "eicar.txt",
+				Size:      68,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+
+			_, err := s.Get(job.ID)
+			assert.ErrorIs(t, err, ErrJobNotFound)
+
+			assert.NoError(t, s.Put(job))
+
+			got, err := s.Get(job.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, job, got)
+
+			// The stored job isn't shared with the caller
+			got.Status = StatusRunning
+			got, err = s.Get(job.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, StatusQueued, got.Status)
+
+			job.Status = StatusDone
+			job.Signature = "Win.Test.EICAR_HDB-1"
+			job.VirusFound = true
+			assert.NoError(t, s.Put(job))
+
+			other := &Job{ID: helper.NewID(), Status: StatusQueued, CreatedAt: now, UpdatedAt: now}
+			assert.NoError(t, s.Put(other))
+
+			jobs, err := s.List()
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, []*Job{job, other}, jobs)
+
+			assert.NoError(t, s.Delete(job.ID))
+			assert.NoError(t, s.Delete(job.ID))
+
+			_, err = s.Get(job.ID)
+			assert.ErrorIs(t, err, ErrJobNotFound)
+
+			jobs, err = s.List()
+			assert.NoError(t, err)
+			assert.Equal(t, []*Job{other}, jobs)
+		})
+	}
+}
+
+func TestFileStorePersistence(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	job := &Job{ID: helper.NewID(), Status: StatusQueued, CreatedAt: time.Unix(1688800073, 0).UTC()}
+	require.NoError(t, s.Put(job))
+
+	// Files which aren't jobs are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "foobar.json"), []byte("{}"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".job-123"), []byte("{"), 0o600))
+
+	s, err = NewFileStore(dir)
+	require.NoError(t, err)
+
+	jobs, err := s.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []*Job{job}, jobs)
+
+	// Ids which could escape the directory are refused
+	_, err = s.Get("../" + job.ID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	assert.Error(t, s.Put(&Job{ID: "../foobar"}))
+}
+
+func TestOpenStore(t *testing.T) {
+	s, err := OpenStore(StoreMemory, "")
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, s)
+
+	s, err = OpenStore(StoreFile, t.TempDir())
+	assert.NoError(t, err)
+	assert.IsType(t, &FileStore{}, s)
+
+	_, err = OpenStore(StoreFile, "")
+	assert.Error(t, err)
+
+	_, err = OpenStore("redis", "")
+	assert.ErrorIs(t, err, ErrUnknownStore)
+}
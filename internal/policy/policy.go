@@ -0,0 +1,236 @@
+// Package policy decides, before they are scanned, whether the uploaded files
+// are allowed, denied or scanned, from their name, MIME type and size.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Actions taken on the files matched by a rule
+const (
+	// The file is accepted without being scanned
+	ActionAllow = "allow"
+
+	// The file is refused without being scanned
+	ActionDeny = "deny"
+
+	// The file is scanned, as if no rule matched
+	ActionScan = "scan"
+)
+
+var ErrInvalidRule = errors.New("invalid policy rule")
+
+// Rule matches the files meeting all of its conditions. A condition
+// left empty matches every file, and a list of values matches the
+// files matching any of them.
+type Rule struct {
+	// Name of the rule, reported with the decisions it made
+	Name string
+
+	// Either ActionAllow, ActionDeny or ActionScan
+	Action string
+
+	// Extensions of the name of the file, eg. ".exe" or ".tar.gz". Case insensitive
+	Extensions []string
+
+	// Sniffed MIME types of the file, without parameters. They are
+	// patterns as understood by path.Match, eg. "application/vnd.ms-*"
+	MIMETypes []string
+
+	// Patterns of the name of the file, as understood by path.Match,
+	// eg. "invoice*.pdf". Case insensitive
+	Filenames []string
+
+	// Minimum and maximum size of the file, in bytes, inclusive. 0 means no bound
+	MinSize int64
+	MaxSize int64
+}
+
+// File is what is known of a file before it is scanned.
+type File struct {
+	// Name of the file, empty when unknown
+	Name string
+
+	// Sniffed MIME type of the file
+	MIMEType string
+
+	// Size of the file, negative when unknown
+	Size int64
+}
+
+// normalize returns the base name of f, lowercased, and its
+// MIME type without parameters, as matched by the rules.
+func (f File) normalize() (name string, mimeType string) {
+	if f.Name != "" {
+		name = strings.ToLower(path.Base(strings.ReplaceAll(f.Name, `\`, "/")))
+	}
+
+	mimeType, _, _ = strings.Cut(f.MIMEType, ";")
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+
+	return name, mimeType
+}
+
+// Policy is an ordered list of rules: the first rule matching
+// a file decides of its fate. The files matched by no rule are scanned.
+type Policy struct {
+	rules []Rule
+}
+
+// New returns the policy made of rules, in order,
+// or an error wrapping ErrInvalidRule if one of them is invalid.
+func New(rules []Rule) (*Policy, error) {
+	p := &Policy{rules: make([]Rule, 0, len(rules))}
+
+	for i, rule := range rules {
+		if err := validate(rule); err != nil {
+			return nil, fmt.Errorf("%w: #%d %q: %v", ErrInvalidRule, i+1, rule.Name, err)
+		}
+
+		// The conditions are normalized once for all
+		rule.Extensions = normalize(rule.Extensions)
+		for j, ext := range rule.Extensions {
+			if !strings.HasPrefix(ext, ".") {
+				rule.Extensions[j] = "." + ext
+			}
+		}
+		rule.MIMETypes = normalize(rule.MIMETypes)
+		rule.Filenames = normalize(rule.Filenames)
+
+		p.rules = append(p.rules, rule)
+	}
+
+	return p, nil
+}
+
+func validate(rule Rule) error {
+	if rule.Name == "" {
+		return errors.New("missing name")
+	}
+
+	switch rule.Action {
+	case ActionAllow, ActionDeny, ActionScan:
+	default:
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+
+	for _, pattern := range slices.Concat(rule.MIMETypes, rule.Filenames) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("pattern %q: %v", pattern, err)
+		}
+	}
+
+	if rule.MinSize < 0 || rule.MaxSize < 0 {
+		return errors.New("negative size")
+	}
+	if rule.MaxSize > 0 && rule.MaxSize < rule.MinSize {
+		return errors.New("max size lower than min size")
+	}
+
+	return nil
+}
+
+func normalize(values []string) []string {
+	normalized := make([]string, 0, len(values))
+	for _, v := range values {
+		normalized = append(normalized, strings.ToLower(strings.TrimSpace(v)))
+	}
+	return normalized
+}
+
+// Match returns the first rule matching f, nil if none does.
+//
+// When the size of f is unknown, ok is false if a rule depending on the
+// size may be the first one matching: the file must be matched again once
+// its size is known.
+func (p *Policy) Match(f File) (rule *Rule, ok bool) {
+	name, mimeType := f.normalize()
+
+	for i := range p.rules {
+		rule := &p.rules[i]
+
+		if !matchExtension(rule.Extensions, name) ||
+			!matchPattern(rule.MIMETypes, mimeType) ||
+			!matchPattern(rule.Filenames, name) {
+			continue
+		}
+
+		if rule.MinSize == 0 && rule.MaxSize == 0 {
+			return rule, true
+		}
+		if f.Size < 0 {
+			return nil, false
+		}
+		if f.Size >= rule.MinSize && (rule.MaxSize == 0 || f.Size <= rule.MaxSize) {
+			return rule, true
+		}
+	}
+
+	return nil, true
+}
+
+// SizeLimit returns the number of bytes of f to read to know which rule
+// matches it when its size is unknown: the largest size bound of the rules
+// which may be the first one matching it. A file larger than the limit
+// matches the same rule as a file of the limit plus one byte. It is 0 when
+// the size of f isn't needed.
+func (p *Policy) SizeLimit(f File) int64 {
+	f.Size = -1
+	if _, ok := p.Match(f); ok {
+		return 0
+	}
+
+	name, mimeType := f.normalize()
+
+	var limit int64
+	for i := range p.rules {
+		rule := &p.rules[i]
+
+		if !matchExtension(rule.Extensions, name) ||
+			!matchPattern(rule.MIMETypes, mimeType) ||
+			!matchPattern(rule.Filenames, name) {
+			continue
+		}
+
+		// The rules beyond are never reached
+		if rule.MinSize == 0 && rule.MaxSize == 0 {
+			break
+		}
+		limit = max(limit, rule.MinSize, rule.MaxSize)
+	}
+
+	return limit
+}
+
+// matchExtension returns true if there are no extensions
+// or if name, when known, ends with one of them.
+func matchExtension(extensions []string, name string) bool {
+	if len(extensions) == 0 {
+		return true
+	}
+	if name == "" {
+		return false
+	}
+	return slices.ContainsFunc(extensions, func(ext string) bool {
+		return strings.HasSuffix(name, ext)
+	})
+}
+
+// matchPattern returns true if there are no patterns
+// or if s, when known, matches one of them.
+func matchPattern(patterns []string, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	if s == "" {
+		return false
+	}
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		ok, _ := path.Match(pattern, s)
+		return ok
+	})
+}
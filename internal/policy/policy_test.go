@@ -0,0 +1,195 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		error string
+	}{
+		{
+			name:  "missing name",
+			rule:  Rule{Action: ActionDeny},
+			error: `invalid policy rule: #1 "": missing name`,
+		},
+		{
+			name:  "unknown action",
+			rule:  Rule{Name: "foo", Action: "quarantine"},
+			error: `invalid policy rule: #1 "foo": unknown action "quarantine"`,
+		},
+		{
+			name:  "bad pattern",
+			rule:  Rule{Name: "foo", Action: ActionDeny, Filenames: []string{"[a-"}},
+			error: `invalid policy rule: #1 "foo": pattern "[a-": syntax error in pattern`,
+		},
+		{
+			name:  "negative size",
+			rule:  Rule{Name: "foo", Action: ActionDeny, MinSize: -1},
+			error: `invalid policy rule: #1 "foo": negative size`,
+		},
+		{
+			name:  "max size lower than min size",
+			rule:  Rule{Name: "foo", Action: ActionDeny, MinSize: 10, MaxSize: 5},
+			error: `invalid policy rule: #1 "foo": max size lower than min size`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New([]Rule{tt.rule})
+			assert.ErrorIs(t, err, ErrInvalidRule)
+			assert.EqualError(t, err, tt.error)
+		})
+	}
+
+	p, err := New(nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, p)
+}
+
+func TestPolicyMatch(t *testing.T) {
+	p, err := New([]Rule{
+		{Name: "executables", Action: ActionDeny, Extensions: []string{"EXE", ".dll"}},
+		{Name: "binaries", Action: ActionDeny, MIMETypes: []string{"application/vnd.microsoft.portable-executable", "application/x-executable"}},
+		{Name: "macros", Action: ActionDeny, Extensions: []string{".docm", ".xlsm"}},
+		{Name: "large pdf", Action: ActionDeny, MIMETypes: []string{"application/pdf"}, MinSize: 1025},
+		{Name: "reports", Action: ActionScan, Filenames: []string{"report-*.pdf"}},
+		{Name: "pdf", Action: ActionAllow, MIMETypes: []string{"application/pdf"}},
+		{Name: "images", Action: ActionAllow, MIMETypes: []string{"image/*"}, MaxSize: 1024},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		file File
+		rule string
+		ok   bool
+	}{
+		{
+			name: "extension",
+			file: File{Name: "setup.EXE", MIMEType: "application/octet-stream", Size: 10},
+			rule: "executables",
+			ok:   true,
+		},
+		{
+			name: "sniffed MIME type",
+			file: File{Name: "notes.txt", MIMEType: "application/vnd.microsoft.portable-executable", Size: 10},
+			rule: "binaries",
+			ok:   true,
+		},
+		{
+			name: "path in the name",
+			file: File{Name: `C:\Users\foo\budget.xlsm`, MIMEType: "application/zip", Size: 10},
+			rule: "macros",
+			ok:   true,
+		},
+		{
+			name: "size",
+			file: File{Name: "report-2023.pdf", MIMEType: "application/pdf", Size: 2048},
+			rule: "large pdf",
+			ok:   true,
+		},
+		{
+			name: "filename pattern",
+			file: File{Name: "Report-2023.pdf", MIMEType: "application/pdf", Size: 1024},
+			rule: "reports",
+			ok:   true,
+		},
+		{
+			name: "first matching rule",
+			file: File{Name: "invoice.pdf", MIMEType: "application/pdf", Size: 1024},
+			rule: "pdf",
+			ok:   true,
+		},
+		{
+			name: "MIME type with parameters",
+			file: File{Name: "logo.svg", MIMEType: "image/svg+xml; charset=utf-8", Size: 1024},
+			rule: "images",
+			ok:   true,
+		},
+		{
+			name: "no matching rule",
+			file: File{Name: "logo.png", MIMEType: "image/png", Size: 1025},
+			ok:   true,
+		},
+		{
+			name: "unknown name",
+			file: File{MIMEType: "text/plain; charset=utf-8", Size: 10},
+			ok:   true,
+		},
+		{
+			name: "unknown size, rule depending on the size",
+			file: File{Name: "invoice.pdf", MIMEType: "application/pdf", Size: -1},
+			ok:   false,
+		},
+		{
+			name: "unknown size, rule not depending on the size",
+			file: File{Name: "setup.exe", MIMEType: "application/octet-stream", Size: -1},
+			rule: "executables",
+			ok:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, ok := p.Match(tt.file)
+			assert.Equal(t, tt.ok, ok)
+			if tt.rule == "" {
+				assert.Nil(t, rule)
+			} else if assert.NotNil(t, rule) {
+				assert.Equal(t, tt.rule, rule.Name)
+			}
+		})
+	}
+}
+
+func TestPolicySizeLimit(t *testing.T) {
+	p, err := New([]Rule{
+		{Name: "executables", Action: ActionDeny, Extensions: []string{".exe"}},
+		{Name: "large pdf", Action: ActionDeny, MIMETypes: []string{"application/pdf"}, MinSize: 1025},
+		{Name: "small images", Action: ActionAllow, MIMETypes: []string{"image/*"}, MaxSize: 1024},
+		{Name: "medium images", Action: ActionScan, MIMETypes: []string{"image/*"}, MinSize: 1025, MaxSize: 4096},
+		{Name: "images", Action: ActionDeny, MIMETypes: []string{"image/*"}},
+		{Name: "huge", Action: ActionDeny, MinSize: 1 << 20},
+	})
+	require.NoError(t, err)
+
+	// The size isn't needed
+	assert.Zero(t, p.SizeLimit(File{Name: "setup.exe", MIMEType: "application/octet-stream"}))
+
+	// The rules beyond the first one not depending on the size are never reached
+	assert.EqualValues(t, 4096, p.SizeLimit(File{Name: "cat.png", MIMEType: "image/png"}))
+	assert.EqualValues(t, 1<<20, p.SizeLimit(File{Name: "invoice.pdf", MIMEType: "application/pdf"}))
+
+	// A file larger than the limit matches as a file of the limit plus one byte
+	for _, size := range []int64{4097, 1 << 30} {
+		rule, ok := p.Match(File{Name: "cat.png", MIMEType: "image/png", Size: size})
+		assert.True(t, ok)
+		assert.Equal(t, "images", rule.Name)
+	}
+}
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{name: "windows executable", head: "MZ\x90\x00\x03\x00", want: "application/vnd.microsoft.portable-executable"},
+		{name: "linux executable", head: "\x7fELF\x02\x01\x01", want: "application/x-executable"},
+		{name: "macos executable", head: "\xcf\xfa\xed\xfe\x07\x00\x00\x01", want: "application/x-mach-binary"},
+		{name: "legacy office document", head: "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1\x00", want: "application/x-ole-storage"},
+		{name: "script", head: "#!/bin/sh\necho foo\n", want: "text/x-shellscript"},
+		{name: "pdf", head: "%PDF-1.7\n", want: "application/pdf"},
+		{name: "text", head: "foobar", want: "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, DetectContentType([]byte(tt.head)))
+		})
+	}
+}
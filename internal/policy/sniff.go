@@ -0,0 +1,44 @@
+package policy
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// signatures are the magic bytes of the file types
+// http.DetectContentType doesn't tell apart.
+var signatures = []struct {
+	magic    []byte
+	mimeType string
+}{
+	// Windows executables and libraries
+	{[]byte("MZ"), "application/vnd.microsoft.portable-executable"},
+
+	// Linux executables and libraries
+	{[]byte("\x7fELF"), "application/x-executable"},
+
+	// macOS executables and libraries, 32 and 64 bits, both endiannesses
+	{[]byte("\xfe\xed\xfa\xce"), "application/x-mach-binary"},
+	{[]byte("\xfe\xed\xfa\xcf"), "application/x-mach-binary"},
+	{[]byte("\xce\xfa\xed\xfe"), "application/x-mach-binary"},
+	{[]byte("\xcf\xfa\xed\xfe"), "application/x-mach-binary"},
+
+	// Legacy Office documents, which may contain macros, and msi installers
+	{[]byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), "application/x-ole-storage"},
+
+	// Scripts
+	{[]byte("#!"), "text/x-shellscript"},
+}
+
+// DetectContentType returns the MIME type of the content starting with head,
+// at most 512 bytes being considered. It extends http.DetectContentType
+// with the executables, scripts and legacy Office documents.
+func DetectContentType(head []byte) string {
+	for _, sig := range signatures {
+		if bytes.HasPrefix(head, sig.magic) {
+			return sig.mimeType
+		}
+	}
+
+	return http.DetectContentType(head)
+}
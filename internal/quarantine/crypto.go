@@ -0,0 +1,227 @@
+package quarantine
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrInvalidKey = errors.New("invalid quarantine key")
+	ErrDecrypt    = errors.New("unable to decrypt the quarantined object")
+)
+
+// ParseKey decodes a base64-encoded AES-256 key.
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("%w: %d bytes instead of %d", ErrInvalidKey, len(key), keySize)
+	}
+	return key, nil
+}
+
+// The objects are encrypted with AES-256-GCM, in segments so that they can
+// be encrypted and decrypted while being streamed. An object starts with a
+// random nonce prefix, followed by the sealed segments. The nonce of a
+// segment is made of the prefix, of its index and of a flag set for the
+// last one, so that the segments can't be reordered, nor the object truncated.
+// The key of the object is authenticated along with each segment, so that
+// the objects can't be swapped.
+const (
+	keySize     = 32
+	prefixSize  = 7
+	segmentSize = 64 * 1024
+)
+
+type streamCipher struct {
+	aead cipher.AEAD
+}
+
+func newStreamCipher(key []byte) (*streamCipher, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("%w: %d bytes instead of %d", ErrInvalidKey, len(key), keySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamCipher{aead: aead}, nil
+}
+
+// nonce returns the nonce of the segment i of the object whose nonce prefix is prefix.
+func nonce(prefix []byte, i uint32, last bool) []byte {
+	n := make([]byte, 0, prefixSize+5)
+	n = append(n, prefix...)
+	n = binary.BigEndian.AppendUint32(n, i)
+	if last {
+		return append(n, 1)
+	}
+	return append(n, 0)
+}
+
+// encrypt returns a writer encrypting the object key to w.
+// It must be closed for the last segment to be written.
+func (c *streamCipher) encrypt(w io.Writer, key string) (*encryptWriter, error) {
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		aead:   c.aead,
+		w:      w,
+		ad:     []byte(key),
+		prefix: prefix,
+		buf:    make([]byte, 0, segmentSize+c.aead.Overhead()),
+	}, nil
+}
+
+type encryptWriter struct {
+	aead   cipher.AEAD
+	w      io.Writer
+	ad     []byte
+	prefix []byte
+	buf    []byte
+	i      uint32
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// A full segment is only sealed once more data comes,
+		// the last segment being always shorter
+		if len(e.buf) == segmentSize {
+			if err := e.seal(false); err != nil {
+				return n, err
+			}
+		}
+
+		m := copy(e.buf[len(e.buf):segmentSize], p)
+		e.buf = e.buf[:len(e.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Close seals the last segment. It doesn't close the underlying writer.
+func (e *encryptWriter) Close() error {
+	if len(e.buf) == segmentSize {
+		if err := e.seal(false); err != nil {
+			return err
+		}
+	}
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	if e.i == ^uint32(0) {
+		return errors.New("quarantined object too large")
+	}
+
+	sealed := e.aead.Seal(e.buf[:0], nonce(e.prefix, e.i, last), e.buf, e.ad)
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+
+	e.buf = e.buf[:0]
+	e.i++
+	return nil
+}
+
+// decrypt returns a reader decrypting the object key read from r.
+// Its errors wrap ErrDecrypt when the object was tampered with.
+func (c *streamCipher) decrypt(r io.Reader, key string) io.Reader {
+	return &decryptReader{
+		aead: c.aead,
+		r:    r,
+		ad:   []byte(key),
+		buf:  make([]byte, segmentSize+c.aead.Overhead()),
+	}
+}
+
+type decryptReader struct {
+	aead   cipher.AEAD
+	r      io.Reader
+	ad     []byte
+	prefix []byte
+	buf    []byte
+	i      uint32
+
+	// Decrypted data not read yet
+	plain []byte
+	last  bool
+	err   error
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 && d.err == nil {
+		if d.last {
+			d.err = io.EOF
+			break
+		}
+		d.err = d.open()
+	}
+	if len(d.plain) == 0 {
+		return 0, d.err
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// open decrypts the next segment.
+func (d *decryptReader) open() error {
+	if d.prefix == nil {
+		d.prefix = make([]byte, prefixSize)
+		if _, err := io.ReadFull(d.r, d.prefix); err != nil {
+			return truncated(err)
+		}
+	}
+
+	// Only the last segment is shorter than a full one
+	n, err := io.ReadFull(d.r, d.buf)
+	switch {
+	case err == nil:
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		d.last = true
+	default:
+		return truncated(err)
+	}
+
+	plain, err := d.aead.Open(d.buf[:0], nonce(d.prefix, d.i, d.last), d.buf[:n], d.ad)
+	if err != nil {
+		return fmt.Errorf("%w: segment %d: %v", ErrDecrypt, d.i, err)
+	}
+
+	d.plain = plain
+	d.i++
+	return nil
+}
+
+// truncated returns the error of a read which reached the end
+// of an object before its last segment.
+func truncated(err error) error {
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: truncated", ErrDecrypt)
+	}
+	return err
+}
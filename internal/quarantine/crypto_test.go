@@ -0,0 +1,91 @@
+package quarantine
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testKey = bytes.Repeat([]byte{0x42}, keySize)
+
+func TestParseKey(t *testing.T) {
+	key, err := ParseKey(base64.StdEncoding.EncodeToString(testKey))
+	assert.NoError(t, err)
+	assert.Equal(t, testKey, key)
+
+	_, err = ParseKey("not base64")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = ParseKey(base64.StdEncoding.EncodeToString(testKey[:16]))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	assert.EqualError(t, err, "invalid quarantine key: 16 bytes instead of 32")
+}
+
+func TestStreamCipher(t *testing.T) {
+	c, err := newStreamCipher(testKey)
+	require.NoError(t, err)
+
+	encrypt := func(plain []byte, key string) []byte {
+		buf := &bytes.Buffer{}
+		w, err := c.encrypt(buf, key)
+		require.NoError(t, err)
+
+		// Written in small chunks, as when copied from a stream
+		for p := plain; len(p) > 0; {
+			n := min(len(p), 1000)
+			_, err := w.Write(p[:n])
+			require.NoError(t, err)
+			p = p[n:]
+		}
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 2 * segmentSize, 3*segmentSize + 42} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		encrypted := encrypt(plain, "content/foo")
+		segments := size/segmentSize + 1
+		assert.Len(t, encrypted, prefixSize+size+segments*c.aead.Overhead(), "size %d", size)
+
+		decrypted, err := io.ReadAll(c.decrypt(bytes.NewReader(encrypted), "content/foo"))
+		require.NoError(t, err, "size %d", size)
+		assert.True(t, bytes.Equal(plain, decrypted), "size %d", size)
+	}
+
+	plain := []byte(strings.Repeat("foobar", segmentSize/3))
+	encrypted := encrypt(plain, "content/foo")
+	assert.NotContains(t, string(encrypted), "foobar")
+
+	// The objects are bound to their key
+	_, err = io.ReadAll(c.decrypt(bytes.NewReader(encrypted), "content/bar"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	// Truncated after a segment
+	_, err = io.ReadAll(c.decrypt(bytes.NewReader(encrypted[:prefixSize+segmentSize+c.aead.Overhead()]), "content/foo"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+	assert.EqualError(t, err, "unable to decrypt the quarantined object: truncated")
+
+	// Tampered with
+	tampered := bytes.Clone(encrypted)
+	tampered[len(tampered)-1] ^= 1
+	_, err = io.ReadAll(c.decrypt(bytes.NewReader(tampered), "content/foo"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	// Encrypted with another key
+	other, err := newStreamCipher(bytes.Repeat([]byte{0x24}, keySize))
+	require.NoError(t, err)
+	_, err = io.ReadAll(other.decrypt(bytes.NewReader(encrypted), "content/foo"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	// Empty
+	_, err = io.ReadAll(c.decrypt(bytes.NewReader(nil), "content/foo"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
@@ -0,0 +1,111 @@
+package quarantine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lescactus/clamav-api-go/internal/helper"
+)
+
+// DirBackend is a Backend keeping each object in a file of a local directory.
+type DirBackend struct {
+	dir string
+}
+
+var _ Backend = (*DirBackend)(nil)
+
+// NewDirBackend returns a DirBackend keeping the objects in dir,
+// which is created if needed.
+func NewDirBackend(dir string) (*DirBackend, error) {
+	if dir == "" {
+		return nil, errors.New("quarantine directory not configured")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error while creating the quarantine directory: %w", err)
+	}
+
+	return &DirBackend{dir: dir}, nil
+}
+
+func (b *DirBackend) path(key string) string {
+	return filepath.Join(b.dir, filepath.FromSlash(key))
+}
+
+// Put writes the object to a temporary file renamed once complete,
+// so that an object is never read partially written.
+func (b *DirBackend) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	path := b.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	_, err := helper.WriteFile(path, &sizedReader{r: r, n: size})
+	return err
+}
+
+func (b *DirBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(b.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (b *DirBackend) Delete(ctx context.Context, key string) error {
+	err := os.Remove(b.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List returns the keys of the objects of the directory of prefix,
+// which must end with a slash.
+func (b *DirBackend) List(ctx context.Context, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(b.path(prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(entries))
+	for _, e := range entries {
+		// Skipping the objects being written
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		keys = append(keys, prefix+e.Name())
+	}
+	return keys, nil
+}
+
+// sizedReader reads n bytes from r. It returns io.ErrUnexpectedEOF
+// when r ends before, so that a truncated object isn't written.
+type sizedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (s *sizedReader) Read(p []byte) (int, error) {
+	if s.n <= 0 {
+		return 0, io.EOF
+	}
+
+	n, err := s.r.Read(p[:min(int64(len(p)), s.n)])
+	s.n -= int64(n)
+	if err == io.EOF && s.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
@@ -0,0 +1,448 @@
+// Package quarantine saves the infected uploads, encrypted at rest, so that
+// they can be looked at later on.
+//
+// The content of an item and its metadata are stored encrypted as two objects
+// of a Backend, either a local directory or an S3-compatible bucket. The
+// items expire after a while, the oldest ones being deleted beyond a
+// maximum number of items.
+package quarantine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/helper"
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrNotFound       = errors.New("quarantined item not found")
+	ErrUnknownBackend = errors.New("unknown quarantine backend")
+)
+
+// Available quarantine backends
+const (
+	BackendDir = "dir"
+	BackendS3  = "s3"
+)
+
+// Item is the metadata of an infected content saved in the quarantine.
+type Item struct {
+	ID string `json:"id"`
+
+	// Name of the uploaded file, if any
+	FileName string `json:"filename,omitempty"`
+	Size     int64  `json:"size"`
+	MIMEType string `json:"mime_type,omitempty"`
+
+	// Hex-encoded hashes of the content
+	MD5    string `json:"md5"`
+	SHA1   string `json:"sha1"`
+	SHA256 string `json:"sha256"`
+
+	// Signature of the virus found
+	Signature string `json:"signature"`
+
+	// Id of the request which uploaded the content, and address of its client
+	RequestID string `json:"request_id"`
+	ClientIP  string `json:"client_ip"`
+
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// Backend stores the encrypted objects of the quarantine by key.
+// Its methods must be safe for concurrent use.
+type Backend interface {
+	// Put creates or replaces the object key with the size bytes of r
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+
+	// Get returns the content of the object key, or an error wrapping ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the object key, if any
+	Delete(ctx context.Context, key string) error
+
+	// List returns the keys of the objects starting with prefix, in no particular order
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Options configures a Quarantine.
+type Options struct {
+	// AES-256 key with which the items are encrypted, 32 bytes long
+	Key []byte
+
+	// Password of the zip archives the items are exported to
+	ZipPassword string
+
+	// Duration an item is kept. 0 keeps the items forever
+	MaxAge time.Duration
+
+	// Maximum number of items kept, the oldest ones being deleted
+	// beyond. 0 means no limit
+	MaxItems int
+
+	// Interval between two deletions of the expired items
+	CleanupInterval time.Duration
+
+	// Maximum duration to save an item in the backend. 0 means no limit
+	Timeout time.Duration
+
+	// Directory in which the contents are spooled while being scanned.
+	// The default directory for temporary files is used when empty
+	SpoolDir string
+}
+
+// Quarantine saves the infected contents in a Backend.
+type Quarantine struct {
+	backend Backend
+	cipher  *streamCipher
+	opts    Options
+	logger  *zerolog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// Overridden in tests
+	clock helper.Clock
+}
+
+// Prefixes of the keys of the objects of the items
+const (
+	prefixContent  = "content/"
+	prefixMetadata = "metadata/"
+)
+
+// New returns a Quarantine saving the items in backend. Start must be
+// called for the expired items to be deleted periodically.
+func New(backend Backend, opts Options, logger *zerolog.Logger) (*Quarantine, error) {
+	c, err := newStreamCipher(opts.Key)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxAge < 0 || opts.MaxItems < 0 {
+		return nil, errors.New("invalid quarantine retention limits")
+	}
+	if logger == nil {
+		nop := zerolog.Nop()
+		logger = &nop
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Quarantine{
+		backend: backend,
+		cipher:  c,
+		opts:    opts,
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+// Start starts the periodic deletion of the expired items,
+// if there are retention limits.
+func (q *Quarantine) Start() {
+	if q.opts.CleanupInterval <= 0 || (q.opts.MaxAge == 0 && q.opts.MaxItems == 0) {
+		return
+	}
+
+	q.wg.Add(1)
+	go q.cleanup()
+}
+
+// Close stops the deletion of the expired items.
+func (q *Quarantine) Close() {
+	q.cancel()
+	q.wg.Wait()
+}
+
+func (q *Quarantine) cleanup() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.opts.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := q.DeleteExpired(q.ctx); err != nil {
+				q.logger.Error().Err(err).Msg("unable to delete expired quarantined items")
+			} else if n > 0 {
+				q.logger.Debug().Int("count", n).Msg("expired quarantined items deleted")
+			}
+		}
+	}
+}
+
+// ExpiresAt returns the time after which item is deleted,
+// zero when the items are kept forever.
+func (q *Quarantine) ExpiresAt(item *Item) time.Time {
+	if q.opts.MaxAge == 0 {
+		return time.Time{}
+	}
+	return item.QuarantinedAt.Add(q.opts.MaxAge)
+}
+
+// Spool is a content being copied to an encrypted temporary file while it
+// is scanned, until it is known whether it must be quarantined.
+type Spool struct {
+	q   *Quarantine
+	id  string
+	f   *os.File
+	w   *encryptWriter
+	n   int64
+	err error
+}
+
+// NewSpool returns a new Spool. Either Commit or Discard must be called.
+func (q *Quarantine) NewSpool() (*Spool, error) {
+	f, err := os.CreateTemp(q.opts.SpoolDir, "clamav-api-quarantine-*")
+	if err != nil {
+		return nil, fmt.Errorf("error while creating the quarantine spool: %w", err)
+	}
+
+	id := helper.NewID()
+	w, err := q.cipher.encrypt(f, prefixContent+id)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	return &Spool{q: q, id: id, f: f, w: w}, nil
+}
+
+// Write never fails, so that the spool can be fed along with a scan:
+// the first error is returned by Commit.
+func (s *Spool) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return len(p), nil
+	}
+	n, err := s.w.Write(p)
+	s.n += int64(n)
+	s.err = err
+	return len(p), nil
+}
+
+// Commit saves the content written to the spool in the quarantine, with the
+// metadata of item. The id, the size and the time of item are set.
+func (s *Spool) Commit(ctx context.Context, item *Item) error {
+	defer s.Discard()
+
+	if s.q.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.q.opts.Timeout)
+		defer cancel()
+	}
+
+	if s.err != nil {
+		return fmt.Errorf("error while writing the quarantine spool: %w", s.err)
+	}
+	if err := s.w.Close(); err != nil {
+		return fmt.Errorf("error while writing the quarantine spool: %w", err)
+	}
+	size, err := s.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	item.ID = s.id
+	item.Size = s.n
+	item.QuarantinedAt = s.q.clock.Now().UTC()
+
+	// The metadata is written last: an item exists once it is readable
+	if err := s.q.backend.Put(ctx, prefixContent+s.id, s.f, size); err != nil {
+		return fmt.Errorf("error while saving the quarantined content: %w", err)
+	}
+	if err := s.q.putMetadata(ctx, item); err != nil {
+		s.q.backend.Delete(ctx, prefixContent+s.id)
+		return fmt.Errorf("error while saving the quarantined item: %w", err)
+	}
+
+	return nil
+}
+
+// Discard removes the spool. It is a no-op once committed.
+func (s *Spool) Discard() {
+	if s.f == nil {
+		return
+	}
+	s.f.Close()
+	os.Remove(s.f.Name())
+	s.f = nil
+}
+
+// Put saves the content of r in the quarantine, with the metadata
+// of item. The id, the size and the time of item are set.
+func (q *Quarantine) Put(ctx context.Context, item *Item, r io.Reader) error {
+	s, err := q.NewSpool()
+	if err != nil {
+		return err
+	}
+	defer s.Discard()
+
+	if _, err := io.Copy(s, r); err != nil {
+		return fmt.Errorf("error while writing the quarantine spool: %w", err)
+	}
+	return s.Commit(ctx, item)
+}
+
+func (q *Quarantine) putMetadata(ctx context.Context, item *Item) error {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	key := prefixMetadata + item.ID
+	buf := &bytes.Buffer{}
+	w, err := q.cipher.encrypt(buf, key)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return q.backend.Put(ctx, key, buf, int64(buf.Len()))
+}
+
+// Get returns the metadata of the item with the given id, or ErrNotFound.
+func (q *Quarantine) Get(ctx context.Context, id string) (*Item, error) {
+	if !helper.ValidID(id) {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, id)
+	}
+
+	key := prefixMetadata + id
+	rc, err := q.backend.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var item Item
+	if err := json.NewDecoder(q.cipher.decrypt(rc, key)).Decode(&item); err != nil {
+		return nil, fmt.Errorf("error while decoding the quarantined item %q: %w", id, err)
+	}
+	return &item, nil
+}
+
+// List returns the metadata of all the items, the most recent first.
+func (q *Quarantine) List(ctx context.Context) ([]*Item, error) {
+	keys, err := q.backend.List(ctx, prefixMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*Item, 0, len(keys))
+	for _, key := range keys {
+		item, err := q.Get(ctx, strings.TrimPrefix(key, prefixMetadata))
+		if errors.Is(err, ErrNotFound) {
+			// Deleted in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	slices.SortFunc(items, func(a, b *Item) int {
+		if c := b.QuarantinedAt.Compare(a.QuarantinedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return items, nil
+}
+
+// Open returns the decrypted content of the item with the given id,
+// or ErrNotFound. Reading it fails if the content was tampered with.
+func (q *Quarantine) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	if !helper.ValidID(id) {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, id)
+	}
+
+	key := prefixContent + id
+	rc, err := q.backend.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{q.cipher.decrypt(rc, key), rc}, nil
+}
+
+// Delete deletes the item with the given id, or returns ErrNotFound.
+func (q *Quarantine) Delete(ctx context.Context, id string) error {
+	if _, err := q.Get(ctx, id); err != nil {
+		return err
+	}
+
+	// The metadata is deleted first: an item doesn't exist anymore
+	// as soon as it isn't listed
+	if err := q.backend.Delete(ctx, prefixMetadata+id); err != nil {
+		return err
+	}
+	return q.backend.Delete(ctx, prefixContent+id)
+}
+
+// DeleteExpired deletes the items older than the maximum age, then the
+// oldest ones beyond the maximum number of items, and returns how many
+// were deleted.
+func (q *Quarantine) DeleteExpired(ctx context.Context) (int, error) {
+	if q.opts.MaxAge == 0 && q.opts.MaxItems == 0 {
+		return 0, nil
+	}
+
+	items, err := q.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := q.clock.Now()
+	n := 0
+	for i, item := range items {
+		expired := q.opts.MaxAge > 0 && !q.ExpiresAt(item).After(now)
+		if !expired && (q.opts.MaxItems == 0 || i < q.opts.MaxItems) {
+			continue
+		}
+
+		err := q.Delete(ctx, item.ID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
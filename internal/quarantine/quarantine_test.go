@@ -0,0 +1,234 @@
+package quarantine
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/helper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+func newTestQuarantine(t *testing.T, opts Options) (*Quarantine, string) {
+	dir := t.TempDir()
+	backend, err := NewDirBackend(dir)
+	require.NoError(t, err)
+
+	opts.Key = testKey
+	opts.SpoolDir = t.TempDir()
+	q, err := New(backend, opts, nil)
+	require.NoError(t, err)
+	t.Cleanup(q.Close)
+
+	return q, dir
+}
+
+func TestNew(t *testing.T) {
+	backend, err := NewDirBackend(t.TempDir())
+	require.NoError(t, err)
+
+	_, err = New(backend, Options{Key: testKey[:16]}, nil)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = New(backend, Options{Key: testKey, MaxItems: -1}, nil)
+	assert.Error(t, err)
+
+	_, err = NewDirBackend("")
+	assert.Error(t, err)
+}
+
+func TestQuarantine(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, time.July, 8, 8, 0, 0, 0, time.UTC)
+
+	q, dir := newTestQuarantine(t, Options{})
+	q.clock = func() time.Time { return now }
+
+	item := &Item{
+		FileName:  "eicar.txt",
+		SHA256:    "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f",
+		Signature: "Win.Test.EICAR_HDB-1",
+		RequestID: "cimuf5d3d0kc73ahh5h0",
+		ClientIP:  "192.0.2.1",
+	}
+	require.NoError(t, q.Put(ctx, item, strings.NewReader(eicar)))
+	assert.True(t, helper.ValidID(item.ID))
+	assert.EqualValues(t, len(eicar), item.Size)
+	assert.Equal(t, now, item.QuarantinedAt)
+
+	// Encrypted at rest, the spool being removed
+	for _, name := range []string{"content", "metadata"} {
+		b, err := os.ReadFile(filepath.Join(dir, name, item.ID))
+		require.NoError(t, err)
+		assert.NotContains(t, string(b), "EICAR")
+		assert.NotContains(t, string(b), "192.0.2.1")
+	}
+	spooled, err := os.ReadDir(q.opts.SpoolDir)
+	require.NoError(t, err)
+	assert.Empty(t, spooled)
+
+	got, err := q.Get(ctx, item.ID)
+	require.NoError(t, err)
+	assert.Equal(t, item, got)
+
+	rc, err := q.Open(ctx, item.ID)
+	require.NoError(t, err)
+	b, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, eicar, string(b))
+
+	// Streamed content, most recent first
+	now = now.Add(time.Minute)
+	s, err := q.NewSpool()
+	require.NoError(t, err)
+	io.WriteString(s, "foo")
+	io.WriteString(s, "bar")
+	other := &Item{Signature: "Foo.Bar"}
+	require.NoError(t, s.Commit(ctx, other))
+	assert.EqualValues(t, 6, other.Size)
+
+	items, err := q.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*Item{other, item}, items)
+
+	// Discarded spool
+	s, err = q.NewSpool()
+	require.NoError(t, err)
+	io.WriteString(s, "foobar")
+	s.Discard()
+	s.Discard()
+
+	items, err = q.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, items, 2)
+
+	// Deleted
+	require.NoError(t, q.Delete(ctx, item.ID))
+	_, err = q.Get(ctx, item.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = q.Open(ctx, item.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, q.Delete(ctx, item.ID), ErrNotFound)
+
+	// Invalid ids aren't used as keys
+	_, err = q.Get(ctx, "../metadata/"+other.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = q.Open(ctx, "../content/"+other.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Tampered with
+	path := filepath.Join(dir, "content", other.ID)
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	b[len(b)-1] ^= 1
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+
+	rc, err = q.Open(ctx, other.ID)
+	require.NoError(t, err)
+	_, err = io.ReadAll(rc)
+	rc.Close()
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestQuarantineDeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, time.July, 8, 8, 0, 0, 0, time.UTC)
+
+	q, _ := newTestQuarantine(t, Options{MaxAge: time.Hour, MaxItems: 2})
+	q.clock = func() time.Time { return now }
+
+	var ids []string
+	for i := range 4 {
+		now = now.Add(time.Duration(i) * 20 * time.Minute)
+
+		item := &Item{}
+		require.NoError(t, q.Put(ctx, item, strings.NewReader("foobar")))
+		ids = append(ids, item.ID)
+	}
+	// Quarantined at 08:00, 08:20, 09:00 and 10:00
+
+	assert.Equal(t, time.Date(2023, time.July, 8, 11, 0, 0, 0, time.UTC), q.ExpiresAt(&Item{QuarantinedAt: now}))
+
+	// The first two are too old
+	now = time.Date(2023, time.July, 8, 9, 30, 0, 0, time.UTC)
+	n, err := q.DeleteExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	items, err := q.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, ids[3], items[0].ID)
+	assert.Equal(t, ids[2], items[1].ID)
+
+	// Beyond the maximum number of items
+	item := &Item{}
+	require.NoError(t, q.Put(ctx, item, strings.NewReader("foobar")))
+
+	n, err = q.DeleteExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	items, err = q.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, ids[3], items[0].ID)
+	assert.Equal(t, item.ID, items[1].ID)
+}
+
+func TestDirBackendPut(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	backend, err := NewDirBackend(dir)
+	require.NoError(t, err)
+
+	// Only size bytes are written
+	require.NoError(t, backend.Put(ctx, "content/foo", strings.NewReader("foobar"), 3))
+
+	rc, err := backend.Get(ctx, "content/foo")
+	require.NoError(t, err)
+	b, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+
+	// Truncated, without leaving anything behind
+	err = backend.Put(ctx, "content/bar", strings.NewReader("foobar"), 7)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	keys, err := backend.List(ctx, "content/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"content/foo"}, keys)
+
+	entries, err := os.ReadDir(filepath.Join(dir, "content"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// blockingBackend is a Backend whose Put blocks until its context is done.
+type blockingBackend struct {
+	Backend
+}
+
+func (b blockingBackend) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestQuarantineTimeout(t *testing.T) {
+	q, err := New(blockingBackend{}, Options{Key: testKey, SpoolDir: t.TempDir(), Timeout: 10 * time.Millisecond}, nil)
+	require.NoError(t, err)
+	defer q.Close()
+
+	err = q.Put(context.Background(), &Item{}, strings.NewReader(eicar))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,317 @@
+package quarantine
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/helper"
+)
+
+// S3Options configures an S3Backend.
+type S3Options struct {
+	// Url of the S3-compatible service, eg. "https://s3.eu-west-1.amazonaws.com"
+	Endpoint string
+
+	// Region of the bucket, used to sign the requests
+	Region string
+
+	Bucket string
+
+	// Prefix of the keys of the objects in the bucket, eg. "quarantine/"
+	Prefix string
+
+	// Credentials the requests are signed with
+	AccessKey string
+	SecretKey string
+
+	// Address the bucket as a path of the endpoint, eg.
+	// "https://minio:9000/bucket", rather than as a subdomain,
+	// eg. "https://bucket.s3.eu-west-1.amazonaws.com"
+	PathStyle bool
+
+	// Maximum duration of a request, including the read of the
+	// response body, when Client is nil. 0 means no limit
+	Timeout time.Duration
+
+	// Http client sending the requests, a client whose
+	// timeout is Timeout when nil
+	Client *http.Client
+}
+
+// S3Backend is a Backend keeping each object in an S3-compatible bucket.
+// The requests are signed with the AWS signature version 4.
+type S3Backend struct {
+	opts     S3Options
+	endpoint *url.URL
+	client   *http.Client
+
+	// Overridden in tests
+	clock helper.Clock
+}
+
+var _ Backend = (*S3Backend)(nil)
+
+func NewS3Backend(opts S3Options) (*S3Backend, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid quarantine s3 endpoint %q", opts.Endpoint)
+	}
+	if opts.Region == "" || opts.Bucket == "" {
+		return nil, errors.New("quarantine s3 region and bucket must be set")
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: opts.Timeout}
+	}
+
+	return &S3Backend{opts: opts, endpoint: u, client: client}, nil
+}
+
+// url returns the url of the object key, or of the bucket when key is empty.
+func (b *S3Backend) url(key string, query url.Values) *url.URL {
+	u := *b.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if b.opts.PathStyle {
+		path += "/" + b.opts.Bucket
+	} else {
+		u.Host = b.opts.Bucket + "." + u.Host
+	}
+	// The path and the query are sent as encoded for the signature
+	u.Path = path + "/" + key
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+func (b *S3Backend) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	// The objects are encrypted and authenticated
+	// by the quarantine, whatever the transport
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	signV4(req, b.opts.AccessKey, b.opts.SecretKey, b.opts.Region, b.clock.Now())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, s3Error(method, resp)
+	}
+	return resp, nil
+}
+
+// s3Error returns the error of a failed request. Its error wraps
+// ErrNotFound when the object or the bucket doesn't exist.
+func s3Error(method string, resp *http.Response) error {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&e)
+	if e.Code == "" {
+		e.Code = http.StatusText(resp.StatusCode)
+	}
+
+	err := fmt.Errorf("s3: %s %s: %d %s", method, resp.Request.URL.Path, resp.StatusCode, e.Code)
+	if e.Message != "" {
+		err = fmt.Errorf("%w: %s", err, e.Message)
+	}
+	if resp.StatusCode == http.StatusNotFound && e.Code != "NoSuchBucket" {
+		err = fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
+
+func (b *S3Backend) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	resp, err := b.do(ctx, http.MethodPut, b.url(b.opts.Prefix+key, nil), io.LimitReader(r, size), size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (b *S3Backend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := b.do(ctx, http.MethodGet, b.url(b.opts.Prefix+key, nil), nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *S3Backend) Delete(ctx context.Context, key string) error {
+	resp, err := b.do(ctx, http.MethodDelete, b.url(b.opts.Prefix+key, nil), nil, 0)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List lists the objects with the ListObjectsV2 action, page by page.
+func (b *S3Backend) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {b.opts.Prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := b.do(ctx, http.MethodGet, b.url("", query), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3: error while decoding the list of objects: %w", err)
+		}
+
+		for _, c := range result.Contents {
+			keys = append(keys, strings.TrimPrefix(c.Key, b.opts.Prefix))
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// signV4 signs req with the AWS signature version 4, for the S3 service.
+// The host and all the headers of req are signed. The hash of the payload
+// is the value of the X-Amz-Content-Sha256 header, which must be set.
+//
+// ref: https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func signV4(req *http.Request, accessKey string, secretKey string, region string, t time.Time) {
+	t = t.UTC()
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+
+	// Canonical headers, sorted by lowercase name
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + t.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		",SignedHeaders="+signedHeaders+",Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery returns the query sorted by name, then by value,
+// the names and values being encoded as required by the signature.
+func canonicalQuery(query url.Values) string {
+	type param struct{ name, value string }
+
+	params := make([]param, 0, len(query))
+	for name, values := range query {
+		for _, v := range values {
+			params = append(params, param{uriEncode(name, true), uriEncode(v, true)})
+		}
+	}
+	slices.SortFunc(params, func(a, b param) int {
+		if c := strings.Compare(a.name, b.name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.value, b.value)
+	})
+
+	encoded := make([]string, 0, len(params))
+	for _, p := range params {
+		encoded = append(encoded, p.name+"="+p.value)
+	}
+	return strings.Join(encoded, "&")
+}
+
+// uriEncode percent-encodes every byte of s but the unreserved characters
+// of RFC 3986 and, unless encodeSlash is set, the slashes.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
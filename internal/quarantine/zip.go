@@ -0,0 +1,165 @@
+package quarantine
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Export writes a zip archive protected by the password of the quarantine
+// to w. It contains the content of the item with the given id, named after
+// its SHA-256 so that it isn't opened by mistake once extracted, and its
+// metadata as "metadata.json". It returns ErrNotFound before writing
+// anything if there is no such item.
+//
+// The archive is encrypted with the traditional zip encryption, as is
+// customary to share malware samples: it only keeps the antiviruses and
+// the users from opening the content by mistake, and doesn't protect it.
+func (q *Quarantine) Export(ctx context.Context, w io.Writer, id string) error {
+	item, err := q.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	content, err := q.Open(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	metadata, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	name := item.SHA256
+	if name == "" {
+		name = item.ID
+	}
+	if err := writeEncryptedEntry(zw, name, item.QuarantinedAt, q.opts.ZipPassword, content); err != nil {
+		return err
+	}
+	if err := writeEncryptedEntry(zw, "metadata.json", item.QuarantinedAt, q.opts.ZipPassword, bytes.NewReader(metadata)); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeEncryptedEntry writes the entry name of the archive zw, with the
+// content of r deflated then encrypted with password. The sizes and the
+// checksum of the entry are only known once written: they follow it in a
+// data descriptor, the modification time being the check value of the
+// encryption header.
+func writeEncryptedEntry(zw *zip.Writer, name string, modified time.Time, password string, r io.Reader) error {
+	fh := &zip.FileHeader{
+		Name:           name,
+		Method:         zip.Deflate,
+		Flags:          0x1 | 0x8, // encrypted, with a data descriptor
+		CreatorVersion: 20,
+		ReaderVersion:  20,
+	}
+	fh.ModifiedDate, fh.ModifiedTime = msDosTime(modified)
+
+	raw, err := zw.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+
+	enc := &zipCryptoWriter{w: raw, keys: newZipCryptoKeys(password)}
+
+	header := make([]byte, 12)
+	if _, err := rand.Read(header[:11]); err != nil {
+		return err
+	}
+	header[11] = byte(fh.ModifiedTime >> 8)
+	if _, err := enc.Write(header); err != nil {
+		return err
+	}
+
+	fw, err := flate.NewWriter(enc, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	crc := crc32.NewIEEE()
+	n, err := io.Copy(io.MultiWriter(fw, crc), r)
+	if err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+
+	// The header is written once the next entry is created or the
+	// archive closed, along with the data descriptor
+	fh.CRC32 = crc.Sum32()
+	fh.UncompressedSize64 = uint64(n)
+	fh.CompressedSize64 = uint64(enc.n)
+	fh.UncompressedSize = uint32(min(fh.UncompressedSize64, 0xffffffff))
+	fh.CompressedSize = uint32(min(fh.CompressedSize64, 0xffffffff))
+
+	return nil
+}
+
+// msDosTime returns t in the MS-DOS date and time format of the zip headers.
+func msDosTime(t time.Time) (date uint16, dosTime uint16) {
+	if t.Year() < 1980 {
+		t = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	dosTime = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, dosTime
+}
+
+// zipCryptoKeys is the state of the traditional PKWARE encryption.
+//
+// ref: https://pkware.cachefly.net/webdocs/casestudies/APPNOTE.TXT, 6.1
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password string) *zipCryptoKeys {
+	k := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for i := 0; i < len(password); i++ {
+		k.update(password[i])
+	}
+	return k
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ (crc >> 8)
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32Update(k[0], b)
+	k[1] = (k[1]+(k[0]&0xff))*134775813 + 1
+	k[2] = crc32Update(k[2], byte(k[1]>>24))
+}
+
+func (k *zipCryptoKeys) stream() byte {
+	t := uint16(k[2] | 2)
+	return byte((uint32(t) * uint32(t^1)) >> 8)
+}
+
+// zipCryptoWriter encrypts what is written to it before writing it to w.
+type zipCryptoWriter struct {
+	w    io.Writer
+	keys *zipCryptoKeys
+	n    int64
+	buf  []byte
+}
+
+func (z *zipCryptoWriter) Write(p []byte) (int, error) {
+	z.buf = append(z.buf[:0], p...)
+	for i, c := range z.buf {
+		z.buf[i] = c ^ z.keys.stream()
+		z.keys.update(c)
+	}
+
+	n, err := z.w.Write(z.buf)
+	z.n += int64(n)
+	return n, err
+}
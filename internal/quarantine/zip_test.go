@@ -0,0 +1,79 @@
+package quarantine
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readEncryptedEntry returns the content of the entry f of an archive
+// written by Export, decrypted with password.
+func readEncryptedEntry(t *testing.T, f *zip.File, password string) []byte {
+	raw, err := f.OpenRaw()
+	require.NoError(t, err)
+	encrypted, err := io.ReadAll(raw)
+	require.NoError(t, err)
+	require.Greater(t, len(encrypted), 12)
+
+	keys := newZipCryptoKeys(password)
+	decrypted := make([]byte, len(encrypted))
+	for i, c := range encrypted {
+		decrypted[i] = c ^ keys.stream()
+		keys.update(decrypted[i])
+	}
+	require.Equal(t, byte(f.ModifiedTime>>8), decrypted[11], "wrong password")
+
+	b, err := io.ReadAll(flate.NewReader(bytes.NewReader(decrypted[12:])))
+	require.NoError(t, err)
+	assert.Equal(t, f.CRC32, crc32.ChecksumIEEE(b))
+	assert.EqualValues(t, len(b), f.UncompressedSize64)
+	return b
+}
+
+func TestQuarantineExport(t *testing.T) {
+	ctx := context.Background()
+
+	q, _ := newTestQuarantine(t, Options{ZipPassword: "infected"})
+	q.clock = func() time.Time { return time.Date(2023, time.July, 8, 8, 0, 0, 0, time.UTC) }
+
+	item := &Item{
+		FileName:  "eicar.txt",
+		SHA256:    "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f",
+		Signature: "Win.Test.EICAR_HDB-1",
+	}
+	content := strings.Repeat(eicar, 1000)
+	require.NoError(t, q.Put(ctx, item, strings.NewReader(content)))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, q.Export(ctx, buf, item.ID))
+	assert.NotContains(t, buf.String(), "EICAR")
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+
+	assert.Equal(t, item.SHA256, zr.File[0].Name)
+	assert.Equal(t, uint16(0x1), zr.File[0].Flags&0x1)
+	assert.Equal(t, time.Date(2023, time.July, 8, 8, 0, 0, 0, time.UTC), zr.File[0].Modified.UTC())
+	assert.Equal(t, content, string(readEncryptedEntry(t, zr.File[0], "infected")))
+
+	assert.Equal(t, "metadata.json", zr.File[1].Name)
+	var metadata Item
+	require.NoError(t, json.Unmarshal(readEncryptedEntry(t, zr.File[1], "infected"), &metadata))
+	assert.Equal(t, *item, metadata)
+
+	// Not found
+	buf.Reset()
+	assert.ErrorIs(t, q.Export(ctx, buf, "0123456789abcdef0123456789abcdef"), ErrNotFound)
+	assert.Zero(t, buf.Len())
+}
@@ -0,0 +1,430 @@
+// Package webhook notifies http endpoints of the results of the scans.
+//
+// An Event is sent to the callback url given with a scan request, if any,
+// and to the webhooks configured globally when a virus is detected.
+// Each delivery is a json POST request signed with HMAC-SHA256, and is
+// retried with an exponential backoff. The deliveries failing after the
+// last attempt are written to a dead-letter log.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/fetcher"
+	"github.com/lescactus/clamav-api-go/internal/helper"
+	"github.com/rs/zerolog"
+)
+
+// Types of the events
+const (
+	// Sent to the callback url of a scan request once scanned
+	EventScanCompleted = "scan.completed"
+
+	// Sent to the global webhooks when a virus is detected
+	EventVirusDetected = "virus.detected"
+)
+
+// Headers of the deliveries
+const (
+	// Unique id of the delivery, the same for all its attempts
+	HeaderID = "X-Webhook-Id"
+
+	// Unix time at which the delivery was attempted
+	HeaderTimestamp = "X-Webhook-Timestamp"
+
+	// Signature of the timestamp and body of the delivery, see Sign
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+var (
+	ErrUnexpectedStatus = errors.New("unexpected status code")
+	ErrQueueFull        = errors.New("webhook queue is full")
+	ErrClosed           = errors.New("webhook dispatcher is closed")
+)
+
+// Event is the payload of a delivery.
+type Event struct {
+	Type string    `json:"event"`
+	Time time.Time `json:"time"`
+
+	// Id of the request which led to the scan
+	RequestID string `json:"request_id"`
+
+	// Id of the job which scanned the file, if any
+	JobID string `json:"job_id,omitempty"`
+
+	// Either "clean", "infected", "error", or "allowed" or "denied" by the scan policy
+	Verdict    string `json:"verdict"`
+	VirusFound bool   `json:"virus_found"`
+	Signature  string `json:"signature"`
+	Error      string `json:"error,omitempty"`
+
+	// Name of the rule of the scan policy which allowed or denied the file
+	Rule string `json:"rule,omitempty"`
+
+	// Id of the item of the quarantine the infected file was saved as, if any
+	QuarantineID string `json:"quarantine_id,omitempty"`
+
+	File File `json:"file"`
+}
+
+// File is the metadata of the scanned file.
+// The fields which don't apply to a scan are empty.
+type File struct {
+	Name        string `json:"name,omitempty"`
+	Size        int64  `json:"size"`
+	Field       string `json:"field,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Path        string `json:"path,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// Options configures a Dispatcher.
+type Options struct {
+	// Urls notified of every detection
+	URLs []string
+
+	// Secret with which the deliveries are signed
+	Secret string
+
+	// Retries of the failing deliveries
+	Retry RetryPolicy
+
+	// Maximum duration of an attempt to deliver an event
+	Timeout time.Duration
+
+	// Schemes allowed for the callback urls of the scan requests
+	CallbackSchemes []string
+
+	// Allow the callback urls to resolve to loopback, private,
+	// link-local and other reserved addresses
+	CallbackAllowPrivate bool
+
+	// Dead-letter log, in which the deliveries failing after
+	// the last attempt are written as json lines. They are only
+	// logged when nil
+	DeadLetter io.Writer
+
+	// Number of concurrent deliveries. Defaults to 4
+	Workers int
+
+	// Maximum number of deliveries waiting for a worker.
+	// The deliveries are dead-lettered beyond. Defaults to 1000
+	QueueSize int
+}
+
+// RetryPolicy defines how the failing deliveries are sent again.
+type RetryPolicy struct {
+	// Maximum number of attempts to deliver an event, including
+	// the first one. 1 or less disables the retries
+	MaxAttempts int
+
+	// Duration waited before the first retry. It is doubled
+	// before each subsequent retry
+	InitialBackoff time.Duration
+
+	// Maximum duration waited between two attempts
+	MaxBackoff time.Duration
+}
+
+// backoff returns the duration to wait after the given attempt failed.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+
+	return d
+}
+
+// Dispatcher delivers the events asynchronously with a pool of workers.
+type Dispatcher struct {
+	opts   Options
+	logger *zerolog.Logger
+
+	// Clients of the global webhooks, which are trusted, and of the
+	// callback urls, which are guarded against request forgery
+	client         *http.Client
+	callbackClient *http.Client
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *delivery
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	deadLetterMu sync.Mutex
+
+	// Overridden in tests
+	clock helper.Clock
+}
+
+// delivery is an event to send to a url.
+type delivery struct {
+	id     string
+	url    string
+	client *http.Client
+	body   []byte
+}
+
+// New returns a Dispatcher and starts its workers.
+func New(opts Options, logger *zerolog.Logger) (*Dispatcher, error) {
+	if opts.Secret == "" {
+		return nil, errors.New("webhook secret not configured")
+	}
+	for _, u := range opts.URLs {
+		if _, err := fetcher.CheckURL(u, []string{"http", "https"}); err != nil {
+			return nil, fmt.Errorf("invalid webhook url: %w", err)
+		}
+	}
+	if opts.Workers < 1 {
+		opts.Workers = 4
+	}
+	if opts.QueueSize < 1 {
+		opts.QueueSize = 1000
+	}
+	if logger == nil {
+		nop := zerolog.Nop()
+		logger = &nop
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d := &Dispatcher{
+		opts:   opts,
+		logger: logger,
+		client: fetcher.NewClient(fetcher.Options{
+			AllowedSchemes: []string{"http", "https"},
+			AllowPrivate:   true,
+			Timeout:        opts.Timeout,
+		}),
+		callbackClient: fetcher.NewClient(fetcher.Options{
+			AllowedSchemes: opts.CallbackSchemes,
+			AllowPrivate:   opts.CallbackAllowPrivate,
+			Timeout:        opts.Timeout,
+		}),
+		queue:  make(chan *delivery, opts.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+
+	return d, nil
+}
+
+// CheckCallback returns an error if rawURL can't be used as a callback url.
+// Whether it resolves to a reserved address is only checked on delivery.
+func (d *Dispatcher) CheckCallback(rawURL string) error {
+	_, err := fetcher.CheckURL(rawURL, d.opts.CallbackSchemes)
+	return err
+}
+
+// Notify queues the delivery of ev to callbackURL, if not empty, and
+// to the global webhooks if a virus was detected. It doesn't wait for
+// the deliveries.
+func (d *Dispatcher) Notify(callbackURL string, ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = d.clock.Now()
+	}
+
+	if callbackURL != "" {
+		ev.Type = EventScanCompleted
+		d.enqueue(callbackURL, d.callbackClient, ev)
+	}
+
+	if ev.VirusFound {
+		ev.Type = EventVirusDetected
+		for _, u := range d.opts.URLs {
+			d.enqueue(u, d.client, ev)
+		}
+	}
+}
+
+func (d *Dispatcher) enqueue(url string, client *http.Client, ev Event) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		d.logger.Error().Err(err).Str("url", url).Msg("unable to encode webhook event")
+		return
+	}
+
+	del := &delivery{id: helper.NewID(), url: url, client: client, body: body}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		d.deadLetter(del, 0, ErrClosed)
+		return
+	}
+
+	select {
+	case d.queue <- del:
+	default:
+		d.deadLetter(del, 0, ErrQueueFull)
+	}
+}
+
+// Close stops the workers and waits for them to return. The attempts in
+// progress are completed, the deliveries waiting for a retry or a worker
+// are dead-lettered.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	d.cancel()
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+
+	for del := range d.queue {
+		if d.ctx.Err() != nil {
+			d.deadLetter(del, 0, ErrClosed)
+			continue
+		}
+		d.deliver(del)
+	}
+}
+
+// deliver sends del until it succeeds, fails permanently or
+// the maximum number of attempts is reached.
+func (d *Dispatcher) deliver(del *delivery) {
+	maxAttempts := max(d.opts.Retry.MaxAttempts, 1)
+
+	attempt := 1
+	for ; ; attempt++ {
+		retryable, err := d.send(del)
+		if err == nil {
+			d.logger.Debug().Str("webhook_id", del.id).Str("url", del.url).Int("attempts", attempt).Msg("webhook delivered")
+			return
+		}
+
+		if !retryable || attempt >= maxAttempts {
+			d.deadLetter(del, attempt, err)
+			return
+		}
+
+		d.logger.Debug().Err(err).Str("webhook_id", del.id).Str("url", del.url).Int("attempt", attempt).Msg("webhook delivery failed, retrying")
+
+		t := time.NewTimer(d.opts.Retry.backoff(attempt))
+		select {
+		case <-t.C:
+		case <-d.ctx.Done():
+			t.Stop()
+			d.deadLetter(del, attempt, fmt.Errorf("%w: %w", ErrClosed, err))
+			return
+		}
+	}
+}
+
+// send makes an attempt to deliver del. It returns whether
+// the delivery can be retried when it fails.
+func (d *Dispatcher) send(del *delivery) (bool, error) {
+	// The attempts aren't canceled on close, they are bounded by the timeout
+	req, err := http.NewRequest(http.MethodPost, del.url, bytes.NewReader(del.body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := strconv.FormatInt(d.clock.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, del.id)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(d.opts.Secret, timestamp, del.body))
+
+	resp, err := del.client.Do(req)
+	if err != nil {
+		// The urls which aren't allowed won't be on the next attempts
+		retryable := !errors.Is(err, fetcher.ErrURLNotAllowed) && !errors.Is(err, fetcher.ErrTooManyRedirects)
+		return retryable, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return true, nil
+	}
+
+	// The other client errors are unlikely to be solved by retrying
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return retryable, fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+}
+
+// deadLetterEntry represents a line of the dead-letter log.
+type deadLetterEntry struct {
+	Time     time.Time       `json:"time"`
+	ID       string          `json:"id"`
+	URL      string          `json:"url"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Event    json.RawMessage `json:"event"`
+}
+
+func (d *Dispatcher) deadLetter(del *delivery, attempts int, err error) {
+	d.logger.Error().
+		Err(err).
+		Str("webhook_id", del.id).
+		Str("url", del.url).
+		Int("attempts", attempts).
+		Msg("webhook delivery failed")
+
+	if d.opts.DeadLetter == nil {
+		return
+	}
+
+	b, _ := json.Marshal(deadLetterEntry{
+		Time:     d.clock.Now(),
+		ID:       del.id,
+		URL:      del.url,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Event:    del.body,
+	})
+
+	d.deadLetterMu.Lock()
+	defer d.deadLetterMu.Unlock()
+
+	if _, err := d.opts.DeadLetter.Write(append(b, '\n')); err != nil {
+		d.logger.Error().Err(err).Str("webhook_id", del.id).Msg("unable to write to the webhook dead-letter log")
+	}
+}
+
+// Sign returns the signature of a delivery sent at timestamp, a unix time,
+// with body. It is the hex encoded HMAC-SHA256 of the timestamp, a dot and
+// the body, keyed with secret, prefixed with "sha256=".
+//
+// Signing the timestamp lets the receivers refuse the replayed deliveries.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
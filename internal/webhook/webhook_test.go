@@ -0,0 +1,298 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/fetcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "s3cr3t"
+
+// receiver is a webhook endpoint recording the deliveries it receives.
+// It responds with the status codes of statuses in turn, then with 200.
+type receiver struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	deliveries []*http.Request
+	bodies     [][]byte
+	statuses   []int
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rcv := &receiver{statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+
+		rcv.deliveries = append(rcv.deliveries, r)
+		rcv.bodies = append(rcv.bodies, body)
+		if len(rcv.statuses) > 0 {
+			w.WriteHeader(rcv.statuses[0])
+			rcv.statuses = rcv.statuses[1:]
+		}
+	}))
+	t.Cleanup(rcv.Close)
+
+	return rcv
+}
+
+func (rcv *receiver) count() int {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return len(rcv.deliveries)
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Split(strings.TrimSpace(b.buf.String()), "\n")
+}
+
+func newTestDispatcher(t *testing.T, opts Options) *Dispatcher {
+	opts.Secret = testSecret
+	if opts.CallbackSchemes == nil {
+		opts.CallbackSchemes = []string{"http", "https"}
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	d, err := New(opts, nil)
+	require.NoError(t, err)
+	t.Cleanup(d.Close)
+
+	return d
+}
+
+var testEvent = Event{
+	Time:       time.Date(2023, time.July, 8, 8, 0, 0, 0, time.UTC),
+	RequestID:  "cimuf5d3d0kc73ahh5h0",
+	Verdict:    "infected",
+	VirusFound: true,
+	Signature:  "Win.Test.EICAR_HDB-1",
+	File:       File{Name: "eicar.txt", Size: 68, Field: "file"},
+}
+
+func TestDispatcherNotify(t *testing.T) {
+	callback := newReceiver(t)
+	global := newReceiver(t)
+
+	d := newTestDispatcher(t, Options{URLs: []string{global.URL}, CallbackAllowPrivate: true})
+
+	d.Notify(callback.URL, testEvent)
+
+	clean := testEvent
+	clean.Verdict, clean.VirusFound, clean.Signature = "clean", false, ""
+	d.Notify("", clean)
+
+	require.Eventually(t, func() bool {
+		return callback.count() == 1 && global.count() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The clean scan without callback isn't delivered
+	d.Close()
+	assert.Equal(t, 1, global.count())
+
+	for rcv, eventType := range map[*receiver]string{callback: EventScanCompleted, global: EventVirusDetected} {
+		req, body := rcv.deliveries[0], rcv.bodies[0]
+
+		assert.Equal(t, http.MethodPost, req.Method)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		assert.Len(t, req.Header.Get(HeaderID), 32)
+
+		timestamp := req.Header.Get(HeaderTimestamp)
+		assert.NotEmpty(t, timestamp)
+		assert.Equal(t, Sign(testSecret, timestamp, body), req.Header.Get(HeaderSignature))
+
+		var ev Event
+		require.NoError(t, json.Unmarshal(body, &ev))
+		want := testEvent
+		want.Type = eventType
+		assert.Equal(t, want, ev)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}
+
+	assert.Equal(t, 100*time.Millisecond, p.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, p.backoff(2))
+	assert.Equal(t, 800*time.Millisecond, p.backoff(4))
+	assert.Equal(t, time.Second, p.backoff(5))
+	assert.Equal(t, time.Second, p.backoff(50))
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	tests := []struct {
+		name           string
+		statuses       []int
+		wantDeliveries int
+		wantDeadLetter bool
+		wantAttempts   int
+	}{
+		{
+			name:           "delivered after retries",
+			statuses:       []int{http.StatusInternalServerError, http.StatusTooManyRequests},
+			wantDeliveries: 3,
+		},
+		{
+			name:           "too many attempts",
+			statuses:       []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			wantDeliveries: 3,
+			wantDeadLetter: true,
+			wantAttempts:   3,
+		},
+		{
+			name:           "not retryable",
+			statuses:       []int{http.StatusBadRequest},
+			wantDeliveries: 1,
+			wantDeadLetter: true,
+			wantAttempts:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcv := newReceiver(t, tt.statuses...)
+			deadLetter := &syncBuffer{}
+
+			d := newTestDispatcher(t, Options{URLs: []string{rcv.URL}, Retry: policy, DeadLetter: deadLetter})
+			d.Notify("", testEvent)
+
+			require.Eventually(t, func() bool {
+				return rcv.count() == tt.wantDeliveries
+			}, 5*time.Second, time.Millisecond)
+			d.Close()
+
+			assert.Equal(t, tt.wantDeliveries, rcv.count())
+
+			// All the attempts are the same delivery
+			for _, req := range rcv.deliveries {
+				assert.Equal(t, rcv.deliveries[0].Header.Get(HeaderID), req.Header.Get(HeaderID))
+			}
+
+			if !tt.wantDeadLetter {
+				assert.Equal(t, []string{""}, deadLetter.lines())
+				return
+			}
+
+			lines := deadLetter.lines()
+			require.Len(t, lines, 1)
+
+			var entry deadLetterEntry
+			require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+			assert.Equal(t, rcv.deliveries[0].Header.Get(HeaderID), entry.ID)
+			assert.Equal(t, rcv.URL, entry.URL)
+			assert.Equal(t, tt.wantAttempts, entry.Attempts)
+			assert.Contains(t, entry.Error, "unexpected status code")
+			assert.JSONEq(t, string(rcv.bodies[0]), string(entry.Event))
+		})
+	}
+}
+
+func TestDispatcherCallbackPrivateAddress(t *testing.T) {
+	rcv := newReceiver(t)
+	deadLetter := &syncBuffer{}
+
+	// The global webhooks are trusted, unlike the callback urls
+	d := newTestDispatcher(t, Options{
+		URLs:       []string{rcv.URL},
+		Retry:      RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+		DeadLetter: deadLetter,
+	})
+	d.Notify(rcv.URL+"/callback", testEvent)
+
+	require.Eventually(t, func() bool {
+		return rcv.count() == 1 && deadLetter.lines()[0] != ""
+	}, 5*time.Second, 10*time.Millisecond)
+	d.Close()
+
+	assert.Equal(t, "/", rcv.deliveries[0].URL.Path)
+
+	var entry deadLetterEntry
+	require.NoError(t, json.Unmarshal([]byte(deadLetter.lines()[0]), &entry))
+	assert.Equal(t, rcv.URL+"/callback", entry.URL)
+	assert.Equal(t, 1, entry.Attempts)
+	assert.Contains(t, entry.Error, fetcher.ErrAddressNotAllowed.Error())
+}
+
+func TestDispatcherClose(t *testing.T) {
+	var calls atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	deadLetter := &syncBuffer{}
+	d := newTestDispatcher(t, Options{
+		URLs:       []string{s.URL},
+		Retry:      RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour},
+		DeadLetter: deadLetter,
+	})
+	d.Notify("", testEvent)
+
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// Waiting before the second attempt
+	d.Close()
+	assert.Len(t, deadLetter.lines(), 1)
+	assert.Contains(t, deadLetter.lines()[0], ErrClosed.Error())
+
+	// Notifying once closed
+	d.Notify("", testEvent)
+	assert.Len(t, deadLetter.lines(), 2)
+}
+
+func TestDispatcherCheckCallback(t *testing.T) {
+	d := newTestDispatcher(t, Options{CallbackSchemes: []string{"https"}})
+
+	assert.NoError(t, d.CheckCallback("https://example.com/callback"))
+	assert.ErrorIs(t, d.CheckCallback("http://example.com/callback"), fetcher.ErrURLNotAllowed)
+	assert.ErrorIs(t, d.CheckCallback("/callback"), fetcher.ErrInvalidURL)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Options{}, nil)
+	assert.Error(t, err)
+
+	_, err = New(Options{Secret: testSecret, URLs: []string{"ftp://example.com"}}, nil)
+	assert.ErrorIs(t, err, fetcher.ErrURLNotAllowed)
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t,
+		"sha256=123f681cdeb0bb6110ec2f3412ed04cb6959620b951702cd63943e2422c08a10",
+		Sign(testSecret, "1688803200", []byte(`{"event":"virus.detected"}`)),
+	)
+}
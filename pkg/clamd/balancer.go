@@ -0,0 +1,430 @@
+package clamd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BalancerStrategy represents the way a ClamavBalancer
+// picks the backend a command is sent to.
+type BalancerStrategy string
+
+const (
+	// BalancerRoundRobin sends the commands to each healthy backend in turn.
+	BalancerRoundRobin BalancerStrategy = "round-robin"
+
+	// BalancerLeastOutstanding sends the commands to the healthy backend
+	// with the fewest commands waiting for a reply.
+	BalancerLeastOutstanding BalancerStrategy = "least-outstanding"
+)
+
+var (
+	ErrInvalidBalancerStrategy = errors.New("invalid balancer strategy")
+
+	// ErrNoBackendAvailable is returned when all the backends
+	// of a ClamavBalancer are out of rotation.
+	ErrNoBackendAvailable = errors.New("no clamd backend available")
+)
+
+// ParseBalancerStrategy returns the BalancerStrategy named by s.
+// It is case insensitive.
+func ParseBalancerStrategy(s string) (BalancerStrategy, error) {
+	switch strategy := BalancerStrategy(strings.ToLower(s)); strategy {
+	case BalancerRoundRobin, BalancerLeastOutstanding:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidBalancerStrategy, s)
+	}
+}
+
+// Backend represents a Clamd server a ClamavBalancer
+// can send commands to.
+type Backend struct {
+	// Name identifying the backend in errors, usually its address
+	Name string
+
+	Clamav Clamaver
+
+	healthy     atomic.Bool
+	outstanding atomic.Int64
+
+	// Last version returned by the backend to
+	// the "VERSION" command of the balancer
+	version atomic.Pointer[Version]
+}
+
+// Healthy returns whether the backend is in rotation.
+func (b *Backend) Healthy() bool {
+	return b.healthy.Load()
+}
+
+// Version returns the version of Clamd last returned by the backend
+// to a "VERSION" command sent by the balancer, nil if none was.
+func (b *Backend) Version() *Version {
+	v := b.version.Load()
+	if v == nil {
+		return nil
+	}
+	version := *v
+	return &version
+}
+
+// ClamavBalancer is a Clamaver spreading the commands across
+// several Clamd backends.
+//
+// Each backend is health-checked in the background with the "PING" command,
+// and taken out of rotation until it replies again. A backend failing
+// with a network error is also taken out of rotation right away, until the
+// next successful health check or, when the backends aren't health-checked,
+// for a while. The commands cancelled by their caller don't count as failures.
+//
+// Admin commands (RELOAD, SHUTDOWN, DETSTATSCLEAR) are sent to all
+// the backends in rotation, as are DETSTATS whose results are merged and
+// VERSION which returns the most recent signature database. The version
+// of each backend is kept, and recorded along with the backend the other
+// commands are sent to by a BackendTrace.
+type ClamavBalancer struct {
+	backends []*Backend
+	strategy BalancerStrategy
+
+	// next is the index of the next backend to use
+	// with the round-robin strategy
+	next atomic.Uint64
+
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+
+	// readmitDelay is the time a backend failing with a network
+	// error stays out of rotation when there is no health check
+	readmitDelay time.Duration
+}
+
+// defaultReadmitDelay is the time a backend failing with a network
+// error stays out of rotation when the backends aren't health-checked.
+const defaultReadmitDelay = 10 * time.Second
+
+var _ Clamaver = (*ClamavBalancer)(nil)
+
+// NewClamavBalancer returns a ClamavBalancer spreading the commands across backends
+// with the given strategy. The backends are all considered healthy at first.
+//
+// When interval is greater than 0, the backends are health-checked at this
+// interval until Close is called.
+func NewClamavBalancer(backends []*Backend, strategy BalancerStrategy, interval time.Duration) *ClamavBalancer {
+	if strategy == "" {
+		strategy = BalancerRoundRobin
+	}
+
+	b := &ClamavBalancer{
+		backends:     backends,
+		strategy:     strategy,
+		interval:     interval,
+		stop:         make(chan struct{}),
+		readmitDelay: defaultReadmitDelay,
+	}
+
+	for _, backend := range backends {
+		backend.healthy.Store(true)
+	}
+
+	if interval > 0 {
+		b.wg.Add(1)
+		go b.healthCheckLoop()
+	}
+
+	return b
+}
+
+// Backends returns the backends of the balancer.
+func (b *ClamavBalancer) Backends() []*Backend {
+	return b.backends
+}
+
+// healthCheckLoop health-checks the backends every b.interval
+// until the balancer is closed.
+func (b *ClamavBalancer) healthCheckLoop() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			b.HealthCheck()
+		}
+	}
+}
+
+// HealthCheck sends the "PING" command to all the backends concurrently
+// and updates whether they are in rotation accordingly.
+func (b *ClamavBalancer) HealthCheck() {
+	timeout := b.interval
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	var wg sync.WaitGroup
+	for _, backend := range b.backends {
+		wg.Add(1)
+		go func(backend *Backend) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			_, err := backend.Clamav.Ping(ctx)
+			backend.healthy.Store(err == nil)
+		}(backend)
+	}
+	wg.Wait()
+}
+
+// pick returns the backend the next command should be sent to
+// according to the strategy of the balancer.
+func (b *ClamavBalancer) pick() (*Backend, error) {
+	n := len(b.backends)
+	if n == 0 {
+		return nil, ErrNoBackendAvailable
+	}
+
+	start := int(b.next.Add(1)-1) % n
+
+	var best *Backend
+	for i := 0; i < n; i++ {
+		backend := b.backends[(start+i)%n]
+		if !backend.Healthy() {
+			continue
+		}
+
+		if b.strategy == BalancerRoundRobin {
+			return backend, nil
+		}
+
+		if best == nil || backend.outstanding.Load() < best.outstanding.Load() {
+			best = backend
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoBackendAvailable
+	}
+
+	return best, nil
+}
+
+// do sends a command to a backend picked by the balancer.
+func do[T any](ctx context.Context, b *ClamavBalancer, fn func(c Clamaver) (T, error)) (T, error) {
+	backend, err := b.pick()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	traceBackend(ctx, backend)
+
+	backend.outstanding.Add(1)
+	defer backend.outstanding.Add(-1)
+
+	resp, err := fn(backend.Clamav)
+	// A cancelled command unblocks its connection with a deadline,
+	// failing with a network error although the backend is fine
+	if isNetError(err) && ctx.Err() == nil {
+		b.eject(backend)
+	}
+
+	return resp, err
+}
+
+// eject takes backend out of rotation until the next successful health
+// check or, when the backends aren't health-checked, for b.readmitDelay.
+func (b *ClamavBalancer) eject(backend *Backend) {
+	if !backend.healthy.CompareAndSwap(true, false) {
+		return
+	}
+
+	if b.interval <= 0 {
+		time.AfterFunc(b.readmitDelay, func() {
+			backend.healthy.Store(true)
+		})
+	}
+}
+
+// fanOut sends a command to all the backends in rotation concurrently and
+// returns the errors encountered, prefixed by the name of the backend.
+// The backends out of rotation are skipped so that a dead backend doesn't
+// fail the command, and ErrNoBackendAvailable is returned when there is none left.
+func (b *ClamavBalancer) fanOut(ctx context.Context, fn func(backend *Backend) error) error {
+	errs := make([]error, len(b.backends))
+
+	var wg sync.WaitGroup
+	sent := false
+	for i, backend := range b.backends {
+		if !backend.Healthy() {
+			continue
+		}
+		sent = true
+
+		wg.Add(1)
+		go func(i int, backend *Backend) {
+			defer wg.Done()
+
+			backend.outstanding.Add(1)
+			defer backend.outstanding.Add(-1)
+
+			err := fn(backend)
+			if err == nil {
+				return
+			}
+			if isNetError(err) && ctx.Err() == nil {
+				b.eject(backend)
+			}
+			errs[i] = fmt.Errorf("%s: %w", backend.Name, err)
+		}(i, backend)
+	}
+	wg.Wait()
+
+	if !sent {
+		return ErrNoBackendAvailable
+	}
+
+	return errors.Join(errs...)
+}
+
+// isNetError returns true if the error
+// is a net.Error
+func isNetError(err error) bool {
+	var e net.Error
+	return errors.As(err, &e)
+}
+
+func (b *ClamavBalancer) Ping(ctx context.Context) ([]byte, error) {
+	return do(ctx, b, func(c Clamaver) ([]byte, error) { return c.Ping(ctx) })
+}
+
+// Version is sent to all the backends, and the reply with the most recent
+// signature database is returned so that the version doesn't go back and
+// forth while the backends are updated one after the other. It only fails
+// when none of the backends replied.
+//
+// The version of each backend which replied is kept, see Backend.Version.
+func (b *ClamavBalancer) Version(ctx context.Context) ([]byte, error) {
+	var mu sync.Mutex
+	var latest []byte
+	database := -1
+
+	err := b.fanOut(ctx, func(backend *Backend) error {
+		resp, err := backend.Clamav.Version(ctx)
+		if err != nil {
+			return err
+		}
+		v, err := ParseVersion(resp)
+		if err != nil {
+			return err
+		}
+		backend.version.Store(v)
+
+		mu.Lock()
+		if v.Database > database {
+			latest, database = resp, v.Database
+		}
+		mu.Unlock()
+		return nil
+	})
+	if latest == nil {
+		return nil, err
+	}
+
+	return latest, nil
+}
+
+func (b *ClamavBalancer) Stats(ctx context.Context) ([]byte, error) {
+	return do(ctx, b, func(c Clamaver) ([]byte, error) { return c.Stats(ctx) })
+}
+
+func (b *ClamavBalancer) VersionCommands(ctx context.Context) ([]byte, error) {
+	return do(ctx, b, func(c Clamaver) ([]byte, error) { return c.VersionCommands(ctx) })
+}
+
+func (b *ClamavBalancer) InStream(ctx context.Context, r io.Reader) ([]byte, error) {
+	return do(ctx, b, func(c Clamaver) ([]byte, error) { return c.InStream(ctx, r) })
+}
+
+func (b *ClamavBalancer) ScanFile(ctx context.Context, f *os.File) ([]byte, error) {
+	return do(ctx, b, func(c Clamaver) ([]byte, error) { return c.ScanFile(ctx, f) })
+}
+
+func (b *ClamavBalancer) ScanPath(ctx context.Context, path string, mode ScanMode) ([]ScanResult, error) {
+	return do(ctx, b, func(c Clamaver) ([]ScanResult, error) { return c.ScanPath(ctx, path, mode) })
+}
+
+// Reload is sent to all the backends.
+func (b *ClamavBalancer) Reload(ctx context.Context) error {
+	return b.fanOut(ctx, func(backend *Backend) error { return backend.Clamav.Reload(ctx) })
+}
+
+// Shutdown is sent to all the backends.
+func (b *ClamavBalancer) Shutdown(ctx context.Context) error {
+	return b.fanOut(ctx, func(backend *Backend) error { return backend.Clamav.Shutdown(ctx) })
+}
+
+// DetStatsClear is sent to all the backends.
+func (b *ClamavBalancer) DetStatsClear(ctx context.Context) error {
+	return b.fanOut(ctx, func(backend *Backend) error { return backend.Clamav.DetStatsClear(ctx) })
+}
+
+// DetStats is sent to all the backends and the detections reported
+// by each of them are merged, in chronological order. Each detection
+// is tagged with the name of the backend which recorded it.
+func (b *ClamavBalancer) DetStats(ctx context.Context) ([]DetStat, error) {
+	var mu sync.Mutex
+	stats := make([]DetStat, 0)
+
+	err := b.fanOut(ctx, func(backend *Backend) error {
+		s, err := backend.Clamav.DetStats(ctx)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		for _, stat := range s {
+			stat.Backend = backend.Name
+			stats = append(stats, stat)
+		}
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(stats, func(a, b DetStat) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	return stats, nil
+}
+
+// Close stops the health checks of the backends.
+func (b *ClamavBalancer) Close() error {
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+	}
+	b.wg.Wait()
+
+	return nil
+}
@@ -0,0 +1,344 @@
+package clamd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClamaver is a Clamaver whose "PING" command blocks until
+// release is closed, if not nil.
+type fakeClamaver struct {
+	Clamaver
+
+	release chan struct{}
+
+	mu      sync.Mutex
+	pings   int
+	reloads int
+	err     error
+
+	// detections returned by the "DETSTATS" command
+	detections []DetStat
+}
+
+func (f *fakeClamaver) Ping(ctx context.Context) ([]byte, error) {
+	f.mu.Lock()
+	f.pings++
+	err := f.err
+	f.mu.Unlock()
+
+	if f.release != nil {
+		<-f.release
+	}
+	if err != nil {
+		return nil, err
+	}
+	return RespPing, nil
+}
+
+func (f *fakeClamaver) Reload(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.reloads++
+	return f.err
+}
+
+func (f *fakeClamaver) DetStats(ctx context.Context) ([]DetStat, error) {
+	return f.detections, nil
+}
+
+func (f *fakeClamaver) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.pings
+}
+
+func TestParseBalancerStrategy(t *testing.T) {
+	s, err := ParseBalancerStrategy("Round-Robin")
+	assert.NoError(t, err)
+	assert.Equal(t, BalancerRoundRobin, s)
+
+	s, err = ParseBalancerStrategy("least-outstanding")
+	assert.NoError(t, err)
+	assert.Equal(t, BalancerLeastOutstanding, s)
+
+	_, err = ParseBalancerStrategy("random")
+	assert.ErrorIs(t, err, ErrInvalidBalancerStrategy)
+}
+
+func TestClamavBalancerRoundRobin(t *testing.T) {
+	s1 := NewServer(network, listen, handlerPing)
+	<-s1.ready
+	s2 := NewServer(network, listen, handlerPing)
+	<-s2.ready
+
+	b := NewClamavBalancer([]*Backend{
+		{Name: "s1", Clamav: NewClamavClient(s1.listener.Addr().String(), network, time.Second, time.Second)},
+		{Name: "s2", Clamav: NewClamavClient(s2.listener.Addr().String(), network, time.Second, time.Second)},
+	}, BalancerRoundRobin, 0)
+	defer b.Close()
+
+	for i := 0; i < 10; i++ {
+		resp, err := b.Ping(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(RespPing), resp)
+	}
+
+	assert.EqualValues(t, 5, s1.accepted.Load())
+	assert.EqualValues(t, 5, s2.accepted.Load())
+
+	// The stopped backend is taken out of rotation by the health check
+	s1.Stop()
+	b.HealthCheck()
+	assert.False(t, b.Backends()[0].Healthy())
+	assert.True(t, b.Backends()[1].Healthy())
+
+	for i := 0; i < 10; i++ {
+		_, err := b.Ping(context.Background())
+		assert.NoError(t, err)
+	}
+	assert.EqualValues(t, 16, s2.accepted.Load())
+
+	// No backend is left in rotation
+	s2.Stop()
+	b.HealthCheck()
+
+	_, err := b.Ping(context.Background())
+	assert.ErrorIs(t, err, ErrNoBackendAvailable)
+}
+
+func TestClamavBalancerNetErrorOutOfRotation(t *testing.T) {
+	s := NewServer(network, listen, handlerPing)
+	<-s.ready
+	addr := s.listener.Addr().String()
+	s.Stop()
+
+	b := NewClamavBalancer([]*Backend{
+		{Name: "stopped", Clamav: NewClamavClient(addr, network, time.Second, time.Second)},
+	}, BalancerRoundRobin, 0)
+	defer b.Close()
+
+	_, err := b.Ping(context.Background())
+	var netErr net.Error
+	assert.ErrorAs(t, err, &netErr)
+	assert.False(t, b.Backends()[0].Healthy())
+
+	_, err = b.Ping(context.Background())
+	assert.ErrorIs(t, err, ErrNoBackendAvailable)
+}
+
+func TestClamavBalancerReadmit(t *testing.T) {
+	backend := &fakeClamaver{err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}}
+
+	b := NewClamavBalancer([]*Backend{{Name: "fake", Clamav: backend}}, BalancerRoundRobin, 0)
+	b.readmitDelay = 10 * time.Millisecond
+	defer b.Close()
+
+	_, err := b.Ping(context.Background())
+	var netErr net.Error
+	assert.ErrorAs(t, err, &netErr)
+	assert.False(t, b.Backends()[0].Healthy())
+
+	// Without health check, the backend is put back in rotation after a while
+	assert.Eventually(t, func() bool { return b.Backends()[0].Healthy() }, time.Second, time.Millisecond)
+}
+
+func TestClamavBalancerCancelled(t *testing.T) {
+	// The deadline set on the connection when the context is cancelled
+	backend := &fakeClamaver{err: &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}}
+
+	b := NewClamavBalancer([]*Backend{{Name: "fake", Clamav: backend}}, BalancerRoundRobin, 0)
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := b.Ping(ctx)
+	var netErr net.Error
+	assert.ErrorAs(t, err, &netErr)
+	assert.True(t, b.Backends()[0].Healthy())
+}
+
+func TestClamavBalancerLeastOutstanding(t *testing.T) {
+	busy := &fakeClamaver{release: make(chan struct{})}
+	idle := &fakeClamaver{}
+
+	b := NewClamavBalancer([]*Backend{
+		{Name: "busy", Clamav: busy},
+		{Name: "idle", Clamav: idle},
+	}, BalancerLeastOutstanding, 0)
+	defer b.Close()
+
+	// Keep a command outstanding on the first backend
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Ping(context.Background())
+	}()
+	assert.Eventually(t, func() bool { return busy.count() == 1 }, time.Second, time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		_, err := b.Ping(context.Background())
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, busy.count())
+	assert.Equal(t, 10, idle.count())
+
+	close(busy.release)
+	<-done
+}
+
+func TestClamavBalancerHealthCheckLoop(t *testing.T) {
+	backend := &fakeClamaver{err: errors.New("down")}
+
+	b := NewClamavBalancer([]*Backend{{Name: "fake", Clamav: backend}}, BalancerRoundRobin, 5*time.Millisecond)
+	defer b.Close()
+
+	assert.Eventually(t, func() bool { return !b.Backends()[0].Healthy() }, time.Second, time.Millisecond)
+
+	// The backend recovers
+	backend.mu.Lock()
+	backend.err = nil
+	backend.mu.Unlock()
+
+	assert.Eventually(t, func() bool { return b.Backends()[0].Healthy() }, time.Second, time.Millisecond)
+}
+
+func TestClamavBalancerFanOut(t *testing.T) {
+	ok := &fakeClamaver{detections: []DetStat{
+		{Time: time.Unix(1688628580, 0), Signature: "Eicar-Signature"},
+	}}
+	failing := &fakeClamaver{err: ErrUnknownCommand, detections: []DetStat{
+		{Time: time.Unix(1688628578, 0), Signature: "Win.Test.EICAR_HDB-1"},
+	}}
+
+	b := NewClamavBalancer([]*Backend{
+		{Name: "ok", Clamav: ok},
+		{Name: "failing", Clamav: failing},
+	}, BalancerRoundRobin, 0)
+	defer b.Close()
+
+	err := b.Reload(context.Background())
+	assert.ErrorIs(t, err, ErrUnknownCommand)
+	assert.Contains(t, err.Error(), "failing")
+
+	failing.mu.Lock()
+	failing.err = nil
+	failing.mu.Unlock()
+
+	assert.NoError(t, b.Reload(context.Background()))
+
+	// The detections of all the backends are merged in chronological
+	// order and tagged with their backend
+	stats, err := b.DetStats(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []DetStat{
+		{Time: time.Unix(1688628578, 0), Signature: "Win.Test.EICAR_HDB-1", Backend: "failing"},
+		{Time: time.Unix(1688628580, 0), Signature: "Eicar-Signature", Backend: "ok"},
+	}, stats)
+}
+
+func TestClamavBalancerFanOutOutOfRotation(t *testing.T) {
+	up := &fakeClamaver{}
+	down := &fakeClamaver{err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+
+	b := NewClamavBalancer([]*Backend{
+		{Name: "up", Clamav: up},
+		{Name: "down", Clamav: down},
+	}, BalancerRoundRobin, 0)
+	defer b.Close()
+
+	// The backend failing with a network error is taken out of rotation
+	err := b.Reload(context.Background())
+	var netErr net.Error
+	assert.ErrorAs(t, err, &netErr)
+	assert.False(t, b.Backends()[1].Healthy())
+
+	// and no longer fails the admin commands
+	assert.NoError(t, b.Reload(context.Background()))
+	assert.Equal(t, 2, up.reloads)
+	assert.Equal(t, 1, down.reloads)
+
+	// No backend is left in rotation
+	b.Backends()[0].healthy.Store(false)
+	assert.ErrorIs(t, b.Reload(context.Background()), ErrNoBackendAvailable)
+}
+
+func TestClamavBalancerVersion(t *testing.T) {
+	updated := &watchedClamaver{version: "ClamAV 1.0.1/26962/Fri Jul  7 07:29:38 2023"}
+	outdated := &watchedClamaver{version: "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023"}
+
+	b := NewClamavBalancer([]*Backend{
+		{Name: "outdated", Clamav: outdated},
+		{Name: "updated", Clamav: updated},
+	}, BalancerRoundRobin, 0)
+	defer b.Close()
+
+	// The most recent database is returned whichever backend is next
+	for range 2 {
+		resp, err := b.Version(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "ClamAV 1.0.1/26962/Fri Jul  7 07:29:38 2023\n", string(resp))
+	}
+
+	// The version of each backend is kept
+	assert.Equal(t, 26961, b.Backends()[0].Version().Database)
+	assert.Equal(t, 26962, b.Backends()[1].Version().Database)
+
+	// Unless its backend fails
+	updated.set("", errors.New("connection refused"))
+	resp, err := b.Version(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023\n", string(resp))
+
+	outdated.set("foobar", nil)
+	_, err = b.Version(context.Background())
+	assert.ErrorIs(t, err, ErrParsingVersion)
+	assert.Contains(t, err.Error(), "connection refused")
+
+	// The last version known is kept on failure
+	assert.Equal(t, 26962, b.Backends()[1].Version().Database)
+}
+
+func TestClamavBalancerBackendTrace(t *testing.T) {
+	b := NewClamavBalancer([]*Backend{
+		{Name: "unknown", Clamav: &fakeClamaver{}},
+		{Name: "known", Clamav: &fakeClamaver{}},
+	}, BalancerRoundRobin, 0)
+	defer b.Close()
+
+	b.Backends()[1].version.Store(&Version{Engine: "1.0.1", Database: 26962})
+
+	var trace BackendTrace
+	ctx := WithBackendTrace(context.Background(), &trace)
+
+	name, v := trace.Backend()
+	assert.Empty(t, name)
+	assert.Nil(t, v)
+
+	_, err := b.Ping(ctx)
+	assert.NoError(t, err)
+	name, v = trace.Backend()
+	assert.Equal(t, "unknown", name)
+	assert.Nil(t, v)
+
+	// The last backend the command was sent to is recorded
+	_, err = b.Ping(ctx)
+	assert.NoError(t, err)
+	name, v = trace.Backend()
+	assert.Equal(t, "known", name)
+	assert.Equal(t, &Version{Engine: "1.0.1", Database: 26962}, v)
+
+	// The commands can be sent without trace
+	_, err = b.Ping(context.Background())
+	assert.NoError(t, err)
+}
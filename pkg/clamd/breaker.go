@@ -0,0 +1,199 @@
+package clamd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BreakerState represents the state of a CircuitBreaker.
+type BreakerState string
+
+const (
+	// BreakerClosed lets all the commands through.
+	BreakerClosed BreakerState = "closed"
+
+	// BreakerOpen fails all the commands fast, until the open timeout elapsed.
+	BreakerOpen BreakerState = "open"
+
+	// BreakerHalfOpen lets a single command through to probe whether
+	// Clamd recovered.
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// ErrCircuitOpen is returned when a command is not sent to Clamd
+// because it failed repeatedly.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitOpenError is returned when a command is rejected by a CircuitBreaker.
+// It matches ErrCircuitOpen with errors.Is.
+type CircuitOpenError struct {
+	// Duration after which commands will be let through again
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrCircuitOpen, e.RetryAfter)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerStatus is a snapshot of the state of a CircuitBreaker.
+type BreakerStatus struct {
+	State    BreakerState
+	Failures int
+
+	// Time at which the breaker opened for the last time,
+	// zero if it never did
+	OpenedAt time.Time
+
+	// Duration after which the breaker lets commands through again,
+	// zero unless it is open
+	RetryAfter time.Duration
+}
+
+// CircuitBreaker stops sending commands to Clamd once it failed
+// consecutively for a given number of times.
+//
+// The breaker then stays open for a given timeout, after which a single
+// command is let through: the breaker closes if it succeeds and opens again otherwise.
+type CircuitBreaker struct {
+	// Number of consecutive failures opening the breaker
+	threshold int
+
+	// Duration the breaker stays open
+	openTimeout time.Duration
+
+	// Called whenever the breaker changes its state
+	onStateChange func(from, to BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+
+	// now is overridden in tests
+	now func() time.Time
+}
+
+// NewCircuitBreaker returns a closed CircuitBreaker opening after threshold
+// consecutive failures, for openTimeout.
+//
+// onStateChange, if not nil, is called whenever the breaker changes its state.
+// It is called with the breaker locked, so it must not call the breaker back.
+func NewCircuitBreaker(threshold int, openTimeout time.Duration, onStateChange func(from, to BreakerState)) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	return &CircuitBreaker{
+		threshold:     threshold,
+		openTimeout:   openTimeout,
+		onStateChange: onStateChange,
+		state:         BreakerClosed,
+		now:           time.Now,
+	}
+}
+
+// Allow returns whether a command can be sent to Clamd,
+// or a *CircuitOpenError otherwise.
+//
+// Each command let through must be followed by a call to Record.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		retryAfter := b.openedAt.Add(b.openTimeout).Sub(b.now())
+		if retryAfter > 0 {
+			return &CircuitOpenError{RetryAfter: retryAfter}
+		}
+		b.setState(BreakerHalfOpen)
+	}
+
+	if b.state == BreakerHalfOpen {
+		// Only one probe at a time
+		if b.probing {
+			return &CircuitOpenError{RetryAfter: time.Second}
+		}
+		b.probing = true
+	}
+
+	return nil
+}
+
+// Record reports the outcome of a command let through by Allow.
+//
+// Only the failures to communicate with Clamd are counted as
+// failures, see isClamdFailure.
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	// The command was abandoned by its caller, or the stream to scan
+	// could not be read, which tells nothing about the health of Clamd
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrReadStream) {
+		return
+	}
+
+	if !isClamdFailure(err) {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		if b.state != BreakerOpen {
+			b.setState(BreakerOpen)
+		}
+	}
+}
+
+// Status returns a snapshot of the state of the breaker.
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := BreakerStatus{
+		State:    b.state,
+		Failures: b.failures,
+		OpenedAt: b.openedAt,
+	}
+	if b.state == BreakerOpen {
+		s.RetryAfter = max(b.openedAt.Add(b.openTimeout).Sub(b.now()), 0)
+	}
+
+	return s
+}
+
+// setState must be called with b.mu held.
+func (b *CircuitBreaker) setState(state BreakerState) {
+	from := b.state
+	b.state = state
+
+	if b.onStateChange != nil {
+		b.onStateChange(from, state)
+	}
+}
+
+// isClamdFailure returns whether err means Clamd could not be
+// communicated with, as opposed to Clamd replying with an error.
+func isClamdFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrReadStream) {
+		return false
+	}
+
+	return isNetError(err) || errors.Is(err, ErrSessionClosed) || errors.Is(err, ErrNoBackendAvailable)
+}
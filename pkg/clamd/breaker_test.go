@@ -0,0 +1,106 @@
+package clamd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	netErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+
+	var transitions []BreakerState
+	b := NewCircuitBreaker(3, 30*time.Second, func(from, to BreakerState) {
+		transitions = append(transitions, to)
+	})
+	b.now = func() time.Time { return now }
+
+	// Errors replied by Clamd are not failures
+	assert.NoError(t, b.Allow())
+	b.Record(ErrVirusFound)
+	assert.NoError(t, b.Allow())
+	b.Record(ErrUnknownCommand)
+	assert.Equal(t, BreakerClosed, b.Status().State)
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, b.Allow())
+		b.Record(netErr)
+	}
+	assert.Equal(t, BreakerClosed, b.Status().State)
+	assert.Equal(t, 2, b.Status().Failures)
+
+	// Abandoned commands are ignored
+	assert.NoError(t, b.Allow())
+	b.Record(context.Canceled)
+	assert.Equal(t, 2, b.Status().Failures)
+
+	// as are the streams which could not be read
+	assert.NoError(t, b.Allow())
+	b.Record(errors.Join(ErrReadStream, netErr))
+	assert.Equal(t, BreakerClosed, b.Status().State)
+	assert.Equal(t, 2, b.Status().Failures)
+
+	assert.NoError(t, b.Allow())
+	b.Record(netErr)
+	assert.Equal(t, BreakerOpen, b.Status().State)
+	assert.Equal(t, 30*time.Second, b.Status().RetryAfter)
+
+	// Failing fast while open
+	now = now.Add(10 * time.Second)
+	err := b.Allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	var openErr *CircuitOpenError
+	assert.ErrorAs(t, err, &openErr)
+	assert.Equal(t, 20*time.Second, openErr.RetryAfter)
+
+	// A single probe is let through once the timeout elapsed
+	now = now.Add(20 * time.Second)
+	assert.NoError(t, b.Allow())
+	assert.Equal(t, BreakerHalfOpen, b.Status().State)
+	assert.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+
+	// A probe whose stream could not be read lets another one through
+	b.Record(errors.Join(ErrReadStream, netErr))
+	assert.Equal(t, BreakerHalfOpen, b.Status().State)
+	assert.NoError(t, b.Allow())
+
+	// The probe fails
+	b.Record(netErr)
+	assert.Equal(t, BreakerOpen, b.Status().State)
+	assert.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+
+	// The probe succeeds
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, b.Allow())
+	b.Record(nil)
+	assert.Equal(t, BreakerClosed, b.Status().State)
+	assert.Equal(t, 0, b.Status().Failures)
+
+	assert.Equal(t, []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}, transitions)
+}
+
+func TestIsClamdFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "net error", err: &net.OpError{}, want: true},
+		{name: "wrapped net error", err: errors.Join(errors.New("foo"), &net.OpError{}), want: true},
+		{name: "session closed", err: ErrSessionClosed, want: true},
+		{name: "no backend available", err: ErrNoBackendAvailable, want: true},
+		{name: "virus found", err: ErrVirusFound, want: false},
+		{name: "read stream", err: errors.Join(ErrReadStream, &net.OpError{}), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isClamdFailure(tt.err))
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package clamd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrParsingVersionCommands = errors.New("error while parsing 'versioncommands'")
+
+	// ErrUnsupportedCommand is returned when Clamd doesn't
+	// advertise a command in its "VERSIONCOMMANDS" response.
+	ErrUnsupportedCommand = errors.New("command not supported by clamav")
+)
+
+// ParseVersionCommands will parse the response to a "VERSIONCOMMANDS" command
+// into the version of Clamav and the list of the commands it supports.
+//
+// Example of response:
+//
+// ClamAV 1.0.0/26804/Mon Feb  6 08:47:07 2023| COMMANDS: SCAN QUIT RELOAD PING CONTSCAN VERSIONCOMMANDS VERSION END SHUTDOWN MULTISCAN FILDES STATS IDSESSION INSTREAM DETSTATSCLEAR DETSTATS ALLMATCHSCAN
+func ParseVersionCommands(b []byte) (string, []string, error) {
+	version, cmds, ok := strings.Cut(strings.TrimSuffix(string(b), "\n"), "| COMMANDS: ")
+	if !ok || strings.Contains(cmds, "| COMMANDS: ") {
+		return "", nil, ErrParsingVersionCommands
+	}
+
+	return version, strings.Split(cmds, " "), nil
+}
+
+// Capabilities caches the commands supported by Clamd,
+// as advertised by the "VERSIONCOMMANDS" command.
+//
+// As long as the commands were never fetched successfully,
+// all of them are assumed to be supported.
+type Capabilities struct {
+	mu          sync.RWMutex
+	version     string
+	commands    map[string]bool
+	refreshedAt time.Time
+	err         error
+}
+
+// CapabilitiesStatus is a snapshot of Capabilities.
+type CapabilitiesStatus struct {
+	// Whether the commands were fetched successfully at least once
+	Known bool
+
+	Version  string
+	Commands []string
+
+	// Time of the last successful refresh
+	RefreshedAt time.Time
+
+	// Error returned by the last refresh, if any
+	Err error
+}
+
+func NewCapabilities() *Capabilities {
+	return &Capabilities{}
+}
+
+// Refresh sends the "VERSIONCOMMANDS" command with c and caches
+// the commands supported by Clamd.
+//
+// On failure, the previously cached commands are kept.
+func (cp *Capabilities) Refresh(ctx context.Context, c Clamaver) error {
+	resp, err := c.VersionCommands(ctx)
+	if err == nil {
+		var version string
+		var cmds []string
+		version, cmds, err = ParseVersionCommands(resp)
+		if err == nil {
+			commands := make(map[string]bool, len(cmds))
+			for _, cmd := range cmds {
+				commands[cmd] = true
+			}
+
+			cp.mu.Lock()
+			cp.version = version
+			cp.commands = commands
+			cp.refreshedAt = time.Now()
+			cp.err = nil
+			cp.mu.Unlock()
+
+			return nil
+		}
+	}
+
+	cp.mu.Lock()
+	cp.err = err
+	cp.mu.Unlock()
+
+	return err
+}
+
+// Supports returns whether Clamd supports cmd, eg. "DETSTATS".
+func (cp *Capabilities) Supports(cmd string) bool {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	return cp.commands == nil || cp.commands[cmd]
+}
+
+// Require returns an error wrapping ErrUnsupportedCommand
+// when Clamd doesn't support cmd.
+func (cp *Capabilities) Require(cmd string) error {
+	if !cp.Supports(cmd) {
+		return fmt.Errorf("%w: %s", ErrUnsupportedCommand, cmd)
+	}
+	return nil
+}
+
+// Status returns a snapshot of the cached capabilities.
+func (cp *Capabilities) Status() CapabilitiesStatus {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	s := CapabilitiesStatus{
+		Known:       cp.commands != nil,
+		Version:     cp.version,
+		Commands:    make([]string, 0, len(cp.commands)),
+		RefreshedAt: cp.refreshedAt,
+		Err:         cp.err,
+	}
+	for cmd := range cp.commands {
+		s.Commands = append(s.Commands, cmd)
+	}
+	sort.Strings(s.Commands)
+
+	return s
+}
@@ -0,0 +1,75 @@
+package clamd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersionCommands(t *testing.T) {
+	version, cmds, err := ParseVersionCommands([]byte(versionCommandsResp + "\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023", version)
+	assert.Len(t, cmds, 17)
+	assert.Equal(t, "SCAN", cmds[0])
+	assert.Equal(t, "ALLMATCHSCAN", cmds[16])
+
+	for _, invalid := range []string{"", "PONG", "ClamAV 1.0.1| COMMANDS: PING| COMMANDS: PING"} {
+		_, _, err = ParseVersionCommands([]byte(invalid))
+		assert.ErrorIs(t, err, ErrParsingVersionCommands)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	cp := NewCapabilities()
+
+	// Everything is assumed to be supported until refreshed
+	assert.True(t, cp.Supports("FOOBAR"))
+	assert.NoError(t, cp.Require("FOOBAR"))
+	assert.False(t, cp.Status().Known)
+
+	// Failing refresh
+	s := NewServer(network, listen, handlerPing)
+	<-s.ready
+
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
+	err := cp.Refresh(context.Background(), c)
+	assert.ErrorIs(t, err, ErrParsingVersionCommands)
+	assert.True(t, cp.Supports("FOOBAR"))
+	assert.ErrorIs(t, cp.Status().Err, ErrParsingVersionCommands)
+	s.Stop()
+
+	// Successful refresh
+	s = NewServer(network, listen, handlerVersionCommands)
+	<-s.ready
+
+	c = NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
+	err = cp.Refresh(context.Background(), c)
+	assert.NoError(t, err)
+	assert.True(t, cp.Supports("DETSTATS"))
+	assert.True(t, cp.Supports(string(ScanModeAllMatch)))
+	assert.False(t, cp.Supports("FOOBAR"))
+	assert.ErrorIs(t, cp.Require("FOOBAR"), ErrUnsupportedCommand)
+
+	status := cp.Status()
+	assert.True(t, status.Known)
+	assert.NoError(t, status.Err)
+	assert.Equal(t, "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023", status.Version)
+	assert.Contains(t, status.Commands, "INSTREAM")
+	assert.Equal(t, "ALLMATCHSCAN", status.Commands[0])
+	assert.False(t, status.RefreshedAt.IsZero())
+
+	// The cached commands are kept when clamd is unreachable
+	s.Stop()
+
+	err = cp.Refresh(context.Background(), c)
+	assert.Error(t, err)
+	assert.True(t, cp.Supports("DETSTATS"))
+	assert.False(t, cp.Supports("FOOBAR"))
+}
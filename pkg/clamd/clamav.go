@@ -0,0 +1,404 @@
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// Clamaver is implemented by the clients able to send
+// the commands of the Clamd protocol.
+type Clamaver interface {
+	Ping(ctx context.Context) ([]byte, error)
+	Version(ctx context.Context) ([]byte, error)
+	Reload(ctx context.Context) error
+	Stats(ctx context.Context) ([]byte, error)
+	VersionCommands(ctx context.Context) ([]byte, error)
+	Shutdown(ctx context.Context) error
+	InStream(ctx context.Context, r io.Reader) ([]byte, error)
+	ScanPath(ctx context.Context, path string, mode ScanMode) ([]ScanResult, error)
+	ScanFile(ctx context.Context, f *os.File) ([]byte, error)
+	DetStats(ctx context.Context) ([]DetStat, error)
+	DetStatsClear(ctx context.Context) error
+}
+
+// DefaultStreamChunkSize is the default maximum size of the chunks
+// sent to Clamd with the "INSTREAM" command.
+const DefaultStreamChunkSize = 64 * 1024
+
+// ClamavClient is a Clamaver opening a new connection
+// to Clamd for each command.
+type ClamavClient struct {
+	dialer  net.Dialer
+	address string
+	network string
+
+	// Maximum size of the chunks sent with the "INSTREAM" command
+	chunkSize int
+}
+
+var _ Clamaver = (*ClamavClient)(nil)
+
+// NewClamavClient returns a ClamavClient connecting to Clamd at addr over
+// the netw network ("tcp" or "unix"), with the given dial timeout and
+// keep-alive period.
+func NewClamavClient(addr string, netw string, timeout time.Duration, keepalive time.Duration) *ClamavClient {
+	return &ClamavClient{
+		dialer: net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: keepalive,
+		},
+		address:   addr,
+		network:   netw,
+		chunkSize: DefaultStreamChunkSize,
+	}
+}
+
+// SetStreamChunkSize sets the maximum size of the chunks sent to Clamd
+// with the "INSTREAM" command.
+// It should be lower than the Clamd "StreamMaxLength" setting.
+func (c *ClamavClient) SetStreamChunkSize(size int) {
+	if size <= 0 {
+		size = DefaultStreamChunkSize
+	}
+	c.chunkSize = size
+}
+
+// Ping will send the "PING" command to Clamd and return
+// its response, "PONG", or any error encountered.
+func (c *ClamavClient) Ping(ctx context.Context) ([]byte, error) {
+	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, err := c.sendCommand(conn, CmdPing)
+	if err != nil {
+		return nil, fmt.Errorf("error while sending command: %w", err)
+	}
+
+	err = c.parseResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error from clamav: %w", err)
+	}
+	return resp, nil
+}
+
+// Version will send the "VERSION" command to Clamd and return its response,
+// eg. "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023", or any error encountered.
+// See ParseVersion to parse it.
+func (c *ClamavClient) Version(ctx context.Context) ([]byte, error) {
+	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, err := c.sendCommand(conn, CmdVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error while sending command: %w", err)
+	}
+
+	err = c.parseResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error from clamav: %w", err)
+	}
+	return resp, nil
+}
+
+// Reload will send the "RELOAD" command to Clamd for it to reload
+// its signature databases. It returns ErrUnexpectedResponse
+// if Clamd doesn't reply with "RELOADING".
+func (c *ClamavClient) Reload(ctx context.Context) error {
+	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	resp, err := c.sendCommand(conn, CmdReload)
+	if err != nil {
+		return fmt.Errorf("error while sending command: %w", err)
+	}
+
+	err = c.parseResponse(resp)
+	if err != nil {
+		return fmt.Errorf("error from clamav: %w", err)
+	}
+
+	if !bytes.Equal(resp, RespReload) {
+		return fmt.Errorf("error from clamav: %w. Expected %s but got %s", ErrUnexpectedResponse, RespReload, resp)
+	}
+	return nil
+}
+
+// Stats will send the "STATS" command to Clamd and return the statistics
+// about its scan queue and memory usage, or any error encountered.
+// See ParseStats to parse them.
+func (c *ClamavClient) Stats(ctx context.Context) ([]byte, error) {
+	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, err := c.sendCommand(conn, CmdStats)
+	if err != nil {
+		return nil, fmt.Errorf("error while sending command: %w", err)
+	}
+
+	err = c.parseResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error from clamav: %w", err)
+	}
+	return resp, nil
+}
+
+// VersionCommands will send the "VERSIONCOMMANDS" command to Clamd and return
+// its version followed by the commands it supports, or any error encountered.
+// See ParseVersionCommands to parse them.
+func (c *ClamavClient) VersionCommands(ctx context.Context) ([]byte, error) {
+	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, err := c.sendCommand(conn, CmdVersionCommands)
+	if err != nil {
+		return nil, fmt.Errorf("error while sending command: %w", err)
+	}
+
+	err = c.parseResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error from clamav: %w", err)
+	}
+	return resp, nil
+}
+
+// Shutdown will send the "SHUTDOWN" command for Clamd to perform
+// a clean exit. Clamd doesn't reply to it.
+func (c *ClamavClient) Shutdown(ctx context.Context) error {
+	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = c.sendCommand(conn, CmdShutdown)
+	if err != nil {
+		return fmt.Errorf("error while sending command: %w", err)
+	}
+	return nil
+}
+
+// InStream will attempt to connect to Clamd, send the command over the network ("INSTREAM")
+// and stream the given io.Reader to let Clamd scan it.
+//
+// The stream is sent to Clamd in chunks, after INSTREAM, on the same socket on which the command was sent.
+// The length of the stream doesn't need to be known beforehand: the io.Reader is read until io.EOF
+// and each chunk is at most the configured chunk size long.
+//
+// Clamd may reply before the end of the stream, for example when the size limit
+// defined by its "StreamMaxLength" setting is exceeded. In this case, the streaming
+// is stopped early.
+//
+// It will read the response and return it as a byte slice as well as any error
+// encountered.
+//
+// See https://linux.die.net/man/8/clamd for a detailed explanation of the INSTREAM command.
+func (c *ClamavClient) InStream(ctx context.Context, r io.Reader) ([]byte, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error while dialing %s/%s: %w", c.network, c.address, err)
+	}
+	defer conn.Close()
+
+	// Unblock the reads and writes on the connection when the context is done
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	// Reading the response concurrently since Clamd may reply
+	// before the end of the stream
+	var resp []byte
+	var respErr error
+	replied := make(chan struct{})
+	go func() {
+		resp, respErr = c.readResponse(conn)
+		close(replied)
+	}()
+
+	writer := bufio.NewWriter(conn)
+
+	// Start scan command.
+	_, err = writer.Write(CmdInstream)
+	if err != nil {
+		return nil, fmt.Errorf("error while writing command to %s/%s: %w", c.network, c.address, err)
+	}
+
+	err = writeChunks(writer, r, c.chunkSize, replied)
+	if err != nil {
+		if errors.Is(err, ErrReadStream) {
+			return nil, err
+		}
+
+		// Clamd may have replied before closing the connection
+		<-replied
+		if respErr != nil || len(resp) == 0 {
+			return nil, fmt.Errorf("error while streaming content to %s/%s: %w", c.network, c.address, err)
+		}
+	} else {
+		<-replied
+		if respErr != nil {
+			return nil, respErr
+		}
+	}
+
+	return c.parseInStreamResponse(resp)
+}
+
+// parseInStreamResponse will parse the response to an "INSTREAM" command.
+//
+// If a virus is found, the response is returned along with ErrVirusFound.
+func (c *ClamavClient) parseInStreamResponse(resp []byte) ([]byte, error) {
+	// An empty response must never be mistaken for a clean stream
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("error from clamav: %w", ErrUnknownResponse)
+	}
+
+	err := c.parseResponse(resp)
+	if err != nil {
+		if err == ErrVirusFound {
+			return resp, err
+		}
+		if err == ErrScanFileSizeLimitExceeded {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error from clamav: %w", err)
+	}
+
+	return resp, nil
+}
+
+// writeChunks will stream r to w as a series of chunks of at most chunkSize bytes.
+//
+// The format of the chunk is: '<length><data>' where <length> is the size of the following data in bytes
+// expressed as a 4 byte unsigned integer in network byte order and <data> is the actual chunk.
+// Streaming is terminated by sending a zero-length chunk.
+//
+// The streaming is interrupted with errStreamInterrupted as soon as replied is closed.
+// Errors returned while reading r are wrapped in ErrReadStream.
+func writeChunks(w *bufio.Writer, r io.Reader, chunkSize int, replied <-chan struct{}) error {
+	if chunkSize <= 0 {
+		chunkSize = DefaultStreamChunkSize
+	}
+
+	buf := make([]byte, 4+chunkSize)
+	for {
+		select {
+		case <-replied:
+			return errStreamInterrupted
+		default:
+		}
+
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			// The size (refered previously as '<length>') must be a byte[] of length 4 - representing a
+			// uint32 in a big-endian format (network byte order, tcp standard).
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+			if werr := w.Flush(); werr != nil {
+				return werr
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrReadStream, err)
+		}
+	}
+
+	// Sending 4 bytes to signal the end of the transfer.
+	if _, err := w.Write([]byte{'\000', '\000', '\000', '\000'}); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// dial opens a new connection to Clamd.
+func (c *ClamavClient) dial(ctx context.Context) (net.Conn, error) {
+	return c.dialer.DialContext(ctx, c.network, c.address)
+}
+
+// sendCommand will attempt send the given command to Clamd
+// over the network.
+// It will read the response and return it as a byte slice as well as any error
+// encountered.
+//
+// See https://linux.die.net/man/8/clamd for a list of supported commands.
+func (c *ClamavClient) sendCommand(conn net.Conn, cmd []byte) ([]byte, error) {
+	writer := bufio.NewWriter(conn)
+
+	_, err := writer.Write(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error while writing command to %s/%s: %w", c.network, c.address, err)
+	}
+	writer.Flush()
+
+	resp, err := c.readResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// readResponse will read from the given io.Reader until a null character is found
+// and returns the read bytes before the null character or any error encountered.
+func (c *ClamavClient) readResponse(r io.Reader) ([]byte, error) {
+	reader := bufio.NewReader(r)
+
+	resp, err := reader.ReadBytes('\000')
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error while reading response from %s/%s: %w", c.network, c.address, err)
+	}
+
+	// Clamd terminate the response with a NULL character (\000)
+	// which can safely be trimed
+	return bytes.TrimSuffix(resp, []byte("\000")), nil
+}
+
+// parseResponse will attempt to parse the Clamav response to the command
+// and determine whether or not Clamav answered with an error.
+// See errors.go for a list of known errors.
+func (c *ClamavClient) parseResponse(msg []byte) error {
+	if bytes.EqualFold(msg, RespErrScanFileSizeLimitExceeded) {
+		return ErrScanFileSizeLimitExceeded
+	}
+
+	// Either "stream: <signature> FOUND" or "fd[<fd>]: <signature> FOUND"
+	if bytes.HasSuffix(msg, []byte(" FOUND")) {
+		return ErrVirusFound
+	}
+
+	if bytes.Equal(msg, RespErrUnknownCommand) {
+		return ErrUnknownCommand
+	}
+
+	return nil
+}
@@ -1,9 +1,11 @@
-package clamav
+package clamd
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,6 +13,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -38,6 +41,11 @@ var (
 	handlerInStreamGoodFile    handlerType = "instreamgoodfile"
 	handlerInStreamBadFile     handlerType = "instreamgbadfile"
 	handlerInStreamTooLongFile handlerType = "instreamtoolongfile"
+	handlerSession             handlerType = "session"
+	handlerScanPath            handlerType = "scanpath"
+	handlerFildes              handlerType = "fildes"
+	handlerDetStats            handlerType = "detstats"
+	handlerDetStatsClear       handlerType = "detstatsclear"
 )
 
 // ClamdMockTCPServer is a tcp server
@@ -48,6 +56,12 @@ type ClamdMockTCPServer struct {
 	quit     chan struct{}
 	ready    chan bool
 	wg       sync.WaitGroup
+
+	// number of accepted connections
+	accepted atomic.Int32
+
+	// last command received by handlerShutdown
+	shutdownCmd atomic.Value
 }
 
 // Mostly taken from https://eli.thegreenplace.net/2020/graceful-shutdown-of-a-tcp-server-in-go/
@@ -82,6 +96,7 @@ func (s *ClamdMockTCPServer) Serve(handler handlerType) {
 				log.Println("accept error", err)
 			}
 		} else {
+			s.accepted.Add(1)
 			s.wg.Add(1)
 
 			go func(handler handlerType, conn net.Conn) {
@@ -113,6 +128,21 @@ func (s *ClamdMockTCPServer) Serve(handler handlerType) {
 				case handlerInStreamTooLongFile:
 					s.handlerInStreamTooLongFile(conn)
 					s.wg.Done()
+				case handlerSession:
+					s.handlerSession(conn)
+					s.wg.Done()
+				case handlerScanPath:
+					s.handlerScanPath(conn)
+					s.wg.Done()
+				case handlerFildes:
+					s.handlerFildes(conn)
+					s.wg.Done()
+				case handlerDetStats:
+					s.handlerDetStats(conn)
+					s.wg.Done()
+				case handlerDetStatsClear:
+					s.handlerDetStatsClear(conn)
+					s.wg.Done()
 				default:
 					s.handlerPing(conn)
 					s.wg.Done()
@@ -202,7 +232,9 @@ func (s *ClamdMockTCPServer) handlerVersionCommands(conn net.Conn) {
 
 func (s *ClamdMockTCPServer) handlerShutdown(conn net.Conn) {
 	defer conn.Close()
-	s.readFromConnection(conn)
+
+	msg, _ := s.readFromConnection(conn)
+	s.shutdownCmd.Store(msg)
 }
 
 var (
@@ -222,19 +254,36 @@ func (s *ClamdMockTCPServer) readInStreamCmd(conn net.Conn) []byte {
 	//   ^                       ^  ^       ^  ^                 ^  ^     ^
 	//   |       zINSTREAM       |  |  len  |  |      foobar     |  | null|
 	//   +-----------------------+  +-------+  +-----------------+  +-----+
-	buf := make([]byte, 64)
-	msg := make([]byte, 0)
+	s.readFromConnection(conn)
 
+	data, err := readChunks(conn)
+	if err != nil {
+		log.Fatalf("error while reading chunks: %s", err)
+	}
+
+	return data
+}
+
+// readChunks reads the chunks following an "INSTREAM" command
+// until a zero-length chunk is received.
+func readChunks(r io.Reader) ([]byte, error) {
+	var data []byte
 	for {
-		n, err := conn.Read(buf)
-		if err != nil && err != io.EOF {
-			log.Fatalf("error while reading response: %s", err)
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
 		}
 
-		msg = append(msg, buf[:n]...)
-		if err == io.EOF || n == 0 || bytes.HasSuffix(msg, []byte{'\000', '\000', '\000', '\000'}) {
-			return msg
+		size := binary.BigEndian.Uint32(b)
+		if size == 0 {
+			return data, nil
+		}
+
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
 		}
+		data = append(data, chunk...)
 	}
 }
 
@@ -252,16 +301,36 @@ func (s *ClamdMockTCPServer) handlerInStreamBadFile(conn net.Conn) {
 	fmt.Fprint(conn, "stream: Win.Test.EICAR_HDB-1 FOUND\000")
 }
 
+// handlerInStreamTooLongFile mocks a Clamd daemon with a "StreamMaxLength"
+// of 128 bytes: the error is sent as soon as the limit is exceeded, without
+// waiting for the end of the stream.
 func (s *ClamdMockTCPServer) handlerInStreamTooLongFile(conn net.Conn) {
 	defer conn.Close()
 
-	msg := s.readInStreamCmd(conn)
-	// Get file size. It's 4 bytes after the Command
-	fsize := msg[len(CmdInstream) : len(CmdInstream)+4]
-	size := binary.BigEndian.Uint32(fsize)
+	s.readFromConnection(conn)
+
+	var size uint32
+	for {
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return
+		}
+
+		l := binary.BigEndian.Uint32(b)
+		if l == 0 {
+			fmt.Fprint(conn, "stream: OK\000")
+			return
+		}
 
-	if size > 128 {
-		fmt.Fprint(conn, "INSTREAM size limit exceeded. ERROR\000")
+		size += l
+		if size > 128 {
+			fmt.Fprint(conn, "INSTREAM size limit exceeded. ERROR\000")
+			return
+		}
+
+		if _, err := io.CopyN(io.Discard, conn, int64(l)); err != nil {
+			return
+		}
 	}
 }
 
@@ -436,6 +505,15 @@ func TestClamavClientVersionShutdown(t *testing.T) {
 	err := c.Shutdown(context.Background())
 	assert.NoError(t, err)
 
+	// Stop mock tcp server, waiting for the command to be handled
+	s.Stop()
+	assert.Equal(t, []byte("zSHUTDOWN\000"), s.shutdownCmd.Load())
+
+	s = NewServer(network, listen, handlerShutdown)
+	<-s.ready
+	c = NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
 	// Stop mock tcp server
 	s.Stop()
 
@@ -453,7 +531,7 @@ func TestClamavClientInStream(t *testing.T) {
 	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
 		time.Second, time.Second)
 
-	resp, err := c.InStream(context.Background(), strings.NewReader(goodFile), int64(len(goodFile)))
+	resp, err := c.InStream(context.Background(), strings.NewReader(goodFile))
 	assert.EqualValues(t, RespScan, resp)
 	assert.NoError(t, err)
 
@@ -467,7 +545,7 @@ func TestClamavClientInStream(t *testing.T) {
 	c = NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
 		time.Second, time.Second)
 
-	resp, err = c.InStream(context.Background(), strings.NewReader(badFile), int64(len(badFile)))
+	resp, err = c.InStream(context.Background(), strings.NewReader(badFile))
 	assert.True(t, bytes.Contains(resp, []byte("FOUND")))
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, ErrVirusFound)
@@ -482,7 +560,7 @@ func TestClamavClientInStream(t *testing.T) {
 	c = NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
 		time.Second, time.Second)
 
-	_, err = c.InStream(context.Background(), strings.NewReader(tooLongFile), int64(len(tooLongFile)))
+	_, err = c.InStream(context.Background(), strings.NewReader(tooLongFile))
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, ErrScanFileSizeLimitExceeded)
 
@@ -490,11 +568,117 @@ func TestClamavClientInStream(t *testing.T) {
 	s.Stop()
 
 	// When the server is stopped
-	resp, err = c.InStream(context.Background(), strings.NewReader(goodFile), int64(len(goodFile)))
+	resp, err = c.InStream(context.Background(), strings.NewReader(goodFile))
 	assert.Nil(t, resp)
 	assert.Error(t, err)
 }
 
+func TestClamavClientInStreamChunks(t *testing.T) {
+	s := NewServer(network, listen, handlerInStreamTooLongFile)
+	<-s.ready
+
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+	c.SetStreamChunkSize(16)
+
+	// The stream is sent in several chunks, its length is not known beforehand
+	resp, err := c.InStream(context.Background(), io.MultiReader(strings.NewReader(goodFile), strings.NewReader(goodFile)))
+	assert.NoError(t, err)
+	assert.EqualValues(t, RespScan, resp)
+
+	// Clamd replies before the end of the stream when the size limit is exceeded.
+	// The stream is interrupted without reading the remaining content
+	r := &countingReader{r: io.LimitReader(zeroReader{}, 1024*1024)}
+	resp, err = c.InStream(context.Background(), r)
+	assert.ErrorIs(t, err, ErrScanFileSizeLimitExceeded)
+	assert.Nil(t, resp)
+	assert.Less(t, r.n, int64(1024*1024))
+
+	// Errors while reading the stream are reported as such
+	resp, err = c.InStream(context.Background(), io.MultiReader(strings.NewReader(goodFile), errReader{}))
+	assert.ErrorIs(t, err, ErrReadStream)
+	assert.Nil(t, resp)
+
+	s.Stop()
+}
+
+func TestWriteChunks(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		chunkSize int
+		want      []byte
+	}{
+		{
+			name:      "empty stream",
+			data:      "",
+			chunkSize: 4,
+			want:      []byte{0, 0, 0, 0},
+		},
+		{
+			name:      "single chunk",
+			data:      "foobar",
+			chunkSize: 16,
+			want:      []byte{0, 0, 0, 6, 'f', 'o', 'o', 'b', 'a', 'r', 0, 0, 0, 0},
+		},
+		{
+			name:      "several chunks",
+			data:      "foobar",
+			chunkSize: 4,
+			want:      []byte{0, 0, 0, 4, 'f', 'o', 'o', 'b', 0, 0, 0, 2, 'a', 'r', 0, 0, 0, 0},
+		},
+		{
+			name:      "default chunk size",
+			data:      "foobar",
+			chunkSize: 0,
+			want:      []byte{0, 0, 0, 6, 'f', 'o', 'o', 'b', 'a', 'r', 0, 0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			w := bufio.NewWriter(b)
+
+			err := writeChunks(w, strings.NewReader(tt.data), tt.chunkSize, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, b.Bytes())
+		})
+	}
+
+	// Interrupted as soon as clamd replies
+	replied := make(chan struct{})
+	close(replied)
+	err := writeChunks(bufio.NewWriter(io.Discard), strings.NewReader("foobar"), 4, replied)
+	assert.ErrorIs(t, err, errStreamInterrupted)
+}
+
+// zeroReader is an io.Reader returning an infinite stream of zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// errReader is an io.Reader always returning an error.
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+// countingReader is an io.Reader counting the number of bytes read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
 func TestClamavClientParseResponse(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -544,6 +728,12 @@ func TestClamavClientParseResponse(t *testing.T) {
 			wantErr: true,
 			typeErr: ErrVirusFound,
 		},
+		{
+			name:    "response is fd[10]: Eicar FOUND",
+			resp:    []byte("fd[10]: Eicar FOUND"),
+			wantErr: true,
+			typeErr: ErrVirusFound,
+		},
 		{
 			name:    "response is INSTREAM size limit exceeded. ERROR",
 			resp:    RespErrScanFileSizeLimitExceeded,
@@ -1,4 +1,4 @@
-package clamav
+package clamd
 
 // The ClamavCommand represents Clamd commands
 // over a tcp connection.
@@ -24,4 +24,9 @@ var (
 	CmdStats           ClamavCommand = []byte("zSTATS\000")
 	CmdVersionCommands ClamavCommand = []byte("nVERSIONCOMMANDS\n") // From https://linux.die.net/man/8/clamd, it is recommended to use nVERSIONCOMMANDS.
 	CmdShutdown        ClamavCommand = []byte("zSHUTDOWN\000")
+	CmdDetStats        ClamavCommand = []byte("zDETSTATS\000")
+	CmdDetStatsClear   ClamavCommand = []byte("zDETSTATSCLEAR\000")
+	CmdFildes          ClamavCommand = []byte("zFILDES\000")
+	CmdIDSession       ClamavCommand = []byte("zIDSESSION\000")
+	CmdEnd             ClamavCommand = []byte("zEND\000")
 )
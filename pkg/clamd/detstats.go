@@ -0,0 +1,130 @@
+package clamd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrParsingDetStats = errors.New("error while parsing 'detstats'")
+
+// DetStat represents a detection recorded by Clamd
+// and reported by the "DETSTATS" command.
+type DetStat struct {
+	Time      time.Time
+	MD5       string
+	Size      int64
+	Signature string
+	FileName  string
+
+	// Name of the backend which recorded the detection,
+	// only set by a ClamavBalancer
+	Backend string
+}
+
+// DetStats will attempt to connect to Clamd and send the "DETSTATS" command
+// to retrieve the statistics about the latest detections.
+//
+// Clamd replies with a line for each detection, in the form
+// "<time>:<md5>:<size>:<signature>:<file name>", or with nothing at all
+// when no virus has been detected yet.
+// It returns a DetStat for each line and any error encountered.
+func (c *ClamavClient) DetStats(ctx context.Context) ([]DetStat, error) {
+	resps, err := c.sendMultiResponseCommand(ctx, CmdDetStats)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDetStats(resps)
+}
+
+// DetStatsClear will attempt to connect to Clamd and send the "DETSTATSCLEAR" command
+// to reset the statistics about the latest detections.
+//
+// Clamd doesn't reply to this command unless it is unknown.
+func (c *ClamavClient) DetStatsClear(ctx context.Context) error {
+	resps, err := c.sendMultiResponseCommand(ctx, CmdDetStatsClear)
+	if err != nil {
+		return err
+	}
+
+	if len(resps) == 0 {
+		return nil
+	}
+
+	if err := c.parseResponse(resps[0]); err != nil {
+		return fmt.Errorf("error from clamav: %w", err)
+	}
+	return fmt.Errorf("error from clamav: %w: %q", ErrUnexpectedResponse, resps[0])
+}
+
+// sendMultiResponseCommand will send cmd to Clamd and read all
+// the responses until the connection is closed by Clamd.
+func (c *ClamavClient) sendMultiResponseCommand(ctx context.Context, cmd []byte) ([][]byte, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Unblock the reads and writes on the connection when the context is done
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	writer := bufio.NewWriter(conn)
+	if _, err := writer.Write(cmd); err != nil {
+		return nil, fmt.Errorf("error while writing command to %s/%s: %w", c.network, c.address, err)
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, fmt.Errorf("error while writing command to %s/%s: %w", c.network, c.address, err)
+	}
+
+	return c.readResponses(conn)
+}
+
+// parseDetStats will parse the responses to a "DETSTATS" command
+// into a DetStat for each detection.
+//
+// Example of response:
+//
+// 1688628578:44d88612fea8a8f36de82e1278abb02f:68:Win.Test.EICAR_HDB-1:eicar.txt
+func parseDetStats(resps [][]byte) ([]DetStat, error) {
+	stats := make([]DetStat, 0, len(resps))
+	for _, resp := range resps {
+		line := string(resp)
+		if line == string(RespErrUnknownCommand) {
+			return nil, fmt.Errorf("error from clamav: %w", ErrUnknownCommand)
+		}
+
+		// The file name may contain ':'
+		s := strings.SplitN(line, ":", 5)
+		if len(s) != 5 {
+			return nil, fmt.Errorf("%w: %q", ErrParsingDetStats, line)
+		}
+
+		t, err := strconv.ParseInt(s[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrParsingDetStats, line)
+		}
+		size, err := strconv.ParseInt(s[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrParsingDetStats, line)
+		}
+
+		stats = append(stats, DetStat{
+			Time:      time.Unix(t, 0).UTC(),
+			MD5:       s[1],
+			Size:      size,
+			Signature: s[3],
+			FileName:  s[4],
+		})
+	}
+
+	return stats, nil
+}
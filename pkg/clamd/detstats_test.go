@@ -0,0 +1,176 @@
+package clamd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Example of output for a 'DETSTATS' command
+var detStatsResp = []string{
+	"1688628578:44d88612fea8a8f36de82e1278abb02f:68:Win.Test.EICAR_HDB-1:eicar.txt",
+	"1688628612:e4968ef99266df7c9a1f0637d2389dab:184:Eicar-Signature:C:\\eicar.com",
+}
+
+func (s *ClamdMockTCPServer) handlerDetStats(conn net.Conn) {
+	defer conn.Close()
+
+	s.readFromConnection(conn)
+	for _, line := range detStatsResp {
+		fmt.Fprintf(conn, "%s\000", line)
+	}
+}
+
+func (s *ClamdMockTCPServer) handlerDetStatsClear(conn net.Conn) {
+	defer conn.Close()
+	s.readFromConnection(conn)
+}
+
+func TestClamavClientDetStats(t *testing.T) {
+	// Start mock tcp server on random port and wait for it to be ready
+	s := NewServer(network, listen, handlerDetStats)
+	<-s.ready
+
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
+	stats, err := c.DetStats(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, stats, 2)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", stats[0].Signature)
+	assert.Equal(t, `C:\eicar.com`, stats[1].FileName)
+
+	// Stop mock tcp server
+	s.Stop()
+
+	// When the server is stopped
+	stats, err = c.DetStats(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, stats)
+}
+
+func TestClamavClientDetStatsEmpty(t *testing.T) {
+	s := NewServer(network, listen, handlerDetStatsClear)
+	<-s.ready
+	defer s.Stop()
+
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
+	stats, err := c.DetStats(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, stats)
+}
+
+func TestClamavClientDetStatsClear(t *testing.T) {
+	// Start mock tcp server on random port and wait for it to be ready
+	s := NewServer(network, listen, handlerDetStatsClear)
+	<-s.ready
+
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
+	err := c.DetStatsClear(context.Background())
+	assert.NoError(t, err)
+
+	// Stop mock tcp server
+	s.Stop()
+
+	// When the server is stopped
+	err = c.DetStatsClear(context.Background())
+	assert.Error(t, err)
+}
+
+func TestClamavClientDetStatsUnknownCommand(t *testing.T) {
+	// handlerPing replies with "PONG" to any command
+	s := NewServer(network, listen, handlerPing)
+	<-s.ready
+	defer s.Stop()
+
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
+	err := c.DetStatsClear(context.Background())
+	assert.ErrorIs(t, err, ErrUnexpectedResponse)
+
+	stats, err := c.DetStats(context.Background())
+	assert.ErrorIs(t, err, ErrParsingDetStats)
+	assert.Nil(t, stats)
+}
+
+func TestParseDetStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		resps   [][]byte
+		want    []DetStat
+		wantErr error
+	}{
+		{
+			name:  "empty",
+			resps: nil,
+			want:  []DetStat{},
+		},
+		{
+			name:  "single detection",
+			resps: [][]byte{[]byte(detStatsResp[0])},
+			want: []DetStat{
+				{
+					Time:      time.Unix(1688628578, 0).UTC(),
+					MD5:       "44d88612fea8a8f36de82e1278abb02f",
+					Size:      68,
+					Signature: "Win.Test.EICAR_HDB-1",
+					FileName:  "eicar.txt",
+				},
+			},
+		},
+		{
+			name:  "file name containing ':'",
+			resps: [][]byte{[]byte(detStatsResp[1])},
+			want: []DetStat{
+				{
+					Time:      time.Unix(1688628612, 0).UTC(),
+					MD5:       "e4968ef99266df7c9a1f0637d2389dab",
+					Size:      184,
+					Signature: "Eicar-Signature",
+					FileName:  `C:\eicar.com`,
+				},
+			},
+		},
+		{
+			name:    "unknown command",
+			resps:   [][]byte{RespErrUnknownCommand},
+			wantErr: ErrUnknownCommand,
+		},
+		{
+			name:    "missing fields",
+			resps:   [][]byte{[]byte("1688628578:44d88612fea8a8f36de82e1278abb02f:68")},
+			wantErr: ErrParsingDetStats,
+		},
+		{
+			name:    "invalid time",
+			resps:   [][]byte{[]byte("foo:44d88612fea8a8f36de82e1278abb02f:68:Eicar-Signature:eicar.txt")},
+			wantErr: ErrParsingDetStats,
+		},
+		{
+			name:    "invalid size",
+			resps:   [][]byte{[]byte("1688628578:44d88612fea8a8f36de82e1278abb02f:bar:Eicar-Signature:eicar.txt")},
+			wantErr: ErrParsingDetStats,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDetStats(tt.resps)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
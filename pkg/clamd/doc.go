@@ -0,0 +1,28 @@
+// Package clamd implements a client for the protocol of the Clamav daemon, Clamd.
+//
+// ClamavClient opens a new connection to Clamd for each command. It can be
+// wrapped by ClamavPoolClient to reuse long lived sessions, by ClamavBalancer
+// to spread the commands across several Clamd and by ClamavResilientClient to
+// retry the failing commands behind a circuit breaker. All of them implement
+// the Clamaver interface and honour the cancellation of the given context.
+//
+// Content is scanned by streaming it to Clamd with the "INSTREAM" command:
+//
+//	c := clamd.NewClamavClient("localhost:3310", "tcp", 5*time.Second, 5*time.Second)
+//
+//	result, err := clamd.ScanStream(ctx, c, f)
+//	if err != nil {
+//		return err
+//	}
+//	if result != nil {
+//		log.Printf("virus found: %s", result.Signature)
+//	}
+//
+// The raw responses of Clamd can be parsed into typed results with
+// ParseScanResult, ParseStats, ParseVersion or ParseVersionCommands.
+//
+// The errors returned by Clamd are reported by wrapping the exported
+// Err* errors, which can be checked with errors.Is.
+//
+// See https://linux.die.net/man/8/clamd for the description of the protocol.
+package clamd
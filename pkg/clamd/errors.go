@@ -1,4 +1,4 @@
-package clamav
+package clamd
 
 import "errors"
 
@@ -8,4 +8,9 @@ var (
 	ErrUnexpectedResponse        = errors.New("unexpected response from clamav")
 	ErrScanFileSizeLimitExceeded = errors.New("size limit exceeded")
 	ErrVirusFound                = errors.New("file contains potential virus")
+	ErrReadStream                = errors.New("error while reading the stream to scan")
 )
+
+// errStreamInterrupted is returned when the streaming of
+// the content to scan is stopped early because Clamd already replied.
+var errStreamInterrupted = errors.New("stream interrupted by clamd reply")
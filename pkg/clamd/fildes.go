@@ -0,0 +1,78 @@
+package clamd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// ErrFildesUnsupported is returned when file descriptors
+// can't be passed to Clamd.
+var ErrFildesUnsupported = errors.New("passing file descriptors is not supported")
+
+// fildesSupported returns whether the client can pass file descriptors
+// to Clamd, which is only possible over a unix domain socket.
+func (c *ClamavClient) fildesSupported() bool {
+	return c.network == "unix" && fildesAvailable
+}
+
+// ScanFile will scan the given file.
+//
+// When connected to Clamd over a unix domain socket, the file descriptor of f is passed
+// to Clamd with the "FILDES" command, so that Clamd reads the file directly instead of
+// receiving its content over the socket. Otherwise, the file is streamed from its beginning
+// with the "INSTREAM" command.
+//
+// It will read the response and return it as a byte slice as well as any error
+// encountered.
+//
+// See https://linux.die.net/man/8/clamd for a detailed explanation of the FILDES command.
+func (c *ClamavClient) ScanFile(ctx context.Context, f *os.File) ([]byte, error) {
+	if !c.fildesSupported() {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrReadStream, err)
+		}
+		return c.InStream(ctx, f)
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error while dialing %s/%s: %w", c.network, c.address, err)
+	}
+	defer conn.Close()
+
+	// Unblock the reads and writes on the connection when the context is done
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, ErrFildesUnsupported
+	}
+
+	writer := bufio.NewWriter(conn)
+	_, err = writer.Write(CmdFildes)
+	if err != nil {
+		return nil, fmt.Errorf("error while writing command to %s/%s: %w", c.network, c.address, err)
+	}
+	writer.Flush()
+
+	err = sendFd(uc, f)
+	if err != nil {
+		return nil, fmt.Errorf("error while sending file descriptor to %s/%s: %w", c.network, c.address, err)
+	}
+
+	resp, err := c.readResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.parseInStreamResponse(resp)
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package clamd
+
+import (
+	"net"
+	"os"
+)
+
+const fildesAvailable = false
+
+// sendFd is not supported on this platform.
+func sendFd(conn *net.UnixConn, f *os.File) error {
+	return ErrFildesUnsupported
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package clamd
+
+import "net"
+
+// handlerFildes is not supported on this platform.
+func (s *ClamdMockTCPServer) handlerFildes(conn net.Conn) {
+	conn.Close()
+}
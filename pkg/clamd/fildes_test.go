@@ -0,0 +1,74 @@
+package clamd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFile(t *testing.T, content string) *os.File {
+	f, err := os.CreateTemp(t.TempDir(), "fildes-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+func TestClamavClientScanFileUnix(t *testing.T) {
+	if !fildesAvailable {
+		t.Skip("passing file descriptors is not supported on this platform")
+	}
+
+	// Start mock unix server and wait for it to be ready
+	s := NewServer("unix", filepath.Join(t.TempDir(), "clamd.sock"), handlerFildes)
+	<-s.ready
+
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+	assert.True(t, c.fildesSupported())
+
+	resp, err := c.ScanFile(context.Background(), newTestFile(t, goodFile))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(resp), ": OK"))
+
+	resp, err = c.ScanFile(context.Background(), newTestFile(t, badFile))
+	assert.ErrorIs(t, err, ErrVirusFound)
+	assert.Contains(t, string(resp), "Win.Test.EICAR_HDB-1 FOUND")
+
+	// Stop mock server
+	s.Stop()
+
+	// When the server is stopped
+	resp, err = c.ScanFile(context.Background(), newTestFile(t, goodFile))
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+}
+
+func TestClamavClientScanFileTCP(t *testing.T) {
+	// Falls back to INSTREAM over tcp
+	s := NewServer(network, listen, handlerInStreamBadFile)
+	<-s.ready
+
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+	assert.False(t, c.fildesSupported())
+
+	// The file is streamed from its beginning, whatever its current offset
+	f := newTestFile(t, badFile)
+	resp, err := c.ScanFile(context.Background(), f)
+	assert.ErrorIs(t, err, ErrVirusFound)
+	assert.Contains(t, string(resp), "FOUND")
+
+	s.Stop()
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package clamd
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+const fildesAvailable = true
+
+// sendFd sends the file descriptor of f over conn
+// as ancillary data (SCM_RIGHTS).
+//
+// At least one byte of regular data must be sent along the ancillary data.
+func sendFd(conn *net.UnixConn, f *os.File) error {
+	rights := syscall.UnixRights(int(f.Fd()))
+
+	_, _, err := conn.WriteMsgUnix([]byte{'\000'}, rights, nil)
+	return err
+}
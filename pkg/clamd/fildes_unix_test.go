@@ -0,0 +1,51 @@
+//go:build unix
+
+package clamd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// handlerFildes mocks the "FILDES" command by receiving a file descriptor
+// and reading the file it refers to.
+func (s *ClamdMockTCPServer) handlerFildes(conn net.Conn) {
+	defer conn.Close()
+
+	s.readFromConnection(conn)
+
+	buf := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := conn.(*net.UnixConn).ReadMsgUnix(buf, oob)
+	if err != nil {
+		return
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		return
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		return
+	}
+
+	f := os.NewFile(uintptr(fds[0]), "fildes")
+	defer f.Close()
+
+	// Clamd reads the file from its beginning
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, 1<<20))
+	if err != nil {
+		return
+	}
+
+	if strings.Contains(string(data), "EICAR") {
+		fmt.Fprintf(conn, "fd[%d]: Win.Test.EICAR_HDB-1 FOUND\000", fds[0])
+	} else {
+		fmt.Fprintf(conn, "fd[%d]: OK\000", fds[0])
+	}
+}
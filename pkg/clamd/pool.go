@@ -0,0 +1,245 @@
+package clamd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ClamavPoolClient is a Clamaver keeping a pool of long lived
+// Clamd sessions open (see the "IDSESSION" command) instead of dialing a
+// new connection for each command.
+//
+// Commands are multiplexed over the sessions of the pool: a new session is opened
+// only when all the existing ones are busy and the pool is not full, otherwise
+// the least busy session is used.
+//
+// Commands which are not allowed within a session by Clamd (RELOAD,
+// VERSIONCOMMANDS, SHUTDOWN) or replying with several responses (SCAN,
+// CONTSCAN, MULTISCAN) are sent over a dedicated connection.
+type ClamavPoolClient struct {
+	client *ClamavClient
+
+	// Maximum number of sessions kept open
+	size int
+
+	// Duration after which an unused session is closed.
+	// It should be lower than the Clamd "IdleTimeout" setting
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	sessions []*session
+	closed   bool
+}
+
+var _ Clamaver = (*ClamavPoolClient)(nil)
+
+// ErrPoolClosed is returned when a command is sent
+// through a ClamavPoolClient which has been closed.
+var ErrPoolClosed = errors.New("clamd pool closed")
+
+func NewClamavPoolClient(client *ClamavClient, size int, idleTimeout time.Duration) *ClamavPoolClient {
+	if size < 1 {
+		size = 1
+	}
+
+	return &ClamavPoolClient{
+		client:      client,
+		size:        size,
+		idleTimeout: idleTimeout,
+	}
+}
+
+// acquire returns a session of the pool to send a command over.
+//
+// Broken and idle sessions are evicted from the pool beforehand.
+func (p *ClamavPoolClient) acquire(ctx context.Context) (*session, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+
+	p.evict()
+
+	var best *session
+	for _, s := range p.sessions {
+		if best == nil || s.inflight() < best.inflight() {
+			best = s
+		}
+	}
+
+	if best != nil && (best.inflight() == 0 || len(p.sessions) >= p.size) {
+		p.mu.Unlock()
+		return best, nil
+	}
+	defer p.mu.Unlock()
+
+	// Dialing while holding the lock ensures the pool never
+	// grows larger than its size
+	conn, err := p.client.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newSession(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error while opening session to %s/%s: %w", p.client.network, p.client.address, err)
+	}
+	p.sessions = append(p.sessions, s)
+
+	return s, nil
+}
+
+// evict removes the broken and idle sessions from the pool.
+// It must be called with p.mu held.
+func (p *ClamavPoolClient) evict() {
+	deadline := time.Now().Add(-p.idleTimeout)
+
+	sessions := p.sessions[:0]
+	for _, s := range p.sessions {
+		if s.broken() {
+			continue
+		}
+		if p.idleTimeout > 0 && s.idleSince(deadline) {
+			go s.close()
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	p.sessions = sessions
+}
+
+// command sends cmd over a session of the pool.
+//
+// Clamd closes the sessions which stayed idle for too long, hence if the session turns
+// out to be closed before any reply is received, the command is sent once again
+// over a new session.
+func (p *ClamavPoolClient) command(ctx context.Context, cmd ClamavCommand) ([]byte, error) {
+	var resp []byte
+	var err error
+
+	for i := 0; i < 2; i++ {
+		var s *session
+		s, err = p.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err = s.send(ctx, cmd, nil)
+		if !errors.Is(err, ErrSessionClosed) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while sending command: %w", err)
+	}
+
+	err = p.client.parseResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error from clamav: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (p *ClamavPoolClient) Ping(ctx context.Context) ([]byte, error) {
+	return p.command(ctx, CmdPing)
+}
+
+func (p *ClamavPoolClient) Version(ctx context.Context) ([]byte, error) {
+	return p.command(ctx, CmdVersion)
+}
+
+func (p *ClamavPoolClient) Stats(ctx context.Context) ([]byte, error) {
+	return p.command(ctx, CmdStats)
+}
+
+// Reload is not allowed within a session and is sent
+// over a dedicated connection.
+func (p *ClamavPoolClient) Reload(ctx context.Context) error {
+	return p.client.Reload(ctx)
+}
+
+// VersionCommands is not allowed within a session and is sent
+// over a dedicated connection.
+func (p *ClamavPoolClient) VersionCommands(ctx context.Context) ([]byte, error) {
+	return p.client.VersionCommands(ctx)
+}
+
+// Shutdown is not allowed within a session and is sent
+// over a dedicated connection.
+func (p *ClamavPoolClient) Shutdown(ctx context.Context) error {
+	return p.client.Shutdown(ctx)
+}
+
+// ScanPath replies with several responses, so it is sent
+// over a dedicated connection.
+func (p *ClamavPoolClient) ScanPath(ctx context.Context, path string, mode ScanMode) ([]ScanResult, error) {
+	return p.client.ScanPath(ctx, path, mode)
+}
+
+// DetStats replies with several responses, so it is sent
+// over a dedicated connection.
+func (p *ClamavPoolClient) DetStats(ctx context.Context) ([]DetStat, error) {
+	return p.client.DetStats(ctx)
+}
+
+func (p *ClamavPoolClient) DetStatsClear(ctx context.Context) error {
+	return p.client.DetStatsClear(ctx)
+}
+
+// ScanFile will pass the file descriptor of f to Clamd over a dedicated connection
+// when connected over a unix domain socket, otherwise the file is streamed over a
+// session of the pool.
+func (p *ClamavPoolClient) ScanFile(ctx context.Context, f *os.File) ([]byte, error) {
+	if p.client.fildesSupported() {
+		return p.client.ScanFile(ctx, f)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadStream, err)
+	}
+
+	return p.InStream(ctx, f)
+}
+
+// InStream will send the "INSTREAM" command over a session of the pool
+// and stream the given io.Reader to let Clamd scan it.
+func (p *ClamavPoolClient) InStream(ctx context.Context, r io.Reader) ([]byte, error) {
+	s, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.inStream(ctx, r, p.client.chunkSize)
+	if err != nil {
+		if errors.Is(err, ErrReadStream) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error while streaming content to %s/%s: %w", p.client.network, p.client.address, err)
+	}
+
+	return p.client.parseInStreamResponse(resp)
+}
+
+// Close ends all the sessions of the pool.
+// The pool can't be used afterwards.
+func (p *ClamavPoolClient) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	sessions := p.sessions
+	p.sessions = nil
+	p.mu.Unlock()
+
+	for _, s := range sessions {
+		s.close()
+	}
+
+	return nil
+}
@@ -0,0 +1,318 @@
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// handlerSession mocks a Clamd session opened with
+// the "IDSESSION" command.
+//
+// Every command received within the session is answered
+// with its request id, until "END" is received.
+func (s *ClamdMockTCPServer) handlerSession(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	cmd, err := reader.ReadBytes('\000')
+	if err != nil || !bytes.Equal(cmd, CmdIDSession) {
+		fmt.Fprint(conn, "UNKNOWN COMMAND\000")
+		return
+	}
+
+	var wmu sync.Mutex
+	for id := 1; ; id++ {
+		cmd, err := reader.ReadBytes('\000')
+		if err != nil {
+			return
+		}
+
+		var resp string
+		switch {
+		case bytes.Equal(cmd, CmdPing):
+			resp = "PONG"
+		case bytes.Equal(cmd, CmdVersion):
+			resp = "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023"
+		case bytes.Equal(cmd, CmdStats):
+			resp = statsResp
+		case bytes.Equal(cmd, CmdInstream):
+			data, err := readChunks(reader)
+			if err != nil {
+				return
+			}
+			resp = "stream: OK"
+			if strings.Contains(string(data), "EICAR") {
+				resp = "stream: Win.Test.EICAR_HDB-1 FOUND"
+			}
+		case bytes.Equal(cmd, CmdEnd):
+			return
+		default:
+			resp = "UNKNOWN COMMAND"
+		}
+
+		// Replying asynchronously, as Clamd does
+		go func(id int, resp string) {
+			wmu.Lock()
+			defer wmu.Unlock()
+			fmt.Fprintf(conn, "%d: %s\000", id, resp)
+		}(id, resp)
+	}
+}
+
+func newTestPoolClient(s *ClamdMockTCPServer, size int, idleTimeout time.Duration) *ClamavPoolClient {
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
+	return NewClamavPoolClient(c, size, idleTimeout)
+}
+
+func TestNewClamavPoolClient(t *testing.T) {
+	c := NewClamavClient("127.0.0.1:3310", "tcp", time.Second, time.Second)
+
+	p := NewClamavPoolClient(c, 0, time.Second)
+	assert.Equal(t, 1, p.size)
+	assert.Equal(t, time.Second, p.idleTimeout)
+	assert.Equal(t, c, p.client)
+
+	p = NewClamavPoolClient(c, 10, 0)
+	assert.Equal(t, 10, p.size)
+	assert.Equal(t, time.Duration(0), p.idleTimeout)
+}
+
+func TestClamavPoolClientCommands(t *testing.T) {
+	s := NewServer(network, listen, handlerSession)
+	<-s.ready
+
+	p := newTestPoolClient(s, 1, time.Minute)
+
+	resp, err := p.Ping(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(RespPing), resp)
+
+	resp, err = p.Version(context.Background())
+	assert.NoError(t, err)
+	assert.Contains(t, string(resp), "ClamAV")
+
+	resp, err = p.Stats(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, statsResp, string(resp))
+
+	resp, err = p.InStream(context.Background(), strings.NewReader(goodFile))
+	assert.NoError(t, err)
+	assert.EqualValues(t, RespScan, resp)
+
+	resp, err = p.InStream(context.Background(), strings.NewReader(badFile))
+	assert.ErrorIs(t, err, ErrVirusFound)
+	assert.True(t, bytes.Contains(resp, []byte("FOUND")))
+
+	// All the commands went through the same session
+	assert.EqualValues(t, 1, s.accepted.Load())
+
+	p.Close()
+	s.Stop()
+
+	_, err = p.Ping(context.Background())
+	assert.ErrorIs(t, err, ErrPoolClosed)
+}
+
+func TestClamavPoolClientConcurrency(t *testing.T) {
+	s := NewServer(network, listen, handlerSession)
+	<-s.ready
+
+	p := newTestPoolClient(s, 2, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			if i%2 == 0 {
+				resp, err := p.Ping(context.Background())
+				assert.NoError(t, err)
+				assert.Equal(t, []byte(RespPing), resp)
+			} else {
+				resp, err := p.InStream(context.Background(), strings.NewReader(goodFile))
+				assert.NoError(t, err)
+				assert.EqualValues(t, RespScan, resp)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, s.accepted.Load(), int32(2))
+
+	p.Close()
+	s.Stop()
+}
+
+func TestClamavPoolClientBrokenSession(t *testing.T) {
+	s := NewServer(network, listen, handlerSession)
+	<-s.ready
+
+	p := newTestPoolClient(s, 1, time.Minute)
+
+	_, err := p.Ping(context.Background())
+	assert.NoError(t, err)
+
+	// Simulate Clamd closing the session
+	p.mu.Lock()
+	p.sessions[0].conn.Close()
+	p.mu.Unlock()
+
+	// A new session is opened transparently
+	resp, err := p.Ping(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(RespPing), resp)
+	assert.EqualValues(t, 2, s.accepted.Load())
+
+	p.Close()
+	s.Stop()
+}
+
+// blockingReader returns some data, then blocks until
+// unblock is closed and fails with err.
+type blockingReader struct {
+	read    bool
+	reading chan struct{}
+	unblock chan struct{}
+	err     error
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	if !r.read {
+		r.read = true
+		close(r.reading)
+		return copy(p, "foo"), nil
+	}
+	<-r.unblock
+	return 0, r.err
+}
+
+func TestClamavPoolClientFailedRequest(t *testing.T) {
+	s := NewServer(network, listen, handlerSession)
+	<-s.ready
+
+	p := newTestPoolClient(s, 1, time.Minute)
+
+	r := &blockingReader{reading: make(chan struct{}), unblock: make(chan struct{}), err: errors.New("foo")}
+
+	streamErr := make(chan error)
+	go func() {
+		_, err := p.InStream(context.Background(), r)
+		streamErr <- err
+	}()
+	<-r.reading
+
+	// Another request waiting for the session while
+	// the stream of the first one is being written
+	pingErr := make(chan error)
+	go func() {
+		resp, err := p.Ping(context.Background())
+		assert.Equal(t, []byte(RespPing), resp)
+		pingErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	close(r.unblock)
+
+	// The error of the stream is only returned to its own request
+	err := <-streamErr
+	assert.ErrorIs(t, err, ErrReadStream)
+	assert.ErrorIs(t, err, r.err)
+
+	// The other request is told the session is closed and is sent again
+	assert.NoError(t, <-pingErr)
+	assert.EqualValues(t, 2, s.accepted.Load())
+
+	p.Close()
+	s.Stop()
+}
+
+func TestClamavPoolClientIdleTimeout(t *testing.T) {
+	s := NewServer(network, listen, handlerSession)
+	<-s.ready
+
+	p := newTestPoolClient(s, 1, 10*time.Millisecond)
+
+	_, err := p.Ping(context.Background())
+	assert.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+
+	// The idle session is evicted and a new one is opened
+	_, err = p.Ping(context.Background())
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, s.accepted.Load())
+
+	p.Close()
+	s.Stop()
+}
+
+func TestClamavPoolClientServerStopped(t *testing.T) {
+	s := NewServer(network, listen, handlerSession)
+	<-s.ready
+
+	p := newTestPoolClient(s, 1, time.Minute)
+	s.Stop()
+
+	resp, err := p.Ping(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+}
+
+func TestParseSessionReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    []byte
+		id      int
+		resp    []byte
+		wantErr bool
+	}{
+		{
+			name: "PONG",
+			line: []byte("1: PONG"),
+			id:   1,
+			resp: []byte("PONG"),
+		},
+		{
+			name: "stream: OK",
+			line: []byte("42: stream: OK"),
+			id:   42,
+			resp: []byte("stream: OK"),
+		},
+		{
+			name:    "no id",
+			line:    []byte("PONG"),
+			wantErr: true,
+		},
+		{
+			name:    "invalid id",
+			line:    []byte("foo: PONG"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, resp, err := parseSessionReply(tt.line)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrUnknownResponse)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.id, id)
+			assert.Equal(t, tt.resp, resp)
+		})
+	}
+}
@@ -1,4 +1,4 @@
-package clamav
+package clamd
 
 // The ClamavResponse represents Clamd responses
 // to commands over a tcp connection.
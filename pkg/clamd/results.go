@@ -0,0 +1,67 @@
+package clamd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseScanResult will parse a response to a scanning command
+// reporting a detection into a ScanResult.
+//
+// Examples of response:
+//
+// stream: Win.Test.EICAR_HDB-1 FOUND
+//
+// /data/eicar.txt: Win.Test.EICAR_HDB-1 FOUND
+func ParseScanResult(resp []byte) (*ScanResult, error) {
+	line := string(resp)
+
+	// The signature can't contain ": " but the path can
+	i := strings.LastIndex(line, ": ")
+	if i < 0 || !strings.HasSuffix(line, " FOUND") {
+		return nil, fmt.Errorf("error from clamav: %w: %q", ErrUnknownResponse, line)
+	}
+
+	return &ScanResult{
+		Path:      line[:i],
+		Signature: strings.TrimSuffix(line[i+2:], " FOUND"),
+	}, nil
+}
+
+// ScanStream streams r to Clamd with the "INSTREAM" command and returns
+// the detection reported by Clamd. It returns a nil ScanResult when
+// no virus is found.
+func ScanStream(ctx context.Context, c Clamaver, r io.Reader) (*ScanResult, error) {
+	resp, err := c.InStream(ctx, r)
+	if errors.Is(err, ErrVirusFound) {
+		return ParseScanResult(resp)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// GetStats sends the "STATS" command with c and parses the response.
+func GetStats(ctx context.Context, c Clamaver) (*Stats, error) {
+	resp, err := c.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseStats(resp)
+}
+
+// GetVersion sends the "VERSION" command with c and parses the response.
+func GetVersion(ctx context.Context, c Clamaver) (*Version, error) {
+	resp, err := c.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseVersion(resp)
+}
@@ -0,0 +1,95 @@
+package clamd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// versionClamaver is a Clamaver replying to the "VERSION" command with version.
+type versionClamaver struct {
+	Clamaver
+
+	version string
+}
+
+func (v *versionClamaver) Version(ctx context.Context) ([]byte, error) {
+	return []byte(v.version), nil
+}
+
+func TestParseScanResult(t *testing.T) {
+	result, err := ParseScanResult([]byte("stream: Win.Test.EICAR_HDB-1 FOUND"))
+	assert.NoError(t, err)
+	assert.Equal(t, &ScanResult{Path: "stream", Signature: "Win.Test.EICAR_HDB-1"}, result)
+
+	result, err = ParseScanResult([]byte("/data/foo: bar.txt: Eicar-Signature FOUND"))
+	assert.NoError(t, err)
+	assert.Equal(t, &ScanResult{Path: "/data/foo: bar.txt", Signature: "Eicar-Signature"}, result)
+
+	for _, invalid := range []string{"", "stream: OK", "Eicar-Signature FOUND"} {
+		_, err = ParseScanResult([]byte(invalid))
+		assert.ErrorIs(t, err, ErrUnknownResponse)
+	}
+}
+
+func TestScanStream(t *testing.T) {
+	s := NewServer(network, listen, handlerInStreamGoodFile)
+	<-s.ready
+
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
+	result, err := ScanStream(context.Background(), c, strings.NewReader(goodFile))
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+	s.Stop()
+
+	s = NewServer(network, listen, handlerInStreamBadFile)
+	<-s.ready
+
+	c = NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
+	result, err = ScanStream(context.Background(), c, strings.NewReader(badFile))
+	assert.NoError(t, err)
+	assert.Equal(t, &ScanResult{Path: "stream", Signature: "Win.Test.EICAR_HDB-1"}, result)
+	s.Stop()
+
+	// When the server is stopped
+	result, err = ScanStream(context.Background(), c, strings.NewReader(badFile))
+	assert.Error(t, err)
+	assert.Nil(t, result)
+}
+
+func TestGetStats(t *testing.T) {
+	s := NewServer(network, listen, handlerStats)
+	<-s.ready
+
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
+	stats, err := GetStats(context.Background(), c)
+	assert.NoError(t, err)
+	assert.Equal(t, "VALID PRIMARY", stats.State)
+	assert.Equal(t, 10, stats.Threads.Max)
+	s.Stop()
+
+	// When the server is stopped
+	stats, err = GetStats(context.Background(), c)
+	assert.Error(t, err)
+	assert.Nil(t, stats)
+}
+
+func TestGetVersion(t *testing.T) {
+	v, err := GetVersion(context.Background(), &versionClamaver{version: "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.1", v.Engine)
+	assert.Equal(t, 26961, v.Database)
+	assert.Equal(t, time.Date(2023, time.July, 6, 7, 29, 38, 0, time.UTC), v.DatabaseTime)
+
+	_, err = GetVersion(context.Background(), &versionClamaver{version: "PONG"})
+	assert.ErrorIs(t, err, ErrParsingVersion)
+}
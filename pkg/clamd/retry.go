@@ -0,0 +1,198 @@
+package clamd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// RetryPolicy defines how the commands failing to reach
+// Clamd are sent again.
+type RetryPolicy struct {
+	// Maximum number of times a command is sent, including the first one.
+	// 1 or less disables the retries
+	MaxAttempts int
+
+	// Duration waited before the first retry. It is multiplied
+	// by Multiplier before each subsequent retry
+	InitialBackoff time.Duration
+
+	// Maximum duration waited between two attempts
+	MaxBackoff time.Duration
+
+	// Factor applied to the backoff after each retry.
+	// Defaults to 2 when lower than 1
+	Multiplier float64
+}
+
+// backoff returns the duration to wait after the given attempt failed.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= multiplier
+		if p.MaxBackoff > 0 && d >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+
+	return time.Duration(d)
+}
+
+// ClamavResilientClient is a Clamaver decorating another Clamaver
+// with a retry policy and a circuit breaker.
+//
+// The idempotent commands failing to reach Clamd are retried with an exponential
+// backoff. The streams of "INSTREAM" are retried only when they can be replayed,
+// that is when the io.Reader is also an io.Seeker. "SHUTDOWN" is never retried.
+//
+// All the commands go through the circuit breaker, if any: they fail fast
+// with a *CircuitOpenError while it is open, and are not retried anymore.
+type ClamavResilientClient struct {
+	clamav  Clamaver
+	policy  RetryPolicy
+	breaker *CircuitBreaker
+}
+
+var _ Clamaver = (*ClamavResilientClient)(nil)
+
+// NewClamavResilientClient returns a ClamavResilientClient sending the
+// commands to c. The circuit breaker is disabled when breaker is nil.
+func NewClamavResilientClient(c Clamaver, policy RetryPolicy, breaker *CircuitBreaker) *ClamavResilientClient {
+	return &ClamavResilientClient{
+		clamav:  c,
+		policy:  policy,
+		breaker: breaker,
+	}
+}
+
+// Breaker returns the circuit breaker of the client, if any.
+func (c *ClamavResilientClient) Breaker() *CircuitBreaker {
+	return c.breaker
+}
+
+// call sends a command through the circuit breaker with fn, and sends it again
+// according to the retry policy when it is retryable and fails to reach Clamd.
+//
+// rewind, if not nil, is called before each retry to replay the command.
+func call[T any](ctx context.Context, c *ClamavResilientClient, retryable bool, rewind func() error, fn func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		if c.breaker != nil {
+			if err := c.breaker.Allow(); err != nil {
+				var zero T
+				return zero, err
+			}
+		}
+
+		resp, err := fn()
+
+		if c.breaker != nil {
+			if ctx.Err() != nil {
+				// The deadline of the connection was altered by the context
+				c.breaker.Record(ctx.Err())
+			} else {
+				c.breaker.Record(err)
+			}
+		}
+
+		if !retryable || attempt >= c.policy.MaxAttempts || !isClamdFailure(err) {
+			return resp, err
+		}
+
+		t := time.NewTimer(c.policy.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return resp, err
+		case <-t.C:
+		}
+
+		if rewind != nil {
+			if rerr := rewind(); rerr != nil {
+				return resp, err
+			}
+		}
+	}
+}
+
+// exec is call for the commands returning only an error.
+func exec(ctx context.Context, c *ClamavResilientClient, retryable bool, fn func() error) error {
+	_, err := call(ctx, c, retryable, nil, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
+
+func (c *ClamavResilientClient) Ping(ctx context.Context) ([]byte, error) {
+	return call(ctx, c, true, nil, func() ([]byte, error) { return c.clamav.Ping(ctx) })
+}
+
+func (c *ClamavResilientClient) Version(ctx context.Context) ([]byte, error) {
+	return call(ctx, c, true, nil, func() ([]byte, error) { return c.clamav.Version(ctx) })
+}
+
+func (c *ClamavResilientClient) Reload(ctx context.Context) error {
+	return exec(ctx, c, true, func() error { return c.clamav.Reload(ctx) })
+}
+
+func (c *ClamavResilientClient) Stats(ctx context.Context) ([]byte, error) {
+	return call(ctx, c, true, nil, func() ([]byte, error) { return c.clamav.Stats(ctx) })
+}
+
+func (c *ClamavResilientClient) VersionCommands(ctx context.Context) ([]byte, error) {
+	return call(ctx, c, true, nil, func() ([]byte, error) { return c.clamav.VersionCommands(ctx) })
+}
+
+// Shutdown is never retried.
+func (c *ClamavResilientClient) Shutdown(ctx context.Context) error {
+	return exec(ctx, c, false, func() error { return c.clamav.Shutdown(ctx) })
+}
+
+// InStream is retried only when r is an io.Seeker, by
+// rewinding it to its offset at the time of the call.
+func (c *ClamavResilientClient) InStream(ctx context.Context, r io.Reader) ([]byte, error) {
+	var rewind func() error
+
+	if seeker, ok := r.(io.Seeker); ok {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			rewind = func() error {
+				if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+					return fmt.Errorf("%w: %w", ErrReadStream, err)
+				}
+				return nil
+			}
+		}
+	}
+
+	return call(ctx, c, rewind != nil, rewind, func() ([]byte, error) { return c.clamav.InStream(ctx, r) })
+}
+
+func (c *ClamavResilientClient) ScanPath(ctx context.Context, path string, mode ScanMode) ([]ScanResult, error) {
+	return call(ctx, c, true, nil, func() ([]ScanResult, error) { return c.clamav.ScanPath(ctx, path, mode) })
+}
+
+// ScanFile is retried by rewinding f to its beginning.
+func (c *ClamavResilientClient) ScanFile(ctx context.Context, f *os.File) ([]byte, error) {
+	rewind := func() error {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("%w: %w", ErrReadStream, err)
+		}
+		return nil
+	}
+
+	return call(ctx, c, true, rewind, func() ([]byte, error) { return c.clamav.ScanFile(ctx, f) })
+}
+
+func (c *ClamavResilientClient) DetStats(ctx context.Context) ([]DetStat, error) {
+	return call(ctx, c, true, nil, func() ([]DetStat, error) { return c.clamav.DetStats(ctx) })
+}
+
+func (c *ClamavResilientClient) DetStatsClear(ctx context.Context) error {
+	return exec(ctx, c, true, func() error { return c.clamav.DetStatsClear(ctx) })
+}
@@ -0,0 +1,152 @@
+package clamd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyClamaver is a Clamaver failing to reach Clamd
+// for the given number of calls.
+type flakyClamaver struct {
+	Clamaver
+
+	failures int
+	calls    int
+
+	// content read by InStream at each call
+	streams []string
+}
+
+var errFlaky = &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+
+func (f *flakyClamaver) fail() bool {
+	f.calls++
+	return f.calls <= f.failures
+}
+
+func (f *flakyClamaver) Ping(ctx context.Context) ([]byte, error) {
+	if f.fail() {
+		return nil, errFlaky
+	}
+	return RespPing, nil
+}
+
+func (f *flakyClamaver) Shutdown(ctx context.Context) error {
+	if f.fail() {
+		return errFlaky
+	}
+	return nil
+}
+
+func (f *flakyClamaver) InStream(ctx context.Context, r io.Reader) ([]byte, error) {
+	b, _ := io.ReadAll(r)
+	f.streams = append(f.streams, string(b))
+
+	if f.fail() {
+		return nil, errFlaky
+	}
+	return RespScan, nil
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}
+
+	assert.Equal(t, 100*time.Millisecond, p.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, p.backoff(2))
+	assert.Equal(t, 400*time.Millisecond, p.backoff(3))
+	assert.Equal(t, 800*time.Millisecond, p.backoff(4))
+	assert.Equal(t, time.Second, p.backoff(5))
+
+	p.Multiplier = 3
+	assert.Equal(t, 300*time.Millisecond, p.backoff(2))
+}
+
+func TestClamavResilientClientRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	f := &flakyClamaver{failures: 2}
+	c := NewClamavResilientClient(f, policy, nil)
+
+	resp, err := c.Ping(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(RespPing), resp)
+	assert.Equal(t, 3, f.calls)
+
+	// Giving up after MaxAttempts
+	f = &flakyClamaver{failures: 3}
+	c = NewClamavResilientClient(f, policy, nil)
+
+	_, err = c.Ping(context.Background())
+	assert.ErrorIs(t, err, errFlaky)
+	assert.Equal(t, 3, f.calls)
+
+	// Shutdown is never retried
+	f = &flakyClamaver{failures: 1}
+	c = NewClamavResilientClient(f, policy, nil)
+
+	err = c.Shutdown(context.Background())
+	assert.ErrorIs(t, err, errFlaky)
+	assert.Equal(t, 1, f.calls)
+}
+
+func TestClamavResilientClientInStreamReplay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	// A seekable stream is replayed from its initial offset
+	f := &flakyClamaver{failures: 1}
+	c := NewClamavResilientClient(f, policy, nil)
+
+	r := strings.NewReader("xxfoobar")
+	r.Seek(2, io.SeekStart)
+
+	resp, err := c.InStream(context.Background(), r)
+	assert.NoError(t, err)
+	assert.EqualValues(t, RespScan, resp)
+	assert.Equal(t, []string{"foobar", "foobar"}, f.streams)
+
+	// A stream which can't be replayed is not retried
+	f = &flakyClamaver{failures: 1}
+	c = NewClamavResilientClient(f, policy, nil)
+
+	_, err = c.InStream(context.Background(), io.LimitReader(strings.NewReader("foobar"), 6))
+	assert.ErrorIs(t, err, errFlaky)
+	assert.Equal(t, 1, f.calls)
+}
+
+func TestClamavResilientClientBreaker(t *testing.T) {
+	f := &flakyClamaver{failures: 10}
+	b := NewCircuitBreaker(2, time.Minute, nil)
+	c := NewClamavResilientClient(f, RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}, b)
+
+	// The retries stop as soon as the breaker opens
+	_, err := c.Ping(context.Background())
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, f.calls)
+	assert.Equal(t, b, c.Breaker())
+
+	_, err = c.Ping(context.Background())
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, f.calls)
+}
+
+func TestClamavResilientClientContextCancelled(t *testing.T) {
+	f := &flakyClamaver{failures: 10}
+	c := NewClamavResilientClient(f, RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := c.Ping(ctx)
+	assert.ErrorIs(t, err, errFlaky)
+	assert.Equal(t, 1, f.calls)
+}
@@ -0,0 +1,202 @@
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ScanMode represents the Clamd commands scanning
+// a file or a directory from the filesystem of the Clamd server.
+type ScanMode string
+
+const (
+	// ScanModeScan scans a file or a directory (recursively) and stops
+	// at the first virus found.
+	ScanModeScan ScanMode = "SCAN"
+
+	// ScanModeContScan scans a file or a directory (recursively) and doesn't
+	// stop the scanning when a virus is found.
+	ScanModeContScan ScanMode = "CONTSCAN"
+
+	// ScanModeMultiScan scans a file or a directory (recursively) in parallel
+	// using multiple threads.
+	ScanModeMultiScan ScanMode = "MULTISCAN"
+
+	// ScanModeAllMatch scans a file or a directory (recursively) and doesn't
+	// stop the scanning of a file when a virus is found, so that all the
+	// matching signatures are reported.
+	ScanModeAllMatch ScanMode = "ALLMATCHSCAN"
+)
+
+var (
+	ErrInvalidScanMode = errors.New("invalid scan mode")
+	ErrInvalidPath     = errors.New("invalid path")
+	ErrScanPath        = errors.New("error while scanning path")
+)
+
+// ScanResult represents a detection of a virus
+// by Clamd in a file, or a file Clamd couldn't scan.
+type ScanResult struct {
+	Path      string
+	Signature string
+
+	// Error reported by Clamd when the file couldn't be
+	// scanned, in which case Signature is empty
+	Error string
+}
+
+// ParseScanMode returns the ScanMode named by s.
+// It is case insensitive.
+func ParseScanMode(s string) (ScanMode, error) {
+	switch mode := ScanMode(strings.ToUpper(s)); mode {
+	case ScanModeScan, ScanModeContScan, ScanModeMultiScan, ScanModeAllMatch:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidScanMode, s)
+	}
+}
+
+// scanCommand returns the command scanning path with the given mode.
+//
+// ex: "zCONTSCAN /var/lib/data\000"
+func scanCommand(mode ScanMode, path string) (ClamavCommand, error) {
+	if _, err := ParseScanMode(string(mode)); err != nil {
+		return nil, err
+	}
+
+	// The null character delimits the command
+	if path == "" || strings.ContainsAny(path, "\000\n") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPath, path)
+	}
+
+	return []byte("z" + string(mode) + " " + path + "\000"), nil
+}
+
+// ScanPath will attempt to connect to Clamd and send one of the
+// "SCAN", "CONTSCAN", "MULTISCAN" or "ALLMATCHSCAN" command to scan the given path.
+//
+// The path must be visible from the Clamd server.
+//
+// Clamd replies with a line for each infected file, in the form "<path>: <signature> FOUND",
+// or with a single "<path>: OK" line when no virus is found. With "ALLMATCHSCAN", a line
+// is sent for each signature matching a file. The files which can't be read are reported
+// with a "<path>: <reason> ERROR" line, without stopping the scan of the others.
+// It returns a ScanResult for each detection or file which couldn't be scanned, and
+// any error encountered. When nothing but errors is reported, the path couldn't
+// be scanned at all and an error wrapping ErrScanPath is returned.
+//
+// See https://linux.die.net/man/8/clamd for a detailed explanation of the scanning commands.
+func (c *ClamavClient) ScanPath(ctx context.Context, path string, mode ScanMode) ([]ScanResult, error) {
+	cmd, err := scanCommand(mode, path)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Unblock the reads and writes on the connection when the context is done
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	writer := bufio.NewWriter(conn)
+	_, err = writer.Write(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error while writing command to %s/%s: %w", c.network, c.address, err)
+	}
+	writer.Flush()
+
+	resps, err := c.readResponses(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.parseScanResponses(resps)
+}
+
+// readResponses will read from the given io.Reader until io.EOF
+// and returns all the null-terminated responses read or any error encountered.
+func (c *ClamavClient) readResponses(r io.Reader) ([][]byte, error) {
+	reader := bufio.NewReader(r)
+
+	var resps [][]byte
+	for {
+		resp, err := reader.ReadBytes('\000')
+		if len(resp) > 0 {
+			resps = append(resps, bytes.TrimSuffix(resp, []byte("\000")))
+		}
+		if err == io.EOF {
+			return resps, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error while reading response from %s/%s: %w", c.network, c.address, err)
+		}
+	}
+}
+
+// parseScanResponses will parse the responses to a scanning command
+// into a ScanResult for each detection or file reported in error.
+//
+// Example of responses:
+//
+// /data/eicar.txt: Win.Test.EICAR_HDB-1 FOUND
+//
+// /data: OK
+//
+// /foo: lstat() failed: No such file or directory. ERROR
+func (c *ClamavClient) parseScanResponses(resps [][]byte) ([]ScanResult, error) {
+	if len(resps) == 0 {
+		return nil, fmt.Errorf("error from clamav: %w", ErrUnknownResponse)
+	}
+
+	results := make([]ScanResult, 0)
+	var errs []string
+	for _, resp := range resps {
+		if bytes.Equal(resp, RespErrUnknownCommand) {
+			return nil, fmt.Errorf("error from clamav: %w", ErrUnknownCommand)
+		}
+
+		line := string(resp)
+		switch {
+		case strings.HasSuffix(line, " ERROR"):
+			line = strings.TrimSuffix(line, " ERROR")
+			errs = append(errs, line)
+
+			// Unlike a signature, the reason may contain ": ",
+			// hence the path is assumed not to
+			i := strings.Index(line, ": ")
+			if i < 0 {
+				return nil, fmt.Errorf("error from clamav: %w: %q", ErrUnknownResponse, resp)
+			}
+			results = append(results, ScanResult{Path: line[:i], Error: line[i+2:]})
+		case strings.HasSuffix(line, ": OK"):
+			continue
+		case strings.HasSuffix(line, " FOUND"):
+			result, err := ParseScanResult(resp)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, *result)
+		default:
+			return nil, fmt.Errorf("error from clamav: %w: %q", ErrUnknownResponse, line)
+		}
+	}
+
+	// Nothing could be scanned
+	if len(errs) == len(resps) {
+		return nil, fmt.Errorf("%w: %s", ErrScanPath, strings.Join(errs, ", "))
+	}
+
+	return results, nil
+}
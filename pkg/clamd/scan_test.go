@@ -0,0 +1,207 @@
+package clamd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// handlerScanPath mocks the scanning commands.
+//
+// The replies depend on the scanned path:
+// "/clean" is clean, "/infected" contains two infected files,
+// "/multiple" is a file matching two signatures, "/partial"
+// contains an infected file and an unreadable one
+// and any other path doesn't exist.
+func (s *ClamdMockTCPServer) handlerScanPath(conn net.Conn) {
+	defer conn.Close()
+
+	msg, _ := s.readFromConnection(conn)
+
+	cmd := strings.TrimSuffix(string(msg), "\000")
+	i := strings.Index(cmd, " ")
+	if i < 0 {
+		fmt.Fprint(conn, "UNKNOWN COMMAND\000")
+		return
+	}
+
+	switch path := cmd[i+1:]; path {
+	case "/clean":
+		fmt.Fprintf(conn, "%s: OK\000", path)
+	case "/infected":
+		fmt.Fprintf(conn, "%s/eicar.txt: Win.Test.EICAR_HDB-1 FOUND\000", path)
+		fmt.Fprintf(conn, "%s/dir: name/eicar.com: Eicar-Signature FOUND\000", path)
+	case "/multiple":
+		fmt.Fprintf(conn, "%s: Win.Test.EICAR_HDB-1 FOUND\000", path)
+		fmt.Fprintf(conn, "%s: Eicar-Signature FOUND\000", path)
+	case "/partial":
+		fmt.Fprintf(conn, "%s/eicar.txt: Win.Test.EICAR_HDB-1 FOUND\000", path)
+		fmt.Fprintf(conn, "%s/secret: Can't open file or directory ERROR\000", path)
+	default:
+		fmt.Fprintf(conn, "%s: lstat() failed: No such file or directory. ERROR\000", path)
+	}
+}
+
+func TestParseScanMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    ScanMode
+		wantErr bool
+	}{
+		{name: "scan", s: "scan", want: ScanModeScan},
+		{name: "CONTSCAN", s: "CONTSCAN", want: ScanModeContScan},
+		{name: "MultiScan", s: "MultiScan", want: ScanModeMultiScan},
+		{name: "allmatchscan", s: "allmatchscan", want: ScanModeAllMatch},
+		{name: "empty", s: "", wantErr: true},
+		{name: "unknown", s: "instream", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScanMode(tt.s)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidScanMode)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestScanCommand(t *testing.T) {
+	cmd, err := scanCommand(ScanModeContScan, "/var/lib/data")
+	assert.NoError(t, err)
+	assert.Equal(t, ClamavCommand("zCONTSCAN /var/lib/data\000"), cmd)
+
+	cmd, err = scanCommand(ScanModeAllMatch, "/var/lib/data")
+	assert.NoError(t, err)
+	assert.Equal(t, ClamavCommand("zALLMATCHSCAN /var/lib/data\000"), cmd)
+
+	_, err = scanCommand(ScanMode("INSTREAM"), "/var/lib/data")
+	assert.ErrorIs(t, err, ErrInvalidScanMode)
+
+	_, err = scanCommand(ScanModeScan, "")
+	assert.ErrorIs(t, err, ErrInvalidPath)
+
+	_, err = scanCommand(ScanModeScan, "/foo\000zSHUTDOWN")
+	assert.ErrorIs(t, err, ErrInvalidPath)
+}
+
+func TestClamavClientScanPath(t *testing.T) {
+	// Start mock tcp server on random port and wait for it to be ready
+	s := NewServer(network, listen, handlerScanPath)
+	<-s.ready
+
+	c := NewClamavClient(s.listener.Addr().String(), s.listener.Addr().Network(),
+		time.Second, time.Second)
+
+	results, err := c.ScanPath(context.Background(), "/clean", ScanModeScan)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	results, err = c.ScanPath(context.Background(), "/infected", ScanModeContScan)
+	assert.NoError(t, err)
+	assert.Equal(t, []ScanResult{
+		{Path: "/infected/eicar.txt", Signature: "Win.Test.EICAR_HDB-1"},
+		{Path: "/infected/dir: name/eicar.com", Signature: "Eicar-Signature"},
+	}, results)
+
+	results, err = c.ScanPath(context.Background(), "/multiple", ScanModeAllMatch)
+	assert.NoError(t, err)
+	assert.Equal(t, []ScanResult{
+		{Path: "/multiple", Signature: "Win.Test.EICAR_HDB-1"},
+		{Path: "/multiple", Signature: "Eicar-Signature"},
+	}, results)
+
+	results, err = c.ScanPath(context.Background(), "/partial", ScanModeContScan)
+	assert.NoError(t, err)
+	assert.Equal(t, []ScanResult{
+		{Path: "/partial/eicar.txt", Signature: "Win.Test.EICAR_HDB-1"},
+		{Path: "/partial/secret", Error: "Can't open file or directory"},
+	}, results)
+
+	results, err = c.ScanPath(context.Background(), "/foo", ScanModeMultiScan)
+	assert.ErrorIs(t, err, ErrScanPath)
+	assert.Nil(t, results)
+
+	results, err = c.ScanPath(context.Background(), "/clean", ScanMode("FOO"))
+	assert.ErrorIs(t, err, ErrInvalidScanMode)
+	assert.Nil(t, results)
+
+	// Stop mock tcp server
+	s.Stop()
+
+	// When the server is stopped
+	results, err = c.ScanPath(context.Background(), "/clean", ScanModeScan)
+	assert.Error(t, err)
+	assert.Nil(t, results)
+}
+
+func TestClamavClientParseScanResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		resps   []string
+		want    []ScanResult
+		typeErr error
+	}{
+		{
+			name:    "no response",
+			resps:   nil,
+			typeErr: ErrUnknownResponse,
+		},
+		{
+			name:  "clean",
+			resps: []string{"/data: OK"},
+			want:  []ScanResult{},
+		},
+		{
+			name:  "infected",
+			resps: []string{"/data/a: Eicar FOUND", "/data/b: Eicar-2 FOUND"},
+			want:  []ScanResult{{Path: "/data/a", Signature: "Eicar"}, {Path: "/data/b", Signature: "Eicar-2"}},
+		},
+		{
+			name:    "error",
+			resps:   []string{"/data: Access denied. ERROR"},
+			typeErr: ErrScanPath,
+		},
+		{
+			name:  "partial errors",
+			resps: []string{"/data/a: Eicar FOUND", "/data/b: lstat() failed: Permission denied. ERROR", "/data: OK"},
+			want:  []ScanResult{{Path: "/data/a", Signature: "Eicar"}, {Path: "/data/b", Error: "lstat() failed: Permission denied."}},
+		},
+		{
+			name:    "unknown command",
+			resps:   []string{"UNKNOWN COMMAND"},
+			typeErr: ErrUnknownCommand,
+		},
+		{
+			name:    "unknown response",
+			resps:   []string{"foobar"},
+			typeErr: ErrUnknownResponse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ClamavClient{}
+
+			var resps [][]byte
+			for _, r := range tt.resps {
+				resps = append(resps, []byte(r))
+			}
+
+			got, err := c.parseScanResponses(resps)
+			if tt.typeErr != nil {
+				assert.ErrorIs(t, err, tt.typeErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSessionClosed is returned when a command is sent over a clamd session
+	// which has been closed, either by the client or by clamd itself.
+	ErrSessionClosed = errors.New("clamd session closed")
+)
+
+// session represents a long lived connection to Clamd opened with
+// the "IDSESSION" command.
+//
+// Within a session, several commands can be sent on the same socket without
+// waiting for the previous ones to complete. Clamd prefixes each reply with the
+// id of the request it answers to, in the form "<id>: <response>", ids being
+// assigned sequentially starting from 1 in the order the commands are received.
+//
+// See https://linux.die.net/man/8/clamd for a detailed explanation of the IDSESSION command.
+type session struct {
+	conn net.Conn
+
+	// wmu serializes the writes on the connection, so that a command and
+	// its payload are never interleaved with another command.
+	wmu    sync.Mutex
+	writer *bufio.Writer
+
+	mu       sync.Mutex
+	nextID   int
+	pending  map[int]*sessionRequest
+	lastUsed time.Time
+	err      error
+
+	done chan struct{}
+}
+
+// sessionRequest represents a command sent over a session
+// and waiting for its reply.
+type sessionRequest struct {
+	done chan struct{}
+	resp []byte
+	err  error
+}
+
+// newSession will send the "IDSESSION" command over conn
+// and start reading the replies sent by Clamd.
+func newSession(conn net.Conn) (*session, error) {
+	s := &session{
+		conn:     conn,
+		writer:   bufio.NewWriter(conn),
+		pending:  make(map[int]*sessionRequest),
+		lastUsed: time.Now(),
+		done:     make(chan struct{}),
+	}
+
+	if _, err := s.writer.Write(CmdIDSession); err != nil {
+		return nil, err
+	}
+	if err := s.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	go s.readLoop()
+
+	return s, nil
+}
+
+// readLoop reads the replies sent by Clamd and dispatches them
+// to the pending requests according to their id.
+//
+// When the connection is broken, all the pending requests are
+// failed and the session is marked as closed.
+func (s *session) readLoop() {
+	reader := bufio.NewReader(s.conn)
+
+	for {
+		line, err := reader.ReadBytes('\000')
+		if err != nil {
+			if err == io.EOF {
+				err = ErrSessionClosed
+			} else {
+				err = fmt.Errorf("%w: %w", ErrSessionClosed, err)
+			}
+			s.fail(err)
+			return
+		}
+
+		id, resp, err := parseSessionReply(bytes.TrimSuffix(line, []byte("\000")))
+		if err != nil {
+			s.fail(fmt.Errorf("%w: %w", ErrSessionClosed, err))
+			return
+		}
+
+		s.mu.Lock()
+		req, ok := s.pending[id]
+		delete(s.pending, id)
+		s.lastUsed = time.Now()
+		s.mu.Unlock()
+
+		// The request may have been abandoned by its caller
+		if ok {
+			req.resp = resp
+			close(req.done)
+		}
+	}
+}
+
+// fail marks the session as broken with err, closes the
+// underlying connection and fails all the pending requests.
+//
+// err must wrap ErrSessionClosed, so that the requests which didn't
+// cause the failure can be retried over another session.
+func (s *session) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return
+	}
+
+	s.err = err
+	for id, req := range s.pending {
+		req.err = err
+		close(req.done)
+		delete(s.pending, id)
+	}
+	close(s.done)
+	s.conn.Close()
+}
+
+// parseSessionReply splits a reply received within a session
+// into the request id and the actual response.
+//
+// Example of such reply: "1: PONG"
+func parseSessionReply(line []byte) (int, []byte, error) {
+	i := bytes.Index(line, []byte(": "))
+	if i < 0 {
+		return 0, nil, fmt.Errorf("%w: %q", ErrUnknownResponse, line)
+	}
+
+	id, err := strconv.Atoi(string(line[:i]))
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %q", ErrUnknownResponse, line)
+	}
+
+	return id, line[i+2:], nil
+}
+
+// send will send cmd over the session, followed by the payload written by
+// body if not nil, and wait for Clamd to reply.
+//
+// body is given a channel closed as soon as the reply to the command is received,
+// so that it can stop writing early.
+//
+// If the context is cancelled while the payload is being written, the
+// session is closed since its stream can't be trusted anymore.
+func (s *session) send(ctx context.Context, cmd []byte, body func(w *bufio.Writer, replied <-chan struct{}) error) ([]byte, error) {
+	req := &sessionRequest{done: make(chan struct{})}
+
+	s.wmu.Lock()
+
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		s.wmu.Unlock()
+		return nil, s.err
+	}
+	s.nextID++
+	id := s.nextID
+	s.pending[id] = req
+	s.lastUsed = time.Now()
+	s.mu.Unlock()
+
+	// Unblock the writes on the connection when the context is done
+	stop := context.AfterFunc(ctx, func() {
+		s.conn.SetWriteDeadline(time.Now())
+	})
+	err := s.write(cmd, body, req.done)
+	if !stop() && err == nil {
+		// The write deadline of the connection has been altered
+		err = ctx.Err()
+	}
+	s.wmu.Unlock()
+	if err != nil {
+		// The stream of the session is left in an inconsistent
+		// state, so it can't be used anymore. The other requests
+		// aren't at fault and are only told the session is closed:
+		// the cause is kept in the message but not in the chain, so
+		// that an ErrReadStream isn't mistaken for one of theirs.
+		s.fail(fmt.Errorf("%w: %v", ErrSessionClosed, err))
+		<-req.done
+		// Clamd may have replied before the end of the payload
+		if req.resp != nil {
+			return req.resp, nil
+		}
+		return nil, err
+	}
+
+	select {
+	case <-req.done:
+		return req.resp, req.err
+	case <-ctx.Done():
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (s *session) write(cmd []byte, body func(w *bufio.Writer, replied <-chan struct{}) error, replied <-chan struct{}) error {
+	if _, err := s.writer.Write(cmd); err != nil {
+		return err
+	}
+
+	if body != nil {
+		if err := body(s.writer, replied); err != nil {
+			return err
+		}
+	}
+
+	return s.writer.Flush()
+}
+
+// inStream sends the "INSTREAM" command over the session
+// and streams r in chunks of at most chunkSize bytes for Clamd to scan it.
+func (s *session) inStream(ctx context.Context, r io.Reader, chunkSize int) ([]byte, error) {
+	return s.send(ctx, CmdInstream, func(w *bufio.Writer, replied <-chan struct{}) error {
+		return writeChunks(w, r, chunkSize, replied)
+	})
+}
+
+// inflight returns the number of requests waiting for a reply.
+func (s *session) inflight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.pending)
+}
+
+// idleSince returns whether the session has no pending request and
+// has not been used since t.
+func (s *session) idleSince(t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.pending) == 0 && s.lastUsed.Before(t)
+}
+
+// broken returns whether the session has been closed.
+func (s *session) broken() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// close ends the session by sending the "END" command
+// and closes the underlying connection.
+func (s *session) close() {
+	s.wmu.Lock()
+	s.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	s.writer.Write(CmdEnd)
+	s.writer.Flush()
+	s.wmu.Unlock()
+
+	s.fail(ErrSessionClosed)
+}
@@ -0,0 +1,250 @@
+package clamd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrParsingStats = errors.New("error while parsing 'stats'")
+
+// Stats represents the statistics about the scan queue, contents
+// of the scan queue, and memory usage reported by the "STATS" command.
+type Stats struct {
+	Pools    int
+	State    string
+	Threads  ThreadStats
+	Queue    QueueStats
+	Memstats MemStats
+}
+
+// ThreadStats represents the "THREADS" section of the "STATS" command.
+type ThreadStats struct {
+	Live int
+	Idle int
+	Max  int
+
+	// Seconds after which an idle thread exits
+	IdleTimeout int
+}
+
+// QueueStats represents the "QUEUE" section of the "STATS" command.
+type QueueStats struct {
+	// Number of jobs waiting for a thread
+	Length int
+
+	// Jobs queued or being processed
+	Items []QueueItem
+}
+
+// QueueItem represents a job listed in the "QUEUE" section
+// of the "STATS" command.
+type QueueItem struct {
+	Command string
+
+	// Seconds elapsed since the job was queued
+	Age float64
+
+	// File being scanned, if any
+	File string
+}
+
+// MemStats represents the "MEMSTATS" section of the "STATS" command.
+//
+// All the sizes are in bytes. They are nil when reported as
+// "N/A" by Clamd, which happens on platforms without mallinfo().
+type MemStats struct {
+	Heap       *int64
+	Mmap       *int64
+	Used       *int64
+	Free       *int64
+	Releasable *int64
+	Pools      int
+	PoolsUsed  *int64
+	PoolsTotal *int64
+}
+
+// ParseStats will parse the response to a "STATS" command.
+//
+// Example of response:
+//
+// POOLS: 1
+//
+// STATE: VALID PRIMARY
+// THREADS: live 1  idle 0 max 10 idle-timeout 30
+// QUEUE: 0 items
+//
+//	STATS 0.000111
+//
+// MEMSTATS: heap N/A mmap N/A used N/A free N/A releasable N/A pools 1 pools_used 713.137M pools_total 713.226M
+// END
+//
+// It returns any error encountered.
+func ParseStats(s []byte) (*Stats, error) {
+	if len(s) == 0 {
+		return nil, fmt.Errorf("%w: empty response", ErrParsingStats)
+	}
+
+	var stats Stats
+	var err error
+	var inQueue bool
+
+	scanner := bufio.NewScanner(strings.NewReader(string(s)))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// The items of the queue are indented with a tab
+		if inQueue && strings.HasPrefix(line, "\t") {
+			item, err := parseQueueItem(line)
+			if err != nil {
+				return nil, err
+			}
+			stats.Queue.Items = append(stats.Queue.Items, item)
+			continue
+		}
+		inQueue = false
+
+		key, value, _ := strings.Cut(line, ": ")
+		switch key {
+		case "POOLS":
+			stats.Pools, err = strconv.Atoi(value)
+		case "STATE":
+			stats.State = value
+		case "THREADS":
+			stats.Threads, err = parseThreadStats(value)
+		case "QUEUE":
+			inQueue = true
+			stats.Queue.Items = make([]QueueItem, 0)
+			_, err = fmt.Sscanf(value, "%d items", &stats.Queue.Length)
+		case "MEMSTATS":
+			stats.Memstats, err = parseMemStats(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrParsingStats, line, err)
+		}
+	}
+
+	return &stats, nil
+}
+
+// parseThreadStats parses the "THREADS" section of the "STATS" command.
+//
+// Example: "live 1  idle 0 max 10 idle-timeout 30"
+func parseThreadStats(s string) (ThreadStats, error) {
+	var t ThreadStats
+
+	values, err := parseFields(s)
+	if err != nil {
+		return t, err
+	}
+
+	fields := map[string]*int{
+		"live":         &t.Live,
+		"idle":         &t.Idle,
+		"max":          &t.Max,
+		"idle-timeout": &t.IdleTimeout,
+	}
+	for name, v := range values {
+		if p, ok := fields[name]; ok {
+			if *p, err = strconv.Atoi(v); err != nil {
+				return t, err
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// parseQueueItem parses an item of the "QUEUE" section of the "STATS" command.
+//
+// Example: "\tSCAN 0.000217 /data/eicar.txt"
+func parseQueueItem(s string) (QueueItem, error) {
+	s = strings.TrimPrefix(s, "\t")
+
+	cmd, rest, _ := strings.Cut(s, " ")
+	age, file, _ := strings.Cut(rest, " ")
+
+	a, err := strconv.ParseFloat(age, 64)
+	if err != nil {
+		return QueueItem{}, fmt.Errorf("%w: %q: %v", ErrParsingStats, s, err)
+	}
+
+	return QueueItem{
+		Command: cmd,
+		Age:     a,
+		File:    strings.TrimSpace(file),
+	}, nil
+}
+
+// parseMemStats parses the "MEMSTATS" section of the "STATS" command.
+//
+// Example: "heap 3.656M mmap 0.129M used 3.012M free 0.644M releasable 0.127M pools 1 pools_used 565.577M pools_total 565.616M"
+func parseMemStats(s string) (MemStats, error) {
+	var m MemStats
+
+	values, err := parseFields(s)
+	if err != nil {
+		return m, err
+	}
+
+	sizes := map[string]**int64{
+		"heap":        &m.Heap,
+		"mmap":        &m.Mmap,
+		"used":        &m.Used,
+		"free":        &m.Free,
+		"releasable":  &m.Releasable,
+		"pools_used":  &m.PoolsUsed,
+		"pools_total": &m.PoolsTotal,
+	}
+	for name, v := range values {
+		if name == "pools" {
+			if m.Pools, err = strconv.Atoi(v); err != nil {
+				return m, err
+			}
+			continue
+		}
+
+		if p, ok := sizes[name]; ok {
+			if *p, err = parseMegabytes(v); err != nil {
+				return m, err
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// parseFields parses a list of space separated
+// "<name> <value>" pairs.
+func parseFields(s string) (map[string]string, error) {
+	fields := strings.Fields(s)
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("odd number of fields")
+	}
+
+	values := make(map[string]string, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		values[fields[i]] = fields[i+1]
+	}
+
+	return values, nil
+}
+
+// parseMegabytes parses a size in megabytes as reported by Clamd,
+// eg. "565.577M", into bytes. It returns nil for "N/A".
+func parseMegabytes(s string) (*int64, error) {
+	if s == "N/A" {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "M"), 64)
+	if err != nil {
+		return nil, err
+	}
+
+	b := int64(math.Round(f * 1024 * 1024))
+	return &b, nil
+}
@@ -0,0 +1,130 @@
+package clamd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestParseStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		stats   string
+		want    *Stats
+		wantErr bool
+	}{
+		{
+			name:  "memstats not available",
+			stats: statsResp,
+			want: &Stats{
+				Pools: 1,
+				State: "VALID PRIMARY",
+				Threads: ThreadStats{
+					Live:        1,
+					Idle:        0,
+					Max:         10,
+					IdleTimeout: 30,
+				},
+				Queue: QueueStats{
+					Length: 0,
+					Items: []QueueItem{
+						{Command: "STATS", Age: 0.000038},
+					},
+				},
+				Memstats: MemStats{
+					Pools:      1,
+					PoolsUsed:  int64Ptr(1370536018),
+					PoolsTotal: int64Ptr(1370586350),
+				},
+			},
+		},
+		{
+			name: "busy",
+			stats: `POOLS: 1
+
+STATE: VALID PRIMARY
+THREADS: live 3  idle 0 max 3 idle-timeout 30
+QUEUE: 2 items
+	SCAN 0.000217 /data/eicar.txt
+	INSTREAM 1.250000
+	STATS 0.000038
+
+MEMSTATS: heap 3.656M mmap 0.129M used 3.012M free 0.644M releasable 0.127M pools 1 pools_used 565.577M pools_total 565.616M
+END`,
+			want: &Stats{
+				Pools: 1,
+				State: "VALID PRIMARY",
+				Threads: ThreadStats{
+					Live:        3,
+					Idle:        0,
+					Max:         3,
+					IdleTimeout: 30,
+				},
+				Queue: QueueStats{
+					Length: 2,
+					Items: []QueueItem{
+						{Command: "SCAN", Age: 0.000217, File: "/data/eicar.txt"},
+						{Command: "INSTREAM", Age: 1.25},
+						{Command: "STATS", Age: 0.000038},
+					},
+				},
+				Memstats: MemStats{
+					Heap:       int64Ptr(3833594),
+					Mmap:       int64Ptr(135266),
+					Used:       int64Ptr(3158311),
+					Free:       int64Ptr(675283),
+					Releasable: int64Ptr(133169),
+					Pools:      1,
+					PoolsUsed:  int64Ptr(593050468),
+					PoolsTotal: int64Ptr(593091363),
+				},
+			},
+		},
+		{
+			name:    "empty",
+			stats:   "",
+			wantErr: true,
+		},
+		{
+			name:    "invalid pools",
+			stats:   "POOLS: foo",
+			wantErr: true,
+		},
+		{
+			name:    "invalid threads",
+			stats:   "THREADS: live foo",
+			wantErr: true,
+		},
+		{
+			name:    "invalid queue length",
+			stats:   "QUEUE: foo items",
+			wantErr: true,
+		},
+		{
+			name:    "invalid queue item",
+			stats:   "QUEUE: 0 items\n\tSTATS foo",
+			wantErr: true,
+		},
+		{
+			name:    "invalid memstats",
+			stats:   "MEMSTATS: heap fooM",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStats([]byte(tt.stats))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrParsingStats)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package clamd
+
+import (
+	"context"
+	"sync"
+)
+
+// BackendTrace records the backend a ClamavBalancer sent a command to,
+// along with the version of Clamd the backend was known to run when the
+// command was sent, eg. to tell which signature database made a verdict.
+//
+// When a command is retried, the last backend it was sent to is recorded.
+// It is safe for concurrent use.
+type BackendTrace struct {
+	mu      sync.Mutex
+	name    string
+	version *Version
+}
+
+type backendTraceKey struct{}
+
+// WithBackendTrace returns a copy of ctx carrying t. The commands sent
+// with the returned context through a ClamavBalancer are recorded in t.
+func WithBackendTrace(ctx context.Context, t *BackendTrace) context.Context {
+	return context.WithValue(ctx, backendTraceKey{}, t)
+}
+
+// traceBackend records backend in the BackendTrace carried by ctx, if any.
+func traceBackend(ctx context.Context, backend *Backend) {
+	t, ok := ctx.Value(backendTraceKey{}).(*BackendTrace)
+	if !ok || t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.name = backend.Name
+	t.version = backend.Version()
+	t.mu.Unlock()
+}
+
+// Backend returns the name of the backend recorded, empty if no command
+// was sent through a ClamavBalancer, and its version if known.
+func (t *BackendTrace) Backend() (string, *Version) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.name, t.version
+}
@@ -0,0 +1,80 @@
+package clamd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrParsingVersion = errors.New("error while parsing 'version'")
+
+// Version represents the response to the "VERSION" command.
+type Version struct {
+	// Version of the Clamav engine, eg. "1.0.1"
+	Engine string
+
+	// Version of the signature database, 0 if not loaded
+	Database int
+
+	// Build time of the signature database, zero if not loaded
+	DatabaseTime time.Time
+}
+
+// ParseVersion will parse the response to a "VERSION" command,
+// in the form "ClamAV <engine>/<database>/<database build time>".
+//
+// The database build time is formatted by Clamd like time.ANSIC, without any
+// time zone: it is assumed to be UTC.
+//
+// Example of response:
+//
+// ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023
+//
+// The database parts are missing when Clamd runs without signature database.
+func ParseVersion(b []byte) (*Version, error) {
+	s := strings.TrimSpace(string(b))
+
+	rest, ok := strings.CutPrefix(s, "ClamAV ")
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrParsingVersion, s)
+	}
+
+	parts := strings.SplitN(rest, "/", 3)
+
+	v := &Version{Engine: parts[0]}
+	if v.Engine == "" {
+		return nil, fmt.Errorf("%w: %q", ErrParsingVersion, s)
+	}
+
+	if len(parts) == 1 {
+		return v, nil
+	}
+
+	db, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrParsingVersion, s, err)
+	}
+	v.Database = db
+
+	if len(parts) == 3 {
+		t, err := time.Parse(time.ANSIC, parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrParsingVersion, s, err)
+		}
+		v.DatabaseTime = t
+	}
+
+	return v, nil
+}
+
+// DatabaseAge returns the time elapsed between the build of
+// the signature database and now. It returns 0 if unknown.
+func (v *Version) DatabaseAge(now time.Time) time.Duration {
+	if v.DatabaseTime.IsZero() {
+		return 0
+	}
+
+	return now.Sub(v.DatabaseTime)
+}
@@ -0,0 +1,93 @@
+package clamd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    *Version
+		wantErr bool
+	}{
+		{
+			name:    "complete",
+			version: "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023",
+			want: &Version{
+				Engine:       "1.0.1",
+				Database:     26961,
+				DatabaseTime: time.Date(2023, time.July, 6, 7, 29, 38, 0, time.UTC),
+			},
+		},
+		{
+			name:    "two digits day",
+			version: "ClamAV 1.0.0/26804/Mon Feb 16 08:47:07 2023\n",
+			want: &Version{
+				Engine:       "1.0.0",
+				Database:     26804,
+				DatabaseTime: time.Date(2023, time.February, 16, 8, 47, 7, 0, time.UTC),
+			},
+		},
+		{
+			name:    "no database",
+			version: "ClamAV 0.103.8",
+			want: &Version{
+				Engine: "0.103.8",
+			},
+		},
+		{
+			name:    "database without time",
+			version: "ClamAV 0.103.8/26961",
+			want: &Version{
+				Engine:   "0.103.8",
+				Database: 26961,
+			},
+		},
+		{
+			name:    "not clamav",
+			version: "PONG",
+			wantErr: true,
+		},
+		{
+			name:    "empty engine",
+			version: "ClamAV /26961/Thu Jul  6 07:29:38 2023",
+			wantErr: true,
+		},
+		{
+			name:    "invalid database",
+			version: "ClamAV 1.0.1/foo/Thu Jul  6 07:29:38 2023",
+			wantErr: true,
+		},
+		{
+			name:    "invalid time",
+			version: "ClamAV 1.0.1/26961/yesterday",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVersion([]byte(tt.version))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrParsingVersion)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestVersionDatabaseAge(t *testing.T) {
+	v := &Version{
+		DatabaseTime: time.Date(2023, time.July, 6, 7, 29, 38, 0, time.UTC),
+	}
+	assert.Equal(t, 26*time.Hour, v.DatabaseAge(time.Date(2023, time.July, 7, 9, 29, 38, 0, time.UTC)))
+
+	v = &Version{Engine: "1.0.1"}
+	assert.Equal(t, time.Duration(0), v.DatabaseAge(time.Now()))
+}
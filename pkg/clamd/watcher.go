@@ -0,0 +1,121 @@
+package clamd
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VersionWatcher keeps track of the version of Clamd and of its signature
+// database, as returned by the "VERSION" command, to tell when the
+// database was updated.
+type VersionWatcher struct {
+	clamav   Clamaver
+	interval time.Duration
+	onChange func(from, to string)
+
+	mu      sync.RWMutex
+	raw     string
+	version *Version
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewVersionWatcher returns a VersionWatcher sending the "VERSION" command
+// with c. When interval is greater than 0, the version is refreshed at this
+// interval until Close is called.
+//
+// onChange, if not nil, is called with the previous and the new version
+// whenever a refresh returns a different signature database version, but
+// not on the first one.
+func NewVersionWatcher(c Clamaver, interval time.Duration, onChange func(from, to string)) *VersionWatcher {
+	w := &VersionWatcher{
+		clamav:   c,
+		interval: interval,
+		onChange: onChange,
+		stop:     make(chan struct{}),
+	}
+
+	if interval > 0 {
+		w.wg.Add(1)
+		go w.refreshLoop()
+	}
+
+	return w
+}
+
+// refreshLoop refreshes the version every w.interval until the watcher is closed.
+func (w *VersionWatcher) refreshLoop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), w.interval)
+			// On failure, the previous version is kept
+			w.Refresh(ctx)
+			cancel()
+		}
+	}
+}
+
+// Refresh sends the "VERSION" command and records the version of Clamd.
+// Only a change of the version of the signature database is reported to
+// onChange, not of the engine.
+//
+// On failure, the previously recorded version is kept.
+func (w *VersionWatcher) Refresh(ctx context.Context) error {
+	resp, err := w.clamav.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	v, err := ParseVersion(resp)
+	if err != nil {
+		return err
+	}
+	raw := strings.TrimSpace(string(resp))
+
+	w.mu.Lock()
+	from, prev := w.raw, w.version
+	w.raw = raw
+	w.version = v
+	w.mu.Unlock()
+
+	if prev != nil && prev.Database != v.Database && w.onChange != nil {
+		w.onChange(from, raw)
+	}
+
+	return nil
+}
+
+// Version returns the last version recorded, nil if it was never refreshed successfully.
+func (w *VersionWatcher) Version() *Version {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.version == nil {
+		return nil
+	}
+	v := *w.version
+	return &v
+}
+
+// Close stops the periodic refreshes of the version.
+func (w *VersionWatcher) Close() error {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+	w.wg.Wait()
+
+	return nil
+}
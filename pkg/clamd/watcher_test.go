@@ -0,0 +1,111 @@
+package clamd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// watchedClamaver is a Clamaver whose "VERSION" command returns version.
+type watchedClamaver struct {
+	Clamaver
+
+	mu      sync.Mutex
+	version string
+	err     error
+}
+
+func (f *watchedClamaver) Version(ctx context.Context) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []byte(f.version + "\n"), nil
+}
+
+func (f *watchedClamaver) set(version string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.version = version
+	f.err = err
+}
+
+func TestVersionWatcher(t *testing.T) {
+	c := &watchedClamaver{version: "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023"}
+
+	var changes [][2]string
+	w := NewVersionWatcher(c, 0, func(from, to string) {
+		changes = append(changes, [2]string{from, to})
+	})
+	defer w.Close()
+
+	// Never refreshed
+	assert.Nil(t, w.Version())
+
+	// First refresh
+	require.NoError(t, w.Refresh(context.Background()))
+	assert.Equal(t, &Version{
+		Engine:       "1.0.1",
+		Database:     26961,
+		DatabaseTime: time.Date(2023, 7, 6, 7, 29, 38, 0, time.UTC),
+	}, w.Version())
+	assert.Empty(t, changes)
+
+	// Unchanged
+	require.NoError(t, w.Refresh(context.Background()))
+	assert.Empty(t, changes)
+
+	// Failing refreshes keep the previous version
+	c.set("", errors.New("connection refused"))
+	assert.Error(t, w.Refresh(context.Background()))
+	c.set("foobar", nil)
+	assert.ErrorIs(t, w.Refresh(context.Background()), ErrParsingVersion)
+	assert.Equal(t, 26961, w.Version().Database)
+	assert.Empty(t, changes)
+
+	// Only the engine was updated
+	c.set("ClamAV 1.0.2/26961/Thu Jul  6 07:29:38 2023", nil)
+	require.NoError(t, w.Refresh(context.Background()))
+	assert.Equal(t, "1.0.2", w.Version().Engine)
+	assert.Empty(t, changes)
+
+	// The signature database was updated
+	c.set("ClamAV 1.0.1/26962/Fri Jul  7 07:29:38 2023", nil)
+	require.NoError(t, w.Refresh(context.Background()))
+	assert.Equal(t, 26962, w.Version().Database)
+	assert.Equal(t, [][2]string{{
+		"ClamAV 1.0.2/26961/Thu Jul  6 07:29:38 2023",
+		"ClamAV 1.0.1/26962/Fri Jul  7 07:29:38 2023",
+	}}, changes)
+}
+
+func TestVersionWatcherRefreshLoop(t *testing.T) {
+	c := &watchedClamaver{version: "ClamAV 1.0.1/26961/Thu Jul  6 07:29:38 2023"}
+
+	changed := make(chan string, 1)
+	w := NewVersionWatcher(c, 10*time.Millisecond, func(from, to string) {
+		changed <- to
+	})
+	defer w.Close()
+
+	assert.Eventually(t, func() bool { return w.Version() != nil }, 5*time.Second, 10*time.Millisecond)
+
+	c.set("ClamAV 1.0.1/26962/Fri Jul  7 07:29:38 2023", nil)
+	select {
+	case to := <-changed:
+		assert.Equal(t, "ClamAV 1.0.1/26962/Fri Jul  7 07:29:38 2023", to)
+	case <-time.After(5 * time.Second):
+		t.Fatal("version change not detected")
+	}
+
+	assert.NoError(t, w.Close())
+	assert.NoError(t, w.Close())
+}
@@ -0,0 +1,318 @@
+// Package client implements a client for the REST API of clamav-api-go.
+//
+// Each method of Client calls one endpoint of the API and decodes its json
+// response. Error responses are returned as *Error.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RequestIDHeader is the header carrying the id of a request.
+const RequestIDHeader = "X-Request-ID"
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	// Token sent to the admin endpoints, if any
+	adminToken string
+}
+
+// New returns a Client sending requests to the server at baseURL,
+// eg. "http://127.0.0.1:8080", with httpClient.
+// http.DefaultClient is used if httpClient is nil.
+func New(baseURL string, httpClient *http.Client) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base url: unsupported scheme %q", u.Scheme)
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}, nil
+}
+
+// WithAdminToken returns a copy of c sending token as a bearer token
+// to the /admin endpoints, when the server requires one.
+func (c *Client) WithAdminToken(token string) *Client {
+	cc := *c
+	cc.adminToken = token
+	return &cc
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying id. The requests sent with
+// the returned context have their X-Request-ID header set to id.
+//
+// The server reuses id as the id of the request when it is a valid xid,
+// eg. "cimuf5d3d0kc73ahh5h0", and generates a new one otherwise.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func (c *Client) Ping(ctx context.Context) (*PingResponse, error) {
+	return get[PingResponse](ctx, c, "/rest/v1/ping")
+}
+
+func (c *Client) Version(ctx context.Context) (*VersionResponse, error) {
+	return get[VersionResponse](ctx, c, "/rest/v1/version")
+}
+
+func (c *Client) VersionCommands(ctx context.Context) (*VersionCommandsResponse, error) {
+	return get[VersionCommandsResponse](ctx, c, "/rest/v1/versioncommands")
+}
+
+// Stats calls the /v1/stats endpoint.
+//
+// Deprecated: use StatsV2 instead.
+func (c *Client) Stats(ctx context.Context) (*StatsResponse, error) {
+	return get[StatsResponse](ctx, c, "/rest/v1/stats")
+}
+
+func (c *Client) StatsV2(ctx context.Context) (*StatsV2Response, error) {
+	return get[StatsV2Response](ctx, c, "/rest/v2/stats")
+}
+
+func (c *Client) DetStats(ctx context.Context) (*DetStatsResponse, error) {
+	return get[DetStatsResponse](ctx, c, "/rest/v1/detstats")
+}
+
+func (c *Client) DetStatsClear(ctx context.Context) (*DetStatsClearResponse, error) {
+	return post[DetStatsClearResponse](ctx, c, "/rest/v1/detstats/clear", "", nil)
+}
+
+func (c *Client) Reload(ctx context.Context) (*ReloadResponse, error) {
+	return post[ReloadResponse](ctx, c, "/rest/v1/reload", "", nil)
+}
+
+func (c *Client) Shutdown(ctx context.Context) (*ShutdownResponse, error) {
+	return post[ShutdownResponse](ctx, c, "/rest/v1/shutdown", "", nil)
+}
+
+func (c *Client) BreakerStatus(ctx context.Context) (*BreakerResponse, error) {
+	return get[BreakerResponse](ctx, c, "/rest/v1/admin/breaker")
+}
+
+func (c *Client) Capabilities(ctx context.Context) (*CapabilitiesResponse, error) {
+	return get[CapabilitiesResponse](ctx, c, "/rest/v1/admin/capabilities")
+}
+
+// InStream uploads req.File to the /scan endpoint.
+//
+// The file is streamed to the server as a multipart form
+// without being buffered in memory.
+// Finding a virus isn't an error: see InStreamResponse.VirusFound.
+func (c *Client) InStream(ctx context.Context, req *InStreamRequest) (*InStreamResponse, error) {
+	path := "/rest/v1/scan"
+	if req.AllMatch {
+		path += "?allmatch=true"
+	} else if req.Expand {
+		path += "?expand=true"
+	}
+
+	body, contentType := multipartBody([]FormFile{{Field: "file", FileName: req.FileName, File: req.File}})
+	defer body.Close()
+
+	return post[InStreamResponse](ctx, c, path, contentType, body)
+}
+
+// ScanFiles uploads files to the /scan/files endpoint, which scans each of them.
+//
+// The files are streamed to the server as a multipart form
+// without being buffered in memory.
+// Finding a virus isn't an error: see ScanFilesResponse.VirusFound.
+func (c *Client) ScanFiles(ctx context.Context, files []FormFile) (*ScanFilesResponse, error) {
+	body, contentType := multipartBody(files)
+	defer body.Close()
+
+	return post[ScanFilesResponse](ctx, c, "/rest/v1/scan/files", contentType, body)
+}
+
+// multipartBody returns a reader streaming files as a multipart form, and its content type.
+// It must be closed to release the writing goroutine if it isn't fully read.
+func multipartBody(files []FormFile) (io.ReadCloser, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		var err error
+		for _, f := range files {
+			field, fileName := f.Field, f.FileName
+			if field == "" {
+				field = "file"
+			}
+			if fileName == "" {
+				fileName = field
+			}
+
+			var part io.Writer
+			part, err = mw.CreateFormFile(field, fileName)
+			if err == nil {
+				_, err = io.Copy(part, f.File)
+			}
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	return pr, mw.FormDataContentType()
+}
+
+// SubmitJob uploads r to the /jobs endpoint, which queues a job
+// scanning it and returns without waiting for the scan.
+// The job can then be polled with Job.
+func (c *Client) SubmitJob(ctx context.Context, fileName string, r io.Reader) (*JobResponse, error) {
+	body, contentType := multipartBody([]FormFile{{Field: "file", FileName: fileName, File: r}})
+	defer body.Close()
+
+	return post[JobResponse](ctx, c, "/rest/v1/jobs", contentType, body)
+}
+
+func (c *Client) Job(ctx context.Context, id string) (*JobResponse, error) {
+	return get[JobResponse](ctx, c, "/rest/v1/jobs/"+url.PathEscape(id))
+}
+
+// InStreamRaw streams r to the /scan/stream endpoint, which
+// forwards it to Clamd while it is being received.
+// Finding a virus isn't an error: see InStreamResponse.VirusFound.
+func (c *Client) InStreamRaw(ctx context.Context, r io.Reader) (*InStreamResponse, error) {
+	return do[InStreamResponse](ctx, c, http.MethodPut, "/rest/v1/scan/stream", "application/octet-stream", r)
+}
+
+// ScanURL asks the server to download req.URL and scan its content.
+// Finding a virus isn't an error: see ScanURLResponse.VirusFound.
+func (c *Client) ScanURL(ctx context.Context, req *ScanURLRequest) (*ScanURLResponse, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return post[ScanURLResponse](ctx, c, "/rest/v1/scan/url", "application/json", bytes.NewReader(b))
+}
+
+func (c *Client) ScanPath(ctx context.Context, req *ScanPathRequest) (*ScanPathResponse, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return post[ScanPathResponse](ctx, c, "/rest/v1/scan/path", "application/json", bytes.NewReader(b))
+}
+
+// LookupHash returns the last verdict of the scan of the content of the given
+// hex-encoded SHA-256. The server responds with a 404 when it was never scanned.
+func (c *Client) LookupHash(ctx context.Context, sha256 string) (*HashLookupResponse, error) {
+	return get[HashLookupResponse](ctx, c, "/rest/v1/scan/"+url.PathEscape(sha256))
+}
+
+// ListQuarantine returns the infected files kept in the quarantine of the server,
+// most recent first.
+func (c *Client) ListQuarantine(ctx context.Context) (*QuarantineListResponse, error) {
+	return get[QuarantineListResponse](ctx, c, "/rest/v1/admin/quarantine")
+}
+
+// DownloadQuarantine returns the quarantined item with the given id as a zip
+// archive protected by the password of the quarantine of the server, which
+// contains the infected file and its metadata. It must be closed.
+func (c *Client) DownloadQuarantine(ctx context.Context, id string) (io.ReadCloser, error) {
+	resp, err := send(ctx, c, http.MethodGet, "/rest/v1/admin/quarantine/"+url.PathEscape(id)+"/download", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ReleaseQuarantine returns the original content of the quarantined item
+// with the given id, which the server deletes once it is entirely sent.
+// It must be closed.
+func (c *Client) ReleaseQuarantine(ctx context.Context, id string) (io.ReadCloser, error) {
+	resp, err := send(ctx, c, http.MethodPost, "/rest/v1/admin/quarantine/"+url.PathEscape(id)+"/release", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) DeleteQuarantine(ctx context.Context, id string) (*QuarantineDeleteResponse, error) {
+	return do[QuarantineDeleteResponse](ctx, c, http.MethodDelete, "/rest/v1/admin/quarantine/"+url.PathEscape(id), "", nil)
+}
+
+func get[T any](ctx context.Context, c *Client, path string) (*T, error) {
+	return do[T](ctx, c, http.MethodGet, path, "", nil)
+}
+
+func post[T any](ctx context.Context, c *Client, path string, contentType string, body io.Reader) (*T, error) {
+	return do[T](ctx, c, http.MethodPost, path, contentType, body)
+}
+
+// do sends a request to the server and decodes its json response into a T.
+// Error responses are returned as *Error.
+func do[T any](ctx context.Context, c *Client, method string, path string, contentType string, body io.Reader) (*T, error) {
+	resp, err := send(ctx, c, method, path, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	v := new(T)
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("error while decoding response from %s %s: %w", method, path, err)
+	}
+
+	return v, nil
+}
+
+// send sends a request to the server and returns its response,
+// whose body must be closed. Error responses are returned as *Error.
+func send(ctx context.Context, c *Client, method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok && id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	if c.adminToken != "" && strings.HasPrefix(path, "/rest/v1/admin/") {
+		req.Header.Set("Authorization", "Bearer "+c.adminToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, newError(resp)
+	}
+
+	return resp, nil
+}
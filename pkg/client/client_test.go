@@ -0,0 +1,534 @@
+package client
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lescactus/clamav-api-go/internal/controllers"
+	"github.com/lescactus/clamav-api-go/internal/fetcher"
+	"github.com/lescactus/clamav-api-go/internal/history"
+	"github.com/lescactus/clamav-api-go/internal/jobs"
+	"github.com/lescactus/clamav-api-go/internal/quarantine"
+	"github.com/lescactus/clamav-api-go/pkg/clamd"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamav is a Clamaver replying with canned responses,
+// or failing with err if not nil.
+type fakeClamav struct {
+	err error
+}
+
+func (f *fakeClamav) Ping(ctx context.Context) ([]byte, error) {
+	return []byte("PONG"), f.err
+}
+
+func (f *fakeClamav) Version(ctx context.Context) ([]byte, error) {
+	return []byte("ClamAV 1.0.1/26963/Sat Jul  8 07:27:53 2023"), f.err
+}
+
+func (f *fakeClamav) Reload(ctx context.Context) error {
+	return f.err
+}
+
+func (f *fakeClamav) Stats(ctx context.Context) ([]byte, error) {
+	return []byte(`POOLS: 1
+
+STATE: VALID PRIMARY
+THREADS: live 1  idle 0 max 10 idle-timeout 30
+QUEUE: 0 items
+	STATS 0.000038
+
+MEMSTATS: heap N/A mmap N/A used N/A free N/A releasable N/A pools 1 pools_used 1307.045M pools_total 1307.093M
+END`), f.err
+}
+
+func (f *fakeClamav) VersionCommands(ctx context.Context) ([]byte, error) {
+	return []byte("ClamAV 1.0.1/26963/Sat Jul  8 07:27:53 2023| COMMANDS: SCAN PING VERSION INSTREAM"), f.err
+}
+
+func (f *fakeClamav) Shutdown(ctx context.Context) error {
+	return f.err
+}
+
+func (f *fakeClamav) InStream(ctx context.Context, r io.Reader) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if string(b) == eicar {
+		return []byte("stream: Win.Test.EICAR_HDB-1 FOUND"), clamd.ErrVirusFound
+	}
+	return []byte("stream: OK"), nil
+}
+
+func (f *fakeClamav) ScanPath(ctx context.Context, path string, mode clamd.ScanMode) ([]clamd.ScanResult, error) {
+	return []clamd.ScanResult{{Path: path + "/eicar.txt", Signature: "Win.Test.EICAR_HDB-1"}}, f.err
+}
+
+func (f *fakeClamav) ScanFile(ctx context.Context, file *os.File) ([]byte, error) {
+	return f.InStream(ctx, file)
+}
+
+func (f *fakeClamav) DetStats(ctx context.Context) ([]clamd.DetStat, error) {
+	return []clamd.DetStat{{
+		Time:      time.Unix(1688800073, 0),
+		MD5:       "44d88612fea8a8f36de82e1278abb02f",
+		Size:      68,
+		Signature: "Win.Test.EICAR_HDB-1",
+		FileName:  "eicar.txt",
+	}}, f.err
+}
+
+func (f *fakeClamav) DetStatsClear(ctx context.Context) error {
+	return f.err
+}
+
+// newTestServer returns a server running the handlers of the API with clamav.
+func newTestServer(t *testing.T, clamav clamd.Clamaver) (*httptest.Server, *controllers.Handler) {
+	logger := zerolog.New(io.Discard)
+
+	h := controllers.NewHandler(&logger, clamav)
+	h.ScanPathAllowlist = []string{"/data"}
+
+	// The middlewares of the server
+	c := controllers.NewChain(logger, 10<<20)
+
+	s := httptest.NewServer(controllers.NewRouter(h, c))
+	t.Cleanup(s.Close)
+
+	return s, h
+}
+
+func TestNew(t *testing.T) {
+	c, err := New("http://127.0.0.1:8080/", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8080", c.baseURL)
+	assert.Equal(t, http.DefaultClient, c.httpClient)
+
+	for _, invalid := range []string{"127.0.0.1:8080", "ftp://127.0.0.1", "http://[::1"} {
+		_, err = New(invalid, nil)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestClient(t *testing.T) {
+	s, h := newTestServer(t, &fakeClamav{})
+	ctx := context.Background()
+
+	c, err := New(s.URL, s.Client())
+	require.NoError(t, err)
+
+	ping, err := c.Ping(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &PingResponse{Ping: "PONG"}, ping)
+
+	version, err := c.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "ClamAV 1.0.1/26963/Sat Jul  8 07:27:53 2023", version.Version)
+	assert.Equal(t, "1.0.1", version.Engine)
+	assert.Equal(t, 26963, version.Database)
+	assert.Equal(t, time.Date(2023, time.July, 8, 7, 27, 53, 0, time.UTC), *version.DatabaseDate)
+
+	versionCommands, err := c.VersionCommands(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SCAN", "PING", "VERSION", "INSTREAM"}, versionCommands.Commands)
+
+	stats, err := c.Stats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "VALID PRIMARY", stats.State)
+
+	statsV2, err := c.StatsV2(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, statsV2.Threads.Max)
+	assert.Equal(t, int64(1370586350), *statsV2.Memstats.PoolsTotal)
+	assert.Nil(t, statsV2.Memstats.Heap)
+
+	detStats, err := c.DetStats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []DetStatsDetection{{
+		Time:      time.Unix(1688800073, 0).UTC(),
+		MD5:       "44d88612fea8a8f36de82e1278abb02f",
+		Size:      68,
+		Signature: "Win.Test.EICAR_HDB-1",
+		FileName:  "eicar.txt",
+	}}, detStats.Detections)
+
+	detStatsClear, err := c.DetStatsClear(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &DetStatsClearResponse{Status: "CLEARED"}, detStatsClear)
+
+	reload, err := c.Reload(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &ReloadResponse{Status: "RELOADING"}, reload)
+
+	shutdown, err := c.Shutdown(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &ShutdownResponse{Status: "Shutting down"}, shutdown)
+
+	scanPath, err := c.ScanPath(ctx, &ScanPathRequest{Path: "/data", Mode: "scan"})
+	assert.NoError(t, err)
+	assert.True(t, scanPath.VirusFound)
+	assert.Equal(t, "scan", scanPath.Mode)
+	assert.Equal(t, []ScanPathResult{{Path: "/data/eicar.txt", Signature: "Win.Test.EICAR_HDB-1"}}, scanPath.Results)
+
+	// Admin endpoints
+	_, err = c.BreakerStatus(ctx)
+	var apiErr *Error
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotImplemented, apiErr.StatusCode)
+
+	h.Capabilities = clamd.NewCapabilities()
+	assert.NoError(t, h.Capabilities.Refresh(ctx, h.Clamav))
+
+	capabilities, err := c.Capabilities(ctx)
+	assert.NoError(t, err)
+	assert.True(t, capabilities.Known)
+	assert.Equal(t, []string{"INSTREAM", "PING", "SCAN", "VERSION"}, capabilities.Commands)
+}
+
+func TestClientInStream(t *testing.T) {
+	s, h := newTestServer(t, &fakeClamav{})
+	ctx := context.Background()
+
+	c, err := New(s.URL, s.Client())
+	require.NoError(t, err)
+
+	// The durations of the scans depend on the host
+	foobarDetails := ScanDetails{
+		MIMEType: "text/plain; charset=utf-8",
+		MD5:      "3858f62230ac3c915f300c664312c63f",
+		SHA1:     "8843d7f92416211de9ebb963ff4ce28125932878",
+		SHA256:   "c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2",
+	}
+	eicarDetails := ScanDetails{
+		MIMEType: "text/plain; charset=utf-8",
+		MD5:      "44d88612fea8a8f36de82e1278abb02f",
+		SHA1:     "3395856ce81f2b7382dee72602f798b642f14140",
+		SHA256:   "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f",
+	}
+
+	resp, err := c.InStream(ctx, &InStreamRequest{FileName: "foobar.txt", File: strings.NewReader("foobar")})
+	assert.NoError(t, err)
+	resp.ScanDuration = 0
+	assert.Equal(t, &InStreamResponse{Status: "noerror", Msg: "stream: OK", FileName: "foobar.txt", Size: 6, ScanDetails: foobarDetails}, resp)
+
+	resp, err = c.InStream(ctx, &InStreamRequest{File: strings.NewReader(eicar)})
+	assert.NoError(t, err)
+	assert.True(t, resp.VirusFound)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", resp.Signature)
+
+	resp, err = c.InStreamRaw(ctx, strings.NewReader("foobar"))
+	assert.NoError(t, err)
+	resp.ScanDuration = 0
+	assert.Equal(t, &InStreamResponse{Status: "noerror", Msg: "stream: OK", Size: 6, ScanDetails: foobarDetails}, resp)
+
+	resp, err = c.InStreamRaw(ctx, strings.NewReader(eicar))
+	assert.NoError(t, err)
+	assert.True(t, resp.VirusFound)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", resp.Signature)
+
+	files, err := c.ScanFiles(ctx, []FormFile{
+		{FileName: "foobar.txt", File: strings.NewReader("foobar")},
+		{Field: "attachment", FileName: "eicar.txt", File: strings.NewReader(eicar)},
+	})
+	assert.NoError(t, err)
+	assert.True(t, files.VirusFound)
+	for i := range files.Files {
+		files.Files[i].ScanDuration = 0
+	}
+	assert.Equal(t, []ScanFileResult{
+		{Field: "file", FileName: "foobar.txt", Size: 6, Verdict: "clean", ScanDetails: foobarDetails},
+		{Field: "attachment", FileName: "eicar.txt", Size: 68, Verdict: "infected", Signature: "Win.Test.EICAR_HDB-1", ScanDetails: eicarDetails},
+	}, files.Files)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, eicar)
+	}))
+	defer upstream.Close()
+
+	// Scanning urls isn't enabled
+	_, err = c.ScanURL(ctx, &ScanURLRequest{URL: upstream.URL + "/eicar.txt"})
+	var apiErr *Error
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotImplemented, apiErr.StatusCode)
+
+	h.Fetcher = fetcher.New(fetcher.Options{AllowedSchemes: []string{"http"}, AllowPrivate: true})
+
+	scanURL, err := c.ScanURL(ctx, &ScanURLRequest{URL: upstream.URL + "/eicar.txt"})
+	assert.NoError(t, err)
+	scanURL.ScanDuration = 0
+	assert.Equal(t, &ScanURLResponse{
+		Status:      "error",
+		Msg:         "file contains potential virus",
+		Signature:   "Win.Test.EICAR_HDB-1",
+		VirusFound:  true,
+		URL:         upstream.URL + "/eicar.txt",
+		ContentType: "text/plain",
+		FileName:    "eicar.txt",
+		Size:        68,
+		ScanDetails: eicarDetails,
+	}, scanURL)
+
+	// The spool directory isn't configured
+	_, err = c.InStream(ctx, &InStreamRequest{File: strings.NewReader(eicar), AllMatch: true})
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotImplemented, apiErr.StatusCode)
+
+	// The archive expansion isn't configured
+	_, err = c.InStream(ctx, &InStreamRequest{File: strings.NewReader(eicar), Expand: true})
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotImplemented, apiErr.StatusCode)
+
+	// Reading the file fails
+	_, err = c.InStream(ctx, &InStreamRequest{File: iotestErrReader{}})
+	assert.Error(t, err)
+}
+
+func TestClientJobs(t *testing.T) {
+	s, h := newTestServer(t, &fakeClamav{})
+	ctx := context.Background()
+
+	c, err := New(s.URL, s.Client())
+	require.NoError(t, err)
+
+	// The jobs aren't enabled
+	_, err = c.SubmitJob(ctx, "eicar.txt", strings.NewReader(eicar))
+	var apiErr *Error
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotImplemented, apiErr.StatusCode)
+
+	manager, err := jobs.NewManager(jobs.NewMemoryStore(), h.Clamav, jobs.Options{Workers: 1, QueueSize: 1, TTL: time.Hour, UploadDir: t.TempDir()}, nil)
+	require.NoError(t, err)
+	require.NoError(t, manager.Start())
+	defer manager.Close()
+	h.Jobs = manager
+
+	job, err := c.SubmitJob(ctx, "eicar.txt", strings.NewReader(eicar))
+	require.NoError(t, err)
+	assert.Equal(t, "eicar.txt", job.FileName)
+	assert.Equal(t, int64(68), job.Size)
+
+	require.Eventually(t, func() bool {
+		job, err = c.Job(ctx, job.ID)
+		require.NoError(t, err)
+		return job.Finished()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, "done", job.Status)
+	assert.Equal(t, &JobResult{Signature: "Win.Test.EICAR_HDB-1", VirusFound: true}, job.Result)
+
+	_, err = c.Job(ctx, "foobar")
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
+
+func TestClientLookupHash(t *testing.T) {
+	s, h := newTestServer(t, &fakeClamav{})
+	ctx := context.Background()
+
+	c, err := New(s.URL, s.Client())
+	require.NoError(t, err)
+
+	const eicarSHA256 = "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"
+
+	// The history isn't enabled
+	_, err = c.LookupHash(ctx, eicarSHA256)
+	var apiErr *Error
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotImplemented, apiErr.StatusCode)
+
+	h.History = history.NewMemoryStore(0)
+
+	_, err = c.LookupHash(ctx, eicarSHA256)
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+
+	_, err = c.InStream(ctx, &InStreamRequest{File: strings.NewReader(eicar)})
+	require.NoError(t, err)
+
+	resp, err := c.LookupHash(ctx, eicarSHA256)
+	require.NoError(t, err)
+	assert.Equal(t, eicarSHA256, resp.SHA256)
+	assert.Equal(t, "infected", resp.Verdict)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", resp.Signature)
+	assert.True(t, resp.VirusFound)
+	assert.False(t, resp.ScannedAt.IsZero())
+}
+
+func TestClientQuarantine(t *testing.T) {
+	s, h := newTestServer(t, &fakeClamav{})
+	ctx := context.Background()
+
+	c, err := New(s.URL, s.Client())
+	require.NoError(t, err)
+
+	// The quarantine isn't enabled
+	_, err = c.ListQuarantine(ctx)
+	var apiErr *Error
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotImplemented, apiErr.StatusCode)
+
+	backend, err := quarantine.NewDirBackend(t.TempDir())
+	require.NoError(t, err)
+	h.Quarantine, err = quarantine.New(backend, quarantine.Options{
+		Key:         bytes.Repeat([]byte{0x42}, 32),
+		ZipPassword: "infected",
+		SpoolDir:    t.TempDir(),
+	}, nil)
+	require.NoError(t, err)
+	defer h.Quarantine.Close()
+
+	// The admin endpoints require the admin token
+	h.AdminToken = "foobar"
+	_, err = c.ListQuarantine(ctx)
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	c = c.WithAdminToken("foobar")
+
+	resp, err := c.InStream(ctx, &InStreamRequest{FileName: "eicar.txt", File: strings.NewReader(eicar)})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.QuarantineID)
+
+	list, err := c.ListQuarantine(ctx)
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	assert.Equal(t, resp.QuarantineID, list.Items[0].ID)
+	assert.Equal(t, "eicar.txt", list.Items[0].FileName)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", list.Items[0].Signature)
+	assert.Equal(t, "127.0.0.1", list.Items[0].ClientIP)
+	assert.Nil(t, list.Items[0].ExpiresAt)
+
+	rc, err := c.DownloadQuarantine(ctx, resp.QuarantineID)
+	require.NoError(t, err)
+	b, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+	assert.Len(t, zr.File, 2)
+
+	rc, err = c.ReleaseQuarantine(ctx, resp.QuarantineID)
+	require.NoError(t, err)
+	b, err = io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, eicar, string(b))
+
+	_, err = c.ReleaseQuarantine(ctx, resp.QuarantineID)
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+
+	resp, err = c.InStream(ctx, &InStreamRequest{File: strings.NewReader(eicar)})
+	require.NoError(t, err)
+
+	deleted, err := c.DeleteQuarantine(ctx, resp.QuarantineID)
+	require.NoError(t, err)
+	assert.Equal(t, "DELETED", deleted.Status)
+
+	_, err = c.DeleteQuarantine(ctx, resp.QuarantineID)
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
+
+func TestClientErrors(t *testing.T) {
+	s, _ := newTestServer(t, &fakeClamav{err: clamd.ErrUnknownCommand})
+
+	c, err := New(s.URL, s.Client())
+	require.NoError(t, err)
+
+	_, err = c.Ping(context.Background())
+
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+	assert.Equal(t, "error", apiErr.Status)
+	assert.Equal(t, "unknown command sent to clamav", apiErr.Msg)
+	assert.NotEmpty(t, apiErr.RequestID)
+	assert.Equal(t, "clamav-api: 500 Internal Server Error: unknown command sent to clamav", apiErr.Error())
+
+	// Circuit breaker open
+	breaker := clamd.NewCircuitBreaker(1, time.Minute, nil)
+	s, _ = newTestServer(t, clamd.NewClamavResilientClient(&fakeClamav{err: &netError{}}, clamd.RetryPolicy{MaxAttempts: 1}, breaker))
+
+	c, err = New(s.URL, s.Client())
+	require.NoError(t, err)
+
+	_, err = c.Ping(context.Background())
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+
+	_, err = c.Ping(context.Background())
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	assert.Equal(t, time.Minute, apiErr.RetryAfter)
+
+	// Unknown route with a non json body
+	_, err = do[PingResponse](context.Background(), c, http.MethodGet, "/foobar", "", nil)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.Equal(t, "404 page not found", apiErr.Msg)
+
+	// Server unreachable
+	s.Close()
+
+	_, err = c.Ping(context.Background())
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &apiErr))
+}
+
+func TestClientRequestID(t *testing.T) {
+	s, _ := newTestServer(t, &fakeClamav{err: clamd.ErrUnknownCommand})
+
+	c, err := New(s.URL, s.Client())
+	require.NoError(t, err)
+
+	// The id of the request is the one given
+	_, err = c.Ping(WithRequestID(context.Background(), "cimuf5d3d0kc73ahh5h0"))
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "cimuf5d3d0kc73ahh5h0", apiErr.RequestID)
+
+	// An invalid id is replaced
+	_, err = c.Ping(WithRequestID(context.Background(), "foo"))
+	require.ErrorAs(t, err, &apiErr)
+	assert.Len(t, apiErr.RequestID, 20)
+
+	// An id is generated when none is given
+	_, err = c.Ping(context.Background())
+	require.ErrorAs(t, err, &apiErr)
+	assert.Len(t, apiErr.RequestID, 20)
+	assert.NotEqual(t, "cimuf5d3d0kc73ahh5h0", apiErr.RequestID)
+}
+
+// iotestErrReader is an io.Reader always failing.
+type iotestErrReader struct{}
+
+func (iotestErrReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+// netError is a net.Error.
+type netError struct{}
+
+func (*netError) Error() string   { return "connection refused" }
+func (*netError) Timeout() bool   { return false }
+func (*netError) Temporary() bool { return false }
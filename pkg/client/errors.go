@@ -0,0 +1,63 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBodySize is the maximum size of an error response read by the client.
+const maxErrorBodySize = 64 * 1024
+
+// Error is returned when the server replies with an error status code.
+// It is decoded from the json body of the response:
+//
+//	{"status":"error","msg":"something wrong happened while communicating with clamav"}
+type Error struct {
+	// HTTP status code of the response
+	StatusCode int `json:"-"`
+
+	Status string `json:"status"`
+	Msg    string `json:"msg"`
+
+	// Request id assigned by the server, from the X-Request-ID header
+	RequestID string `json:"-"`
+
+	// Delay after which the request can be retried, from the Retry-After header.
+	// It is zero if the header is missing
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("clamav-api: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Msg)
+}
+
+// newError builds an Error from the response of the server.
+func newError(resp *http.Response) *Error {
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get(RequestIDHeader),
+	}
+
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+		e.RetryAfter = time.Duration(s) * time.Second
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+
+	// The body may not be json, eg. when the request is rejected
+	// by a proxy or when a route doesn't exist
+	if err := json.Unmarshal(body, e); err != nil || e.Msg == "" {
+		e.Status = "error"
+		e.Msg = strings.TrimSpace(string(body))
+		if e.Msg == "" {
+			e.Msg = http.StatusText(resp.StatusCode)
+		}
+	}
+
+	return e
+}
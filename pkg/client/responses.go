@@ -0,0 +1,399 @@
+package client
+
+import (
+	"io"
+	"time"
+)
+
+// PingResponse represents the json response of the /ping endpoint.
+type PingResponse struct {
+	Ping string `json:"ping"`
+}
+
+// VersionResponse represents the json response of the /version endpoint.
+type VersionResponse struct {
+	Version string `json:"clamav_version"`
+	VersionInfo
+}
+
+// VersionInfo represents the fields parsed from the Clamav version.
+// They are empty when the server can't parse the version.
+type VersionInfo struct {
+	Engine             string     `json:"engine_version,omitempty"`
+	Database           int        `json:"database_version,omitempty"`
+	DatabaseDate       *time.Time `json:"database_date,omitempty"`
+	DatabaseAgeSeconds *int64     `json:"database_age_seconds,omitempty"`
+}
+
+// VersionCommandsResponse represents the json response of the /versioncommands endpoint.
+type VersionCommandsResponse struct {
+	Version string `json:"clamav_version"`
+	VersionInfo
+	Commands []string `json:"commands"`
+}
+
+// StatsResponse represents the json response of the /v1/stats endpoint.
+//
+// Deprecated: use StatsV2Response instead.
+type StatsResponse struct {
+	Pools    int    `json:"pools"`
+	State    string `json:"state"`
+	Threads  string `json:"threads"`
+	Queue    string `json:"queue"`
+	Memstats string `json:"memstats"`
+}
+
+// StatsV2Response represents the json response of the /v2/stats endpoint.
+type StatsV2Response struct {
+	Pools    int             `json:"pools"`
+	State    string          `json:"state"`
+	Threads  StatsV2Threads  `json:"threads"`
+	Queue    StatsV2Queue    `json:"queue"`
+	Memstats StatsV2Memstats `json:"memstats"`
+}
+
+// StatsV2Threads represents the state of the Clamd threads pool.
+type StatsV2Threads struct {
+	Live        int `json:"live"`
+	Idle        int `json:"idle"`
+	Max         int `json:"max"`
+	IdleTimeout int `json:"idle_timeout"`
+}
+
+// StatsV2Queue represents the queue of Clamd.
+type StatsV2Queue struct {
+	Length int                `json:"length"`
+	Items  []StatsV2QueueItem `json:"items"`
+}
+
+// StatsV2QueueItem represents a command queued in Clamd.
+type StatsV2QueueItem struct {
+	Command    string  `json:"command"`
+	AgeSeconds float64 `json:"age_seconds"`
+	File       string  `json:"file,omitempty"`
+}
+
+// StatsV2Memstats represents the memory usage of Clamd, in bytes.
+// Fields are nil when not available.
+type StatsV2Memstats struct {
+	Heap       *int64 `json:"heap"`
+	Mmap       *int64 `json:"mmap"`
+	Used       *int64 `json:"used"`
+	Free       *int64 `json:"free"`
+	Releasable *int64 `json:"releasable"`
+	Pools      int    `json:"pools"`
+	PoolsUsed  *int64 `json:"pools_used"`
+	PoolsTotal *int64 `json:"pools_total"`
+}
+
+// DetStatsResponse represents the json response of the /detstats endpoint.
+type DetStatsResponse struct {
+	Detections []DetStatsDetection `json:"detections"`
+}
+
+// DetStatsDetection represents a single detection reported by Clamd.
+type DetStatsDetection struct {
+	Time      time.Time `json:"time"`
+	MD5       string    `json:"md5"`
+	Size      int64     `json:"size"`
+	Signature string    `json:"signature"`
+	FileName  string    `json:"filename"`
+	Backend   string    `json:"backend,omitempty"`
+}
+
+// DetStatsClearResponse represents the json response of the /detstats/clear endpoint.
+type DetStatsClearResponse struct {
+	Status string `json:"status"`
+}
+
+// ReloadResponse represents the json response of the /reload endpoint.
+type ReloadResponse struct {
+	Status string `json:"status"`
+}
+
+// ShutdownResponse represents the json response of the /shutdown endpoint.
+type ShutdownResponse struct {
+	Status string `json:"status"`
+}
+
+// InStreamRequest represents a file to scan with the /scan endpoint.
+type InStreamRequest struct {
+	// Name of the uploaded file
+	FileName string
+
+	// Content to scan. It is streamed to the server
+	File io.Reader
+
+	// Report all the matching signatures instead of the first one
+	AllMatch bool
+
+	// Expand the archives to report the verdict of each of their entries.
+	// It can't be combined with AllMatch
+	Expand bool
+}
+
+// InStreamResponse represents the json response of the /scan endpoint.
+type InStreamResponse struct {
+	Status     string         `json:"status"`
+	Msg        string         `json:"msg"`
+	Signature  string         `json:"signature"`
+	Signatures []string       `json:"signatures,omitempty"`
+	VirusFound bool           `json:"virus_found"`
+	Entries    []ArchiveEntry `json:"entries,omitempty"`
+
+	// Whether the verdict was served from the cache of the server
+	Cached bool `json:"cached,omitempty"`
+
+	// Name of the uploaded file, empty for InStreamRaw
+	FileName string `json:"filename,omitempty"`
+	Size     int64  `json:"size"`
+
+	ScanDetails
+}
+
+// ScanDetails represents the details of the scan of a file
+// reported along with its verdict.
+type ScanDetails struct {
+	// MIME type sniffed by the server from the first bytes of the file
+	MIMEType string `json:"mime_type,omitempty"`
+
+	// Hex-encoded hashes of the file, empty if the
+	// server didn't read it until the end
+	MD5    string `json:"md5,omitempty"`
+	SHA1   string `json:"sha1,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Duration of the scan, in milliseconds
+	ScanDuration float64 `json:"scan_duration_ms"`
+
+	// Versions of the Clamav engine and signature database which made the verdict, if known
+	Engine   string `json:"engine_version,omitempty"`
+	Database int    `json:"database_version,omitempty"`
+
+	// Rule of the scan policy of the server which matched the file, if any
+	Policy *PolicyMatch `json:"policy,omitempty"`
+
+	// Id of the item of the quarantine of the server the infected
+	// file was saved as, if the quarantine is enabled
+	QuarantineID string `json:"quarantine_id,omitempty"`
+}
+
+// PolicyMatch represents the rule of the scan policy of the server which matched a file.
+type PolicyMatch struct {
+	Rule string `json:"rule"`
+
+	// Either "allow", the file not being scanned, "deny" or "scan"
+	Action string `json:"action"`
+}
+
+// ArchiveEntry represents the result of the scan of an entry of an archive
+// uploaded with InStreamRequest.Expand, and of its own entries if any.
+type ArchiveEntry struct {
+	Name      string         `json:"name"`
+	Size      int64          `json:"size"`
+	Verdict   string         `json:"verdict"`
+	Signature string         `json:"signature"`
+	Error     string         `json:"error,omitempty"`
+	Entries   []ArchiveEntry `json:"entries,omitempty"`
+}
+
+// FormFile represents a file of the multipart form uploaded to the /scan/files endpoint.
+type FormFile struct {
+	// Name of the form field, "file" if empty
+	Field string
+
+	// Name of the uploaded file, the name of the field if empty
+	FileName string
+
+	// Content to scan. It is streamed to the server
+	File io.Reader
+}
+
+// ScanFilesResponse represents the json response of the /scan/files endpoint.
+type ScanFilesResponse struct {
+	Status     string           `json:"status"`
+	Msg        string           `json:"msg"`
+	Files      []ScanFileResult `json:"files"`
+	VirusFound bool             `json:"virus_found"`
+
+	// Whether a file was denied by the scan policy of the server
+	Denied bool `json:"denied,omitempty"`
+}
+
+// ScanFileResult represents the result of the scan of a single file
+// uploaded to the /scan/files endpoint.
+type ScanFileResult struct {
+	Field    string `json:"field"`
+	FileName string `json:"filename"`
+	Size     int64  `json:"size"`
+
+	// Either "clean", "infected" or "error", or "allowed" or "denied" by
+	// the scan policy of the server. The allowed files aren't scanned
+	Verdict   string `json:"verdict"`
+	Signature string `json:"signature"`
+	Error     string `json:"error,omitempty"`
+
+	ScanDetails
+}
+
+// ScanURLRequest represents the json request of the /scan/url endpoint.
+type ScanURLRequest struct {
+	URL string `json:"url"`
+
+	// Headers sent with the request downloading the url
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// ScanURLResponse represents the json response of the /scan/url endpoint.
+type ScanURLResponse struct {
+	Status     string `json:"status"`
+	Msg        string `json:"msg"`
+	Signature  string `json:"signature"`
+	VirusFound bool   `json:"virus_found"`
+
+	// Url the content was downloaded from, once the redirects followed
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+
+	// Last segment of the path of the url, matched by the scan policy
+	FileName string `json:"filename,omitempty"`
+	Size     int64  `json:"size"`
+
+	ScanDetails
+}
+
+// ScanPathRequest represents the json request of the /scan/path endpoint.
+type ScanPathRequest struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+}
+
+// ScanPathResponse represents the json response of the /scan/path endpoint.
+type ScanPathResponse struct {
+	Status     string           `json:"status"`
+	Msg        string           `json:"msg"`
+	Path       string           `json:"path"`
+	Mode       string           `json:"mode"`
+	Results    []ScanPathResult `json:"results"`
+	Errors     []ScanPathError  `json:"errors,omitempty"`
+	VirusFound bool             `json:"virus_found"`
+}
+
+// ScanPathResult represents a single infected file found by the /scan/path endpoint.
+type ScanPathResult struct {
+	Path      string `json:"path"`
+	Signature string `json:"signature"`
+}
+
+// ScanPathError represents a file the /scan/path endpoint couldn't scan.
+type ScanPathError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// JobResponse represents the json response of the /jobs endpoints.
+type JobResponse struct {
+	ID string `json:"id"`
+
+	// Either "queued", "running", "done" or "failed"
+	Status    string    `json:"status"`
+	FileName  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Time after which the job is deleted, nil until it is finished
+	ExpiresAt *time.Time `json:"expires_at"`
+
+	// Result of the scan, nil until the job is done
+	Result *JobResult `json:"result"`
+
+	// Reason of the failure of the job
+	Error string `json:"error,omitempty"`
+}
+
+// JobResult represents the result of the scan of a job.
+type JobResult struct {
+	Signature  string `json:"signature"`
+	VirusFound bool   `json:"virus_found"`
+
+	// Rule of the scan policy which allowed the file without scanning it
+	Policy *PolicyMatch `json:"policy,omitempty"`
+
+	// Id of the quarantined file, if infected
+	QuarantineID string `json:"quarantine_id,omitempty"`
+}
+
+// Finished returns true if the job is done or failed.
+func (j *JobResponse) Finished() bool {
+	return j.Status == "done" || j.Status == "failed"
+}
+
+// HashLookupResponse represents the json response of the /scan/{sha256} endpoint.
+type HashLookupResponse struct {
+	SHA256 string `json:"sha256"`
+
+	// Either "clean" or "infected"
+	Verdict    string `json:"verdict"`
+	Signature  string `json:"signature"`
+	VirusFound bool   `json:"virus_found"`
+
+	// Versions of the Clamav engine and signature database
+	// which made the verdict, empty if unknown
+	Engine   string `json:"engine_version"`
+	Database int    `json:"database_version"`
+
+	ScannedAt time.Time `json:"scanned_at"`
+}
+
+// BreakerResponse represents the json response of the /admin/breaker endpoint.
+type BreakerResponse struct {
+	State             string     `json:"state"`
+	Failures          int        `json:"failures"`
+	OpenedAt          *time.Time `json:"opened_at"`
+	RetryAfterSeconds int        `json:"retry_after_seconds"`
+}
+
+// CapabilitiesResponse represents the json response of the /admin/capabilities endpoint.
+type CapabilitiesResponse struct {
+	Known       bool       `json:"known"`
+	Version     string     `json:"clamav_version"`
+	Commands    []string   `json:"commands"`
+	RefreshedAt *time.Time `json:"refreshed_at"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// QuarantineListResponse represents the json response of the /admin/quarantine endpoint.
+type QuarantineListResponse struct {
+	Items []QuarantinedItem `json:"items"`
+}
+
+// QuarantinedItem represents an infected file kept in the quarantine of the server.
+type QuarantinedItem struct {
+	ID       string `json:"id"`
+	FileName string `json:"filename,omitempty"`
+	Size     int64  `json:"size"`
+	MIMEType string `json:"mime_type,omitempty"`
+
+	// Hex-encoded hashes of the file
+	MD5    string `json:"md5"`
+	SHA1   string `json:"sha1"`
+	SHA256 string `json:"sha256"`
+
+	Signature string `json:"signature"`
+
+	// Id of the request which uploaded the file, and address of its client
+	RequestID string `json:"request_id"`
+	ClientIP  string `json:"client_ip"`
+
+	QuarantinedAt time.Time `json:"quarantined_at"`
+
+	// Time the item is deleted at, nil if the server keeps the items forever
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// QuarantineDeleteResponse represents the json response of the
+// DELETE /admin/quarantine/{id} endpoint.
+type QuarantineDeleteResponse struct {
+	Status string `json:"status"`
+}